@@ -0,0 +1,203 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+/* the per-packet hot path (state lookup, decoding a captured frame,
+ * constructing a reply), each next to a Legacy benchmark of the way
+ * it was done before: string keys, gopacket.Packets and fresh
+ * buffers. run with -benchmem, the gap in allocs/op is what the
+ * current path saves per packet.
+ */
+
+// the state map shard as it was, keyed by "saddr:sport"
+type legacy_shard struct {
+	items		map[string]*packet_state
+	sync.RWMutex
+}
+
+func legacyFNV32( key string ) uint32 {
+	hash := uint32(2166136261)
+	const prime32 = uint32(16777619)
+	for i := 0; i < len(key); i++ {
+		hash *= prime32
+		hash ^= uint32(key[i])
+	}
+	return hash
+}
+
+// an ethernet link with made up addresses, whatever the flags say
+func benchLink( b *testing.B ) {
+
+	savedLink, savedVLANs, savedSrc, savedDst := linkType, vlanIDs, source_mac, dest_mac
+	linkType, vlanIDs = LINK_ETHERNET, nil
+	source_mac, dest_mac = "02:00:00:00:00:01", "02:00:00:00:00:02"
+	resetLinkHeader()
+	b.Cleanup( func() {
+		linkType, vlanIDs, source_mac, dest_mac = savedLink, savedVLANs, savedSrc, savedDst
+		resetLinkHeader()
+	} )
+}
+
+// a SYN-ACK from its target, as it would be decoded
+func benchPacket() *packet_metadata {
+	p := &packet_metadata{
+		Daddr: "198.51.100.1",
+		Sport: 443,
+		Dport: 40000,
+		Seqnum: 1000,
+		Acknum: 2000,
+		Window: 65535,
+		SYN: true,
+		ACK: true,
+	}
+	p.setTarget( "192.0.2.10" )
+	p.daddr = p.localAddr()
+	return p
+}
+
+func legacyFrame( b *testing.B, p *packet_metadata, src string, dst string, sport int, dport int, syn bool, ack bool ) []byte {
+
+	ip := &layers.IPv4{
+		SrcIP: net.ParseIP( src ),
+		DstIP: net.ParseIP( dst ),
+		TTL: 64,
+		Protocol: layers.IPProtocolTCP,
+		Version: 4,
+	}
+	tcp := &layers.TCP{
+		SrcPort: layers.TCPPort( sport ),
+		DstPort: layers.TCPPort( dport ),
+		Seq: uint32( p.Seqnum ),
+		Ack: uint32( p.Acknum ),
+		Window: uint16( p.Window ),
+		SYN: syn,
+		ACK: ack,
+	}
+	tcp.SetNetworkLayerForChecksum( ip )
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers( buffer, serializeOptions,
+		append( constructLinkLayers(), ip, tcp )...); err != nil {
+		b.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// the SYN-ACK from p's target, as it would be captured
+func benchFrame( b *testing.B, p *packet_metadata ) []byte {
+	return legacyFrame( b, p, p.Saddr, p.Daddr, p.Sport, p.Dport, true, true )
+}
+
+func BenchmarkStateLookupLegacy( b *testing.B ) {
+
+	p := benchPacket()
+	shards := make( []legacy_shard, SHARD_COUNT )
+	for i := range shards {
+		shards[i].items = make( map[string]*packet_state )
+	}
+	key := p.Saddr + ":" + strconv.Itoa(p.Sport)
+	shards[ legacyFNV32(key) % uint32(SHARD_COUNT) ].items[key] = &packet_state{ Flow: flowRecordOf(p) }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := p.Saddr + ":" + strconv.Itoa(p.Sport)
+		shard := &shards[ legacyFNV32(key) % uint32(SHARD_COUNT) ]
+		shard.RLock()
+		_, ok := shard.items[key]
+		shard.RUnlock()
+		if !ok {
+			b.Fatal("missing")
+		}
+	}
+}
+
+func BenchmarkStateLookup( b *testing.B ) {
+
+	p := benchPacket()
+	ipMeta := NewpState()
+	ipMeta.Insert( constructKey(p), &packet_state{ Flow: flowRecordOf(p) } )
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := ipMeta.Get( constructKey(p) ); !ok {
+			b.Fatal("missing")
+		}
+	}
+}
+
+func BenchmarkDecodeFrameLegacy( b *testing.B ) {
+
+	benchLink( b )
+	frame := benchFrame( b, benchPacket() )
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packet := gopacket.NewPacket( frame, firstLayerType(), gopacket.Default )
+		tcp, _ := packet.Layer( layers.LayerTypeTCP ).(*layers.TCP)
+		ip, _ := packet.Layer( layers.LayerTypeIPv4 ).(*layers.IPv4)
+		eth, _ := packet.Layer( layers.LayerTypeEthernet ).(*layers.Ethernet)
+		if eth == nil {
+			eth = &layers.Ethernet{}
+		}
+		ReadLayers( ip, tcp, eth )
+	}
+}
+
+func BenchmarkDecodeFrame( b *testing.B ) {
+
+	benchLink( b )
+	frame := benchFrame( b, benchPacket() )
+	decoder := newFrameDecoder()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if decoder.decode( frame, time.Time{} ) == nil {
+			b.Fatal("not decoded")
+		}
+	}
+}
+
+func BenchmarkConstructSYNLegacy( b *testing.B ) {
+
+	benchLink( b )
+	p := benchPacket()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		legacyFrame( b, p, p.Daddr, p.Saddr, p.Dport, p.Sport, true, false )
+	}
+}
+
+func BenchmarkConstructSYN( b *testing.B ) {
+
+	benchLink( b )
+	p := benchPacket()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		constructSYN( p ).release()
+	}
+}
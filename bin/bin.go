@@ -37,7 +37,7 @@ func LZRMain() {
 
 	//initalize
 	ipMeta := lzr.ConstructPacketStateMap( options )
-    f := lzr.InitFile( options.Filename )
+    f := lzr.InitFile( options )
 	lzr.InitParams()
 
     writingQueue := lzr.ConstructWritingQueue( options.Workers )
@@ -108,6 +108,8 @@ func LZRMain() {
 					toPUSH := false
 					lzr.SendAck( options, input, &ipMeta, timeoutQueue,
 						retransmitQueue, writingQueue, toACK, toPUSH, lzr.ACK)
+				} else if lzr.UDPMode() {
+					lzr.SendUDP( options, input, &ipMeta, timeoutQueue )
 				} else {
 					 lzr.SendSyn( input, &ipMeta, timeoutQueue )
 				}
@@ -179,7 +181,7 @@ func LZRMain() {
 					f.Close()
 				}
 			//closing file
-			f.F.Flush()
+			f.Close()
 			t := time.Now()
 			elapsed := t.Sub(start)
 			lzr.Summarize( elapsed )
@@ -0,0 +1,233 @@
+// +build linux
+
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// frames queued for the sender before WritePacketData blocks
+var AFPACKET_SEND_QUEUE = 65536
+
+// frames written per sendmmsg(2)
+var AFPACKET_SEND_BATCH = 256
+
+/* afpacket_handle reads with one TPACKET_V3 ring per worker, joined
+ * in a fanout group so the kernel spreads flows across them, and
+ * sends through a queue drained in batches by a socket of its own.
+ */
+type afpacket_handle struct {
+	rings		[]*afpacket.TPacket
+	tx			*packet_sender
+	link		layers.LinkType
+	queue		chan *[]byte
+	done		chan struct{}
+}
+
+// AF_PACKET hands out link headers as the device has them
+func deviceLinkType( device string ) layers.LinkType {
+
+	iface, err := net.InterfaceByName( device )
+	if err != nil {
+		return layers.LinkTypeEthernet
+	}
+	if iface.Flags & net.FlagLoopback == 0 && len(iface.HardwareAddr) == 0 {
+		return layers.LinkTypeRaw
+	}
+	return layers.LinkTypeEthernet
+}
+
+func compileBPF( link layers.LinkType, filter string ) ( []bpf.RawInstruction, error ) {
+
+	insns, err := pcap.CompileBPFFilter( link, int(snapshot_len), filter )
+	if err != nil {
+		return nil, err
+	}
+	raw := make( []bpf.RawInstruction, len(insns) )
+	for i, ins := range insns {
+		raw[i] = bpf.RawInstruction{ Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K }
+	}
+	return raw, nil
+}
+
+func newRing( device string, ringMB int, workers int ) ( *afpacket.TPacket, error ) {
+
+	frameSize := 1 << 11
+	blockSize := frameSize * 128
+	numBlocks := ringMB * 1024 * 1024 / blockSize / workers
+	if numBlocks < 1 {
+		numBlocks = 1
+	}
+	return afpacket.NewTPacket(
+		afpacket.OptInterface( device ),
+		afpacket.OptFrameSize( frameSize ),
+		afpacket.OptBlockSize( blockSize ),
+		afpacket.OptNumBlocks( numBlocks ),
+		afpacket.OptPollTimeout( 100 * time.Millisecond ),
+		afpacket.OptTPacketVersion( afpacket.TPacketVersion3 ),
+	)
+}
+
+func openAFPacket( device string, workers int, ringMB int ) ( *afpacket_handle, error ) {
+
+	h := &afpacket_handle{
+		link: deviceLinkType( device ),
+		queue: make( chan *[]byte, AFPACKET_SEND_QUEUE ),
+		done: make( chan struct{} ),
+	}
+	fanoutID := uint16( os.Getpid() & 0xffff )
+	for i := 0; i < workers; i++ {
+		ring, err := newRing( device, ringMB, workers )
+		if err != nil {
+			h.Close()
+			return nil, fmt.Errorf("opening afpacket ring: %v", err)
+		}
+		h.rings = append( h.rings, ring )
+		if workers > 1 {
+			if err := ring.SetFanout( afpacket.FanoutHashWithDefrag, fanoutID ); err != nil {
+				h.Close()
+				return nil, fmt.Errorf("joining afpacket fanout: %v", err)
+			}
+		}
+	}
+	tx, err := openSender( device, h.link == layers.LinkTypeRaw, AFPACKET_SEND_BATCH )
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("opening afpacket sender: %v", err)
+	}
+	h.tx = tx
+	go h.sender()
+	return h, nil
+}
+
+func ( h *afpacket_handle ) LinkType() layers.LinkType {
+	return h.link
+}
+
+func ( h *afpacket_handle ) SetBPFFilter( filter string ) error {
+
+	raw, err := compileBPF( h.link, filter )
+	if err != nil {
+		return err
+	}
+	for _, ring := range h.rings {
+		if err := ring.SetBPF( raw ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queued frames, reused once sent
+var afpacketFrames = sync.Pool{
+	New: func() interface{} {
+		frame := make( []byte, 0, 1600 )
+		return &frame
+	},
+}
+
+// queued as a pooled copy, so the caller may reuse data
+func ( h *afpacket_handle ) WritePacketData( data []byte ) error {
+	frame := afpacketFrames.Get().(*[]byte)
+	*frame = append( (*frame)[:0], data... )
+	h.queue <- frame
+	return nil
+}
+
+func ( h *afpacket_handle ) sender() {
+
+	batch := make( []*[]byte, 0, AFPACKET_SEND_BATCH )
+	for {
+		select {
+		case <-h.done:
+			return
+		case frame := <-h.queue:
+			batch = append( batch[:0], frame )
+			//take whatever else is waiting into the same sendmmsg
+			for len(batch) < AFPACKET_SEND_BATCH {
+				select {
+				case frame = <-h.queue:
+					batch = append( batch, frame )
+					continue
+				default:
+				}
+				break
+			}
+			h.tx.send( batch )
+			for _, frame := range batch {
+				afpacketFrames.Put( frame )
+			}
+		}
+	}
+}
+
+func ( h *afpacket_handle ) Close() {
+
+	select {
+	case <-h.done:
+	default:
+		close( h.done )
+	}
+	for _, ring := range h.rings {
+		ring.Close()
+	}
+	if h.tx != nil {
+		h.tx.Close()
+	}
+}
+
+// one reader per ring, decoding straight into pcapIncoming
+func ( h *afpacket_handle ) startReaders( pcapIncoming chan *packet_metadata ) {
+
+	for _, ring := range h.rings {
+		go func( ring *afpacket.TPacket ) {
+			decoder := newFrameDecoder()
+			for {
+				data, ci, err := ring.ZeroCopyReadPacketData()
+				if err == afpacket.ErrTimeout {
+					continue
+				}
+				if err != nil {
+					select {
+					case <-h.done:
+						return
+					default:
+					}
+					continue
+				}
+				packet := decoder.decode( data, ci.Timestamp )
+				if packet == nil {
+					continue
+				}
+				if dest_mac == "" && packet.Smac != "" {
+					saveHostMacAddr( packet )
+				}
+				pcapIncoming <- packet
+			}
+		}( ring )
+	}
+}
@@ -0,0 +1,36 @@
+// +build !linux
+
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"errors"
+
+	"github.com/google/gopacket/layers"
+)
+
+type afpacket_handle struct{}
+
+func openAFPacket( device string, workers int, ringMB int ) ( *afpacket_handle, error ) {
+	return nil, errors.New("the afpacket backend is only available on linux")
+}
+
+func ( h *afpacket_handle ) LinkType() layers.LinkType { return layers.LinkTypeNull }
+func ( h *afpacket_handle ) SetBPFFilter( filter string ) error { return nil }
+func ( h *afpacket_handle ) WritePacketData( data []byte ) error { return nil }
+func ( h *afpacket_handle ) Close() {}
+func ( h *afpacket_handle ) startReaders( pcapIncoming chan *packet_metadata ) {}
@@ -46,6 +46,34 @@ var (
 	priorityFingerprintArr	[]string
 	handshakeArr			[]string
 	recordOnlyData			*bool
+	outputs					*string
+	compress				*string
+	csvFields				*string
+	rotateSize				*int
+	rotateInterval			*int
+	outputFields			*string
+	printSchema				*bool
+	zgrab2Ini				*string
+	aggregate				*bool
+	fingerprintRulesFile	*string
+	hostBudget				*int
+	hostIdenticalPorts		*int
+	hostSummary				*string
+	hostCacheSize			*int
+	hostCacheTTL			*int
+	udp						*bool
+	sourcePorts				*string
+	linkTypeFlag			*string
+	vlans					*string
+	captureBackend			*string
+	ringSizeMB				*int
+	maxFlows				*int
+	maxMemoryMB				*int
+	overload				*string
+	maxSessions				*int
+	tlsSNI					*string
+	tlsALPN					*string
+	tls13					*bool
 )
 
 type options struct {
@@ -69,6 +97,13 @@ type options struct {
 	Handshakes			[]string
 	PriorityFingerprint	[]string
 	RecordOnlyData		bool
+	Outputs				[]string
+	Compress			string
+	CSVFields			string
+	OutputFields		string
+	RotateSize			int
+	RotateInterval		int
+	HostSummary			string
 }
 
 
@@ -77,14 +112,26 @@ func init() {
   fname := "default_"+string(time.Now().Format("20060102150405"))+".json"
   filename = flag.String("f", fname , "json results output file name, use '-' for standard output")
   sendSYNs = flag.Bool("sendSYNs", false , "will read input from stdin containing a newline-delimited list of ip:port")
-  sourceIP = flag.String("sourceIP", "" , "source IP to send syn packets with (if using sendSYNs flag)")
+  sourceIP = flag.String("sourceIP", "" , "source IPs to send syn packets with (if using sendSYNs flag), comma-separated addresses or CIDRs")
+  captureBackend = flag.String("captureBackend", "pcap" , "how to capture and send packets: pcap, or afpacket (linux TPACKET_V3 rings with fanout across -w workers)")
+  ringSizeMB = flag.Int("ringSize", 64 , "total size in MB of the afpacket receive rings")
+  maxFlows = flag.Int("maxFlows", 0 , "most flows in flight (in state or queued from input) at once, 0 for no limit")
+  maxMemoryMB = flag.Int("maxMemory", 0 , "live heap in MB above which no more input is read, 0 for no limit")
+  overload = flag.String("overload", "block" , "at -maxFlows/-maxMemory: block (stop reading input) or drop (skip and count targets)")
+  maxSessions = flag.Int("maxSessions", 10000 , "most TLS (and other session) handshakes running at once, beyond which a flow moves on as if unanswered, 0 for no limit")
+  tlsSNI = flag.String("tlsSNI", "" , "server name to send in TLS ClientHellos: empty for none, a hostname, or target for the scanned address when it is a hostname")
+  tlsALPN = flag.String("tlsALPN", "" , "comma-separated ALPN protocols to offer in TLS ClientHellos, e.g. h2,http/1.1")
+  tls13 = flag.Bool("tls13", false , "offer TLS 1.3 in ClientHellos (certificates are then encrypted and not reported)")
+  linkTypeFlag = flag.String("linkType", "auto" , "link layer to read and write: auto (from the capture), ethernet, raw, sll or null")
+  vlans = flag.String("vlan", "" , "802.1Q tag(s) to send with and expect, outer,inner for QinQ")
+  sourcePorts = flag.String("sourcePorts", "32768-61000" , "range of source ports to send from, min-max")
   device = flag.String("sendInterface", "ens8" , "network interface to send packets on")
   mac = flag.String("gatewayMac", "" , "gateway Mac Address in format xx:xx:xx:xx:xx:xx")
   debug = flag.Bool("d", false, "debug printing on")
-  haf = flag.Int("haf", 0, "number of random ephemeral probes to send to filter ACKing firewalls")
+  haf = flag.Int("haf", 0, "number of random ephemeral probes to send to classify ACKing firewalls, tarpits and load balancers")
   pushDOnly = flag.Bool("pushDataOnly", false, "Don't attach data to ack but rather to push only")
   forceAllHandshakes = flag.Bool("forceAllHandshakes", false, "Complete all handshakes even if data is returned early on. This also turns off HyperACKtive filtering.")
-  feedZGrab = flag.Bool("feedZGrab", false, "send to zgrab ip and fingerprint")
+  feedZGrab = flag.Bool("feedZGrab", false, "send to zgrab ip and fingerprint (see the zgrab2 output sink for multi-port scans)")
   workers = flag.Int("w", 1 , "number of worker threads for each channel")
   timeout = flag.Int("t", 5, "number of seconds to wait in timeout queue for last retransmission")
   retransmitSec = flag.Int("rt", 1 , "number of seconds until re-transmitting packet")
@@ -94,6 +141,22 @@ func init() {
   handshake = flag.String("handshakes", "http" , "handshakes to scan with")
   priorityFingerprint = flag.String("priorityFingerprint", "" , "fingerprint to prioritize when multiple match")
   recordOnlyData = flag.Bool("onlyDataRecord", false, "record to file only services that send back data")
+  outputs = flag.String("outputs", "", "additional comma-separated output sinks as type:path (json, csv, sqlite, sqlite-summary, zgrab2), e.g. csv:out.csv,sqlite:out.db")
+  compress = flag.String("compress", "", "compression for json file sinks: none, gzip or zstd (default inferred from .gz/.zst extension)")
+  csvFields = flag.String("csvFields", "", "columns to write to csv sinks (default same as outputFields)")
+  rotateSize = flag.Int("rotateSize", 0, "rotate file sinks after this many megabytes (0 to disable)")
+  rotateInterval = flag.Int("rotateInterval", 0, "rotate file sinks after this many seconds (0 to disable)")
+  outputFields = flag.String("outputFields", "*", "comma-separated result fields to output, * for all (see -printSchema)")
+  printSchema = flag.Bool("printSchema", false, "print the JSON Schema of result records and exit")
+  fingerprintRulesFile = flag.String("fingerprintRules", "", "file of fingerprint precedence rules, one \"winner refines|overrides loser\" per line")
+  aggregate = flag.Bool("aggregate", false, "write exactly one record per target listing every handshake attempted (use with -forceAllHandshakes)")
+  zgrab2Ini = flag.String("zgrab2Ini", "", "write the zgrab2 multiple-module config matching zgrab2 sink triggers to this file")
+  hostBudget = flag.Int("hostBudget", 0, "max SYNs to spend on one host for further handshakes and HAF probes, across all its ports (0 for no limit)")
+  hostIdenticalPorts = flag.Int("hostIdenticalPorts", 0, "stop trying further handshakes on a host once this many of its ports returned the same data (0 to disable)")
+  udp = flag.Bool("udp", false, "scan over UDP instead of TCP, reads ip:port targets like -sendSYNs")
+  hostCacheSize = flag.Int("hostCacheSize", 1000000, "most hosts the host cache remembers, least recently used ones are dropped first (0 for no limit)")
+  hostCacheTTL = flag.Int("hostCacheTTL", 0, "seconds a host is remembered after its last port finishes (0 for as long as it fits in -hostCacheSize)")
+  hostSummary = flag.String("hostSummary", "", "write one json record per host (ports, fingerprints, middlebox verdict, budget) to this file")
 }
 
 
@@ -105,7 +168,7 @@ func checkAndParse( handshake *string, optHandshakes *[]string ) ( []string, boo
 
 	if !strings.Contains( *handshake, ",")	{
 
-		_, ok := GetHandshake(*handshake)
+		_, ok := resolveHandshake(*handshake)
 
 		if !ok {
 			fmt.Fprintln(os.Stderr,"--Handshake not found:", *handshake)
@@ -117,7 +180,7 @@ func checkAndParse( handshake *string, optHandshakes *[]string ) ( []string, boo
 		i := 0
 		for _, h := range strings.Split( *handshake, "," ) {
 
-			_, ok := GetHandshake(h)
+			_, ok := resolveHandshake(h)
 			if !ok {
 				fmt.Fprintln(os.Stderr,"--Handshake not found:", h)
 				return nil,false
@@ -135,6 +198,15 @@ func checkAndParse( handshake *string, optHandshakes *[]string ) ( []string, boo
 func Parse() (*options,bool) {
 
 	flag.Parse()
+	if *printSchema {
+		schema, err := ResultSchema()
+		if err != nil {
+			fmt.Fprintln(os.Stderr,"--Failed to build schema:", err)
+			os.Exit(1)
+		}
+		fmt.Println(string(schema))
+		os.Exit(0)
+	}
 	opt := &options{
 		Filename: *filename,
 		SendSYNs: *sendSYNs,
@@ -154,6 +226,15 @@ func Parse() (*options,bool) {
 		Handshakes: make([]string, strings.Count(*handshake,",")+1),
 		PriorityFingerprint: make([]string, strings.Count(*priorityFingerprint,",")+1),
 		RecordOnlyData: *recordOnlyData,
+		Compress: *compress,
+		CSVFields: *csvFields,
+		OutputFields: *outputFields,
+		RotateSize: *rotateSize,
+		RotateInterval: *rotateInterval,
+		HostSummary: *hostSummary,
+	}
+	if *outputs != "" {
+		opt.Outputs = strings.Split(*outputs, ",")
 	}
 
 	success := false
@@ -161,23 +242,88 @@ func Parse() (*options,bool) {
 	if !success {
 		return nil, false
 	}
+	if anyStreamingHandshake( handshakeArr ) {
+		snapshot_len = STREAM_SNAPSHOT_LEN
+	}
 
 	priorityFingerprintArr, success = checkAndParse( priorityFingerprint, &(opt.PriorityFingerprint) )
 	if !success {
 		return nil, false
 	}
 
+	if *fingerprintRulesFile != "" {
+		if err := LoadFingerprintRules( *fingerprintRulesFile ); err != nil {
+			fmt.Fprintln(os.Stderr,"--Failed to load fingerprint rules:", err)
+			return nil, false
+		}
+		fmt.Fprintln(os.Stderr,"++Loaded fingerprint rules from:", *fingerprintRulesFile)
+	}
+
+	if err := initSourcePool( *sourceIP, *sourcePorts ); err != nil {
+		fmt.Fprintln(os.Stderr,"--Bad source addresses:", err)
+		return nil, false
+	}
+
+	if _, err := parseResultFields( *outputFields ); err != nil {
+		fmt.Fprintln(os.Stderr,"--Bad output fields:", err)
+		return nil, false
+	}
+
+	if *haf > MAX_PROBES {
+		fmt.Fprintln(os.Stderr,"--Bad -haf: at most", MAX_PROBES, "probes per target")
+		return nil, false
+	}
+
 	if *forceAllHandshakes {
 		*haf = 0
 	}
+	if *udp {
+		*haf = 0
+	}
 
 	fmt.Fprintln(os.Stderr,"++Writing results to file:", *filename)
 	fmt.Fprintln(os.Stderr,"++Handshakes:", *handshake)
 	if *sendSYNs {
 		fmt.Fprintln(os.Stderr,"++Sending SYNs")
 	}
+	if *udp {
+		fmt.Fprintln(os.Stderr,"++Scanning over UDP")
+	}
 	if *sourceIP != "" {
-		fmt.Fprintln(os.Stderr,"++Using SourceIP:", *sendSYNs)
+		fmt.Fprintln(os.Stderr,"++Using SourceIP:", *sourceIP)
+	}
+	if *sourcePorts != "32768-61000" {
+		fmt.Fprintln(os.Stderr,"++Using Source Ports:", *sourcePorts)
+	}
+	switch *captureBackend {
+	case BACKEND_PCAP:
+	case BACKEND_AFPACKET:
+		fmt.Fprintln(os.Stderr,"++Capturing with afpacket, ring size (MB):", *ringSizeMB)
+	default:
+		fmt.Fprintln(os.Stderr,"--Unknown capture backend:", *captureBackend)
+		return nil, false
+	}
+	switch *overload {
+	case OVERLOAD_BLOCK, OVERLOAD_DROP:
+	default:
+		fmt.Fprintln(os.Stderr,"--Unknown overload policy:", *overload)
+		return nil, false
+	}
+	if *maxFlows > 0 {
+		fmt.Fprintln(os.Stderr,"++Max flows in flight:", *maxFlows, "("+*overload+")")
+	}
+	if *maxMemoryMB > 0 {
+		fmt.Fprintln(os.Stderr,"++Max memory (MB):", *maxMemoryMB, "("+*overload+")")
+	}
+	if *linkTypeFlag != "auto" {
+		fmt.Fprintln(os.Stderr,"++Using Link Type:", *linkTypeFlag)
+	}
+	if *vlans != "" {
+		if _, err := parseVLANs( *vlans ); err != nil {
+			fmt.Fprintln(os.Stderr,"--Bad VLAN tags:", err)
+			return nil, false
+		}
+		fmt.Fprintln(os.Stderr,"++Using VLAN tags:", *vlans)
 	}
 	if *device != "ens8" {
 		fmt.Fprintln(os.Stderr,"++Using Sending Interface:", *device)
@@ -203,15 +349,49 @@ func Parse() (*options,bool) {
 	if *feedZGrab {
 		fmt.Fprintln(os.Stderr,"++Feeding ZGrab with fingerprints")
 	}
+	if *zgrab2Ini != "" {
+		if err := WriteZGrab2Ini( *zgrab2Ini ); err != nil {
+			fmt.Fprintln(os.Stderr,"--Failed to write zgrab2 config:", err)
+			return nil, false
+		}
+		fmt.Fprintln(os.Stderr,"++Wrote zgrab2 config to:", *zgrab2Ini)
+	}
 	if *pushDOnly {
 		fmt.Fprintln(os.Stderr,"++Sending Data only with Push Flag (not in ack)")
 	}
 	if *forceAllHandshakes {
 		fmt.Fprintln(os.Stderr,"++Force completing all handshakes")
 	}
+	if *aggregate {
+		fmt.Fprintln(os.Stderr,"++Aggregating all handshakes into one record per target")
+	}
 	if *recordOnlyData {
 		fmt.Fprintln(os.Stderr,"++Recording to file only services that return data")
 	}
+	if *outputFields != "*" {
+		fmt.Fprintln(os.Stderr,"++Output fields:", *outputFields)
+	}
+	if *outputs != "" {
+		fmt.Fprintln(os.Stderr,"++Additional output sinks:", *outputs)
+	}
+	if *compress != "" {
+		fmt.Fprintln(os.Stderr,"++Compressing json output with:", *compress)
+	}
+	if *rotateSize > 0 {
+		fmt.Fprintln(os.Stderr,"++Rotating output files every (MB):", *rotateSize)
+	}
+	if *rotateInterval > 0 {
+		fmt.Fprintln(os.Stderr,"++Rotating output files every (s):", *rotateInterval)
+	}
+	if *hostBudget > 0 {
+		fmt.Fprintln(os.Stderr,"++SYN budget per host:", *hostBudget)
+	}
+	if *hostIdenticalPorts > 0 {
+		fmt.Fprintln(os.Stderr,"++Skipping handshakes on hosts with identical responses on ports:", *hostIdenticalPorts)
+	}
+	if *hostSummary != "" {
+		fmt.Fprintln(os.Stderr,"++Writing host summary to file:", *hostSummary)
+	}
 	fmt.Fprintln(os.Stderr,"++Worker threads:", *workers)
 	fmt.Fprintln(os.Stderr,"++Timeout Interval (s):", *timeout)
 	fmt.Fprintln(os.Stderr,"++Retransmit Interval (s):", *retransmitSec)
@@ -237,7 +417,11 @@ func HyperACKtiveFiltering() bool {
 }
 
 func ReadZMap() bool {
-	return *sendSYNs != true
+	return *sendSYNs != true && !*udp
+}
+
+func UDPMode() bool {
+	return *udp
 }
 
 func getNumFilters() int {
@@ -252,6 +436,38 @@ func getDevice() string {
     return *device
 }
 
+func getCaptureBackend() string {
+	return *captureBackend
+}
+
+func getRingSizeMB() int {
+	return *ringSizeMB
+}
+
+func getMaxFlows() int {
+	return *maxFlows
+}
+
+func getMaxMemoryMB() int {
+	return *maxMemoryMB
+}
+
+func getOverload() string {
+	return *overload
+}
+
+func getMaxSessions() int {
+	return *maxSessions
+}
+
+func getLinkType() string {
+	return *linkTypeFlag
+}
+
+func getVLANs() string {
+	return *vlans
+}
+
 func getHostMacAddr() string {
 	return *mac
 }
@@ -264,6 +480,30 @@ func ForceAllHandshakes() bool {
 	return *forceAllHandshakes
 }
 
+func Aggregate() bool {
+	return *aggregate
+}
+
+func getHostBudget() int {
+	return *hostBudget
+}
+
+func getHostIdenticalPorts() int {
+	return *hostIdenticalPorts
+}
+
+func getHostSummary() string {
+	return *hostSummary
+}
+
+func getHostCacheSize() int {
+	return *hostCacheSize
+}
+
+func getHostCacheTTL() int {
+	return *hostCacheTTL
+}
+
 func GetAllHandshakes()  []string {
 
 	if priorityFingerprintArr != nil {
@@ -276,3 +516,10 @@ func NumHandshakes() int {
     return len(handshakeArr)
 }
 
+func getHandshakeName( num int ) string {
+	if num < 0 || num >= len(handshakeArr) {
+		return ""
+	}
+	return handshakeArr[num]
+}
+
@@ -29,43 +29,49 @@ import (
 
 var SHARD_COUNT = 4096
 
-// A "thread" safe map of type string:Anything.
+// A "thread" safe map of type flow_key:*packet_state.
 // To avoid lock bottlenecks this map is dived to several (SHARD_COUNT) map shards.
 type pState []*pStateShared
 
 
 
-// A "thread" safe string to anything map.
+// A "thread" safe flow_key to *packet_state map.
 type pStateShared struct {
-	items        map[string]*packet_state
+	items        map[flow_key]*packet_state
 	sync.RWMutex // Read Write mutex, guards access to internal map.
+	released     *sync.Cond // Broadcast when a flow stops processing or goes away.
 }
 
 // Creates a new concurrent map.
 func NewpState() pState {
 	m := make(pState, SHARD_COUNT)
 	for i := 0; i < SHARD_COUNT; i++ {
-		m[i] = &pStateShared{items: make(map[string]*packet_state)}
+		m[i] = &pStateShared{items: make(map[flow_key]*packet_state)}
+		m[i].released = sync.NewCond(m[i])
 	}
 	return m
 }
 
 // GetShard returns shard under given key
-func (m pState) GetShard(key string) *pStateShared {
-	return m[uint(fnv32(key))%uint(SHARD_COUNT)]
+func (m pState) GetShard(key flow_key) *pStateShared {
+	return m[uint(key.hash())%uint(SHARD_COUNT)]
 }
 
 // Insert or Update - updates existing element or inserts a new one using UpsertCb
-func (m pState) Insert(key string, p * packet_state) {
+func (m pState) Insert(key flow_key, p * packet_state) {
 	shard := m.GetShard(key)
 	shard.Lock()
 
+	if _, ok := shard.items[key]; !ok {
+		flowLimits.addFlow( 1 )
+	}
 	shard.items[key] = p
+	shard.released.Broadcast()
 	shard.Unlock()
 }
 
 // Get retrieves an element from map under given key.
-func (m pState) Get(key string) (*packet_state, bool) {
+func (m pState) Get(key flow_key) (*packet_state, bool) {
 	// Get shard
 	shard := m.GetShard(key)
 	shard.RLock()
@@ -96,7 +102,7 @@ func (m pState) IsEmpty() bool {
 }
 
 // Looks up an item under specified key
-func (m pState) Has(key string) bool {
+func (m pState) Has(key flow_key) bool {
 	// Get shard
 	shard := m.GetShard(key)
 	shard.RLock()
@@ -107,11 +113,15 @@ func (m pState) Has(key string) bool {
 }
 
 // Remove removes an element from the map.
-func (m pState) Remove(key string) {
+func (m pState) Remove(key flow_key) {
 	// Try to get shard.
 	shard := m.GetShard(key)
 	shard.Lock()
-	delete(shard.items, key)
+	if _, ok := shard.items[key]; ok {
+		flowLimits.addFlow( -1 )
+		delete(shard.items, key)
+		shard.released.Broadcast()
+	}
 	shard.Unlock()
 }
 
@@ -129,8 +139,8 @@ func (m pState) IsStartProcessing( p * packet_metadata ) ( bool,bool ) {
 		shard.Unlock()
         return false,false
     }
-	if !p_out.Packet.Processing {
-		p_out.Packet.startProcessing()
+	if !p_out.Flow.Processing {
+		p_out.Flow.Processing = true
 		shard.Unlock()
 		return true,true
 	}
@@ -139,6 +149,29 @@ func (m pState) IsStartProcessing( p * packet_metadata ) ( bool,bool ) {
 
 }
 
+/* WaitStartProcessing blocks until no other thread is processing p's
+ * flow and takes it, for callers outside the worker pools that cannot
+ * put p back on a queue. false if the flow is gone.
+ */
+func (m pState) WaitStartProcessing( p * packet_metadata ) bool {
+
+	pKey := constructKey(p)
+	shard := m.GetShard(pKey)
+	shard.Lock()
+	defer shard.Unlock()
+	for {
+		p_out, ok := shard.items[pKey]
+		if !ok {
+			return false
+		}
+		if !p_out.Flow.Processing {
+			p_out.Flow.Processing = true
+			return true
+		}
+		shard.released.Wait()
+	}
+}
+
 func (m pState) StartProcessing( p * packet_metadata ) bool {
 
     // Get shard
@@ -151,7 +184,7 @@ func (m pState) StartProcessing( p * packet_metadata ) bool {
 		shard.RUnlock()
         return false
     }
-    p_out.Packet.startProcessing()
+    p_out.Flow.Processing = true
     shard.RUnlock()
     return ok
 
@@ -169,19 +202,9 @@ func (m pState) FinishProcessing( p * packet_metadata ) bool {
 		shard.Unlock()
         return false
     }
-    p_out.Packet.finishedProcessing()
+    p_out.Flow.Processing = false
+	shard.released.Broadcast()
 	shard.Unlock()
     return ok
 
 }
-
-/* Meta functions */
-func fnv32(key string) uint32 {
-	hash := uint32(2166136261)
-	const prime32 = uint32(16777619)
-	for i := 0; i < len(key); i++ {
-		hash *= prime32
-		hash ^= uint32(key[i])
-	}
-	return hash
-}
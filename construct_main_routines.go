@@ -16,7 +16,7 @@ limitations under the License.
 package lzr
 
 import (
-    "github.com/google/gopacket"
+    "github.com/google/gopacket/layers"
     "github.com/google/gopacket/pcap"
     "log"
     "io"
@@ -26,8 +26,36 @@ import (
     "fmt"
 )
 
+/* packet_io is what LZR needs from a capture backend:
+ * libpcap (-captureBackend pcap) or AF_PACKET rings (afpacket)
+ */
+type packet_io interface {
+	WritePacketData( data []byte ) error
+	SetBPFFilter( filter string ) error
+	LinkType() layers.LinkType
+	Close()
+}
+
+/* captured frames waiting for a worker to decode them (or decoded,
+ * waiting for a worker to handle them). they are taken as fast as
+ * they come in, so this only absorbs bursts: past it the reader
+ * blocks and the capture's own buffer fills.
+ */
+var FRAME_QUEUE_SIZE = 65536
+
+// a captured frame waiting for a worker to decode it
+type raw_frame struct {
+	data		[]byte
+	ts			time.Time
+}
+
+const (
+	BACKEND_PCAP		string = "pcap"
+	BACKEND_AFPACKET	string = "afpacket"
+)
+
 var (
-    handle       *pcap.Handle
+    handle       packet_io
     snapshot_len int32  = 1024
     promiscuous  bool   = false
     err          error
@@ -40,6 +68,7 @@ func InitParams() {
 
     source_mac = getSourceMacAddr()
     dest_mac =  getHostMacAddr()
+	resetLinkHeader()
 
 }
 
@@ -54,7 +83,8 @@ func ConstructIncomingRoutine( workers int ) chan *packet_metadata {
 
 
 	//routine to read in from ZMap
-	incoming := make(chan *packet_metadata, QUEUE_SIZE)
+	incoming := make(chan *packet_metadata, incomingQueueSize())
+	go flowLimits.sampleHeap()
 	go func() {
 		reader := bufio.NewReader(os.Stdin)
 		for {
@@ -75,6 +105,13 @@ func ConstructIncomingRoutine( workers int ) chan *packet_metadata {
             if packet == nil {
                 continue
             }
+			//wait for (or drop) targets over -maxFlows/-maxMemory
+			if !flowLimits.admit( incoming ) {
+				if !ReadZMap() {
+					sources.release( packet )
+				}
+				continue
+			}
 			incoming <- packet
 		}
 
@@ -86,32 +123,41 @@ func ConstructIncomingRoutine( workers int ) chan *packet_metadata {
 func ConstructPcapRoutine( workers int ) chan *packet_metadata {
 
 	//routine to read in from pcap
-	pcapIncoming := make(chan *packet_metadata, QUEUE_SIZE)
-	pcapdQueue := make(chan *gopacket.Packet, QUEUE_SIZE)
-	// Open device
-	handle, err = pcap.OpenLive(getDevice(), snapshot_len, promiscuous, pcap.BlockForever)//1*time.Second)
-	if err != nil {
-        panic(err)
-		log.Fatal(err)
+	pcapIncoming := make(chan *packet_metadata, FRAME_QUEUE_SIZE)
+
+	if getCaptureBackend() == BACKEND_AFPACKET {
+		afHandle, err := openAFPacket( getDevice(), workers, getRingSizeMB() )
+		if err != nil {
+			log.Fatal(err)
+		}
+		handle = afHandle
+		initCapture()
+		afHandle.startReaders( pcapIncoming )
+		return pcapIncoming
 	}
-	//set to filter out zmap syn packets (just syn) 
-	err := handle.SetBPFFilter("tcp[tcpflags] != tcp-syn")
+
+	pcapdQueue := make(chan raw_frame, FRAME_QUEUE_SIZE)
+	// Open device
+	pcapHandle, err := pcap.OpenLive(getDevice(), snapshot_len, promiscuous, pcap.BlockForever)//1*time.Second)
 	if err != nil {
         panic(err)
 		log.Fatal(err)
 	}
+	handle = pcapHandle
+	initCapture()
 
 
     for i := 0; i < workers; i ++ {
 		go func(i int) {
+			decoder := newFrameDecoder()
 			for {
 				select {
-				case data := <-pcapdQueue:
-					packet := convertToPacketM( data )
+				case frame := <-pcapdQueue:
+					packet := decoder.decode( frame.data, frame.ts )
 					if packet == nil {
 						continue
 					}
-					if dest_mac  == "" {
+					if dest_mac  == "" && packet.Smac != "" {
 						saveHostMacAddr( packet )
 					}
 					pcapIncoming <- packet
@@ -120,11 +166,14 @@ func ConstructPcapRoutine( workers int ) chan *packet_metadata {
         }(i)
     }
     go func() {
-		    defer handle.Close()
-			packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
+		    defer pcapHandle.Close()
 			for {
-				pcapPacket, _ := packetSource.NextPacket()
-				pcapdQueue <- &pcapPacket
+				//a fresh copy per frame, the workers decode it later
+				data, ci, err := pcapHandle.ReadPacketData()
+				if err != nil {
+					continue
+				}
+				pcapdQueue <- raw_frame{ data: data, ts: ci.Timestamp }
 			}
 	}()
 
@@ -132,6 +181,27 @@ func ConstructPcapRoutine( workers int ) chan *packet_metadata {
 
 }
 
+// link layer and capture filter, the same for every backend
+func initCapture() {
+
+	if err := initLinkLayer( handle.LinkType() ); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintln(os.Stderr,"++Link layer:", linkType)
+
+	//set to filter out zmap syn packets (just syn) 
+	//ICMP errors end flows early
+	filter := "tcp[tcpflags] != tcp-syn or " + ICMP_BPF_FILTER
+	if UDPMode() {
+		filter = "udp or " + ICMP_BPF_FILTER
+	}
+	err := handle.SetBPFFilter(vlanFilter(filter))
+	if err != nil {
+        panic(err)
+		log.Fatal(err)
+	}
+}
+
 func PollTimeoutRoutine( ipMeta * pState, timeoutQueue chan *packet_metadata, retransmitQueue chan *packet_metadata, 
 	workers int, timeoutT int,  timeoutR int ) chan *packet_metadata  {
 
@@ -170,7 +240,7 @@ func timeoutAlg(  ipMeta * pState, queue chan *packet_metadata, timeoutIncoming
                     continue
                 }
                 //if state hasnt changed
-				if p.ExpectedRToLZR != packet.ExpectedRToLZR {
+				if p.Expected != expectedCode( packet.ExpectedRToLZR ) {
 					//fmt.Println("state hasnt changed")
                     continue
                 } else {
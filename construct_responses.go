@@ -20,7 +20,9 @@ import (
     "github.com/google/gopacket/layers"
     "log"
 	"net"
+	"net/netip"
 	"bytes"
+	"sync"
     //"fmt"
 )
 
@@ -29,6 +31,7 @@ import (
 
 func saveHostMacAddr( packet *packet_metadata ) {
 	dest_mac = packet.getSourceMac()
+	resetLinkHeader()
 }
 
 func getSourceMacAddr() (addr string) {
@@ -62,22 +65,106 @@ func constructEthLayer() (eth *layers.Ethernet) {
 
 }
 
-/* NOTE: constructing RESPONSE SYN. 
- * so Daddr/Saddr etc will be inverted in the process
+/* frame_builder holds what constructing one frame needs. pooled,
+ * so sending reuses its layers and serialization buffer instead of
+ * allocating them for every packet.
  */
-func constructSYN( p *packet_metadata ) []byte {
+type frame_builder struct {
+	buffer		gopacket.SerializeBuffer
+	ip			layers.IPv4
+	tcp			layers.TCP
+	udp			layers.UDP
+	src			[4]byte
+	dst			[4]byte
+}
+
+var frameBuilders = sync.Pool{
+	New: func() interface{} {
+		return &frame_builder{ buffer: gopacket.NewSerializeBuffer() }
+	},
+}
 
-	ethernetLayer := constructEthLayer()
+var serializeOptions = gopacket.SerializeOptions{
+	ComputeChecksums: true,
+	FixLengths:       true,
+}
+
+func getFrameBuilder() *frame_builder {
+	return frameBuilders.Get().(*frame_builder)
+}
 
-	ipLayer := &layers.IPv4{
-        SrcIP: net.ParseIP(p.Daddr),
-        DstIP: net.ParseIP(p.Saddr),
+func putIPv4( dst *[4]byte, addr netip.Addr ) {
+
+	if !addr.Is4() {
+		*dst = [4]byte{}
+		return
+	}
+	*dst = addr.As4()
+}
+
+// IP header of a response to p, so Daddr/Saddr are inverted
+func ( b *frame_builder ) ipLayer( p *packet_metadata, proto layers.IPProtocol ) *layers.IPv4 {
+
+	putIPv4( &b.src, p.localAddr() )
+	putIPv4( &b.dst, p.targetAddr() )
+	b.ip = layers.IPv4{
+		SrcIP: b.src[:],
+		DstIP: b.dst[:],
 		TTL : 64,
-		Protocol: layers.IPProtocolTCP,
+		Protocol: proto,
 		Version: 4,
-    }
+	}
+	return &b.ip
+}
+
+/* serialize behind the cached link header. the frame stays in the
+ * builder's buffer, no copy is made: send it, or release the builder.
+ */
+func ( b *frame_builder ) finish( ls ...gopacket.SerializableLayer ) *frame_builder {
+
+	if err := gopacket.SerializeLayers( b.buffer, serializeOptions, ls... ); err != nil {
+		log.Fatal(err)
+	}
+	if hdr := linkHeader(); len(hdr) > 0 {
+		link, _ := b.buffer.PrependBytes( len(hdr) )
+		copy( link, hdr )
+	}
+	//ethernet minimum frame size, as gopacket pads it
+	if linkType == LINK_ETHERNET && len(b.buffer.Bytes()) < 60 {
+		padding, _ := b.buffer.AppendBytes( 60 - len(b.buffer.Bytes()) )
+		for i := range padding {
+			padding[i] = 0
+		}
+	}
+	return b
+}
 
-	tcpLayer := &layers.TCP{
+func ( b *frame_builder ) Bytes() []byte {
+	return b.buffer.Bytes()
+}
+
+func ( b *frame_builder ) release() {
+	frameBuilders.Put( b )
+}
+
+/* write the frame and hand the builder back to the pool. every
+ * handle is done with the bytes once WritePacketData returns.
+ */
+func ( b *frame_builder ) send() error {
+	err := handle.WritePacketData( b.buffer.Bytes() )
+	b.release()
+	return err
+}
+
+/* NOTE: constructing RESPONSE SYN. 
+ * so Daddr/Saddr etc will be inverted in the process
+ */
+func constructSYN( p *packet_metadata ) *frame_builder {
+
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( p, layers.IPProtocolTCP )
+
+	b.tcp = layers.TCP{
         SrcPort: layers.TCPPort(p.Dport),
         DstPort: layers.TCPPort(p.Sport),
 		Seq: uint32(p.Seqnum),
@@ -85,25 +172,9 @@ func constructSYN( p *packet_metadata ) []byte {
 		Window: uint16(p.Window), //65535,
 		SYN: true,
     }
+    b.tcp.SetNetworkLayerForChecksum(ipLayer)
 
-    buffer := gopacket.NewSerializeBuffer()
-    options := gopacket.SerializeOptions{
-        ComputeChecksums: true,
-        FixLengths:       true,
-    }
-    tcpLayer.SetNetworkLayerForChecksum(ipLayer)
-
-    // And create the packet with the layers
-    if err := gopacket.SerializeLayers(buffer, options,
-		ethernetLayer,
-        ipLayer,
-        tcpLayer,
-    ); err != nil {
-        log.Fatal(err)
-
-	}
-    outPacket := buffer.Bytes()
-	return outPacket
+	return b.finish( ipLayer, &b.tcp )
 }
 
 
@@ -111,7 +182,7 @@ func constructSYN( p *packet_metadata ) []byte {
 /* NOTE: constructing RESPONSE. 
  * so Daddr/Saddr etc will be inverted in the process
  */
-func constructData( handshake Handshake, p *packet_metadata, ack bool, push bool) ([]byte, []byte) {
+func constructData( handshake Handshake, p *packet_metadata, ack bool, push bool) (*frame_builder, []byte) {
 
     //data := []byte("\n")
 
@@ -119,17 +190,11 @@ func constructData( handshake Handshake, p *packet_metadata, ack bool, push bool
 	if PushDOnly() && !push {
 		data = []byte("")
 	}
-	ethernetLayer := constructEthLayer()
 
-    ipLayer := &layers.IPv4{
-        SrcIP: net.ParseIP(p.Daddr),
-        DstIP: net.ParseIP(p.Saddr),
-		TTL : 64,
-		Protocol: layers.IPProtocolTCP,
-		Version: 4,
-    }
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( p, layers.IPProtocolTCP )
 
-    tcpLayer := &layers.TCP{
+    b.tcp = layers.TCP{
         SrcPort: layers.TCPPort(p.Dport),
         DstPort: layers.TCPPort(p.Sport),
 		Seq: uint32(p.Acknum),
@@ -138,45 +203,69 @@ func constructData( handshake Handshake, p *packet_metadata, ack bool, push bool
 		ACK: ack,
 		PSH: push,
     }
+    b.tcp.SetNetworkLayerForChecksum(ipLayer)
 
-    buffer := gopacket.NewSerializeBuffer()
-    options := gopacket.SerializeOptions{
-        ComputeChecksums: true,
-        FixLengths:       true,
-    }
-    tcpLayer.SetNetworkLayerForChecksum(ipLayer)
-	// And create the packet with the layers
-	if err := gopacket.SerializeLayers(buffer, options,
-		ethernetLayer,
-		ipLayer,
-		tcpLayer,
-		gopacket.Payload(data),
-	);err != nil {
-		log.Fatal(err)
-	}
+    return b.finish( ipLayer, &b.tcp, gopacket.Payload(data) ),data
+
+}
 
-    outPacket := buffer.Bytes()
-    return outPacket,data
 
+/* NOTE: constructing RESPONSE. 
+ * so Daddr/Saddr etc will be inverted in the process
+ * a bare ACK of everything up to acknum
+ */
+func constructAck( p *packet_metadata, acknum int ) *frame_builder {
+
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( p, layers.IPProtocolTCP )
+
+	b.tcp = layers.TCP{
+		SrcPort: layers.TCPPort(p.Dport),
+		DstPort: layers.TCPPort(p.Sport),
+		Seq: uint32(p.Acknum),
+		Ack: uint32(acknum),
+		Window: uint16(p.Window),
+		ACK: true,
+	}
+	b.tcp.SetNetworkLayerForChecksum(ipLayer)
+
+	return b.finish( ipLayer, &b.tcp )
 }
 
 
 /* NOTE: constructing RESPONSE. 
  * so Daddr/Saddr etc will be inverted in the process
+ * one segment of a session, numbered by the session
  */
-func constructRST( ack *packet_metadata ) []byte {
+func constructSegment( p *packet_metadata, seq uint32, ack uint32, payload []byte, push bool ) *frame_builder {
+
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( p, layers.IPProtocolTCP )
+
+	b.tcp = layers.TCP{
+		SrcPort: layers.TCPPort(p.Dport),
+		DstPort: layers.TCPPort(p.Sport),
+		Seq: seq,
+		Ack: ack,
+		Window: SESSION_WINDOW,
+		ACK: true,
+		PSH: push,
+	}
+	b.tcp.SetNetworkLayerForChecksum(ipLayer)
 
-	ethernetLayer := constructEthLayer()
+	return b.finish( ipLayer, &b.tcp, gopacket.Payload(payload) )
+}
 
-    ipLayer := &layers.IPv4{
-        SrcIP: net.ParseIP(ack.Daddr),
-        DstIP: net.ParseIP(ack.Saddr),
-    TTL : 64,
-    Protocol: layers.IPProtocolTCP,
-    Version: 4,
-    }
 
-    tcpLayer := &layers.TCP{
+/* NOTE: constructing RESPONSE. 
+ * so Daddr/Saddr etc will be inverted in the process
+ */
+func constructRST( ack *packet_metadata ) *frame_builder {
+
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( ack, layers.IPProtocolTCP )
+
+    b.tcp = layers.TCP{
         SrcPort: layers.TCPPort(ack.Dport),
         DstPort: layers.TCPPort(ack.Sport),
     Seq: uint32(ack.Acknum), //NOT SURE
@@ -184,27 +273,28 @@ func constructRST( ack *packet_metadata ) []byte {
     Window: 0,
     RST: true,
     }
+    b.tcp.SetNetworkLayerForChecksum(ipLayer)
 
-    buffer := gopacket.NewSerializeBuffer()
-    options := gopacket.SerializeOptions{
-        ComputeChecksums: true,
-        FixLengths:       true,
-    }
-    tcpLayer.SetNetworkLayerForChecksum(ipLayer)
-    // And create the packet with the layers
-    if err := gopacket.SerializeLayers(buffer, options,
-		ethernetLayer,
-        ipLayer,
-        tcpLayer,
-    ); err != nil {
-        log.Fatal(err)
+    return b.finish( ipLayer, &b.tcp )
 
-    }
-    outPacket := buffer.Bytes()
-    return outPacket
+}
 
 
-}
+/* NOTE: constructing RESPONSE. 
+ * so Daddr/Saddr etc will be inverted in the process
+ */
+func constructUDP( handshake Handshake, p *packet_metadata ) (*frame_builder, []byte) {
+
+	data := udpPayload( handshake, string(p.Saddr) )
 
+	b := getFrameBuilder()
+	ipLayer := b.ipLayer( p, layers.IPProtocolUDP )
 
+	b.udp = layers.UDP{
+		SrcPort: layers.UDPPort(p.Dport),
+		DstPort: layers.UDPPort(p.Sport),
+	}
+	b.udp.SetNetworkLayerForChecksum(ipLayer)
 
+	return b.finish( ipLayer, &b.udp, gopacket.Payload(data) ),data
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+/* frame_decoder decodes raw frames into packet_metadata without
+ * allocating gopacket.Packets: the layers are decoded in place and
+ * reused for every frame. one per reading goroutine, never shared.
+ */
+type frame_decoder struct {
+	parser		*gopacket.DecodingLayerParser
+	decoded		[]gopacket.LayerType
+
+	eth			layers.Ethernet
+	dot1q		layers.Dot1Q
+	sll			layers.LinuxSLL
+	loop		layers.Loopback
+	ip4			layers.IPv4
+	ip6			layers.IPv6
+	tcp			layers.TCP
+	udp			layers.UDP
+	icmp4		layers.ICMPv4
+	icmp6		layers.ICMPv6
+	payload		gopacket.Payload
+	noEth		layers.Ethernet		//stands in for frames without one
+}
+
+func firstLayerType() gopacket.LayerType {
+
+	switch linkType {
+	case LINK_RAW:
+		return layers.LayerTypeIPv4
+	case LINK_SLL:
+		return layers.LayerTypeLinuxSLL
+	case LINK_NULL:
+		return layers.LayerTypeLoopback
+	}
+	return layers.LayerTypeEthernet
+}
+
+// call once the link layer is known (initLinkLayer)
+func newFrameDecoder() *frame_decoder {
+
+	d := &frame_decoder{
+		decoded: make( []gopacket.LayerType, 0, 8 ),
+	}
+	d.parser = gopacket.NewDecodingLayerParser( firstLayerType(),
+		&d.eth, &d.dot1q, &d.sll, &d.loop, &d.ip4, &d.ip6,
+		&d.tcp, &d.udp, &d.icmp4, &d.icmp6, &d.payload )
+	//frames we do not care about (ARP, IPv6 TCP, ...) just stop decoding
+	d.parser.IgnoreUnsupported = true
+	return d
+}
+
+/* nil for frames LZR does not handle. data may be reused by the
+ * caller afterwards, every field of the result is a copy.
+ */
+func ( d *frame_decoder ) decode( data []byte, ts time.Time ) *packet_metadata {
+
+	if err := d.parser.DecodeLayers( data, &d.decoded ); err != nil && len(d.decoded) == 0 {
+		return nil
+	}
+
+	var hasEth, hasSLL, hasIP4, hasIP6, hasTCP, hasUDP, hasICMP4, hasICMP6 bool
+	for _, t := range d.decoded {
+		switch t {
+		case layers.LayerTypeEthernet:
+			hasEth = true
+		case layers.LayerTypeLinuxSLL:
+			hasSLL = true
+		case layers.LayerTypeIPv4:
+			hasIP4 = true
+		case layers.LayerTypeIPv6:
+			hasIP6 = true
+		case layers.LayerTypeTCP:
+			hasTCP = true
+		case layers.LayerTypeUDP:
+			hasUDP = true
+		case layers.LayerTypeICMPv4:
+			hasICMP4 = true
+		case layers.LayerTypeICMPv6:
+			hasICMP6 = true
+		}
+	}
+
+	eth := &d.noEth
+	eth.SrcMAC = nil
+	if hasEth {
+		eth = &d.eth
+	} else if hasSLL {
+		eth.SrcMAC = net.HardwareAddr( d.sll.Addr )
+	}
+
+	var metapacket *packet_metadata
+	switch {
+	case hasICMP4 && hasIP4:
+		metapacket = ReadICMPLayers( &d.ip4, &d.icmp4, eth )
+	case hasICMP6 && hasIP6:
+		metapacket = ReadICMPv6Layers( &d.ip6, &d.icmp6, eth )
+	case UDPMode() && hasUDP && hasIP4:
+		metapacket = ReadUDPLayers( &d.ip4, &d.udp, eth )
+	case !UDPMode() && hasTCP && hasIP4:
+		metapacket = ReadLayers( &d.ip4, &d.tcp, eth )
+	}
+	if metapacket == nil {
+		return nil
+	}
+	if !ts.IsZero() {
+		metapacket.RecvTime = ts
+	}
+	return metapacket
+}
+
+// the gateway's MAC is only needed until it has been learned
+func learnMac( eth *layers.Ethernet ) string {
+
+	if dest_mac != "" || len(eth.SrcMAC) == 0 {
+		return ""
+	}
+	return eth.SrcMAC.String()
+}
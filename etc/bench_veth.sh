@@ -0,0 +1,67 @@
+#!/bin/bash
+# Compare the pcap and afpacket capture backends over a veth pair.
+#
+# A network namespace on the far side of the pair answers on a /24 of
+# addresses with a python http server on a few ports, so every target
+# completes a real handshake. Each backend scans the same target list
+# and the wall clock, CPU time and LZR's summary are printed.
+#
+# usage: sudo etc/bench_veth.sh [workers]
+# run from the repository root after `make lzr`.
+
+set -e
+
+WORKERS=${1:-4}
+NS=lzrbench
+HOST_IF=veth-lzr
+TGT_IF=veth-tgt
+HOST_IP=10.200.0.1
+PORTS="80 8000 8080 8888"
+
+cleanup() {
+	ip netns pids $NS 2>/dev/null | xargs -r kill
+	ip netns del $NS 2>/dev/null || true
+	ip link del $HOST_IF 2>/dev/null || true
+	iptables -D OUTPUT -p tcp --tcp-flags RST RST -s $HOST_IP -j DROP 2>/dev/null || true
+}
+trap cleanup EXIT
+cleanup
+
+ip netns add $NS
+ip link add $HOST_IF type veth peer name $TGT_IF
+ip link set $TGT_IF netns $NS
+ip addr add $HOST_IP/16 dev $HOST_IF
+ip link set $HOST_IF up
+ip netns exec $NS ip link set lo up
+ip netns exec $NS ip link set $TGT_IF up
+ip netns exec $NS ip addr add 10.200.0.2/16 dev $TGT_IF
+for i in $(seq 1 254); do
+	ip netns exec $NS ip addr add 10.200.1.$i/16 dev $TGT_IF
+done
+ip netns exec $NS ip route add default dev $TGT_IF
+
+for port in $PORTS; do
+	ip netns exec $NS python3 -m http.server $port --bind 0.0.0.0 >/dev/null 2>&1 &
+done
+sleep 1
+
+# the kernel knows nothing of LZR's connections, keep it from resetting them
+iptables -A OUTPUT -p tcp --tcp-flags RST RST -s $HOST_IP -j DROP
+
+GW_MAC=$(ip netns exec $NS cat /sys/class/net/$TGT_IF/address)
+TARGETS=$(mktemp)
+for port in $PORTS; do
+	for i in $(seq 1 254); do
+		echo "10.200.1.$i:$port"
+	done
+done > $TARGETS
+echo "targets: $(wc -l < $TARGETS), workers: $WORKERS"
+
+for backend in pcap afpacket; do
+	echo "== $backend"
+	/usr/bin/time -f "wall %es user %Us sys %Ss maxrss %MkB" \
+		./lzr -sendSYNs -sourceIP $HOST_IP -gatewayMac $GW_MAC -sendInterface $HOST_IF \
+		-handshakes http -w $WORKERS -captureBackend $backend -f /dev/null \
+		< $TARGETS 2>&1 | grep -E '^(wall|Runtime|\{)'
+done
+rm -f $TARGETS
@@ -0,0 +1,189 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* when a response matches several handshakes, precedence rules decide
+ * which fingerprint wins. a rule reads "winner relation loser":
+ *
+ *   ipp refines http             ipp is the more specific reading, it wins
+ *                                unless http was the handshake asked for
+ *   rmi overrides postgres       postgres' match is a false positive when
+ *                                rmi matches, rmi wins even if asked for postgres
+ *
+ * a loser of * is every other fingerprint, rules naming both sides
+ * take precedence over it. handshake modules declare their rules when
+ * they register, and -fingerprintRules loads more from a file with one
+ * rule per line (# starts a comment). later rules replace earlier ones
+ * that conflict.
+ */
+const (
+	REFINES		string = "refines"
+	OVERRIDES	string = "overrides"
+	ANY_FINGERPRINT	string = "*"
+)
+
+type fingerprint_rule struct {
+	Winner		string
+	Relation	string
+	Loser		string
+}
+
+var fingerprintRules []fingerprint_rule
+
+func AddFingerprintRule( winner string, relation string, loser string ) error {
+
+	if relation != REFINES && relation != OVERRIDES {
+		return fmt.Errorf("unknown fingerprint relation %q", relation)
+	}
+	if winner == "" || winner == ANY_FINGERPRINT || loser == "" || winner == loser {
+		return fmt.Errorf("bad fingerprint rule %q %s %q", winner, relation, loser)
+	}
+	// drop any rule this one contradicts or repeats
+	rules := fingerprintRules[:0]
+	for _, r := range fingerprintRules {
+		if ( r.Winner == winner && r.Loser == loser ) || ( r.Winner == loser && r.Loser == winner ) {
+			continue
+		}
+		rules = append( rules, r )
+	}
+	fingerprintRules = append( rules, fingerprint_rule{ winner, relation, loser } )
+	return nil
+}
+
+func LoadFingerprintRules( fname string ) error {
+
+	f, err := os.Open( fname )
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner( f )
+	line := 0
+	for scanner.Scan() {
+		line += 1
+		text := scanner.Text()
+		if i := strings.Index( text, "#" ); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields( text )
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return fmt.Errorf("%s:%d: expecting \"winner relation loser\"", fname, line)
+		}
+		if err := AddFingerprintRule( fields[0], fields[1], fields[2] ); err != nil {
+			return fmt.Errorf("%s:%d: %v", fname, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// rules name handshakes, a labelled fingerprint like http/jenkins is its handshake's
+func fingerprintBase( fingerprint string ) string {
+	if i := strings.IndexByte( fingerprint, '/' ); i >= 0 {
+		return fingerprint[:i]
+	}
+	return fingerprint
+}
+
+// how a beats b, "" if it does not
+func beats( a string, b string ) string {
+
+	a, b = fingerprintBase( a ), fingerprintBase( b )
+	wildcard := ""
+	for _, r := range fingerprintRules {
+		switch {
+		case r.Winner == a && r.Loser == b:
+			return r.Relation
+		case r.Winner == b && r.Loser == a:
+			return ""
+		case r.Winner == a && r.Loser == ANY_FINGERPRINT:
+			wildcard = r.Relation
+		}
+	}
+	return wildcard
+}
+
+// the candidates no other candidate beats with relation
+func undominated( candidates []string, relation string ) []string {
+
+	left := []string{}
+	for _, c := range candidates {
+		beaten := false
+		for _, o := range candidates {
+			if o != c && beats( o, c ) == relation {
+				beaten = true
+				break
+			}
+		}
+		if !beaten {
+			left = append( left, c )
+		}
+	}
+	// rules that go in a circle leave nothing standing
+	if len(left) == 0 {
+		return candidates
+	}
+	return left
+}
+
+// resolveFingerprint picks the winner among the (sorted) candidates
+func resolveFingerprint( candidates []string ) string {
+
+	if len(candidates) == 0 {
+		return "unknown"
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	// false positives are out whatever was asked for
+	candidates = undominated( candidates, OVERRIDES )
+
+	// prioritize for the handshake being sent
+	// or for handshake which was asked to be prioritized
+	// so if scanning for http ipp will return as http
+	// but if scanning for ipp then http+ipp will return ipp
+	for _, h := range GetAllHandshakes() {
+		for _, c := range candidates {
+			if fingerprintBase( c ) == h {
+				return c
+			}
+		}
+	}
+
+	// otherwise keep whatever no other candidate refines
+	return strings.Join( undominated( candidates, REFINES ), "-" )
+}
+
+func sortedCandidates( seen map[string]bool ) []string {
+	candidates := make( []string, 0, len(seen) )
+	for c := range seen {
+		candidates = append( candidates, c )
+	}
+	sort.Strings( candidates )
+	return candidates
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"testing"
+)
+
+func testRules( t *testing.T, requested []string, rules ...fingerprint_rule ) {
+
+	savedRules, savedRequested, savedPriority := fingerprintRules, handshakeArr, priorityFingerprintArr
+	t.Cleanup( func() {
+		fingerprintRules, handshakeArr, priorityFingerprintArr = savedRules, savedRequested, savedPriority
+	} )
+	fingerprintRules, handshakeArr, priorityFingerprintArr = nil, requested, nil
+	for _, r := range rules {
+		if err := AddFingerprintRule( r.Winner, r.Relation, r.Loser ); err != nil {
+			t.Fatal( err )
+		}
+	}
+}
+
+func TestResolveFingerprint( t *testing.T ) {
+
+	rules := []fingerprint_rule{
+		{ "ipp", REFINES, ANY_FINGERPRINT },
+		{ "docker", REFINES, "http" },
+		{ "rmi", OVERRIDES, "postgres" },
+	}
+	tests := []struct {
+		requested		[]string
+		candidates		[]string
+		want			string
+	}{
+		// refines yields to what was asked for
+		{ []string{ "tls" }, []string{ "docker", "http" }, "docker" },
+		{ []string{ "http" }, []string{ "docker", "http" }, "http" },
+		// overrides does not
+		{ []string{ "postgres" }, []string{ "postgres", "rmi" }, "rmi" },
+		// ipp beats everything
+		{ []string{ "tls" }, []string{ "http", "ipp", "ssh" }, "ipp" },
+		{ []string{ "tls" }, []string{ "docker", "ipp" }, "ipp" },
+		// no rule, no winner
+		{ []string{ "tls" }, []string{ "ftp", "smtp" }, "ftp-smtp" },
+		// a product label is its handshake's fingerprint to the rules
+		{ []string{ "tls" }, []string{ "docker", "http/docker" }, "docker" },
+		{ []string{ "http" }, []string{ "docker", "http/docker" }, "http/docker" },
+		{ []string{ "tls" }, []string{ "http/grafana", "postgres" }, "http/grafana-postgres" },
+	}
+	for _, test := range tests {
+		testRules( t, test.requested, rules... )
+		if got := resolveFingerprint( test.candidates ); got != test.want {
+			t.Errorf( "asked for %v, matched %v: got %q, want %q", test.requested, test.candidates, got, test.want )
+		}
+	}
+}
+
+func TestFingerprintRuleWildcardYields( t *testing.T ) {
+
+	testRules( t, nil,
+		fingerprint_rule{ "ipp", REFINES, ANY_FINGERPRINT },
+		fingerprint_rule{ "kubernetes", REFINES, "ipp" } )
+	if got := resolveFingerprint( []string{ "ipp", "kubernetes" } ); got != "kubernetes" {
+		t.Fatalf( "got %q, a rule naming ipp should beat ipp's wildcard", got )
+	}
+	if err := AddFingerprintRule( ANY_FINGERPRINT, REFINES, "http" ); err == nil {
+		t.Fatal( "accepted a wildcard winner" )
+	}
+}
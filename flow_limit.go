@@ -0,0 +1,124 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+/* caps on flows in flight (in the state map or queued from input)
+ * and on live heap. when one is hit, reading input either waits for
+ * flows to finish (-overload block) or drops targets (-overload drop).
+ */
+const (
+	OVERLOAD_BLOCK	string = "block"
+	OVERLOAD_DROP	string = "drop"
+)
+
+// how often a blocked reader rechecks, and the heap is sampled
+var LIMIT_POLL = 10 * time.Millisecond
+var HEAP_SAMPLE = 100 * time.Millisecond
+
+const HEAP_METRIC = "/memory/classes/heap/objects:bytes"
+
+type flow_limits struct {
+	inFlight		int64
+	flowsHigh		int64
+	heap			uint64
+	heapHigh		uint64
+	dropped			int64
+	blocked			int64		//nanoseconds input spent waiting
+}
+
+var flowLimits = &flow_limits{}
+
+// called by the state map when a flow is added or removed
+func ( l *flow_limits ) addFlow( n int64 ) {
+
+	cur := atomic.AddInt64( &l.inFlight, n )
+	for {
+		high := atomic.LoadInt64( &l.flowsHigh )
+		if cur <= high || atomic.CompareAndSwapInt64( &l.flowsHigh, high, cur ) {
+			return
+		}
+	}
+}
+
+func ( l *flow_limits ) sampleHeap() {
+
+	sample := []metrics.Sample{ { Name: HEAP_METRIC } }
+	for {
+		metrics.Read( sample )
+		if sample[0].Value.Kind() == metrics.KindUint64 {
+			heap := sample[0].Value.Uint64()
+			atomic.StoreUint64( &l.heap, heap )
+			if heap > atomic.LoadUint64( &l.heapHigh ) {
+				atomic.StoreUint64( &l.heapHigh, heap )
+			}
+		}
+		time.Sleep( HEAP_SAMPLE )
+	}
+}
+
+func ( l *flow_limits ) over( queued int ) bool {
+
+	if max := getMaxFlows(); max > 0 && atomic.LoadInt64( &l.inFlight ) + int64(queued) >= int64(max) {
+		return true
+	}
+	if max := getMaxMemoryMB(); max > 0 && atomic.LoadUint64( &l.heap ) >= uint64(max) << 20 {
+		return true
+	}
+	return false
+}
+
+/* whether to hand one more target to the workers. blocks while over
+ * a limit, unless shedding load, when it counts the target as dropped.
+ */
+func ( l *flow_limits ) admit( incoming chan *packet_metadata ) bool {
+
+	if !l.over( len(incoming) ) {
+		return true
+	}
+	if getOverload() == OVERLOAD_DROP {
+		atomic.AddInt64( &l.dropped, 1 )
+		return false
+	}
+	start := time.Now()
+	for l.over( len(incoming) ) {
+		time.Sleep( LIMIT_POLL )
+	}
+	atomic.AddInt64( &l.blocked, int64( time.Since( start ) ) )
+	return true
+}
+
+// capacity of the input channel, never more than may be in flight
+func incomingQueueSize() int32 {
+
+	if max := getMaxFlows(); max > 0 && int32(max) < QUEUE_SIZE {
+		return int32(max)
+	}
+	return QUEUE_SIZE
+}
+
+func ( l *flow_limits ) summarize( s *summary ) {
+
+	s.FlowsHighWater = atomic.LoadInt64( &l.flowsHigh )
+	s.HeapHighWaterMB = atomic.LoadUint64( &l.heapHigh ) >> 20
+	s.InputDropped = atomic.LoadInt64( &l.dropped )
+	s.InputBlocked = time.Duration( atomic.LoadInt64( &l.blocked ) ).Seconds()
+}
@@ -4,11 +4,13 @@ go 1.18
 
 require (
 	github.com/google/gopacket v1.1.19
+	github.com/mattn/go-sqlite3 v1.14.17
+	golang.org/x/net v0.11.0
+	golang.org/x/sys v0.9.0
 	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
 )
 
 require (
-	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -41,6 +41,12 @@ writingQueue  chan *packet_metadata, toACK bool, toPUSH bool, expectedResponse s
 	handshakeNum := ipMeta.getHandshake(synack)
 	handshake, _ := GetHandshake( opts.Handshakes[ handshakeNum ] )
 
+	//a conversation rather than one payload, probes get the payload
+	if sh, ok := handshake.( SessionHandshake ); ok && !synack.HyperACKtive && !ipMeta.getHyperACKtiveStatus( synack ) {
+		startSession( opts, sh, synack, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+
 	//Send Ack with Data
 	ack, payload := constructData( handshake, synack, toACK, toPUSH )//true, false )
 	//add to map
@@ -48,11 +54,13 @@ writingQueue  chan *packet_metadata, toACK bool, toPUSH bool, expectedResponse s
 	synack.updateResponseL( payload )
 	synack.updateTimestamp()
 	ipMeta.update( synack )
-	err := handle.WritePacketData(ack)
+	ipMeta.updatePayloadL( synack, len(payload) )
+	err := ack.send()
 	if err != nil {
 		log.Fatal(err)
 		panic(err)
 	}
+	ipMeta.markDataSent( synack, synack.Counter > 0 )
 
 	synack.updateTimestamp()
 	retransmitQueue <-synack
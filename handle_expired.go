@@ -25,15 +25,15 @@ func handleExpired( opts *options, packet * packet_metadata, ipMeta * pState,
 
 	// first close the existing connection unless
 	// its already been terminated
-	if !( packet.RST && !packet.ACK ) && !(packet.ExpectedRToLZR == SYN_ACK) {
+	if !( packet.RST && !packet.ACK ) && !(packet.ExpectedRToLZR == SYN_ACK) && !packet.isUDP() {
 
-		rst := constructRST( packet )
-		_ = handle.WritePacketData( rst )
+		_ = constructRST( packet ).send()
 
 	}
 
 	//grab which handshake
 	handshakeNum := ipMeta.getHandshake( packet )
+	ipMeta.recordAttempt( packet )
 
 	//if we are all not trying anymore handshakes, so sad.
 	//because:
@@ -41,24 +41,30 @@ func handleExpired( opts *options, packet * packet_metadata, ipMeta * pState,
 	//2. we have run out of handshakes
 	//3. doesnt synack 
 	//if ( packet.ExpectedRToLZR == SYN_ACK ||
+	//4. the host cache says the host will not tell us more
 	if ( packet.HyperACKtive  || (handshakeNum >= (len( opts.Handshakes ) - 1)) ||
-		(packet.ExpectedRToLZR == SYN_ACK  && !ForceAllHandshakes() )){
+		(packet.ExpectedRToLZR == SYN_ACK  && !ForceAllHandshakes() ) ||
+		!hostAllowsHandshake( packet, len( opts.Handshakes ) - 1 - handshakeNum ) ){
 
 		packet.syncHandshakeNum( handshakeNum )
 
 		//document failure if its a handshake response that hasnt succeeded before
-		if !packet.HyperACKtive && !( ForceAllHandshakes() && ipMeta.getData( packet ) && !(packet.hasData())) {
+		//(when aggregating this is the one record for the target)
+		toRecord := !packet.HyperACKtive && ( Aggregate() ||
+			!( ForceAllHandshakes() && ipMeta.getData( packet ) && !(packet.hasData())) )
 
-			if !(!(packet.hasData()) && RecordOnlyData()) {
+		//remove from state, we are done now
+		packet = ipMeta.remove( packet )
+
+		if toRecord {
+			hasData := packet.hasData() || ( Aggregate() && attemptsHaveData( packet.Attempts ) )
+			if !(!hasData && RecordOnlyData()) {
 				writingQueue <- packet
 			} else {
 				addToSummary(packet)
 			}
-
 		}
 
-		//remove from state, we are done now
-		packet = ipMeta.remove( packet )
 		if HyperACKtiveFiltering() {
 			packet.HyperACKtive = true
 			packet = ipMeta.remove( packet )
@@ -67,19 +73,30 @@ func handleExpired( opts *options, packet * packet_metadata, ipMeta * pState,
 
 
 		//record all succesful fingerprints if forcing all handshakes
-		if ForceAllHandshakes() && packet.hasData() {
+		if ForceAllHandshakes() && packet.hasData() && !Aggregate() {
 			packet.syncHandshakeNum( handshakeNum )
 			writingQueue <- packet
 		}
 
+		ipMeta.renewSource( packet )
 		packet.updatePacketFlow()
 		ipMeta.incHandshake( packet )
-		SendSyn( packet, ipMeta, timeoutQueue )
+		sendHandshake( opts, packet, ipMeta, timeoutQueue )
 
 		//lets also filter for HyperACKtive hosts
-		if ( handshakeNum == 0 &&  HyperACKtiveFiltering() ) {
-			for i := 0; i < getNumFilters(); i++ {
-				highPortPacket := createFilterPacket( packet )
+		//unless this host already has a verdict
+		if ( handshakeNum == 0 &&  HyperACKtiveFiltering() && !packet.isUDP() ) {
+			if v, ok := cachedMiddlebox( packet.targetAddr() ); ok {
+				ipMeta.setMiddlebox( packet, v )
+				return
+			}
+			if !hostAllowsProbes( packet, getNumFilters() ) {
+				return
+			}
+			ports := probePorts( ipMeta, packet, getNumFilters() )
+			ipMeta.recordProbesSent( packet, ports )
+			for _, port := range ports {
+				highPortPacket := createFilterPacket( packet, port )
 				SendSyn( highPortPacket, ipMeta, timeoutQueue )
 				ipMeta.incHandshake( highPortPacket )
 				ipMeta.setHyperACKtiveStatus( highPortPacket )
@@ -24,12 +24,12 @@ import (
 func closeConnection( packet *packet_metadata, ipMeta * pState, writingQueue chan *packet_metadata, write bool, ackingFirewall bool ) {
 
 	//close connection
-	rst := constructRST(packet)
-	err := handle.WritePacketData(rst)
+	err := constructRST(packet).send()
 	if err != nil {
 		log.Fatal(err)
 	}
 	//remove from state, we are done now
+	ipMeta.recordAttempt(packet)
 	packet = ipMeta.remove(packet)
 	if write {
 		packet.setHyperACKtive(ackingFirewall)
@@ -44,9 +44,32 @@ func closeConnection( packet *packet_metadata, ipMeta * pState, writingQueue cha
 }
 
 
+// the host answered the current handshake, packet.Data is the answer
+func finishResponse( opts *options, packet *packet_metadata, ipMeta * pState, handshakeNum int,
+	timeoutQueue chan *packet_metadata, writingQueue chan *packet_metadata, isHyperACKtive bool ) {
+
+	packet.updateResponse(DATA)
+	ipMeta.updateData( packet )
+
+	// if not stopping here, send off to handle_expire
+	if ForceAllHandshakes() {
+		handleExpired( opts,packet, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+
+	packet.syncHandshakeNum( handshakeNum )
+
+	closeConnection( packet, ipMeta, writingQueue, true,  isHyperACKtive)
+}
+
+
 func HandlePcap( opts *options, packet *packet_metadata, ipMeta * pState, timeoutQueue	chan *packet_metadata,
 	retransmitQueue chan *packet_metadata, writingQueue chan *packet_metadata ) {
 
+	//flows running a SessionHandshake are driven by the session
+	if sessions.deliver( packet ) {
+		return
+	}
 
 	//verify
 	verified := ipMeta.verifyScanningIP( packet )
@@ -57,28 +80,41 @@ func HandlePcap( opts *options, packet *packet_metadata, ipMeta * pState, timeou
 		timeoutQueue <-packet
 		return
 	}
+	packet.formatAddrs()
+
+	if packet.isUDP() {
+		handleUDP( opts, packet, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+
+	if packet.ICMPError != "" {
+		handleICMPError( packet, ipMeta, writingQueue )
+		return
+	}
 
 	isHyperACKtive := ipMeta.getHyperACKtiveStatus( packet )
 	handshakeNum := ipMeta.getHandshake( packet )
 
+	if isHyperACKtive {
+		handleProbe( opts, packet, ipMeta, timeoutQueue, retransmitQueue, writingQueue )
+		return
+	}
+
 	//for every ack received, mark as accepting data
 	if (!packet.SYN) && packet.ACK {
 		ipMeta.updateAck( packet )
 	}
 	 //exit condition
 	 if len(packet.Data) > 0 {
-		packet.updateResponse(DATA)
-		ipMeta.updateData( packet )
-
-		// if not stopping here, send off to handle_expire
-		if ForceAllHandshakes() {
-			handleExpired( opts,packet, ipMeta, timeoutQueue, writingQueue )
+		ipMeta.markFirstByte( packet )
+		if handshakeNum == 1 && HyperACKtiveFiltering() {
+			ipMeta.recordRealData( packet )
+		}
+		//some handshakes need more than the first segment
+		if !collectResponse( opts, packet, ipMeta, handshakeNum, timeoutQueue ) {
 			return
 		}
-
-		packet.syncHandshakeNum( handshakeNum )
-
-		closeConnection( packet, ipMeta, writingQueue, true,  isHyperACKtive)
+		finishResponse( opts, packet, ipMeta, handshakeNum, timeoutQueue, writingQueue, isHyperACKtive )
 		return
 
 	}
@@ -96,7 +132,10 @@ func HandlePcap( opts *options, packet *packet_metadata, ipMeta * pState, timeou
      if handshakeNum == 1 && HyperACKtiveFiltering() && !isHyperACKtive {
 			//fmt.Println( ipMeta.getEphemeralRespNum( packet ) )
 			//fmt.Println(getNumFilters())
-            if ipMeta.getEphemeralRespNum( packet )   > getNumFilters() {
+            //a cached verdict from an earlier port needs no probes
+            v := ipMeta.middleboxVerdict( packet, false )
+            if v != nil && ( v.Cached || ipMeta.getEphemeralRespNum( packet ) > ipMeta.getProbesSent( packet ) ) &&
+				v.ackingFirewall() {
                 closeConnection( packet, ipMeta, writingQueue, true, true)
 				return
             }
@@ -117,19 +156,11 @@ func HandlePcap( opts *options, packet *packet_metadata, ipMeta * pState, timeou
 	//for every s/a send the appropriate ack
 	if packet.SYN && packet.ACK {
 
-		if  handshakeNum == 1 && HyperACKtiveFiltering() {
-
-			//just close and record
-			if isHyperACKtive {
+		ipMeta.markSynAck( packet )
 
-                parentSport := ipMeta.getParentSport( packet )
-
-				ipMeta.incEphemeralResp( packet, parentSport )
-				closeConnection( packet, ipMeta, writingQueue, false, isHyperACKtive)
-				return
-			} else {
-				ipMeta.incEphemeralResp( packet, packet.Sport )
-			}
+		if  handshakeNum == 1 && HyperACKtiveFiltering() {
+			ipMeta.incEphemeralResp( packet, packet.Sport )
+			ipMeta.recordRealSynAck( packet )
 		}
 		toACK := true
 		toPUSH := false
@@ -24,13 +24,13 @@ func SendSyn(packet * packet_metadata, ipMeta * pState,
 		packet.updateResponse( SYN_ACK )
 		packet.updateTimestamp()
 		ipMeta.update( packet )
-		syn := constructSYN( packet )
 		// send SYN packet if so and start the whole process again
-		err := handle.WritePacketData(syn)
+		err := constructSYN( packet ).send()
 		if err != nil {
 			panic(err)
 
 		}
+		ipMeta.markSynSent( packet, packet.Counter > 0 )
 		//wait for a s/a
 		packet.updateTimestamp()
 		ipMeta.FinishProcessing( packet )
@@ -31,12 +31,29 @@ func HandleTimeout( opts *options, packet *packet_metadata, ipMeta * pState,
 		//fmt.Println("packet has already been dealt with in handle timeout! returning!")
         return
     }
+	packet.formatAddrs()
 
+	//a session keeps its own time and finishes the flow itself
+	if sessions.running( packet ) {
+		return
+	}
+
+	//a response stopped coming in part way, keep what arrived
+	if data, ok := ipMeta.partialResponse( packet ); ok {
+		packet.Data = data
+		finishResponse( opts, packet, ipMeta, ipMeta.getHandshake( packet ), timeoutQueue, writingQueue,
+			ipMeta.getHyperACKtiveStatus( packet ) )
+		return
+	}
 
     //send again with just data (not apart of handshake)
     if ( packet.Counter < opts.RetransmitNum ) && !packet.HyperACKtive {
             packet.incrementCounter()
 
+		if packet.isUDP() {
+			SendUDP( opts, packet, ipMeta, timeoutQueue )
+			return
+		}
 		if ( packet.ExpectedRToLZR == ACK || packet.ExpectedRToLZR == DATA ) {
 			// pass in timeoutQ as retransmitQ to start the timeout clock
 			SendAck( opts, packet, ipMeta, timeoutQueue, timeoutQueue, writingQueue,
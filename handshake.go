@@ -16,14 +16,16 @@ limitations under the License.
 package lzr
 
 import (
-	//"fmt"
+	"sort"
 	"strings"
 )
 
 var (
 
 	handshakes map[string]Handshake
+	handshakeNames	[]string
 	fingerprintMap  map[string]int
+	handshakeWrappers	map[string]HandshakeWrapper
 )
 type Handshake interface {
 
@@ -34,8 +36,28 @@ type Handshake interface {
 
 }
 
+/* StreamingHandshake is for handshakes whose response spans several
+ * segments, e.g. a TLS certificate chain. LZR keeps acknowledging
+ * data until Complete says everything received so far is enough.
+ */
+type StreamingHandshake interface {
+	Complete( data string ) bool
+}
+
+/* MetadataHandshake is for handshakes that extract more than a
+ * fingerprint from their response. the result must marshal to json,
+ * nil for nothing.
+ */
+type MetadataHandshake interface {
+	Metadata( data string ) interface{}
+}
+
 func AddHandshake( name string, h Handshake ) {
 
+	if _, ok := handshakes[ name ]; !ok {
+		handshakeNames = append( handshakeNames, name )
+		sort.Strings( handshakeNames )
+	}
 	handshakes[ name ] = h
 
 }
@@ -45,77 +67,88 @@ func GetHandshake( name string ) (Handshake,bool) {
 	return h,ok
 }
 
-// implement a hiearchy where when responses match
-// for two fingerprints, we choose the more specific one
-// e.g., protocols implemented on http
-func hiearchizeFingerprint( fingerprint string ) string {
+/* HandshakeWrapper runs a registered handshake inside something else:
+ * registered under "tls", it makes "tls/http" http inside TLS. it is
+ * given the inner handshake and its name.
+ */
+type HandshakeWrapper func( name string, inner Handshake ) Handshake
 
+func AddHandshakeWrapper( prefix string, wrap HandshakeWrapper ) {
+	handshakeWrappers[ prefix ] = wrap
+}
 
-	// prioritize for the handshake being sent
-	// or for handshake which was asked to be prioritized
-	// so if scanning for http ipp will return as http
-	// but if scanning for ipp then http+ipp will return ipp
+/* the named handshake, wrapping "prefix/inner" on first use. wrapped
+ * handshakes are not among those matched against every response, the
+ * wrapper fingerprints what it sees itself.
+ */
+func resolveHandshake( name string ) ( Handshake, bool ) {
 
-	req_handshakes := GetAllHandshakes()
-	for  _, h := range req_handshakes {
-		if strings.Contains( fingerprint, h ) {
-			return h
-		}
+	if h, ok := GetHandshake( name ); ok {
+		return h, true
 	}
+	i := strings.Index( name, "/" )
+	if i < 0 {
+		return nil, false
+	}
+	wrap, ok := handshakeWrappers[ name[:i] ]
+	if !ok {
+		return nil, false
+	}
+	inner, ok := resolveHandshake( name[i+1:] )
+	if !ok {
+		return nil, false
+	}
+	h := wrap( name[i+1:], inner )
+	handshakes[ name ] = h
+	return h, true
+}
 
-
-	if strings.Contains( fingerprint, "ipp" ) {
-		return "ipp"
-	} else if strings.Contains( fingerprint, "kubernetes") {
-		return "kubernetes"
-	} else if (strings.Contains( fingerprint, "dns") &&
-		strings.Contains( fingerprint, "http")) {
-		return "http"
-	}else if (strings.Contains( fingerprint, "ssh") &&
-		strings.Contains( fingerprint, "http")) {
-		return "http"
-	}else if (strings.Contains( fingerprint, "ftp") &&
-		strings.Contains( fingerprint, "http")) {
-		return "http"
-	}else if (strings.Contains( fingerprint, "ftp") &&
-		strings.Contains( fingerprint, "ssh")) {
-		return "ssh"
-	//probs tls with HTTPS text
-	} else if (strings.Contains( fingerprint, "tls") &&
-		strings.Contains( fingerprint, "http")) {
-		return "tls"
-	} else {
-		//fmt.Println("WARNING: NEW MULTI-FINGERPRINT:", fingerprint)
-		return fingerprint
+// matchFingerprints returns every fingerprint the registered
+// handshakes see in data, sorted so resolution is deterministic
+func matchFingerprints( data string ) []string {
+	seen := make( map[string]bool )
+	for _, name := range handshakeNames {
+		if f := handshakes[name].Verify( data ); f != "" {
+			seen[f] = true
+		}
 	}
+	return sortedCandidates( seen )
+}
 
+// matchFingerprint is fingerprintResponse without counting
+// towards the fingerprint summary
+func matchFingerprint( data string ) string {
+	return resolveFingerprint( matchFingerprints( data ) )
+}
+
+// MatchFingerprint is what LZR makes of data, for handshakes that
+// fingerprint what they find inside a response themselves
+func MatchFingerprint( data string ) string {
+	return matchFingerprint( data )
 }
 
 func fingerprintResponse( data string ) string {
-	fingerprint := ""
-	tfingerprint := ""
-	multiprint := false
-	for _, hand := range handshakes {
-		tfingerprint = hand.Verify( data )
-		if tfingerprint != "" {
-			//concat fingerprints together 
-			if fingerprint == "" {
-				fingerprint += tfingerprint
-			} else {
-				multiprint = true
-				fingerprint += ("-" + tfingerprint)
-			}
+	fingerprint := matchFingerprint( data )
+	fingerprintMap[fingerprint] += 1
+	return fingerprint
+}
 
-		}
+// what the named handshake extracts from its response, if anything
+func handshakeMetadata( name string, data string ) map[string]interface{} {
+
+	h, ok := GetHandshake( name )
+	if !ok || data == "" {
+		return nil
 	}
-	if multiprint {
-		fingerprint = hiearchizeFingerprint( fingerprint )
+	mh, ok := h.( MetadataHandshake )
+	if !ok {
+		return nil
 	}
-	if fingerprint == "" {
-		fingerprint = "unknown"
+	m := mh.Metadata( data )
+	if m == nil {
+		return nil
 	}
-	fingerprintMap[fingerprint] += 1
-	return fingerprint
+	return map[string]interface{}{ name: m }
 }
 
 func GetFingerprints() map[string]int {
@@ -124,5 +157,6 @@ func GetFingerprints() map[string]int {
 
 func init() {
 	handshakes = make( map[string]Handshake )
+	handshakeWrappers = make( map[string]HandshakeWrapper )
 	fingerprintMap = make( map[string]int )
 }
@@ -0,0 +1,92 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+/* handshake_attempt records what happened to one handshake
+ * tried against a target, so a single result can carry the whole trail
+ */
+type handshake_attempt struct {
+	Handshake			string		`json:"handshake"`
+	PayloadLength		int			`json:"payload_length"`
+	Outcome				string		`json:"outcome"`
+	Data				string		`json:"data,omitempty"`
+	Fingerprint			string		`json:"fingerprint,omitempty"`
+	Candidates			[]string	`json:"candidates,omitempty"`
+}
+
+func newHandshakeAttempt( packet *packet_metadata, handshake string, payloadL int ) handshake_attempt {
+
+	attempt := handshake_attempt{
+		Handshake: handshake,
+		PayloadLength: payloadL,
+		Outcome: packetOutcome( packet ),
+		Data: packet.Data,
+	}
+	if packet.hasData() {
+		attempt.Candidates = packet.candidates()
+		attempt.Fingerprint = resolveFingerprint( attempt.Candidates )
+	}
+	return attempt
+}
+
+// close out the current handshake of this flow
+func ( ipMeta * pState ) recordAttempt( p *packet_metadata ) bool {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		attempt := newHandshakeAttempt( p, getHandshakeName( ps.HandshakeNum ), ps.PayloadL )
+		e := ps.extra()
+		e.Attempts = append( e.Attempts, attempt )
+		ps.PayloadL = 0
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+func ( ipMeta * pState ) updatePayloadL( p *packet_metadata, l int ) bool {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		ps.PayloadL = l
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+// the final fingerprint of a target is resolved over
+// everything any of its handshakes matched
+func reconcileFingerprints( attempts []handshake_attempt ) ( string, []string ) {
+
+	seen := make( map[string]bool )
+	for _, a := range attempts {
+		for _, c := range a.Candidates {
+			seen[c] = true
+		}
+	}
+	candidates := sortedCandidates( seen )
+	return resolveFingerprint( candidates ), candidates
+}
+
+func attemptsHaveData( attempts []handshake_attempt ) bool {
+	for _, a := range attempts {
+		if a.Outcome == OUTCOME_DATA {
+			return true
+		}
+	}
+	return false
+}
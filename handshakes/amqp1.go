@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/amqp1"
+
+func init() {
+	amqp1.RegisterHandshake()
+}
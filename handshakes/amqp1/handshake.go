@@ -0,0 +1,40 @@
+package amqp1
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return protocolHeader()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseHeader( []byte(data) ) != nil {
+		return "amqp1"
+	}
+	return ""
+}
+
+// read the SASL mechanisms behind the header (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// protocol, SASL mechanisms and the broker's product (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseHeader( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "amqp1", &h )
+	//the 0-9-1 handshake matches any "AMQP"
+	lzr.AddFingerprintRule( "amqp1", lzr.OVERRIDES, "amqp" )
+}
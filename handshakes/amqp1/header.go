@@ -0,0 +1,215 @@
+package amqp1
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/* AMQP 1.0 opens with a protocol header, "AMQP", a protocol id and the
+ * version: 0 for AMQP itself, 2 for TLS, 3 for SASL. LZR offers plain
+ * AMQP 1.0.0, and a broker answers with the header it wants:
+ *
+ *   "AMQP" 03 01 00 00                     SASL first
+ *   00 00 00 22 02 01 00 00  00 53 40 c0 15 01 e0 12 02 a3
+ *   05 "PLAIN" 09 "ANONYMOUS"              sasl-mechanisms
+ *
+ * 0-9-1 brokers answer with "AMQP" 00 00 09 01 instead. frames are a
+ * big endian size, data offset (in 4 byte words), type and channel,
+ * and their body is a described list: 00 53 <code> then the list.
+ * an open (0x10) holds the container id and, in its properties map,
+ * the broker's product and version.
+ */
+const (
+	HEADER_LEN			int = 8
+	FRAME_HEADER_LEN	int = 8
+
+	PROTOCOL_AMQP		byte = 0
+	PROTOCOL_TLS		byte = 2
+	PROTOCOL_SASL		byte = 3
+
+	DESCRIPTOR_OPEN		byte = 0x10
+	DESCRIPTOR_SASL_MECHANISMS	byte = 0x40
+
+	TYPE_STR8			byte = 0xa1
+	TYPE_STR32			byte = 0xb1
+	TYPE_SYM8			byte = 0xa3
+	TYPE_SYM32			byte = 0xb3
+	TYPE_LIST8			byte = 0xc0
+	TYPE_LIST32			byte = 0xd0
+	TYPE_ARRAY8			byte = 0xe0
+	TYPE_ARRAY32		byte = 0xf0
+)
+
+var protocolNames = map[byte]string{
+	PROTOCOL_AMQP: "amqp",
+	PROTOCOL_TLS: "tls",
+	PROTOCOL_SASL: "sasl",
+}
+
+type amqp1_metadata struct {
+	Protocol		string		`json:"protocol"`
+	Version			string		`json:"version"`
+	SASLMechanisms	[]string	`json:"sasl_mechanisms,omitempty"`
+	ContainerID		string		`json:"container_id,omitempty"`
+	Product			string		`json:"product,omitempty"`
+	ProductVersion	string		`json:"product_version,omitempty"`
+}
+
+func protocolHeader() []byte {
+	return []byte{ 'A', 'M', 'Q', 'P', PROTOCOL_AMQP, 1, 0, 0 }
+}
+
+// a str8/32 or sym8/32 at the start of b, and what follows it
+func readString( b []byte ) ( string, []byte, bool ) {
+
+	if len(b) < 2 {
+		return "", nil, false
+	}
+	switch b[0] {
+	case TYPE_STR8, TYPE_SYM8:
+		l := int( b[1] )
+		if len(b) < 2 + l {
+			return "", nil, false
+		}
+		return string( b[2:2+l] ), b[2+l:], true
+	case TYPE_STR32, TYPE_SYM32:
+		if len(b) < 5 {
+			return "", nil, false
+		}
+		l := int( binary.BigEndian.Uint32( b[1:5] ) )
+		if l < 0 || len(b) < 5 + l {
+			return "", nil, false
+		}
+		return string( b[5:5+l] ), b[5+l:], true
+	}
+	return "", nil, false
+}
+
+// the elements of a described list body (00 53 code, list), from the list on
+func listElements( body []byte ) ( byte, []byte, bool ) {
+
+	if len(body) < 4 || body[0] != 0x00 || body[1] != 0x53 {
+		return 0, nil, false
+	}
+	code := body[2]
+	list := body[3:]
+	switch {
+	case list[0] == TYPE_LIST8 && len(list) >= 3:
+		return code, list[3:], true
+	case list[0] == TYPE_LIST32 && len(list) >= 9:
+		return code, list[9:], true
+	}
+	return code, nil, false
+}
+
+// sasl-server-mechanisms: one symbol or an array of them
+func mechanisms( b []byte ) []string {
+
+	if len(b) == 0 {
+		return nil
+	}
+	if s, _, ok := readString( b ); ok {
+		return []string{ s }
+	}
+	var count int
+	switch {
+	case b[0] == TYPE_ARRAY8 && len(b) >= 4:
+		count, b = int( b[2] ), b[3:]
+	case b[0] == TYPE_ARRAY32 && len(b) >= 10:
+		count, b = int( binary.BigEndian.Uint32( b[5:9] ) ), b[9:]
+	default:
+		return nil
+	}
+	//one constructor, then the bare elements
+	constructor := b[0]
+	b = b[1:]
+	var mechs []string
+	for ; count > 0; count-- {
+		s, rest, ok := readString( append( []byte{ constructor }, b... ) )
+		if !ok {
+			break
+		}
+		mechs = append( mechs, s )
+		b = rest
+	}
+	return mechs
+}
+
+// the string value following the symbol key in a properties map
+func property( b []byte, key string ) string {
+
+	needle := append( []byte{ TYPE_SYM8, byte(len(key)) }, key... )
+	for i := 0; i + len(needle) <= len(b); i++ {
+		if string( b[i:i+len(needle)] ) == string(needle) {
+			if s, _, ok := readString( b[i+len(needle):] ); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func ( m *amqp1_metadata ) readFrame( frame []byte ) {
+
+	doff := int( frame[4] ) * 4
+	if doff < FRAME_HEADER_LEN || doff > len(frame) {
+		return
+	}
+	code, elements, ok := listElements( frame[doff:] )
+	if !ok {
+		return
+	}
+	switch code {
+	case DESCRIPTOR_SASL_MECHANISMS:
+		m.SASLMechanisms = mechanisms( elements )
+	case DESCRIPTOR_OPEN:
+		if id, _, ok := readString( elements ); ok {
+			m.ContainerID = id
+		}
+		m.Product = property( elements, "product" )
+		m.ProductVersion = property( elements, "version" )
+	}
+}
+
+// nil unless data starts with an AMQP 1.0 protocol header
+func parseHeader( data []byte ) *amqp1_metadata {
+
+	if len(data) < HEADER_LEN || string( data[0:4] ) != "AMQP" {
+		return nil
+	}
+	name, ok := protocolNames[ data[4] ]
+	if !ok || data[5] != 1 || data[6] != 0 {
+		return nil
+	}
+	m := &amqp1_metadata{
+		Protocol: name,
+		Version: fmt.Sprintf( "%d.%d.%d", data[5], data[6], data[7] ),
+	}
+	frames := data[HEADER_LEN:]
+	for len(frames) >= FRAME_HEADER_LEN {
+		size := int( binary.BigEndian.Uint32( frames[0:4] ) )
+		if size < FRAME_HEADER_LEN || size > len(frames) {
+			break
+		}
+		m.readFrame( frames[:size] )
+		frames = frames[size:]
+	}
+	return m
+}
+
+// after a SASL header, wait for the mechanisms frame behind it
+func answered( data []byte ) bool {
+
+	if len(data) < HEADER_LEN {
+		n := len(data)
+		if n > 4 {
+			n = 4
+		}
+		return string( data[:n] ) != "AMQP"[:n]
+	}
+	if m := parseHeader( data ); m == nil || m.Protocol != "sasl" {
+		return true
+	}
+	frames := data[HEADER_LEN:]
+	return len(frames) >= 4 && len(frames) >= int( binary.BigEndian.Uint32( frames[0:4] ) )
+}
@@ -0,0 +1,80 @@
+package amqp1
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/amqp"
+)
+
+func unhex( s string ) []byte {
+	b, err := hex.DecodeString( s )
+	if err != nil {
+		panic( err )
+	}
+	return b
+}
+
+var (
+	//SASL first, offering PLAIN and ANONYMOUS
+	saslHeader = unhex( "414d515003010000" +
+		"0000002202010000" + "005340c01501e01202a305504c41494e09414e4f4e594d4f5553" )
+	//plain AMQP and an open from ActiveMQ Artemis
+	openFrame = unhex( "414d515000010000" +
+		"0000005c02000000005310c04f0aa10862726f6b65722d3140700001000060ffff4040404040c13404" +
+		"a30770726f64756374a1176170616368652d6163746976656d712d617274656d6973" +
+		"a30776657273696f6ea106322e33312e32" )
+	//a 0-9-1 broker's own header
+	amqp091 = []byte( "AMQP\x00\x00\x09\x01" )
+)
+
+func TestParseHeader( t *testing.T ) {
+
+	m := parseHeader( saslHeader )
+	if m == nil || m.Protocol != "sasl" || m.Version != "1.0.0" || len(m.SASLMechanisms) != 2 ||
+		m.SASLMechanisms[0] != "PLAIN" || m.SASLMechanisms[1] != "ANONYMOUS" {
+		t.Errorf( "sasl: %+v", m )
+	}
+	m = parseHeader( openFrame )
+	if m == nil || m.Protocol != "amqp" || m.ContainerID != "broker-1" || m.Product != "apache-activemq-artemis" ||
+		m.ProductVersion != "2.31.2" {
+		t.Errorf( "open: %+v", m )
+	}
+	if m := parseHeader( unhex( "414d515002010000" ) ); m == nil || m.Protocol != "tls" {
+		t.Errorf( "tls: %+v", m )
+	}
+
+	var h HandshakeMod
+	for _, v := range [][]byte{ nil, saslHeader[:7], amqp091, []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ) } {
+		if m := parseHeader( v ); m != nil || h.Verify( string(v) ) != "" {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	//a header alone is all there is, its frames may be cut short
+	if m := parseHeader( saslHeader[:20] ); m == nil || m.SASLMechanisms != nil {
+		t.Errorf( "truncated: %+v", m )
+	}
+	for i := range openFrame {
+		parseHeader( openFrame[:i] )
+	}
+	if answered( saslHeader[:3] ) || answered( saslHeader[:20] ) || !answered( saslHeader ) ||
+		!answered( amqp091 ) || !answered( openFrame[:8] ) {
+		t.Error( "answered" )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	amqp.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		string(saslHeader): "amqp1",
+		string(openFrame): "amqp1",
+		string(amqp091): "amqp",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package bacnet
+
+import (
+	"encoding/binary"
+)
+
+/* BACnet/IP (Annex J) puts a BVLC header in front of every NPDU: type
+ * 0x81, function, big endian length counting the header. LZR sends an
+ * Original-Unicast-NPDU holding a confirmed ReadProperty of the
+ * Device object's vendor-name (121), addressed to the wildcard instance
+ * 4194303 so any device answers:
+ *
+ *   81 0a 00 11  01 04  00 05 01 0c  0c 02 3f ff ff  19 79
+ *
+ * a device answers with a ComplexACK naming itself and the vendor:
+ *
+ *   81 0a 00 1c  01 00  30 01 0c  0c 02 00 00 64  19 79
+ *   3e 75 08 00 "Siemens" 3f
+ *
+ * or with an Error, Reject or Abort PDU. the same bytes go over TCP
+ * and UDP.
+ */
+const (
+	BVLC_TYPE			byte = 0x81
+	BVLC_RESULT			byte = 0x00
+	BVLC_UNICAST		byte = 0x0a
+	BVLC_BROADCAST		byte = 0x0b
+	BVLC_FORWARDED		byte = 0x04
+	BVLC_HEADER_LEN		int = 4
+
+	NPDU_VERSION		byte = 0x01
+	NPDU_NETWORK_MSG	byte = 0x80
+	NPDU_DNET			byte = 0x20
+	NPDU_SNET			byte = 0x08
+
+	PDU_COMPLEX_ACK		byte = 3
+	PDU_ERROR			byte = 5
+	PDU_REJECT			byte = 6
+	PDU_ABORT			byte = 7
+
+	SERVICE_READ_PROPERTY	byte = 12
+	PROPERTY_VENDOR_NAME	byte = 121
+	TAG_CHARACTER_STRING	byte = 7
+	OBJECT_DEVICE		uint32 = 8
+)
+
+var readVendorName = []byte{
+	BVLC_TYPE, BVLC_UNICAST, 0x00, 0x11,
+	NPDU_VERSION, 0x04,
+	0x00, 0x05, 0x01, SERVICE_READ_PROPERTY,
+	0x0c, 0x02, 0x3f, 0xff, 0xff,
+	0x19, PROPERTY_VENDOR_NAME,
+}
+
+var pduNames = map[byte]string{
+	PDU_COMPLEX_ACK: "complex_ack",
+	PDU_ERROR: "error",
+	PDU_REJECT: "reject",
+	PDU_ABORT: "abort",
+}
+
+type bacnet_metadata struct {
+	BVLCFunction	byte		`json:"bvlc_function"`
+	PDU				string		`json:"pdu,omitempty"`
+	DeviceInstance	*uint32		`json:"device_instance,omitempty"`
+	VendorName		string		`json:"vendor_name,omitempty"`
+	ErrorClass		*byte		`json:"error_class,omitempty"`
+	ErrorCode		*byte		`json:"error_code,omitempty"`
+	Reason			*byte		`json:"reason,omitempty"`
+}
+
+// skips the NPDU, nil for network layer messages
+func apdu( npdu []byte ) []byte {
+
+	if len(npdu) < 2 || npdu[0] != NPDU_VERSION || npdu[1] & NPDU_NETWORK_MSG != 0 {
+		return nil
+	}
+	control := npdu[1]
+	rest := npdu[2:]
+	//DNET, DLEN and DADR, then SNET, SLEN and SADR, then the hop count
+	skipAddress := func() bool {
+		if len(rest) < 3 || len(rest) < 3 + int( rest[2] ) {
+			return false
+		}
+		rest = rest[3+int(rest[2]):]
+		return true
+	}
+	if control & NPDU_DNET != 0 && !skipAddress() {
+		return nil
+	}
+	if control & NPDU_SNET != 0 && !skipAddress() {
+		return nil
+	}
+	if control & NPDU_DNET != 0 {
+		if len(rest) < 1 {
+			return nil
+		}
+		rest = rest[1:]
+	}
+	return rest
+}
+
+// the character string value of a ReadProperty ack, from its tag on
+func characterString( b []byte ) string {
+
+	if len(b) < 2 || b[0] >> 4 != TAG_CHARACTER_STRING || b[0] & 0x08 != 0 {
+		return ""
+	}
+	l := int( b[0] & 0x07 )
+	b = b[1:]
+	if l == 5 {
+		l = int( b[0] )
+		b = b[1:]
+		if l == 254 && len(b) >= 2 {
+			l = int( binary.BigEndian.Uint16( b[0:2] ) )
+			b = b[2:]
+		}
+	}
+	//the first octet is the character set, 0 for UTF-8
+	if l < 1 || len(b) < l || b[0] != 0 {
+		return ""
+	}
+	return string( b[1:l] )
+}
+
+func ( m *bacnet_metadata ) readComplexAck( pdu []byte ) {
+
+	if len(pdu) < 3 || pdu[2] != SERVICE_READ_PROPERTY {
+		return
+	}
+	body := pdu[3:]
+	if len(body) >= 5 && body[0] == 0x0c {
+		id := binary.BigEndian.Uint32( body[1:5] )
+		if id >> 22 == OBJECT_DEVICE {
+			instance := id & 0x3fffff
+			m.DeviceInstance = &instance
+		}
+		body = body[5:]
+	}
+	//property identifier, then the value in an opening and closing tag
+	if len(body) >= 3 && body[0] == 0x19 && body[1] == PROPERTY_VENDOR_NAME && body[2] == 0x3e {
+		m.VendorName = characterString( body[3:] )
+	}
+}
+
+func parseResponse( data []byte ) *bacnet_metadata {
+
+	if len(data) < BVLC_HEADER_LEN || data[0] != BVLC_TYPE {
+		return nil
+	}
+	l := int( binary.BigEndian.Uint16( data[2:4] ) )
+	if l < BVLC_HEADER_LEN || l > len(data) {
+		return nil
+	}
+	data = data[:l]
+	m := &bacnet_metadata{ BVLCFunction: data[1] }
+	switch data[1] {
+	//a NAK of the NPDU, just a result code
+	case BVLC_RESULT:
+		if l != BVLC_HEADER_LEN + 2 {
+			return nil
+		}
+		return m
+	case BVLC_UNICAST, BVLC_BROADCAST:
+		data = data[BVLC_HEADER_LEN:]
+	//from a BBMD: the original source's address and port first
+	case BVLC_FORWARDED:
+		if len(data) < BVLC_HEADER_LEN + 6 {
+			return nil
+		}
+		data = data[BVLC_HEADER_LEN+6:]
+	default:
+		return nil
+	}
+	pdu := apdu( data )
+	if len(pdu) < 2 {
+		return nil
+	}
+	typ := pdu[0] >> 4
+	name, ok := pduNames[ typ ]
+	if !ok {
+		return m
+	}
+	m.PDU = name
+	switch typ {
+	case PDU_COMPLEX_ACK:
+		m.readComplexAck( pdu )
+	//enumerated error class and code, application tag 9
+	case PDU_ERROR:
+		if len(pdu) >= 7 && pdu[3] == 0x91 && pdu[5] == 0x91 {
+			m.ErrorClass, m.ErrorCode = &pdu[4], &pdu[6]
+		}
+	case PDU_REJECT, PDU_ABORT:
+		if len(pdu) >= 3 {
+			m.Reason = &pdu[2]
+		}
+	}
+	return m
+}
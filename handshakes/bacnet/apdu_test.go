@@ -0,0 +1,85 @@
+package bacnet
+
+import (
+	"testing"
+)
+
+var (
+	siemens = []byte( "\x81\x0a\x00\x1c\x01\x00\x30\x01\x0c\x0c\x02\x00\x00\x64\x19\x79\x3e\x75\x08\x00Siemens\x3f" )
+	unknownObject = []byte{ 0x81, 0x0a, 0x00, 0x0d, 0x01, 0x00, 0x50, 0x01, 0x0c, 0x91, 0x01, 0x91, 0x1f }
+	rejected = []byte{ 0x81, 0x0a, 0x00, 0x09, 0x01, 0x00, 0x60, 0x01, 0x09 }
+	nak = []byte{ 0x81, 0x00, 0x00, 0x06, 0x00, 0x30 }
+	//forwarded by a BBMD from 192.0.2.7:47808, with a source network
+	forwarded = []byte{ 0x81, 0x04, 0x00, 0x13, 0xc0, 0x00, 0x02, 0x07, 0xba, 0xc0,
+		0x01, 0x08, 0x00, 0x05, 0x01, 0x2a, 0x70, 0x01, 0x04 }
+)
+
+func TestParseResponse( t *testing.T ) {
+
+	m := parseResponse( siemens )
+	if m == nil || m.PDU != "complex_ack" || m.DeviceInstance == nil || *m.DeviceInstance != 100 ||
+		m.VendorName != "Siemens" {
+		t.Errorf( "complex ack: %+v", m )
+	}
+	m = parseResponse( unknownObject )
+	if m == nil || m.PDU != "error" || *m.ErrorClass != 1 || *m.ErrorCode != 31 {
+		t.Errorf( "error: %+v", m )
+	}
+	if m := parseResponse( rejected ); m == nil || m.PDU != "reject" || *m.Reason != 9 {
+		t.Errorf( "reject: %+v", m )
+	}
+	if m := parseResponse( nak ); m == nil || m.BVLCFunction != BVLC_RESULT || m.PDU != "" {
+		t.Errorf( "nak: %+v", m )
+	}
+	if m := parseResponse( forwarded ); m == nil || m.PDU != "abort" || *m.Reason != 4 {
+		t.Errorf( "forwarded: %+v", m )
+	}
+
+	var h HandshakeMod
+	for _, v := range [][]byte{
+		siemens[:3],
+		siemens[:20],
+		{ 0x81, 0x0a, 0x00, 0x02 },
+		{ 0x81, 0x0a, 0x00, 0x04 },
+		{ 0x81, 0x00, 0x00, 0x07, 0x00, 0x30, 0x00 },
+		{ 0x81, 0x05, 0x00, 0x06, 0x01, 0x00 },
+		//a network layer message
+		{ 0x81, 0x0a, 0x00, 0x08, 0x01, 0x80, 0x01, 0x00 },
+		//a DNET without its address
+		{ 0x81, 0x0a, 0x00, 0x09, 0x01, 0x20, 0x00, 0x05, 0x06 },
+		forwarded[:8],
+		readVendorName[:4],
+		[]byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ),
+	} {
+		if m := parseResponse( v ); m != nil || h.Verify( string(v) ) != "" {
+			t.Errorf( "%x: %+v", v, m )
+		}
+	}
+	for _, v := range [][]byte{ siemens, unknownObject, rejected, nak, forwarded } {
+		if h.Verify( string(v) ) != "bacnet" {
+			t.Errorf( "Verify(%x) is not bacnet", v )
+		}
+		for i := range v {
+			parseResponse( v[:i] )
+		}
+	}
+}
+
+func TestCharacterString( t *testing.T ) {
+
+	for b, s := range map[string]string{
+		"\x75\x08\x00Siemens": "Siemens",
+		"\x74\x00abc": "abc",
+		"\x75\xfe\x00\x04\x00abc": "abc",
+		//not UTF-8, not a character string, too short
+		"\x74\x04abc": "",
+		"\x24\x00abc": "",
+		"\x75\x08\x00Sie": "",
+		"\x75\xfe\x00": "",
+		"\x70": "",
+	} {
+		if got := characterString( []byte(b) ); got != s {
+			t.Errorf( "characterString(%x) = %q, want %q", b, got, s )
+		}
+	}
+}
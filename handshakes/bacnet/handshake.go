@@ -0,0 +1,35 @@
+package bacnet
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return readVendorName
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseResponse( []byte(data) ) != nil {
+		return "bacnet"
+	}
+	return ""
+}
+
+// device instance and vendor name, or why the read failed (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseResponse( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "bacnet", &h )
+	//memcached_binary takes anything starting with 0x81
+	lzr.AddFingerprintRule( "bacnet", lzr.OVERRIDES, "memcached_binary" )
+}
@@ -0,0 +1,89 @@
+package banner
+
+import (
+	"strings"
+)
+
+/* Classify attributes what a server sends unprompted, or in answer to
+ * a few newlines, to a protocol that has no handshake module of its
+ * own. the probe-only handshakes (wait, newlines, newlines50) verify
+ * with it, so those responses need not come back unknown.
+ *
+ * a rule matches a response that starts with prefix and contains one
+ * of contains (if any). each is listed with a response it matches.
+ */
+type rule struct {
+	fingerprint		string
+	prefix			string
+	contains		[]string
+}
+
+var rules = []rule{
+	// @RSYNCD: 31.0
+	{ "rsync", "@RSYNCD:", nil },
+	// :irc.example.net NOTICE * :*** Looking up your hostname...
+	{ "irc", ":", []string{ " NOTICE * :", " NOTICE AUTH :" } },
+	// NOTICE AUTH :*** Processing connection to irc.example.net
+	{ "irc", "NOTICE AUTH :", nil },
+	// <?xml version='1.0'?><stream:stream xmlns='jabber:client' ...
+	{ "xmpp", "<?xml", []string{ "<stream:stream", "<stream:error" } },
+	// <stream:error><not-well-formed xmlns=...
+	{ "xmpp", "<stream:", nil },
+	// SIP/2.0 400 Bad Request
+	{ "sip", "SIP/2.0 ", nil },
+	// JDWP-Handshake
+	{ "jdwp", "JDWP-Handshake", nil },
+	// OK MPD 0.23.5
+	{ "mpd", "OK MPD ", nil },
+	// # munin node at host.example.net
+	{ "munin", "# munin node at ", nil },
+	// 200 news.example.net InterNetNews NNRP server INN 2.6.4 ready (posting ok)
+	{ "nntp", "200 ", []string{ "NNTP", "NNRP" } },
+	// 201 news.example.net NNTP Service Ready, posting prohibited
+	{ "nntp", "201 ", []string{ "NNTP", "NNRP" } },
+	// ncacn_http/1.0
+	{ "msrpc", "ncacn_http/1.0", nil },
+	// \x13BitTorrent protocol...
+	{ "bittorrent", "\x13BitTorrent protocol", nil },
+	// INFO {"server_id":"NAB...","version":"2.10.4",...}
+	{ "nats", "INFO {", []string{ "\"server_id\"" } },
+	// UNKNOWN_COMMAND
+	{ "beanstalkd", "UNKNOWN_COMMAND\r\n", nil },
+	// UNKNOWN COMMAND
+	{ "clamav", "UNKNOWN COMMAND", nil },
+	// ERROR\nmessage:Unknown STOMP action...
+	{ "stomp", "ERROR", []string{ "\nmessage:" } },
+	// cvs [pserver aborted]: bad auth protocol start:
+	{ "cvspserver", "cvs [pserver aborted]", nil },
+	// Microsoft Windows [Version 10.0.17763.1]
+	{ "shell", "Microsoft Windows [Version ", nil },
+}
+
+func ( r rule ) match( data string ) bool {
+
+	if !strings.HasPrefix( data, r.prefix ) {
+		return false
+	}
+	if len(r.contains) == 0 {
+		return true
+	}
+	for _, c := range r.contains {
+		if strings.Contains( data, c ) {
+			return true
+		}
+	}
+	return false
+}
+
+// the fingerprint of the first rule data matches, "" for none
+func Classify( data string ) string {
+
+	//some servers greet with a blank line first
+	data = strings.TrimLeft( data, "\r\n" )
+	for _, r := range rules {
+		if r.match( data ) {
+			return r.fingerprint
+		}
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package banner
+
+import (
+	"testing"
+)
+
+// the responses the rules are listed with, and a few near misses
+func TestClassify( t *testing.T ) {
+
+	tests := []struct {
+		data			string
+		fingerprint		string
+	}{
+		{ "@RSYNCD: 31.0\n", "rsync" },
+		{ ":irc.example.net NOTICE * :*** Looking up your hostname...\r\n", "irc" },
+		{ "NOTICE AUTH :*** Processing connection to irc.example.net\r\n", "irc" },
+		{ "<?xml version='1.0'?><stream:stream xmlns='jabber:client'>", "xmpp" },
+		{ "<stream:error><not-well-formed xmlns='urn:ietf:params:xml:ns:xmpp-streams'/>", "xmpp" },
+		{ "SIP/2.0 400 Bad Request\r\n", "sip" },
+		{ "JDWP-Handshake", "jdwp" },
+		{ "OK MPD 0.23.5\n", "mpd" },
+		{ "# munin node at host.example.net\n", "munin" },
+		{ "200 news.example.net InterNetNews NNRP server INN 2.6.4 ready (posting ok)\r\n", "nntp" },
+		{ "201 news.example.net NNTP Service Ready, posting prohibited\r\n", "nntp" },
+		{ "ncacn_http/1.0", "msrpc" },
+		{ "\x13BitTorrent protocol\x00\x00\x00\x00\x00\x10\x00\x05", "bittorrent" },
+		{ "INFO {\"server_id\":\"NAB\",\"version\":\"2.10.4\"}\r\n", "nats" },
+		{ "UNKNOWN_COMMAND\r\n", "beanstalkd" },
+		{ "UNKNOWN COMMAND\n", "clamav" },
+		{ "ERROR\nmessage:Unknown STOMP action: \n\n\x00", "stomp" },
+		{ "cvs [pserver aborted]: bad auth protocol start: \n", "cvspserver" },
+		{ "Microsoft Windows [Version 10.0.17763.1]\r\n", "shell" },
+		{ "\r\n@RSYNCD: 31.0\n", "rsync" },
+		{ "200 mail.example.net ESMTP Postfix\r\n", "" },
+		{ ":irc.example.net 001 lzr :Welcome\r\n", "" },
+		{ "<?xml version='1.0'?><html>", "" },
+		{ "INFO {}", "" },
+		{ "ERROR\r\n", "" },
+		{ "", "" },
+	}
+	for _, tt := range tests {
+		if f := Classify( tt.data ); f != tt.fingerprint {
+			t.Errorf( "Classify(%q) = %q, want %q", tt.data, f, tt.fingerprint )
+		}
+	}
+}
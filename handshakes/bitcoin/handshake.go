@@ -0,0 +1,38 @@
+package bitcoin
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return version( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseMessages( []byte(data) ) != nil {
+		return "bitcoin"
+	}
+	return ""
+}
+
+// read up to the verack (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// the node's network, services and user agent (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseMessages( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "bitcoin", &h )
+}
@@ -0,0 +1,262 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+/* a version message on the main network. each message has a 24 byte
+ * header, the network's magic, a NUL padded command, the payload's
+ * length and the first 4 bytes of its double SHA-256:
+ *
+ *   f9 be b4 d9 "version" 00 00 00 00 00 5f 00 00 00 <checksum>
+ *   80 11 01 00 (70016) 00 00 00 00 00 00 00 00 <timestamp> ...
+ *
+ * a node answers with its own version and, having read ours, a verack,
+ * possibly with sendaddrv2 or wtxidrelay in between:
+ *
+ *   f9 be b4 d9 "version" ... 66 00 00 00 <checksum>
+ *   80 11 01 00 09 04 00 00 00 00 00 00 ...
+ *   10 "/Satoshi:26.0.0/" 20 5c 0c 00 01
+ *   f9 be b4 d9 "verack" 00 ... 00 00 00 00 5d f6 e0 e2
+ *
+ * a node on another network (or coin) reads garbage and hangs up.
+ */
+const (
+	HEADER_LEN			int = 24
+	COMMAND_LEN			int = 12
+	PROTOCOL_VERSION	uint32 = 70016
+	USER_AGENT			string = "/lzr:0.1/"
+	PORT				uint16 = 8333
+	MAX_PAYLOAD			uint32 = 32 * 1024 * 1024
+)
+
+var MAINNET = []byte{ 0xf9, 0xbe, 0xb4, 0xd9 }
+
+var networks = map[string]string{
+	"\xf9\xbe\xb4\xd9": "mainnet",
+	"\x0b\x11\x09\x07": "testnet3",
+	"\x1c\x16\x3f\x28": "testnet4",
+	"\x0a\x03\xcf\x40": "signet",
+	"\xfa\xbf\xb5\xda": "regtest",
+	"\xe3\xe1\xf3\xe8": "bitcoin_cash",
+	"\xfb\xc0\xb6\xdb": "litecoin",
+	"\xc0\xc0\xc0\xc0": "dogecoin",
+}
+
+var serviceNames = []struct {
+	bit				uint64
+	name			string
+}{
+	{ 1 << 0, "network" },
+	{ 1 << 2, "bloom" },
+	{ 1 << 3, "witness" },
+	{ 1 << 6, "compact_filters" },
+	{ 1 << 10, "network_limited" },
+	{ 1 << 11, "p2p_v2" },
+}
+
+type message struct {
+	command			string
+	payload			[]byte
+}
+
+type bitcoin_metadata struct {
+	Network			string		`json:"network"`
+	Commands		[]string	`json:"commands"`
+	ProtocolVersion	uint32		`json:"protocol_version,omitempty"`
+	Services		uint64		`json:"services,omitempty"`
+	ServiceNames	[]string	`json:"service_names,omitempty"`
+	Timestamp		string		`json:"timestamp,omitempty"`
+	UserAgent		string		`json:"user_agent,omitempty"`
+	StartHeight		int32		`json:"start_height,omitempty"`
+	Relay			*bool		`json:"relay,omitempty"`
+	Verack			bool		`json:"verack"`
+}
+
+func checksum( payload []byte ) []byte {
+	first := sha256.Sum256( payload )
+	second := sha256.Sum256( first[:] )
+	return second[:4]
+}
+
+func encodeMessage( magic []byte, command string, payload []byte ) []byte {
+
+	m := make( []byte, HEADER_LEN, HEADER_LEN + len(payload) )
+	copy( m, magic )
+	copy( m[4:4+COMMAND_LEN], command )
+	binary.LittleEndian.PutUint32( m[16:], uint32( len(payload) ) )
+	copy( m[20:], checksum( payload ) )
+	return append( m, payload... )
+}
+
+// services, IPv6 (or v4-mapped) address and big endian port
+func netAddr( ip net.IP, port uint16 ) []byte {
+
+	a := make( []byte, 26 )
+	copy( a[8:24], ip.To16() )
+	binary.BigEndian.PutUint16( a[24:], port )
+	return a
+}
+
+func version( dst string ) []byte {
+
+	p := make( []byte, 20 )
+	binary.LittleEndian.PutUint32( p, PROTOCOL_VERSION )
+	//no services of our own
+	binary.LittleEndian.PutUint64( p[12:], uint64( time.Now().Unix() ) )
+	p = append( p, netAddr( net.ParseIP( dst ), PORT )... )
+	p = append( p, netAddr( net.IPv6zero, 0 )... )
+	p = append( p, 0x6c, 0x7a, 0x72, 0x31, 0x6c, 0x7a, 0x72, 0x31 )
+	p = append( p, byte( len(USER_AGENT) ) )
+	p = append( p, USER_AGENT... )
+	//start height 0, no transaction relay
+	p = append( p, 0, 0, 0, 0, 0 )
+	return encodeMessage( MAINNET, "version", p )
+}
+
+// a NUL padded command of printable ASCII
+func command( b []byte ) ( string, bool ) {
+
+	end := bytes.IndexByte( b, 0 )
+	if end < 0 {
+		end = len(b)
+	}
+	if end == 0 {
+		return "", false
+	}
+	for i, c := range b {
+		if ( i < end && ( c < 0x21 || c > 0x7e ) ) || ( i >= end && c != 0 ) {
+			return "", false
+		}
+	}
+	return string( b[:end] ), true
+}
+
+/* the whole messages at the start of data and its network. false
+ * unless data starts with a valid header, and a checksum if the first
+ * payload is in. whatever follows a bad message is left out.
+ */
+func readMessages( data []byte ) ( string, []message, bool ) {
+
+	if len(data) < HEADER_LEN {
+		return "", nil, false
+	}
+	magic := data[:4]
+	network, ok := networks[ string(magic) ]
+	if !ok {
+		return "", nil, false
+	}
+	var msgs []message
+	for first := true; len(data) >= HEADER_LEN; first = false {
+		cmd, ok := command( data[4:16] )
+		l := binary.LittleEndian.Uint32( data[16:] )
+		if !bytes.Equal( data[:4], magic ) || !ok || l > MAX_PAYLOAD {
+			if first {
+				return "", nil, false
+			}
+			break
+		}
+		if uint32( len(data) - HEADER_LEN ) < l {
+			break
+		}
+		payload := data[HEADER_LEN:HEADER_LEN+int(l)]
+		if !bytes.Equal( checksum( payload ), data[20:24] ) {
+			if first {
+				return "", nil, false
+			}
+			break
+		}
+		msgs = append( msgs, message{ command: cmd, payload: payload } )
+		data = data[HEADER_LEN+int(l):]
+	}
+	return network, msgs, true
+}
+
+// a CompactSize length, then the string
+func varString( b []byte ) ( string, []byte, bool ) {
+
+	if len(b) < 1 {
+		return "", nil, false
+	}
+	l, b := uint64( b[0] ), b[1:]
+	switch l {
+	case 0xfd:
+		if len(b) < 2 {
+			return "", nil, false
+		}
+		l, b = uint64( binary.LittleEndian.Uint16( b ) ), b[2:]
+	case 0xfe, 0xff:
+		//no user agent is that long
+		return "", nil, false
+	}
+	if uint64( len(b) ) < l {
+		return "", nil, false
+	}
+	return string( b[:l] ), b[l:], true
+}
+
+func ( m *bitcoin_metadata ) readVersion( p []byte ) {
+
+	//version, services, timestamp, two addresses, nonce
+	if len(p) < 80 {
+		return
+	}
+	m.ProtocolVersion = binary.LittleEndian.Uint32( p )
+	m.Services = binary.LittleEndian.Uint64( p[4:] )
+	for _, s := range serviceNames {
+		if m.Services & s.bit != 0 {
+			m.ServiceNames = append( m.ServiceNames, s.name )
+		}
+	}
+	ts := int64( binary.LittleEndian.Uint64( p[12:] ) )
+	m.Timestamp = time.Unix( ts, 0 ).UTC().Format( time.RFC3339 )
+	ua, rest, ok := varString( p[80:] )
+	if !ok {
+		return
+	}
+	m.UserAgent = ua
+	if len(rest) >= 4 {
+		m.StartHeight = int32( binary.LittleEndian.Uint32( rest ) )
+	}
+	if len(rest) >= 5 {
+		relay := rest[4] != 0
+		m.Relay = &relay
+	}
+}
+
+// nil unless data starts with a message of a known network
+func parseMessages( data []byte ) *bitcoin_metadata {
+
+	network, msgs, ok := readMessages( data )
+	if !ok {
+		return nil
+	}
+	m := &bitcoin_metadata{ Network: network, Commands: []string{} }
+	for _, msg := range msgs {
+		m.Commands = append( m.Commands, msg.command )
+		switch msg.command {
+		case "version":
+			m.readVersion( msg.payload )
+		case "verack":
+			m.Verack = true
+		}
+	}
+	return m
+}
+
+// the node has acked our version, or hung up on it in another way
+func answered( data []byte ) bool {
+
+	if len(data) < 4 {
+		return false
+	}
+	if _, ok := networks[ string( data[:4] ) ]; !ok {
+		return true
+	}
+	m := parseMessages( data )
+	return m == nil || m.Verack
+}
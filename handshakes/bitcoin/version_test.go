@@ -0,0 +1,129 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// a node's version payload
+func nodeVersion( services uint64, userAgent string, height uint32, relay ...byte ) []byte {
+	p := make( []byte, 20 )
+	binary.LittleEndian.PutUint32( p, PROTOCOL_VERSION )
+	binary.LittleEndian.PutUint64( p[4:], services )
+	binary.LittleEndian.PutUint64( p[12:], 1727950530 )
+	p = append( p, netAddr( net.ParseIP( "192.0.2.7" ), 50000 )... )
+	p = append( p, netAddr( net.IPv6zero, 0 )... )
+	p = append( p, 1, 2, 3, 4, 5, 6, 7, 8 )
+	p = append( p, byte( len(userAgent) ) )
+	p = append( p, userAgent... )
+	h := make( []byte, 4 )
+	binary.LittleEndian.PutUint32( h, height )
+	p = append( p, h... )
+	return append( p, relay... )
+}
+
+func concat( parts ...[]byte ) []byte {
+	return bytes.Join( parts, nil )
+}
+
+var (
+	core = concat(
+		encodeMessage( MAINNET, "version", nodeVersion( 0x0c09, "/Satoshi:26.0.0/", 818208, 1 ) ),
+		encodeMessage( MAINNET, "wtxidrelay", nil ),
+		encodeMessage( MAINNET, "sendaddrv2", nil ),
+		encodeMessage( MAINNET, "verack", nil ),
+	)
+	litecoin = encodeMessage( []byte{ 0xfb, 0xc0, 0xb6, 0xdb }, "version",
+		nodeVersion( 0x0409, "/LitecoinCore:0.21.2.2/", 2580000 ) )
+)
+
+func TestVersion( t *testing.T ) {
+
+	_, msgs, ok := readMessages( version( "2001:db8::1" ) )
+	if !ok || len(msgs) != 1 || msgs[0].command != "version" || len(msgs[0].payload) != 86 + len(USER_AGENT) ||
+		!bytes.Equal( msgs[0].payload[28:44], net.ParseIP( "2001:db8::1" ) ) {
+		t.Errorf( "version: %+v", msgs )
+	}
+}
+
+func TestParseMessages( t *testing.T ) {
+
+	relay := true
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*bitcoin_metadata
+	}{
+		{ "core", core, &bitcoin_metadata{ Network: "mainnet",
+			Commands: []string{ "version", "wtxidrelay", "sendaddrv2", "verack" }, ProtocolVersion: 70016,
+			Services: 0x0c09, ServiceNames: []string{ "network", "witness", "network_limited", "p2p_v2" },
+			Timestamp: "2024-10-03T10:15:30Z", UserAgent: "/Satoshi:26.0.0/", StartHeight: 818208,
+			Relay: &relay, Verack: true } },
+		{ "litecoin, no relay flag", litecoin, &bitcoin_metadata{ Network: "litecoin",
+			Commands: []string{ "version" }, ProtocolVersion: 70016, Services: 0x0409,
+			ServiceNames: []string{ "network", "witness", "network_limited" }, Timestamp: "2024-10-03T10:15:30Z",
+			UserAgent: "/LitecoinCore:0.21.2.2/", StartHeight: 2580000 } },
+		//the payload has not arrived, but the header is enough
+		{ "header only", core[:HEADER_LEN], &bitcoin_metadata{ Network: "mainnet", Commands: []string{} } },
+		{ "verack cut short", core[:len(core)-1], &bitcoin_metadata{ Network: "mainnet",
+			Commands: []string{ "version", "wtxidrelay", "sendaddrv2" }, ProtocolVersion: 70016,
+			Services: 0x0c09, ServiceNames: []string{ "network", "witness", "network_limited", "p2p_v2" },
+			Timestamp: "2024-10-03T10:15:30Z", UserAgent: "/Satoshi:26.0.0/", StartHeight: 818208,
+			Relay: &relay } },
+		{ "other magic", concat( []byte{ 0xde, 0xad, 0xbe, 0xef }, core[4:] ), nil },
+		{ "bad checksum", concat( core[:20], []byte{ 0, 0, 0, 0 }, core[24:] ), nil },
+		{ "bad command", concat( core[:4], []byte( "vers\x01on\x00\x00\x00\x00\x00" ), core[16:] ), nil },
+		{ "junk after the NUL", concat( core[:4], []byte( "version\x00\x00\x00\x00x" ), core[16:] ), nil },
+		{ "too long", concat( core[:16], []byte{ 0xff, 0xff, 0xff, 0xff }, core[20:] ), nil },
+		{ "short", core[:HEADER_LEN-1], nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseMessages( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( string(c.data) ) == "bitcoin" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( string(c.data) ) )
+		}
+	}
+	for i := range core {
+		parseMessages( core[:i] )
+	}
+}
+
+func TestVarString( t *testing.T ) {
+
+	long := concat( []byte{ 0xfd, 0x00, 0x01 }, bytes.Repeat( []byte{ 'a' }, 256 ) )
+	if s, rest, ok := varString( long ); !ok || len(s) != 256 || len(rest) != 0 {
+		t.Errorf( "varString of 256 bytes failed" )
+	}
+	for _, b := range [][]byte{ nil, { 0x05, 'a' }, { 0xfd, 0x01 }, { 0xfe, 0, 0, 0, 0 }, { 0xff } } {
+		if _, _, ok := varString( b ); ok {
+			t.Errorf( "varString(%x) succeeded", b )
+		}
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		[]byte
+		answered	bool
+	}{
+		{ nil, false },
+		{ core[:3], false },
+		{ core[:HEADER_LEN], false },
+		{ core[:len(core)-1], false },
+		{ core, true },
+		{ concat( core[:20], []byte{ 0, 0, 0, 0 }, core[24:] ), true },
+		{ []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%x) = %v", c.data, !c.answered )
+		}
+	}
+}
@@ -15,6 +15,11 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
     return data
 }
 
+// over UDP the query goes without the TCP length prefix
+func (h *HandshakeMod) GetUDPData( dst string ) []byte {
+	return h.GetData( dst )[2:]
+}
+
 func (h *HandshakeMod) Verify( data string ) string {
 
     if strings.Contains( data, "stackoverflow" ){
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseVersion( data ) != nil {
+		return "docker"
+	}
+	return ""
+}
+
+// the version JSON may be split over segments (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// engine, API and kernel versions (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseVersion( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "docker", &h )
+	lzr.AddFingerprintRule( "docker", lzr.REFINES, "http" )
+}
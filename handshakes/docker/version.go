@@ -0,0 +1,123 @@
+package docker
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+/* GET /version on the Docker Engine API, which needs no auth when the
+ * daemon listens on plain TCP (2375). the answer identifies itself in
+ * the headers and the body, e.g.
+ *
+ *   HTTP/1.1 200 OK
+ *   Api-Version: 1.43
+ *   Content-Type: application/json
+ *   Docker-Experimental: false
+ *   Ostype: linux
+ *   Server: Docker/24.0.7 (linux)
+ *   Content-Length: 820
+ *
+ *   {"Platform":{"Name":"Docker Engine - Community"},"Version":"24.0.7",
+ *    "ApiVersion":"1.43","MinAPIVersion":"1.12","GitCommit":"311b9ff",
+ *    "GoVersion":"go1.20.10","Os":"linux","Arch":"amd64",
+ *    "KernelVersion":"6.5.0-14-generic",...}
+ *
+ * podman's compatible API answers the same, with Libpod-API-Version.
+ */
+type version struct {
+	Platform		struct {
+		Name			string
+	}
+	Version			string
+	ApiVersion		string
+	MinAPIVersion	string
+	GitCommit		string
+	GoVersion		string
+	Os				string
+	Arch			string
+	KernelVersion	string
+}
+
+type docker_metadata struct {
+	Status			int			`json:"status"`
+	Server			string		`json:"server,omitempty"`
+	Platform		string		`json:"platform,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	APIVersion		string		`json:"api_version,omitempty"`
+	MinAPIVersion	string		`json:"min_api_version,omitempty"`
+	GitCommit		string		`json:"git_commit,omitempty"`
+	GoVersion		string		`json:"go_version,omitempty"`
+	OS				string		`json:"os,omitempty"`
+	Arch			string		`json:"arch,omitempty"`
+	KernelVersion	string		`json:"kernel_version,omitempty"`
+	Podman			bool		`json:"podman,omitempty"`
+}
+
+func request( dst string ) []byte {
+
+	req, _ := http.NewRequest( "GET", "/version", nil )
+	req.Host = dst
+	req.Header.Add( "Host", dst )
+	req.Header.Set( "User-Agent", "Mozilla/5.0 zgrab/0.x" )
+	req.Header.Set( "Accept", "application/json" )
+	data, _ := httputil.DumpRequest( req, false )
+	return data
+}
+
+// the response and as much of its body as arrived
+func readResponse( data string ) ( *http.Response, []byte, error ) {
+
+	resp, err := http.ReadResponse( bufio.NewReader( strings.NewReader( data ) ), nil )
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll( resp.Body )
+	return resp, body, err
+}
+
+// nil unless the response comes from a Docker (or podman) daemon
+func parseVersion( data string ) *docker_metadata {
+
+	resp, body, _ := readResponse( data )
+	if resp == nil {
+		return nil
+	}
+	m := &docker_metadata{
+		Status: resp.StatusCode,
+		Server: resp.Header.Get( "Server" ),
+		APIVersion: resp.Header.Get( "Api-Version" ),
+		Podman: resp.Header.Get( "Libpod-Api-Version" ) != "",
+		OS: resp.Header.Get( "Ostype" ),
+	}
+	var v version
+	if json.Unmarshal( body, &v ) == nil && v.ApiVersion != "" {
+		m.Platform = v.Platform.Name
+		m.Version = v.Version
+		m.APIVersion = v.ApiVersion
+		m.MinAPIVersion = v.MinAPIVersion
+		m.GitCommit = v.GitCommit
+		m.GoVersion = v.GoVersion
+		m.OS = v.Os
+		m.Arch = v.Arch
+		m.KernelVersion = v.KernelVersion
+	}
+	if m.APIVersion == "" && !strings.HasPrefix( m.Server, "Docker/" ) &&
+		!strings.HasPrefix( m.Server, "Libpod/" ) {
+		return nil
+	}
+	return m
+}
+
+// the headers are in and so is the body, by Content-Length or chunking
+func answered( data string ) bool {
+
+	if !strings.HasPrefix( data, "HTTP/" ) && !strings.HasPrefix( "HTTP/", data ) {
+		return true
+	}
+	_, _, err := readResponse( data )
+	return err == nil
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func response( status string, headers string, body string ) string {
+	return "HTTP/1.1 " + status + "\r\n" + headers + "Content-Length: " + strconv.Itoa( len(body) ) +
+		"\r\n\r\n" + body
+}
+
+var (
+	engineBody = `{"Platform":{"Name":"Docker Engine - Community"},"Version":"24.0.7",` +
+		`"ApiVersion":"1.43","MinAPIVersion":"1.12","GitCommit":"311b9ff",` +
+		`"GoVersion":"go1.20.10","Os":"linux","Arch":"amd64","KernelVersion":"6.5.0-14-generic"}`
+	engine = response( "200 OK", "Api-Version: 1.43\r\nContent-Type: application/json\r\n" +
+		"Docker-Experimental: false\r\nOstype: linux\r\nServer: Docker/24.0.7 (linux)\r\n", engineBody )
+	podman = response( "200 OK", "Api-Version: 1.41\r\nLibpod-Api-Version: 4.9.3\r\n" +
+		"Server: Libpod/4.9.3 (linux)\r\n", `{"Version":"4.9.3","ApiVersion":"1.41","Os":"linux"}` )
+	//behind an authenticating proxy the headers are all that is left
+	forbidden = response( "403 Forbidden", "Server: Docker/20.10.21 (linux)\r\n", "" )
+	nginx = response( "200 OK", "Server: nginx\r\n", "<html></html>" )
+)
+
+func TestRequest( t *testing.T ) {
+
+	req := string( request( "192.0.2.1" ) )
+	if !strings.HasPrefix( req, "GET /version HTTP/1.1\r\n" ) || !strings.Contains( req, "Host: 192.0.2.1\r\n" ) ||
+		!strings.HasSuffix( req, "\r\n\r\n" ) {
+		t.Errorf( "request: %q", req )
+	}
+}
+
+func TestParseVersion( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		string
+		want		*docker_metadata
+	}{
+		{ "engine", engine, &docker_metadata{ Status: 200, Server: "Docker/24.0.7 (linux)",
+			Platform: "Docker Engine - Community", Version: "24.0.7", APIVersion: "1.43",
+			MinAPIVersion: "1.12", GitCommit: "311b9ff", GoVersion: "go1.20.10", OS: "linux",
+			Arch: "amd64", KernelVersion: "6.5.0-14-generic" } },
+		{ "podman", podman, &docker_metadata{ Status: 200, Server: "Libpod/4.9.3 (linux)",
+			Version: "4.9.3", APIVersion: "1.41", OS: "linux", Podman: true } },
+		{ "forbidden", forbidden, &docker_metadata{ Status: 403, Server: "Docker/20.10.21 (linux)" } },
+		//the headers alone are enough
+		{ "body cut short", engine[:len(engine)-100], &docker_metadata{ Status: 200,
+			Server: "Docker/24.0.7 (linux)", APIVersion: "1.43", OS: "linux" } },
+		{ "nginx", nginx, nil },
+		{ "headers cut short", engine[:30], nil },
+		{ "empty", "", nil },
+		{ "ssh", "SSH-2.0-OpenSSH_8.9\r\n", nil },
+	} {
+		if got := parseVersion( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		string
+		answered	bool
+	}{
+		{ "", false },
+		{ "HTT", false },
+		{ engine[:60], false },
+		{ engine[:len(engine)-1], false },
+		{ engine, true },
+		{ forbidden, true },
+		{ "SSH-2.0-OpenSSH_8.9\r\n", true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%q) = %v", c.data, !c.answered )
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package enip
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return listIdentity()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseIdentity( []byte(data) ) != nil {
+		return "enip"
+	}
+	return ""
+}
+
+// vendor, device type, product and revision (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseIdentity( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "enip", &h )
+}
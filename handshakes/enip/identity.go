@@ -0,0 +1,127 @@
+package enip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+/* ListIdentity (command 0x63) needs no session. the request is a bare
+ * 24 byte encapsulation header, little endian: command, length, session
+ * handle, status, sender context (8), options.
+ *
+ * the reply's data is an item count and CIP Identity items (type 0x0c):
+ * encapsulation version (2), a sockaddr in network byte order (16),
+ * vendor id, device type, product code (2 each), revision major and
+ * minor, status (2), serial number (4), product name (length prefixed),
+ * state. e.g. a CompactLogix:
+ *
+ *   63 00 40 00 00 00 00 00 00 00 00 00 "lzrlzrlz" 00 00 00 00
+ *   01 00 0c 00 3a 00 01 00 00 02 af 12 c0 a8 01 0a 00 00 00 00 00 00 00 00
+ *   01 00 0e 00 5f 00 14 0b 60 30 9a 2e 31 60 18 "1769-L33ER/A LOGIX5333ER" 03
+ */
+const (
+	ENCAP_HEADER_LEN	int = 24
+	CMD_LIST_IDENTITY	uint16 = 0x0063
+	ITEM_CIP_IDENTITY	uint16 = 0x000c
+	IDENTITY_FIXED_LEN	int = 33
+)
+
+var senderContext = []byte( "lzrlzrlz" )
+
+// the most common of the ODVA vendor ids
+var vendorNames = map[uint16]string{
+	1: "Rockwell Automation/Allen-Bradley",
+	2: "Namco Controls Corp.",
+	3: "Honeywell Inc.",
+	5: "Rockwell Automation/Reliance Electric",
+	9: "Eaton Electrical",
+	47: "OMRON Corporation",
+	243: "Schneider Automation, Inc.",
+}
+
+var deviceTypes = map[uint16]string{
+	0x00: "Generic Device (deprecated)",
+	0x02: "AC Drive",
+	0x07: "General Purpose Discrete I/O",
+	0x0c: "Communications Adapter",
+	0x0e: "Programmable Logic Controller",
+	0x13: "DC Drive",
+	0x18: "Human-Machine Interface",
+	0x25: "CIP Motion Drive",
+	0x2b: "Generic Device (keyable)",
+	0x2c: "Managed Switch",
+}
+
+type enip_metadata struct {
+	VendorID		uint16		`json:"vendor_id"`
+	Vendor			string		`json:"vendor,omitempty"`
+	DeviceTypeID	uint16		`json:"device_type_id"`
+	DeviceType		string		`json:"device_type,omitempty"`
+	ProductCode		uint16		`json:"product_code"`
+	Revision		string		`json:"revision"`
+	Serial			string		`json:"serial"`
+	ProductName		string		`json:"product_name,omitempty"`
+	Address			string		`json:"address,omitempty"`
+	State			byte		`json:"state"`
+}
+
+func listIdentity() []byte {
+	b := make( []byte, ENCAP_HEADER_LEN )
+	binary.LittleEndian.PutUint16( b[0:2], CMD_LIST_IDENTITY )
+	copy( b[12:20], senderContext )
+	return b
+}
+
+// nil unless data is a ListIdentity reply with an identity item
+func parseIdentity( data []byte ) *enip_metadata {
+
+	le := binary.LittleEndian
+	if len(data) < ENCAP_HEADER_LEN + 2 || le.Uint16( data[0:2] ) != CMD_LIST_IDENTITY ||
+		le.Uint32( data[8:12] ) != 0 {
+		return nil
+	}
+	body := data[ENCAP_HEADER_LEN:]
+	if l := int( le.Uint16( data[2:4] ) ); l < len(body) {
+		body = body[:l]
+	}
+	//the item count
+	if len(body) < 2 {
+		return nil
+	}
+	count := int( le.Uint16( body[0:2] ) )
+	items := body[2:]
+	for ; count > 0 && len(items) >= 4; count-- {
+		typ, l := le.Uint16( items[0:2] ), int( le.Uint16( items[2:4] ) )
+		if len(items) < 4 + l {
+			return nil
+		}
+		item := items[4:4+l]
+		items = items[4+l:]
+		if typ != ITEM_CIP_IDENTITY || len(item) < IDENTITY_FIXED_LEN {
+			continue
+		}
+		m := &enip_metadata{
+			VendorID: le.Uint16( item[18:20] ),
+			DeviceTypeID: le.Uint16( item[20:22] ),
+			ProductCode: le.Uint16( item[22:24] ),
+			Revision: fmt.Sprintf( "%d.%d", item[24], item[25] ),
+			Serial: fmt.Sprintf( "0x%08x", le.Uint32( item[28:32] ) ),
+		}
+		m.Vendor = vendorNames[ m.VendorID ]
+		m.DeviceType = deviceTypes[ m.DeviceTypeID ]
+		//sin_family and sin_port are big endian
+		if binary.BigEndian.Uint16( item[2:4] ) == 2 {
+			m.Address = net.IP( item[6:10] ).String()
+		}
+		nameL := int( item[32] )
+		if len(item) >= IDENTITY_FIXED_LEN + nameL {
+			m.ProductName = string( item[IDENTITY_FIXED_LEN:IDENTITY_FIXED_LEN+nameL] )
+			if len(item) > IDENTITY_FIXED_LEN + nameL {
+				m.State = item[IDENTITY_FIXED_LEN+nameL]
+			}
+		}
+		return m
+	}
+	return nil
+}
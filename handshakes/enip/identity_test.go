@@ -0,0 +1,74 @@
+package enip
+
+import (
+	"bytes"
+	"testing"
+)
+
+// the CompactLogix reply of the comment on listIdentity
+var compactLogix = append( append( []byte{
+	0x63, 0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00 },
+	[]byte( "lzrlzrlz" )... ), []byte{ 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x0c, 0x00, 0x3a, 0x00, 0x01, 0x00, 0x00, 0x02, 0xaf, 0x12,
+	0xc0, 0xa8, 0x01, 0x0a, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x0e, 0x00, 0x5f, 0x00, 0x14, 0x0b, 0x60, 0x30, 0x9a, 0x2e,
+	0x31, 0x60, 0x18,
+	'1', '7', '6', '9', '-', 'L', '3', '3', 'E', 'R', '/', 'A', ' ',
+	'L', 'O', 'G', 'I', 'X', '5', '3', '3', '3', 'E', 'R', 0x03 }... )
+
+func header( length byte, status byte ) []byte {
+	h := listIdentity()
+	h[2], h[8] = length, status
+	return h
+}
+
+func TestListIdentity( t *testing.T ) {
+
+	req := listIdentity()
+	if len(req) != ENCAP_HEADER_LEN || req[0] != 0x63 || !bytes.Equal( req[12:20], senderContext ) {
+		t.Errorf( "request % x", req )
+	}
+}
+
+func TestParseIdentity( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		product			string
+	}{
+		{ "compactlogix", compactLogix, "1769-L33ER/A LOGIX5333ER" },
+		{ "cut short", compactLogix[:len(compactLogix)-1], "" },
+		{ "truncated item", compactLogix[:60], "" },
+		{ "header only", compactLogix[:ENCAP_HEADER_LEN], "" },
+		{ "length 0", append( header( 0, 0 ), 0x01, 0x00 ), "" },
+		{ "length 1", append( header( 1, 0 ), 0x01, 0x00 ), "" },
+		{ "no items", append( header( 2, 0 ), 0x00, 0x00 ), "" },
+		{ "item past the end", append( header( 6, 0 ), 0x01, 0x00, 0x0c, 0x00, 0xff, 0x00 ), "" },
+		{ "short identity", append( header( 8, 0 ), 0x01, 0x00, 0x0c, 0x00, 0x02, 0x00, 0x01, 0x00 ), "" },
+		{ "error status", append( header( 2, 1 ), 0x00, 0x00 ), "" },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\nHTTP/1.1 400 Bad Request\r\n\r\n" ), "" },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		m := parseIdentity( tt.data )
+		if tt.product == "" {
+			if m != nil {
+				t.Errorf( "%s: unexpected %+v", tt.name, m )
+			}
+			continue
+		}
+		if h.Verify( string(tt.data) ) != "enip" || m == nil {
+			t.Fatalf( "%s: not enip", tt.name )
+		}
+		if m.ProductName != tt.product || m.Vendor != "Rockwell Automation/Allen-Bradley" ||
+			m.DeviceType != "Programmable Logic Controller" || m.Revision != "20.11" ||
+			m.Address != "192.168.1.10" || m.State != 3 {
+			t.Errorf( "%s: got %+v", tt.name, m )
+		}
+	}
+	//a reply cut short anywhere is never read past its end
+	for i := range compactLogix {
+		parseIdentity( compactLogix[:i] )
+	}
+}
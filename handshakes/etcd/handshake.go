@@ -0,0 +1,39 @@
+package etcd
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseVersion( data ) != nil {
+		return "etcd"
+	}
+	return ""
+}
+
+// the version JSON may follow the headers in its own segment (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// server, cluster and storage versions (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseVersion( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "etcd", &h )
+	lzr.AddFingerprintRule( "etcd", lzr.REFINES, "http" )
+}
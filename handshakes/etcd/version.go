@@ -0,0 +1,95 @@
+package etcd
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+)
+
+/* GET /version on etcd's client port (2379), which etcd serves over
+ * HTTP/1 next to its gRPC API and without auth, e.g.
+ *
+ *   HTTP/1.1 200 OK
+ *   Content-Type: application/json
+ *   Date: Thu, 03 Oct 2024 10:15:30 GMT
+ *   Content-Length: 44
+ *
+ *   {"etcdserver":"3.5.9","etcdcluster":"3.5.0"}
+ *
+ * 3.6 adds "storage". etcd 2.0 answered in plain text, "etcd 2.0.13".
+ * with client certificates required, run it as tls/etcd.
+ */
+const (
+	PATH				string = "/version"
+)
+
+var v2Version = regexp.MustCompile( `^etcd (\d+\.\d+\.\d+\S*)\s*$` )
+
+type version struct {
+	Server			string		`json:"etcdserver"`
+	Cluster			string		`json:"etcdcluster"`
+	Storage			string		`json:"storage"`
+}
+
+type etcd_metadata struct {
+	Status			int			`json:"status"`
+	ServerVersion	string		`json:"server_version"`
+	ClusterVersion	string		`json:"cluster_version,omitempty"`
+	StorageVersion	string		`json:"storage_version,omitempty"`
+}
+
+func request( dst string ) []byte {
+
+	req, _ := http.NewRequest( "GET", PATH, nil )
+	req.Host = dst
+	req.Header.Add( "Host", dst )
+	req.Header.Set( "User-Agent", "Mozilla/5.0 zgrab/0.x" )
+	req.Header.Set( "Accept", "application/json" )
+	data, _ := httputil.DumpRequest( req, false )
+	return data
+}
+
+// the response and as much of its body as arrived
+func readResponse( data string ) ( *http.Response, []byte, error ) {
+
+	resp, err := http.ReadResponse( bufio.NewReader( strings.NewReader( data ) ), nil )
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll( resp.Body )
+	return resp, body, err
+}
+
+// nil unless the body names an etcd server version
+func parseVersion( data string ) *etcd_metadata {
+
+	resp, body, _ := readResponse( data )
+	if resp == nil {
+		return nil
+	}
+	m := &etcd_metadata{ Status: resp.StatusCode }
+	var v version
+	if json.Unmarshal( body, &v ) == nil && v.Server != "" {
+		m.ServerVersion, m.ClusterVersion, m.StorageVersion = v.Server, v.Cluster, v.Storage
+		return m
+	}
+	if match := v2Version.FindSubmatch( body ); match != nil {
+		m.ServerVersion = string( match[1] )
+		return m
+	}
+	return nil
+}
+
+// the headers are in and so is the body, by Content-Length or chunking
+func answered( data string ) bool {
+
+	if !strings.HasPrefix( data, "HTTP/" ) && !strings.HasPrefix( "HTTP/", data ) {
+		return true
+	}
+	_, _, err := readResponse( data )
+	return err == nil
+}
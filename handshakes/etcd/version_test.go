@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func response( status string, body string ) string {
+	return "HTTP/1.1 " + status + "\r\nContent-Type: application/json\r\nContent-Length: " +
+		strconv.Itoa( len(body) ) + "\r\n\r\n" + body
+}
+
+var (
+	v35 = response( "200 OK", `{"etcdserver":"3.5.9","etcdcluster":"3.5.0"}` )
+	v36 = response( "200 OK", `{"etcdserver":"3.6.0","etcdcluster":"3.6.0","storage":"3.6.0"}` )
+	v20 = response( "200 OK", "etcd 2.0.13" )
+)
+
+func TestRequest( t *testing.T ) {
+
+	req := string( request( "192.0.2.1" ) )
+	if !strings.HasPrefix( req, "GET /version HTTP/1.1\r\n" ) || !strings.Contains( req, "Host: 192.0.2.1\r\n" ) ||
+		!strings.HasSuffix( req, "\r\n\r\n" ) {
+		t.Errorf( "request: %q", req )
+	}
+}
+
+func TestParseVersion( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		string
+		want		*etcd_metadata
+	}{
+		{ "3.5", v35, &etcd_metadata{ Status: 200, ServerVersion: "3.5.9", ClusterVersion: "3.5.0" } },
+		{ "3.6", v36, &etcd_metadata{ Status: 200, ServerVersion: "3.6.0", ClusterVersion: "3.6.0",
+			StorageVersion: "3.6.0" } },
+		{ "2.0", v20, &etcd_metadata{ Status: 200, ServerVersion: "2.0.13" } },
+		//the cluster version is unknown until the members agree
+		{ "not decided", response( "200 OK", `{"etcdserver":"3.4.27","etcdcluster":"not_decided"}` ),
+			&etcd_metadata{ Status: 200, ServerVersion: "3.4.27", ClusterVersion: "not_decided" } },
+		{ "other json", response( "200 OK", `{"version":"1.2.3"}` ), nil },
+		{ "etcd in a page", response( "200 OK", "<p>etcd 3.5.0 docs</p>" ), nil },
+		{ "not found", response( "404 Not Found", "404 page not found\n" ), nil },
+		{ "body cut short", v35[:len(v35)-10], nil },
+		{ "headers cut short", v35[:20], nil },
+		{ "empty", "", nil },
+		{ "ssh", "SSH-2.0-OpenSSH_8.9\r\n", nil },
+	} {
+		if got := parseVersion( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( c.data ) == "etcd" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( c.data ) )
+		}
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		string
+		answered	bool
+	}{
+		{ "", false },
+		{ "HTT", false },
+		{ v35[:40], false },
+		{ v35[:len(v35)-1], false },
+		{ v35, true },
+		{ "SSH-2.0-OpenSSH_8.9\r\n", true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%q) = %v", c.data, !c.answered )
+		}
+	}
+}
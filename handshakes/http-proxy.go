@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/http_proxy"
+
+func init() {
+	http_proxy.RegisterHandshake()
+}
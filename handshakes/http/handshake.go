@@ -25,17 +25,60 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
 
 func (h *HandshakeMod) Verify( data string ) string {
 
-	if !strings.Contains( data, "HTTPS" ) &&
-		(strings.Contains( data, "HTTP" ) || strings.Contains( data, "html" ) ||
-		strings.Contains( data, "HTML") || strings.Contains( data, "<h1>" )) {
+	//an HTTP error from a TLS port is tls
+	if strings.Contains( data, "HTTPS" ) {
+		return ""
+	}
+	//an embedded product names itself in the label, e.g. http/jenkins
+	if r := parseResponse( data ); r != nil {
+		if product := detectProduct( r, htmlTitle( r.body ) ); product != "" {
+			return "http/" + product
+		}
+		return "http"
+	}
+	if looksLikeHTML( data ) {
          return "http"
 	}
 	return ""
 
 }
 
+type http_metadata struct {
+	Version			string		`json:"version,omitempty"`
+	Status			int			`json:"status,omitempty"`
+	Reason			string		`json:"reason,omitempty"`
+	Server			string		`json:"server,omitempty"`
+	PoweredBy		string		`json:"powered_by,omitempty"`
+	Authenticate	string		`json:"www_authenticate,omitempty"`
+	Title			string		`json:"title,omitempty"`
+	Product			string		`json:"product,omitempty"`
+}
+
+// status line, identifying headers, title and product (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+
+	r := parseResponse( data )
+	if r == nil {
+		return nil
+	}
+	title := htmlTitle( r.body )
+	return &http_metadata{
+		Version: r.version,
+		Status: r.status,
+		Reason: r.reason,
+		Server: r.headers["server"],
+		PoweredBy: r.headers["x-powered-by"],
+		Authenticate: r.headers["www-authenticate"],
+		Title: title,
+		Product: detectProduct( r, title ),
+	}
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "http", &h )
+	lzr.AddFingerprintRule( "http", lzr.REFINES, "dns" )
+	lzr.AddFingerprintRule( "http", lzr.REFINES, "ssh" )
+	lzr.AddFingerprintRule( "http", lzr.REFINES, "ftp" )
 }
 
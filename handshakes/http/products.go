@@ -0,0 +1,78 @@
+package http
+
+import (
+	"strings"
+)
+
+/* embedded products recognized from a response. a matcher needs all
+ * of its non-empty fields to match, compared case-insensitively:
+ * header must be present (and contain value, if given), and title and
+ * body must contain theirs. the first matching entry names the product.
+ */
+type product_matcher struct {
+	product			string
+	header			string
+	value			string
+	title			string
+	body			string
+}
+
+var productMatchers = []product_matcher{
+	{ product: "jenkins", header: "x-jenkins" },
+	{ product: "jenkins", title: "[jenkins]" },
+	{ product: "elasticsearch", header: "x-elastic-product", value: "elasticsearch" },
+	{ product: "elasticsearch", body: "you know, for search" },
+	{ product: "kibana", header: "kbn-name" },
+	{ product: "docker-registry", header: "docker-distribution-api-version" },
+	{ product: "docker", header: "server", value: "docker/" },
+	{ product: "docker", header: "api-version", body: "page not found" },
+	{ product: "prometheus", body: "<a href=\"/graph\">found</a>" },
+	{ product: "prometheus", title: "prometheus time series" },
+	{ product: "prometheus-node-exporter", title: "node exporter" },
+	{ product: "prometheus-exporter", title: "exporter", body: "href=\"/metrics\"" },
+	{ product: "grafana", title: "grafana" },
+	{ product: "mikrotik-routeros", title: "routeros" },
+	{ product: "openwrt", title: "openwrt" },
+	{ product: "openwrt", body: "/cgi-bin/luci" },
+	{ product: "dd-wrt", title: "dd-wrt" },
+	{ product: "ubiquiti-airos", title: "airos" },
+	{ product: "netgear-router", header: "www-authenticate", value: "netgear" },
+	{ product: "tp-link-router", header: "www-authenticate", value: "tp-link" },
+	{ product: "tp-link-router", title: "tp-link" },
+	{ product: "linksys-router", header: "www-authenticate", value: "linksys" },
+	{ product: "d-link-router", header: "www-authenticate", value: "dlink" },
+	{ product: "d-link-router", title: "d-link" },
+	{ product: "asus-router", header: "www-authenticate", value: "realm=\"rt-" },
+	{ product: "hikvision", header: "server", value: "hikvision" },
+	{ product: "hikvision", header: "server", value: "app-webs" },
+}
+
+func ( m product_matcher ) match( r *http_response, title string, body string ) bool {
+
+	if m.header != "" {
+		v, ok := r.headers[ m.header ]
+		if !ok || !strings.Contains( strings.ToLower( v ), m.value ) {
+			return false
+		}
+	}
+	if m.title != "" && !strings.Contains( title, m.title ) {
+		return false
+	}
+	if m.body != "" && !strings.Contains( body, m.body ) {
+		return false
+	}
+	return true
+}
+
+// "" when no matcher recognizes the response
+func detectProduct( r *http_response, title string ) string {
+
+	lowerTitle := strings.ToLower( title )
+	lowerBody := strings.ToLower( r.body )
+	for _, m := range productMatchers {
+		if m.match( r, lowerTitle, lowerBody ) {
+			return m.product
+		}
+	}
+	return ""
+}
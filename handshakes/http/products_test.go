@@ -0,0 +1,77 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+// one response per row of productMatchers, in order
+var productResponses = []struct{
+	product			string
+	response		string
+}{
+	{ "jenkins", "HTTP/1.1 403 Forbidden\r\nX-Jenkins: 2.426.1\r\n\r\n" },
+	{ "jenkins", "HTTP/1.1 200 OK\r\n\r\n<html><head><title>Dashboard [Jenkins]</title>" },
+	{ "elasticsearch", "HTTP/1.1 200 OK\r\nX-elastic-product: Elasticsearch\r\n\r\n" },
+	{ "elasticsearch", "HTTP/1.1 200 OK\r\n\r\n{ \"name\" : \"es01\", \"tagline\" : \"You Know, for Search\" }" },
+	{ "kibana", "HTTP/1.1 302 Found\r\nkbn-name: kibana\r\nlocation: /app/home\r\n\r\n" },
+	{ "docker-registry", "HTTP/1.1 200 OK\r\nDocker-Distribution-Api-Version: registry/2.0\r\n\r\n{}" },
+	{ "docker", "HTTP/1.1 200 OK\r\nServer: Docker/24.0.7 (linux)\r\n\r\n{}" },
+	{ "docker", "HTTP/1.1 404 Not Found\r\nApi-Version: 1.43\r\n\r\n{\"message\":\"page not found\"}" },
+	{ "prometheus", "HTTP/1.1 302 Found\r\nLocation: /graph\r\n\r\n<a href=\"/graph\">Found</a>.\n" },
+	{ "prometheus", "HTTP/1.1 200 OK\r\n\r\n<title>Prometheus Time Series Collection and Processing Server</title>" },
+	{ "prometheus-node-exporter", "HTTP/1.1 200 OK\r\n\r\n<html><head><title>Node Exporter</title>" },
+	{ "prometheus-exporter", "HTTP/1.1 200 OK\r\n\r\n<title>MySQLd Exporter</title><a href=\"/metrics\">Metrics</a>" },
+	{ "grafana", "HTTP/1.1 200 OK\r\n\r\n<!DOCTYPE html><html><head><title>Grafana</title>" },
+	{ "mikrotik-routeros", "HTTP/1.1 200 OK\r\n\r\n<title>RouterOS router configuration page</title>" },
+	{ "openwrt", "HTTP/1.1 200 OK\r\n\r\n<title>OpenWrt - LuCI</title>" },
+	{ "openwrt", "HTTP/1.1 200 OK\r\n\r\n<meta http-equiv=\"refresh\" content=\"0; URL=/cgi-bin/luci\" />" },
+	{ "dd-wrt", "HTTP/1.1 200 OK\r\n\r\n<title>DD-WRT (build 50308) - Info</title>" },
+	{ "ubiquiti-airos", "HTTP/1.1 200 OK\r\n\r\n<title>airOS</title>" },
+	{ "netgear-router", "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"NETGEAR R7000\"\r\n\r\n" },
+	{ "tp-link-router", "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"TP-LINK Wireless N Router WR841N\"\r\n\r\n" },
+	{ "tp-link-router", "HTTP/1.1 200 OK\r\n\r\n<title>TP-Link</title>" },
+	{ "linksys-router", "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"Linksys E1200\"\r\n\r\n" },
+	{ "d-link-router", "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"DLINK_WIRELESS\"\r\n\r\n" },
+	{ "d-link-router", "HTTP/1.1 200 OK\r\n\r\n<title>D-LINK SYSTEMS, INC. | WIRELESS ROUTER | HOME</title>" },
+	{ "asus-router", "HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"RT-AC68U\"\r\n\r\n" },
+	{ "hikvision", "HTTP/1.1 200 OK\r\nServer: Hikvision-Webs\r\n\r\n" },
+	{ "hikvision", "HTTP/1.1 200 OK\r\nServer: App-webs/\r\n\r\n" },
+}
+
+func TestDetectProduct( t *testing.T ) {
+
+	if len(productResponses) != len(productMatchers) {
+		t.Fatalf( "%d responses for %d matchers", len(productResponses), len(productMatchers) )
+	}
+	for i, c := range productResponses {
+		r := parseResponse( c.response )
+		if r == nil {
+			t.Errorf( "row %d: %q does not parse", i, c.response )
+			continue
+		}
+		if got := detectProduct( r, htmlTitle( r.body ) ); got != c.product {
+			t.Errorf( "row %d: %q, want %q", i, got, c.product )
+		}
+		//each response is recognized by its own row, not an earlier one
+		title, body := strings.ToLower( htmlTitle( r.body ) ), strings.ToLower( r.body )
+		for j := 0; j < i; j++ {
+			if productMatchers[j].match( r, title, body ) && productMatchers[j].product != c.product {
+				t.Errorf( "row %d is taken by row %d (%s)", i, j, productMatchers[j].product )
+			}
+		}
+		if !productMatchers[i].match( r, title, body ) {
+			t.Errorf( "row %d does not match its response", i )
+		}
+	}
+	for _, v := range []string{
+		"HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n<title>Welcome to nginx!</title>",
+		//a header the matcher needs a value of, without it
+		"HTTP/1.1 401 Unauthorized\r\nWWW-Authenticate: Basic realm=\"admin\"\r\n\r\n",
+		"HTTP/1.1 200 OK\r\n\r\n<title>Status</title><a href=\"/metrics\">",
+	} {
+		if got := detectProduct( parseResponse( v ), htmlTitle( parseResponse( v ).body ) ); got != "" {
+			t.Errorf( "%q: %q", v, got )
+		}
+	}
+}
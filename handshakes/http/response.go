@@ -0,0 +1,118 @@
+package http
+
+import (
+	"strconv"
+	"strings"
+)
+
+/* http_response is what can be read of a response, which may be cut
+ * off anywhere: LZR usually has just the first segment. a header line
+ * without its line ending is dropped, a title without </title> runs
+ * to the end of the data.
+ */
+type http_response struct {
+	version			string
+	status			int
+	reason			string
+	headers			map[string]string	//lowercased name, first value
+	body			string
+}
+
+// longest title reported
+const MAX_TITLE = 256
+
+// "HTTP/1.1 200 OK" at the start of data
+func parseStatusLine( line string ) ( string, int, string, bool ) {
+
+	if !strings.HasPrefix( line, "HTTP/" ) {
+		return "", 0, "", false
+	}
+	fields := strings.SplitN( line, " ", 3 )
+	if len(fields) < 2 || len(fields[1]) != 3 {
+		return "", 0, "", false
+	}
+	status, err := strconv.Atoi( fields[1] )
+	if err != nil || status < 100 {
+		return "", 0, "", false
+	}
+	reason := ""
+	if len(fields) == 3 {
+		reason = fields[2]
+	}
+	return fields[0], status, reason, true
+}
+
+// nil unless data starts with a status line
+func parseResponse( data string ) *http_response {
+
+	data = strings.TrimLeft( data, "\r\n " )
+	end := strings.Index( data, "\n" )
+	if end < 0 {
+		end = len(data)
+	}
+	version, status, reason, ok := parseStatusLine( strings.TrimRight( data[:end], "\r" ) )
+	if !ok {
+		return nil
+	}
+	r := &http_response{
+		version: version,
+		status: status,
+		reason: reason,
+		headers: make( map[string]string ),
+	}
+	if end == len(data) {
+		return r
+	}
+	rest := data[end+1:]
+	for {
+		end := strings.Index( rest, "\n" )
+		if end < 0 {
+			return r
+		}
+		line := strings.TrimRight( rest[:end], "\r" )
+		rest = rest[end+1:]
+		if line == "" {
+			r.body = rest
+			return r
+		}
+		colon := strings.Index( line, ":" )
+		if colon <= 0 {
+			continue
+		}
+		name := strings.ToLower( strings.TrimSpace( line[:colon] ) )
+		if _, ok := r.headers[name]; !ok {
+			r.headers[name] = strings.TrimSpace( line[colon+1:] )
+		}
+	}
+}
+
+// the contents of the first <title>, whitespace collapsed
+func htmlTitle( body string ) string {
+
+	lower := strings.ToLower( body )
+	start := strings.Index( lower, "<title" )
+	if start < 0 {
+		return ""
+	}
+	open := strings.Index( lower[start:], ">" )
+	if open < 0 {
+		return ""
+	}
+	start += open + 1
+	end := strings.Index( lower[start:], "</title" )
+	if end < 0 {
+		end = len(lower) - start
+	}
+	title := strings.Join( strings.Fields( body[start:start+end] ), " " )
+	if len(title) > MAX_TITLE {
+		title = title[:MAX_TITLE]
+	}
+	return title
+}
+
+// markup a server sends without a status line (HTTP/0.9)
+func looksLikeHTML( data string ) bool {
+	lower := strings.ToLower( data )
+	return strings.Contains( lower, "<html" ) || strings.Contains( lower, "<!doctype html" ) ||
+		strings.Contains( lower, "<h1>" )
+}
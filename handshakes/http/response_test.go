@@ -0,0 +1,79 @@
+package http
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseResponse( t *testing.T ) {
+
+	r := parseResponse( "\r\nHTTP/1.1 401 Unauthorized\r\nServer: lighttpd/1.4.59\r\n" +
+		"WWW-Authenticate: Basic realm=\"admin\"\r\nserver: second\r\n\r\n<html>" )
+	if r == nil || r.version != "HTTP/1.1" || r.status != 401 || r.reason != "Unauthorized" ||
+		r.headers["server"] != "lighttpd/1.4.59" || r.headers["www-authenticate"] != "Basic realm=\"admin\"" ||
+		r.body != "<html>" {
+		t.Errorf( "response: %+v", r )
+	}
+	//cut off inside a header: the partial line is dropped, there is no body
+	r = parseResponse( "HTTP/1.0 200 OK\r\nServer: nginx\r\nX-Powered-By: PH" )
+	if r == nil || r.status != 200 || r.headers["server"] != "nginx" || r.headers["x-powered-by"] != "" || r.body != "" {
+		t.Errorf( "truncated headers: %+v", r )
+	}
+	//cut off after the status line, which has no reason
+	if r := parseResponse( "HTTP/1.1 204" ); r == nil || r.status != 204 || r.reason != "" || len(r.headers) != 0 {
+		t.Errorf( "status line only: %+v", r )
+	}
+	for _, v := range []string{
+		"",
+		"HTTP",
+		"HTTP/1.1 2",
+		"HTTP/1.1 abc OK\r\n",
+		"HTTP/1.1 099 Low\r\n",
+		"SSH-2.0-OpenSSH_9.6\r\n",
+		"<html><body>HTTP/1.1 200 OK</body></html>",
+	} {
+		if r := parseResponse( v ); r != nil {
+			t.Errorf( "%q: %+v", v, r )
+		}
+	}
+}
+
+func TestHTMLTitle( t *testing.T ) {
+
+	for body, title := range map[string]string{
+		"<html><head><TITLE>Router\n   Login</title></head>": "Router Login",
+		"<title lang=\"en\">Dashboard</title>": "Dashboard",
+		//no </title>, the title runs to the end of the data
+		"<html><title>Jenkins [Jenkins": "Jenkins [Jenkins",
+		"<title": "",
+		"<html><body>no title</body>": "",
+		"<title></title>": "",
+	} {
+		if got := htmlTitle( body ); got != title {
+			t.Errorf( "%q: %q, want %q", body, got, title )
+		}
+	}
+	if got := htmlTitle( "<title>" + strings.Repeat( "a", 2 * MAX_TITLE ) ); len(got) != MAX_TITLE {
+		t.Errorf( "title of %d bytes", len(got) )
+	}
+}
+
+func TestVerify( t *testing.T ) {
+
+	var h HandshakeMod
+	for data, fingerprint := range map[string]string{
+		"HTTP/1.1 200 OK\r\nServer: nginx\r\n\r\n<html><title>Welcome</title>": "http",
+		"HTTP/1.1 403 Forbidden\r\nX-Jenkins: 2.426.1\r\n": "http/jenkins",
+		"<html><body>It works</body></html>": "http",
+		"HTTP/1.1 400 Bad Request\r\n\r\nThis port speaks HTTPS": "",
+		"SSH-2.0-OpenSSH_9.6\r\n": "",
+	} {
+		if got := h.Verify( data ); got != fingerprint {
+			t.Errorf( "%q: %q, want %q", data, got, fingerprint )
+		}
+	}
+	m, ok := h.Metadata( "HTTP/1.1 200 OK\r\nServer: Docker/24.0.7 (linux)\r\n\r\n{}" ).( *http_metadata )
+	if !ok || m.Product != "docker" || m.Server != "Docker/24.0.7 (linux)" {
+		t.Errorf( "metadata: %+v", m )
+	}
+}
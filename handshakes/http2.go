@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/http2"
+
+func init() {
+	http2.RegisterHandshake()
+}
@@ -0,0 +1,273 @@
+package http2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+/* HTTP/2 with prior knowledge (RFC 9113 3.3): the client preface, an
+ * empty SETTINGS and a gRPC health check on stream 1, an empty
+ * HealthCheckRequest in one DATA frame. the server's preface has to be
+ * a SETTINGS frame, e.g.
+ *
+ *   00 00 06 04 00 00 00 00 00  00 05 00 00 40 00
+ *
+ * (SETTINGS_MAX_FRAME_SIZE 16384), so that alone identifies HTTP/2. a
+ * gRPC server then answers the call with application/grpc and a
+ * grpc-status, whether or not it implements grpc.health.v1, e.g.
+ *
+ *   00 00 0e 01 04 00 00 00 01  88 5f 8b 1d 75 d0 62 0d 26 3d 4c 4d 65 64 ...
+ *
+ * an HTTP/1 server usually answers the preface with a 400 instead.
+ */
+const (
+	PREFACE				string = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	HEALTH_CHECK		string = "/grpc.health.v1.Health/Check"
+
+	FRAME_HEADER_LEN	int = 9
+
+	FRAME_DATA			byte = 0x0
+	FRAME_HEADERS		byte = 0x1
+	FRAME_RST_STREAM	byte = 0x3
+	FRAME_SETTINGS		byte = 0x4
+	FRAME_GOAWAY		byte = 0x7
+	FRAME_CONTINUATION	byte = 0x9
+
+	FLAG_END_STREAM		byte = 0x1
+	FLAG_ACK			byte = 0x1
+	FLAG_END_HEADERS	byte = 0x4
+	FLAG_PADDED			byte = 0x8
+	FLAG_PRIORITY		byte = 0x20
+)
+
+var settingNames = map[uint16]string{
+	1: "header_table_size",
+	2: "enable_push",
+	3: "max_concurrent_streams",
+	4: "initial_window_size",
+	5: "max_frame_size",
+	6: "max_header_list_size",
+	8: "enable_connect_protocol",
+}
+
+var errorNames = map[uint32]string{
+	0: "NO_ERROR",
+	1: "PROTOCOL_ERROR",
+	2: "INTERNAL_ERROR",
+	3: "FLOW_CONTROL_ERROR",
+	4: "SETTINGS_TIMEOUT",
+	5: "STREAM_CLOSED",
+	6: "FRAME_SIZE_ERROR",
+	7: "REFUSED_STREAM",
+	8: "CANCEL",
+	9: "COMPRESSION_ERROR",
+	10: "CONNECT_ERROR",
+	11: "ENHANCE_YOUR_CALM",
+	12: "INADEQUATE_SECURITY",
+	13: "HTTP_1_1_REQUIRED",
+}
+
+type frame struct {
+	kind			byte
+	flags			byte
+	stream			uint32
+	payload			[]byte
+}
+
+type http2_metadata struct {
+	Settings		map[string]uint32	`json:"settings,omitempty"`
+	Status			string		`json:"status,omitempty"`
+	ContentType		string		`json:"content_type,omitempty"`
+	Server			string		`json:"server,omitempty"`
+	GRPCStatus		string		`json:"grpc_status,omitempty"`
+	GRPCMessage		string		`json:"grpc_message,omitempty"`
+	Reset			string		`json:"rst_stream,omitempty"`
+	GoAway			string		`json:"goaway,omitempty"`
+	GoAwayDebug		string		`json:"goaway_debug,omitempty"`
+	grpc			bool
+	ended			bool
+}
+
+func encodeFrame( kind byte, flags byte, stream uint32, payload []byte ) []byte {
+
+	f := make( []byte, FRAME_HEADER_LEN, FRAME_HEADER_LEN + len(payload) )
+	f[0], f[1], f[2] = byte( len(payload) >> 16 ), byte( len(payload) >> 8 ), byte( len(payload) )
+	f[3], f[4] = kind, flags
+	binary.BigEndian.PutUint32( f[5:], stream )
+	return append( f, payload... )
+}
+
+func request( dst string ) []byte {
+
+	if strings.Contains( dst, ":" ) {
+		dst = "[" + dst + "]"
+	}
+	var block bytes.Buffer
+	enc := hpack.NewEncoder( &block )
+	for _, f := range []hpack.HeaderField{
+		{ Name: ":method", Value: "POST" },
+		{ Name: ":scheme", Value: "http" },
+		{ Name: ":path", Value: HEALTH_CHECK },
+		{ Name: ":authority", Value: dst },
+		{ Name: "content-type", Value: "application/grpc" },
+		{ Name: "te", Value: "trailers" },
+		{ Name: "user-agent", Value: "Mozilla/5.0 zgrab/0.x" },
+	} {
+		enc.WriteField( f )
+	}
+	data := []byte( PREFACE )
+	data = append( data, encodeFrame( FRAME_SETTINGS, 0, 0, nil )... )
+	data = append( data, encodeFrame( FRAME_HEADERS, FLAG_END_HEADERS, 1, block.Bytes() )... )
+	//an uncompressed, empty message
+	return append( data, encodeFrame( FRAME_DATA, FLAG_END_STREAM, 1, make( []byte, 5 ) )... )
+}
+
+// the whole frames at the start of data
+func readFrames( data []byte ) []frame {
+
+	var frames []frame
+	for len(data) >= FRAME_HEADER_LEN {
+		l := int(data[0]) << 16 | int(data[1]) << 8 | int(data[2])
+		if len(data) < FRAME_HEADER_LEN + l {
+			break
+		}
+		frames = append( frames, frame{
+			kind: data[3],
+			flags: data[4],
+			stream: binary.BigEndian.Uint32( data[5:9] ) & 0x7fffffff,
+			payload: data[FRAME_HEADER_LEN:FRAME_HEADER_LEN+l],
+		} )
+		data = data[FRAME_HEADER_LEN+l:]
+	}
+	return frames
+}
+
+// a server preface: a SETTINGS frame on stream 0 (its header is enough)
+func serverPreface( data []byte ) bool {
+
+	if len(data) < FRAME_HEADER_LEN {
+		return false
+	}
+	l := int(data[0]) << 16 | int(data[1]) << 8 | int(data[2])
+	return data[3] == FRAME_SETTINGS && data[4] & FLAG_ACK == 0 &&
+		binary.BigEndian.Uint32( data[5:9] ) == 0 && l % 6 == 0 && l <= 6 * 64
+}
+
+// the header block of a HEADERS frame, without padding and priority
+func headerBlock( f frame ) []byte {
+
+	p := f.payload
+	pad := 0
+	if f.flags & FLAG_PADDED != 0 {
+		if len(p) < 1 {
+			return nil
+		}
+		pad, p = int(p[0]), p[1:]
+	}
+	if f.flags & FLAG_PRIORITY != 0 {
+		if len(p) < 5 {
+			return nil
+		}
+		p = p[5:]
+	}
+	if pad > len(p) {
+		return nil
+	}
+	return p[:len(p)-pad]
+}
+
+func ( m *http2_metadata ) header( f hpack.HeaderField ) {
+
+	switch f.Name {
+	case ":status":
+		m.Status = f.Value
+	case "content-type":
+		m.ContentType = f.Value
+		m.grpc = m.grpc || strings.HasPrefix( f.Value, "application/grpc" )
+	case "server":
+		m.Server = f.Value
+	case "grpc-status":
+		m.GRPCStatus = f.Value
+		m.grpc = true
+	case "grpc-message":
+		m.GRPCMessage = f.Value
+	}
+}
+
+// nil unless data starts with a server preface
+func parseFrames( data []byte ) *http2_metadata {
+
+	if !serverPreface( data ) {
+		return nil
+	}
+	m := &http2_metadata{}
+	dec := hpack.NewDecoder( 4096, nil )
+	var block []byte
+	for _, f := range readFrames( data ) {
+		switch f.kind {
+		case FRAME_SETTINGS:
+			if f.flags & FLAG_ACK != 0 || m.Settings != nil {
+				continue
+			}
+			m.Settings = make( map[string]uint32 )
+			for p := f.payload; len(p) >= 6; p = p[6:] {
+				id := binary.BigEndian.Uint16( p )
+				name, ok := settingNames[id]
+				if !ok {
+					continue
+				}
+				m.Settings[name] = binary.BigEndian.Uint32( p[2:] )
+			}
+		case FRAME_HEADERS, FRAME_CONTINUATION:
+			if f.kind == FRAME_HEADERS {
+				block = headerBlock( f )
+			} else {
+				block = append( block, f.payload... )
+			}
+			if f.flags & FLAG_END_HEADERS != 0 {
+				fields, err := dec.DecodeFull( block )
+				if err != nil {
+					return m
+				}
+				for _, hf := range fields {
+					m.header( hf )
+				}
+			}
+			m.ended = m.ended || f.flags & FLAG_END_STREAM != 0
+		case FRAME_DATA:
+			m.ended = m.ended || f.flags & FLAG_END_STREAM != 0
+		case FRAME_RST_STREAM:
+			if len(f.payload) == 4 {
+				m.Reset = errorName( binary.BigEndian.Uint32( f.payload ) )
+			}
+			m.ended = true
+		case FRAME_GOAWAY:
+			if len(f.payload) >= 8 {
+				m.GoAway = errorName( binary.BigEndian.Uint32( f.payload[4:] ) )
+				m.GoAwayDebug = string( f.payload[8:] )
+			}
+			m.ended = true
+		}
+	}
+	return m
+}
+
+func errorName( code uint32 ) string {
+	if name, ok := errorNames[code]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// the call on stream 1 is over, or the connection is
+func answered( data []byte ) bool {
+
+	if len(data) < FRAME_HEADER_LEN {
+		return false
+	}
+	m := parseFrames( data )
+	return m == nil || m.ended
+}
@@ -0,0 +1,120 @@
+package http2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func headers( flags byte, fields ...string ) []byte {
+	var block bytes.Buffer
+	enc := hpack.NewEncoder( &block )
+	for i := 0; i + 1 < len(fields); i += 2 {
+		enc.WriteField( hpack.HeaderField{ Name: fields[i], Value: fields[i+1] } )
+	}
+	return encodeFrame( FRAME_HEADERS, FLAG_END_HEADERS | flags, 1, block.Bytes() )
+}
+
+func concat( parts ...[]byte ) []byte {
+	return bytes.Join( parts, nil )
+}
+
+var (
+	settings = []byte{ 0x00, 0x00, 0x06, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x40, 0x00 }
+	settingsAck = encodeFrame( FRAME_SETTINGS, FLAG_ACK, 0, nil )
+	//a trailers-only response: the health service is not registered
+	unimplemented = concat( settings, settingsAck, headers( FLAG_END_STREAM, ":status", "200",
+		"content-type", "application/grpc", "grpc-status", "12", "grpc-message", "unknown service grpc.health.v1.Health" ) )
+	serving = concat( settings, headers( 0, ":status", "200", "content-type", "application/grpc" ),
+		encodeFrame( FRAME_DATA, 0, 1, []byte{ 0x00, 0x00, 0x00, 0x00, 0x02, 0x08, 0x01 } ),
+		headers( FLAG_END_STREAM, "grpc-status", "0" ) )
+	notFound = concat( settings, headers( FLAG_END_STREAM, ":status", "404", "server", "nginx" ) )
+	goaway = concat( settings, encodeFrame( FRAME_GOAWAY, 0, 0, append( make( []byte, 8 ), "idle"... ) ) )
+)
+
+func TestRequest( t *testing.T ) {
+
+	req := request( "2001:db8::1" )
+	if !bytes.HasPrefix( req, []byte( PREFACE ) ) {
+		t.Fatalf( "request: %x", req )
+	}
+	frames := readFrames( req[len(PREFACE):] )
+	if len(frames) != 3 || frames[0].kind != FRAME_SETTINGS || frames[1].kind != FRAME_HEADERS ||
+		frames[2].kind != FRAME_DATA || frames[2].flags != FLAG_END_STREAM {
+		t.Fatalf( "frames: %+v", frames )
+	}
+	fields, err := hpack.NewDecoder( 4096, nil ).DecodeFull( frames[1].payload )
+	if err != nil || len(fields) != 7 || fields[2].Value != HEALTH_CHECK || fields[3].Value != "[2001:db8::1]" {
+		t.Errorf( "headers: %v %v", fields, err )
+	}
+}
+
+func TestParseFrames( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*http2_metadata
+		label		string
+	}{
+		{ "settings", settings, &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 } }, "http2" },
+		{ "unimplemented", unimplemented, &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 },
+			Status: "200", ContentType: "application/grpc", GRPCStatus: "12",
+			GRPCMessage: "unknown service grpc.health.v1.Health", grpc: true, ended: true }, "grpc" },
+		{ "serving", serving, &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 },
+			Status: "200", ContentType: "application/grpc", GRPCStatus: "0", grpc: true, ended: true }, "grpc" },
+		{ "not found", notFound, &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 },
+			Status: "404", Server: "nginx", ended: true }, "http2" },
+		{ "goaway", goaway, &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 },
+			GoAway: "NO_ERROR", GoAwayDebug: "idle", ended: true }, "http2" },
+		{ "reset", concat( settings, encodeFrame( FRAME_RST_STREAM, 0, 1, []byte{ 0, 0, 0, 7 } ) ),
+			&http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 }, Reset: "REFUSED_STREAM",
+			ended: true }, "http2" },
+		{ "padded", concat( settings, encodeFrame( FRAME_HEADERS, FLAG_END_HEADERS | FLAG_PADDED | FLAG_END_STREAM, 1,
+			[]byte{ 0x02, 0x8d, 0x00, 0x00 } ) ), &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 },
+			Status: "404", ended: true }, "http2" },
+		{ "bad padding", concat( settings, encodeFrame( FRAME_HEADERS, FLAG_END_HEADERS | FLAG_PADDED, 1,
+			[]byte{ 0x09, 0x8d } ) ), &http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 } }, "http2" },
+		{ "bad hpack", concat( settings, encodeFrame( FRAME_HEADERS, FLAG_END_HEADERS, 1, []byte{ 0xff } ) ),
+			&http2_metadata{ Settings: map[string]uint32{ "max_frame_size": 16384 } }, "http2" },
+		{ "settings ack first", settingsAck, nil, "" },
+		{ "settings on stream 1", encodeFrame( FRAME_SETTINGS, 0, 1, nil ), nil, "" },
+		{ "odd settings", encodeFrame( FRAME_SETTINGS, 0, 0, make( []byte, 5 ) ), nil, "" },
+		{ "short", settings[:8], nil, "" },
+		{ "http/1", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil, "" },
+	} {
+		if got := parseFrames( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if got := h.Verify( string(c.data) ); got != c.label {
+			t.Errorf( "%s: Verify %q, want %q", c.name, got, c.label )
+		}
+	}
+	for i := range serving {
+		parseFrames( serving[:i] )
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		[]byte
+		answered	bool
+	}{
+		{ nil, false },
+		{ settings[:8], false },
+		{ settings, false },
+		{ serving[:len(serving)-1], false },
+		{ serving, true },
+		{ unimplemented, true },
+		{ goaway, true },
+		{ []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%x) = %v", c.data, !c.answered )
+		}
+	}
+}
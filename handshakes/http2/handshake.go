@@ -0,0 +1,43 @@
+package http2
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+
+	m := parseFrames( []byte(data) )
+	if m == nil {
+		return ""
+	}
+	if m.grpc {
+		return "grpc"
+	}
+	return "http2"
+}
+
+// the response to the health check follows the SETTINGS (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// settings, status and grpc-status (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseFrames( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "http2", &h )
+}
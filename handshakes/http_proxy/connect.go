@@ -0,0 +1,108 @@
+package http_proxy
+
+import (
+	"bufio"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+/* CONNECT to port 443 of the target itself, so that an open proxy
+ * makes no connection to anyone else:
+ *
+ *   CONNECT 192.0.2.1:443 HTTP/1.1
+ *   Host: 192.0.2.1:443
+ *
+ * a web server refuses the method (400, 405, 501). a proxy tunnels,
+ *
+ *   HTTP/1.1 200 Connection established
+ *
+ * asks for credentials (407 with Proxy-Authenticate), or fails to
+ * reach the target in its own words, e.g.
+ *
+ *   HTTP/1.1 503 Service Unavailable
+ *   Server: squid/5.7
+ *   X-Squid-Error: ERR_CONNECT_FAIL 111
+ *   Via: 1.1 proxy.example.net (squid/5.7)
+ */
+const TUNNEL_PORT = "443"
+
+type http_proxy_metadata struct {
+	Status			int			`json:"status"`
+	Reason			string		`json:"reason,omitempty"`
+	Open			bool		`json:"open"`
+	Authenticate	string		`json:"proxy_authenticate,omitempty"`
+	ProxyAgent		string		`json:"proxy_agent,omitempty"`
+	Via				string		`json:"via,omitempty"`
+	Server			string		`json:"server,omitempty"`
+	SquidError		string		`json:"squid_error,omitempty"`
+}
+
+// servers that are proxies, as they name themselves
+var proxyServers = []string{ "squid", "tinyproxy", "privoxy", "3proxy",
+	"ccproxy", "polipo", "wingate", "mikrotik httpproxy" }
+
+func authority( dst string ) string {
+	if strings.Contains( dst, ":" ) {
+		return "[" + dst + "]:" + TUNNEL_PORT
+	}
+	return dst + ":" + TUNNEL_PORT
+}
+
+func request( dst string ) []byte {
+	target := authority( dst )
+	return []byte( "CONNECT " + target + " HTTP/1.1\r\n" +
+		"Host: " + target + "\r\n" +
+		"User-Agent: Mozilla/5.0 zgrab/0.x\r\n\r\n" )
+}
+
+// nil unless the response to CONNECT comes from a proxy
+func parseResponse( data string ) *http_proxy_metadata {
+
+	req, _ := http.NewRequest( "CONNECT", "/", nil )
+	resp, err := http.ReadResponse( bufio.NewReader( strings.NewReader( data ) ), req )
+	if err != nil {
+		return nil
+	}
+	resp.Body.Close()
+	m := &http_proxy_metadata{
+		Status: resp.StatusCode,
+		Reason: strings.TrimSpace( strings.TrimPrefix( resp.Status, strconv.Itoa( resp.StatusCode ) ) ),
+		Authenticate: resp.Header.Get( "Proxy-Authenticate" ),
+		ProxyAgent: resp.Header.Get( "Proxy-Agent" ),
+		Via: resp.Header.Get( "Via" ),
+		Server: resp.Header.Get( "Server" ),
+		SquidError: resp.Header.Get( "X-Squid-Error" ),
+	}
+	server := strings.ToLower( m.Server )
+	named := false
+	for _, p := range proxyServers {
+		named = named || strings.Contains( server, p )
+	}
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+	//web servers that take any method answer 200 OK, with a body
+	case resp.StatusCode == http.StatusOK && ( !hasBody( data ) ||
+		strings.Contains( strings.ToLower( m.Reason ), "established" ) ):
+		m.Open = true
+	case m.Authenticate != "" || m.ProxyAgent != "" || m.Via != "" ||
+		m.SquidError != "" || named:
+	default:
+		return nil
+	}
+	return m
+}
+
+// whether the response has a body, or its headers announce one
+func hasBody( data string ) bool {
+
+	end := strings.Index( data, "\r\n\r\n" )
+	if end < 0 {
+		end = len(data)
+	} else if end + 4 < len(data) {
+		return true
+	}
+	headers := strings.ToLower( data[:end] )
+	return strings.Contains( headers, "\ncontent-length:" ) ||
+		strings.Contains( headers, "\ntransfer-encoding:" )
+}
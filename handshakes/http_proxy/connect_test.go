@@ -0,0 +1,74 @@
+package http_proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+var (
+	squidFail = "HTTP/1.1 503 Service Unavailable\r\nServer: squid/5.7\r\nX-Squid-Error: ERR_CONNECT_FAIL 111\r\n" +
+		"Via: 1.1 proxy.example.net (squid/5.7)\r\nContent-Length: 0\r\n\r\n"
+	established = "HTTP/1.1 200 Connection established\r\n\r\n"
+	authRequired = "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"proxy\"\r\n\r\n"
+	tinyproxy = "HTTP/1.0 403 Access denied\r\nServer: tinyproxy/1.11.1\r\nContent-Type: text/html\r\n\r\n<html>"
+	notAllowed = "HTTP/1.1 405 Not Allowed\r\nServer: nginx\r\nContent-Length: 150\r\n\r\n<html>"
+	webServer = "HTTP/1.1 200 OK\r\nServer: Apache\r\nContent-Length: 5\r\n\r\nhello"
+)
+
+func TestRequest( t *testing.T ) {
+
+	for dst, want := range map[string]string{
+		"192.0.2.1": "CONNECT 192.0.2.1:443 HTTP/1.1\r\nHost: 192.0.2.1:443\r\n",
+		"2001:db8::1": "CONNECT [2001:db8::1]:443 HTTP/1.1\r\nHost: [2001:db8::1]:443\r\n",
+	} {
+		req := string( request( dst ) )
+		if req[:len(want)] != want || req[len(req)-4:] != "\r\n\r\n" {
+			t.Errorf( "request(%s) = %q", dst, req )
+		}
+	}
+}
+
+func TestParseResponse( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		string
+		want		*http_proxy_metadata
+	}{
+		{ "established", established, &http_proxy_metadata{ Status: 200, Reason: "Connection established", Open: true } },
+		{ "bare 200", "HTTP/1.0 200 OK\r\n\r\n", &http_proxy_metadata{ Status: 200, Reason: "OK", Open: true } },
+		{ "auth required", authRequired, &http_proxy_metadata{ Status: 407, Reason: "Proxy Authentication Required",
+			Authenticate: "Basic realm=\"proxy\"" } },
+		{ "squid", squidFail, &http_proxy_metadata{ Status: 503, Reason: "Service Unavailable",
+			Via: "1.1 proxy.example.net (squid/5.7)", Server: "squid/5.7", SquidError: "ERR_CONNECT_FAIL 111" } },
+		{ "tinyproxy", tinyproxy, &http_proxy_metadata{ Status: 403, Reason: "Access denied", Server: "tinyproxy/1.11.1" } },
+		{ "web server refusing", notAllowed, nil },
+		{ "web server taking any method", webServer, nil },
+		{ "headers cut short", squidFail[:20], nil },
+		{ "empty", "", nil },
+		{ "ssh", "SSH-2.0-OpenSSH_8.9\r\n", nil },
+	} {
+		if got := parseResponse( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( c.data ) == "http_proxy" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( c.data ) )
+		}
+	}
+}
+
+func TestHasBody( t *testing.T ) {
+
+	for data, body := range map[string]bool{
+		established: false,
+		"HTTP/1.1 200 OK\r\n": false,
+		webServer: true,
+		"HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\n": true,
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n": true,
+	} {
+		if hasBody( data ) != body {
+			t.Errorf( "hasBody(%q) = %v", data, !body )
+		}
+	}
+}
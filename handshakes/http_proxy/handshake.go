@@ -0,0 +1,34 @@
+package http_proxy
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseResponse( data ) != nil {
+		return "http_proxy"
+	}
+	return ""
+}
+
+// whether the proxy tunnels, and how it names itself (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseResponse( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "http_proxy", &h )
+	lzr.AddFingerprintRule( "http_proxy", lzr.REFINES, "http" )
+}
@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/iec104"
+
+func init() {
+	iec104.RegisterHandshake()
+}
@@ -0,0 +1,128 @@
+package iec104
+
+/* IEC 60870-5-104 frames (APDUs) start with 0x68, the length of what
+ * follows (4 to 253) and four control octets. U-format frames (the
+ * first control octet ends in binary 11) carry one function:
+ *
+ *   68 04 43 00 00 00   TESTFR act      68 04 83 00 00 00   TESTFR con
+ *   68 04 07 00 00 00   STARTDT act     68 04 0b 00 00 00   STARTDT con
+ *
+ * LZR sends TESTFR act and then STARTDT act. an outstation confirms
+ * both, and once data transfer is started often sends I-format frames
+ * (first control bit 0) with an ASDU: type id, variable structure
+ * qualifier, cause of transmission, originator, common address (2).
+ */
+const (
+	START_BYTE		byte = 0x68
+	APCI_LEN		int = 6
+	MIN_LENGTH		int = 4
+	MAX_LENGTH		int = 253
+
+	TESTFR_ACT		byte = 0x43
+	TESTFR_CON		byte = 0x83
+	STARTDT_ACT		byte = 0x07
+	STARTDT_CON		byte = 0x0b
+	STOPDT_CON		byte = 0x23
+)
+
+var uFunctions = map[byte]string{
+	TESTFR_ACT: "testfr_act",
+	TESTFR_CON: "testfr_con",
+	STARTDT_ACT: "startdt_act",
+	STARTDT_CON: "startdt_con",
+	0x13: "stopdt_act",
+	STOPDT_CON: "stopdt_con",
+}
+
+type iec104_metadata struct {
+	TestFrame		bool		`json:"testfr_con"`
+	StartDT			bool		`json:"startdt_con"`
+	Functions		[]string	`json:"u_functions,omitempty"`
+	IFrames			int			`json:"i_frames,omitempty"`
+	SFrames			int			`json:"s_frames,omitempty"`
+	TypeIDs			[]int		`json:"type_ids,omitempty"`
+	CommonAddress	*int		`json:"common_address,omitempty"`
+}
+
+func uFrame( function byte ) []byte {
+	return []byte{ START_BYTE, 4, function, 0, 0, 0 }
+}
+
+func request() []byte {
+	return append( uFrame( TESTFR_ACT ), uFrame( STARTDT_ACT )... )
+}
+
+// the whole APDUs at the start of data, and what follows them
+func readAPDUs( data []byte ) ( [][]byte, []byte ) {
+
+	var apdus [][]byte
+	for len(data) >= 2 && data[0] == START_BYTE {
+		l := int( data[1] )
+		if l < MIN_LENGTH || l > MAX_LENGTH || len(data) < 2 + l {
+			break
+		}
+		apdus = append( apdus, data[:2+l] )
+		data = data[2+l:]
+	}
+	return apdus, data
+}
+
+func parseAPDUs( data []byte ) *iec104_metadata {
+
+	apdus, _ := readAPDUs( data )
+	if len(apdus) == 0 {
+		return nil
+	}
+	m := &iec104_metadata{}
+	seen := make( map[int]bool )
+	for _, apdu := range apdus {
+		control := apdu[2]
+		switch {
+		case control & 1 == 0:
+			m.IFrames++
+			//ASDU after the APCI: type, vsq, cot, originator, address
+			if len(apdu) >= APCI_LEN + 6 {
+				typ := int( apdu[APCI_LEN] )
+				if !seen[typ] {
+					seen[typ] = true
+					m.TypeIDs = append( m.TypeIDs, typ )
+				}
+				if m.CommonAddress == nil {
+					addr := int( apdu[APCI_LEN+4] ) | int( apdu[APCI_LEN+5] ) << 8
+					m.CommonAddress = &addr
+				}
+			}
+		case control & 3 == 1:
+			m.SFrames++
+		default:
+			name, known := uFunctions[ control ]
+			if !known || len(apdu) != APCI_LEN {
+				return nil
+			}
+			m.Functions = append( m.Functions, name )
+			m.TestFrame = m.TestFrame || control == TESTFR_CON
+			m.StartDT = m.StartDT || control == STARTDT_CON
+		}
+	}
+	//an IEC 104 peer answers LZR's U frames in kind
+	if len(m.Functions) == 0 {
+		return nil
+	}
+	return m
+}
+
+// both confirmations are in, or the data is not IEC 104
+func answered( data []byte ) bool {
+
+	_, rest := readAPDUs( data )
+	//the start of a frame still to come
+	if len(rest) > 0 && rest[0] == START_BYTE &&
+		( len(rest) < 2 || ( int( rest[1] ) >= MIN_LENGTH && len(rest) < 2 + int( rest[1] ) ) ) {
+		return false
+	}
+	m := parseAPDUs( data )
+	if m == nil {
+		return true
+	}
+	return m.TestFrame && m.StartDT
+}
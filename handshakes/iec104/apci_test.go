@@ -0,0 +1,60 @@
+package iec104
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+var (
+	confirmed = append( uFrame( TESTFR_CON ), uFrame( STARTDT_CON )... )
+	//then an interrogation command activation confirmation (type 100) from common address 1
+	withData = append( append( []byte{}, confirmed... ),
+		0x68, 0x0e, 0x00, 0x00, 0x02, 0x00, 0x64, 0x01, 0x07, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x14 )
+)
+
+func TestRequest( t *testing.T ) {
+	want := []byte{ 0x68, 0x04, 0x43, 0x00, 0x00, 0x00, 0x68, 0x04, 0x07, 0x00, 0x00, 0x00 }
+	if !bytes.Equal( request(), want ) {
+		t.Errorf( "request % x", request() )
+	}
+}
+
+func TestParseAPDUs( t *testing.T ) {
+
+	addr := 1
+	tests := []struct {
+		name			string
+		data			[]byte
+		want			*iec104_metadata
+		answered		bool
+	}{
+		{ "confirmed", confirmed, &iec104_metadata{ TestFrame: true, StartDT: true,
+			Functions: []string{ "testfr_con", "startdt_con" } }, true },
+		{ "with data", withData, &iec104_metadata{ TestFrame: true, StartDT: true,
+			Functions: []string{ "testfr_con", "startdt_con" }, IFrames: 1, TypeIDs: []int{ 100 },
+			CommonAddress: &addr }, true },
+		{ "testfr only", uFrame( TESTFR_CON ), &iec104_metadata{ TestFrame: true,
+			Functions: []string{ "testfr_con" } }, false },
+		{ "second frame cut short", confirmed[:9], &iec104_metadata{ TestFrame: true,
+			Functions: []string{ "testfr_con" } }, false },
+		{ "s frame only", []byte{ 0x68, 0x04, 0x01, 0x00, 0x02, 0x00 }, nil, true },
+		{ "unknown u function", uFrame( 0x33 ), nil, true },
+		{ "long u frame", []byte{ 0x68, 0x05, 0x83, 0x00, 0x00, 0x00, 0x00 }, nil, true },
+		{ "length 3", []byte{ 0x68, 0x03, 0x83, 0x00, 0x00 }, nil, true },
+		{ "start byte only", []byte{ 0x68 }, nil, false },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil, true },
+	}
+	for _, tt := range tests {
+		if m := parseAPDUs( tt.data ); !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "%s: got %+v, want %+v", tt.name, m, tt.want )
+		}
+		if a := answered( tt.data ); a != tt.answered {
+			t.Errorf( "%s: answered = %v", tt.name, a )
+		}
+	}
+	for i := range withData {
+		parseAPDUs( withData[:i] )
+		answered( withData[:i] )
+	}
+}
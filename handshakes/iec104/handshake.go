@@ -0,0 +1,38 @@
+package iec104
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseAPDUs( []byte(data) ) != nil {
+		return "iec104"
+	}
+	return ""
+}
+
+// wait for both confirmations (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// the confirmations and what was sent once started (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseAPDUs( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "iec104", &h )
+}
@@ -41,5 +41,6 @@ func (h *HandshakeMod) Verify( data string ) string {
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "ipp", &h )
+	lzr.AddFingerprintRule( "ipp", lzr.REFINES, lzr.ANY_FINGERPRINT )
 }
 
@@ -0,0 +1,38 @@
+package jdwp
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseReply( data ) != nil {
+		return "jdwp"
+	}
+	return ""
+}
+
+// wait for the Version reply after the echo (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// the debugged VM's name and version (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseReply( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "jdwp", &h )
+}
@@ -0,0 +1,110 @@
+package jdwp
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+/* the JDWP handshake, which the JVM echoes, followed right away by a
+ * VirtualMachine.Version command (set 1, command 1). the reply packet
+ * carries a description, the JDWP version and the VM's, e.g.
+ *
+ *   "JDWP-Handshake"
+ *   00 00 00 e5 6c 7a 72 31 80 00 00
+ *   00 00 00 a6 "Java Debug Wire Protocol (Reference Implementation) version 17.0\n..."
+ *   00 00 00 11 00 00 00 00 00 00 00 08 "17.0.9+9"
+ *   00 00 00 18 "OpenJDK 64-Bit Server VM"
+ */
+const (
+	HANDSHAKE			string = "JDWP-Handshake"
+	HEADER_LEN			int = 11
+	PACKET_ID			uint32 = 0x6c7a7231
+	FLAG_REPLY			byte = 0x80
+	VIRTUAL_MACHINE		byte = 1
+	VERSION				byte = 1
+)
+
+type jdwp_metadata struct {
+	Description		string		`json:"description,omitempty"`
+	JDWPVersion		string		`json:"jdwp_version,omitempty"`
+	VMVersion		string		`json:"vm_version,omitempty"`
+	VMName			string		`json:"vm_name,omitempty"`
+	ErrorCode		uint16		`json:"error_code,omitempty"`
+}
+
+func request() []byte {
+
+	cmd := make( []byte, HEADER_LEN )
+	binary.BigEndian.PutUint32( cmd, uint32( HEADER_LEN ) )
+	binary.BigEndian.PutUint32( cmd[4:], PACKET_ID )
+	cmd[9], cmd[10] = VIRTUAL_MACHINE, VERSION
+	return append( []byte( HANDSHAKE ), cmd... )
+}
+
+// the reply packet after the echoed handshake, whole or not
+func reply( data string ) []byte {
+	return []byte( strings.TrimPrefix( data, HANDSHAKE ) )
+}
+
+type reader struct {
+	b				[]byte
+	ok				bool
+}
+
+func ( r *reader ) int() int {
+	if len(r.b) < 4 {
+		r.ok = false
+		return 0
+	}
+	n := int( int32( binary.BigEndian.Uint32( r.b ) ) )
+	r.b = r.b[4:]
+	return n
+}
+
+func ( r *reader ) string() string {
+	l := r.int()
+	if !r.ok || l < 0 || len(r.b) < l {
+		r.ok = false
+		return ""
+	}
+	s := string( r.b[:l] )
+	r.b = r.b[l:]
+	return s
+}
+
+// nil unless data starts with the echoed handshake
+func parseReply( data string ) *jdwp_metadata {
+
+	if !strings.HasPrefix( data, HANDSHAKE ) {
+		return nil
+	}
+	m := &jdwp_metadata{}
+	p := reply( data )
+	if len(p) < HEADER_LEN || binary.BigEndian.Uint32( p[4:] ) != PACKET_ID ||
+		p[8] != FLAG_REPLY {
+		return m
+	}
+	if m.ErrorCode = binary.BigEndian.Uint16( p[9:] ); m.ErrorCode != 0 {
+		return m
+	}
+	r := &reader{ b: p[HEADER_LEN:], ok: true }
+	m.Description = r.string()
+	major, minor := r.int(), r.int()
+	if r.ok {
+		m.JDWPVersion = strconv.Itoa( major ) + "." + strconv.Itoa( minor )
+	}
+	m.VMVersion = r.string()
+	m.VMName = r.string()
+	return m
+}
+
+// the reply packet is in, by its length
+func answered( data string ) bool {
+
+	if !strings.HasPrefix( data, HANDSHAKE ) {
+		return !strings.HasPrefix( HANDSHAKE, data )
+	}
+	p := reply( data )
+	return len(p) >= 4 && len(p) >= int( binary.BigEndian.Uint32( p ) )
+}
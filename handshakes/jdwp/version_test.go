@@ -0,0 +1,94 @@
+package jdwp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func jdwpString( s string ) []byte {
+	b := make( []byte, 4 )
+	binary.BigEndian.PutUint32( b, uint32( len(s) ) )
+	return append( b, s... )
+}
+
+// a reply packet to our Version command
+func versionReply( errorCode uint16, body ...[]byte ) string {
+	p := make( []byte, HEADER_LEN )
+	binary.BigEndian.PutUint32( p[4:], PACKET_ID )
+	p[8] = FLAG_REPLY
+	binary.BigEndian.PutUint16( p[9:], errorCode )
+	for _, b := range body {
+		p = append( p, b... )
+	}
+	binary.BigEndian.PutUint32( p, uint32( len(p) ) )
+	return HANDSHAKE + string(p)
+}
+
+var (
+	description = "Java Debug Wire Protocol (Reference Implementation) version 17.0\nJVM Debug Interface version 17.0"
+	openjdk = versionReply( 0, jdwpString( description ), []byte{ 0, 0, 0, 17, 0, 0, 0, 0 },
+		jdwpString( "17.0.9+9" ), jdwpString( "OpenJDK 64-Bit Server VM" ) )
+)
+
+func TestRequest( t *testing.T ) {
+
+	req := request()
+	if string( req[:len(HANDSHAKE)] ) != HANDSHAKE || len(req) != len(HANDSHAKE) + HEADER_LEN ||
+		binary.BigEndian.Uint32( req[len(HANDSHAKE):] ) != uint32( HEADER_LEN ) {
+		t.Errorf( "request: %q", req )
+	}
+}
+
+func TestParseReply( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		string
+		want		*jdwp_metadata
+	}{
+		{ "openjdk", openjdk, &jdwp_metadata{ Description: description, JDWPVersion: "17.0",
+			VMVersion: "17.0.9+9", VMName: "OpenJDK 64-Bit Server VM" } },
+		{ "echo only", HANDSHAKE, &jdwp_metadata{} },
+		{ "error", versionReply( 112 ), &jdwp_metadata{ ErrorCode: 112 } },
+		{ "name cut short", openjdk[:len(openjdk)-5], &jdwp_metadata{ Description: description,
+			JDWPVersion: "17.0", VMVersion: "17.0.9+9" } },
+		{ "description cut short", openjdk[:len(HANDSHAKE)+HEADER_LEN+20], &jdwp_metadata{} },
+		{ "negative length", versionReply( 0, []byte{ 0xff, 0xff, 0xff, 0xff } ), &jdwp_metadata{} },
+		{ "other packet", HANDSHAKE + "\x00\x00\x00\x0b\x00\x00\x00\x01\x80\x00\x00", &jdwp_metadata{} },
+		{ "half the echo", HANDSHAKE[:5], nil },
+		{ "empty", "", nil },
+		{ "http", "HTTP/1.1 400 Bad Request\r\n\r\n", nil },
+	} {
+		if got := parseReply( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( c.data ) == "jdwp" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( c.data ) )
+		}
+	}
+	for i := range openjdk {
+		parseReply( openjdk[:i] )
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		string
+		answered	bool
+	}{
+		{ "", false },
+		{ HANDSHAKE[:4], false },
+		{ HANDSHAKE, false },
+		{ openjdk[:len(openjdk)-1], false },
+		{ openjdk, true },
+		{ versionReply( 112 ), true },
+		{ "HTTP/1.1 400 Bad Request\r\n\r\n", true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%q) = %v", c.data, !c.answered )
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package kafka
+
+import (
+	"encoding/binary"
+)
+
+/* an ApiVersions v0 request (api key 18) and its response. Kafka frames
+ * are a big endian int32 size and the message. the request header is
+ * api key, api version, correlation id and client id (int16 length);
+ * the response echoes the correlation id, then an error code and an
+ * int32 count of (api key, min version, max version), e.g.
+ *
+ *   00 00 01 a2 6c 7a 72 31  00 00 00 00 00 44  00 00 00 00 00 09  00 01 00 00 00 0c ...
+ *
+ * brokers do not state their release, but each one raised the versions
+ * of the Fetch API (key 1) it accepts.
+ */
+const (
+	API_FETCH			int16 = 1
+	API_VERSIONS		int16 = 18
+	CORRELATION_ID		uint32 = 0x6c7a7231
+	CLIENT_ID			string = "lzr"
+
+	MAX_RESPONSE_SIZE	int = 65536
+)
+
+// the release that introduced each Fetch version
+var fetchReleases = map[int16]string{
+	2: "0.10.0",
+	3: "0.10.1",
+	5: "0.11.0",
+	6: "1.0",
+	7: "1.1",
+	8: "2.0",
+	10: "2.1",
+	11: "2.3",
+	12: "2.7",
+	13: "3.1",
+}
+
+type api_versions struct {
+	Min				int16		`json:"min"`
+	Max				int16		`json:"max"`
+}
+
+type kafka_metadata struct {
+	ErrorCode		int16					`json:"error_code,omitempty"`
+	APIs			map[int16]api_versions	`json:"api_versions,omitempty"`
+	MinVersion		string					`json:"min_version,omitempty"`
+}
+
+func apiVersionsRequest() []byte {
+
+	b := make( []byte, 14, 14 + len(CLIENT_ID) )
+	be := binary.BigEndian
+	be.PutUint32( b[0:4], uint32( 10 + len(CLIENT_ID) ) )
+	be.PutUint16( b[4:6], uint16( API_VERSIONS ) )
+	be.PutUint32( b[8:12], CORRELATION_ID )
+	be.PutUint16( b[12:14], uint16( len(CLIENT_ID) ) )
+	return append( b, CLIENT_ID... )
+}
+
+// the oldest release accepting Fetch up to max
+func inferRelease( max int16 ) string {
+
+	for v := max; v > 0; v-- {
+		if release, ok := fetchReleases[v]; ok {
+			return release
+		}
+	}
+	return ""
+}
+
+func parseApiVersions( data []byte ) *kafka_metadata {
+
+	if len(data) < 10 {
+		return nil
+	}
+	be := binary.BigEndian
+	size := int( be.Uint32( data[0:4] ) )
+	if size < 6 || size > MAX_RESPONSE_SIZE || be.Uint32( data[4:8] ) != CORRELATION_ID {
+		return nil
+	}
+	m := &kafka_metadata{ ErrorCode: int16( be.Uint16( data[8:10] ) ) }
+	body := data[10:]
+	if len(body) > size - 6 {
+		body = body[:size-6]
+	}
+	if len(body) < 4 {
+		return m
+	}
+	count := int( be.Uint32( body[0:4] ) )
+	body = body[4:]
+	for ; count > 0 && len(body) >= 6; count-- {
+		key := int16( be.Uint16( body[0:2] ) )
+		if m.APIs == nil {
+			m.APIs = make( map[int16]api_versions )
+		}
+		m.APIs[key] = api_versions{ Min: int16( be.Uint16( body[2:4] ) ), Max: int16( be.Uint16( body[4:6] ) ) }
+		body = body[6:]
+	}
+	if fetch, ok := m.APIs[ API_FETCH ]; ok {
+		m.MinVersion = inferRelease( fetch.Max )
+	}
+	return m
+}
+
+// the whole response is in once its size is
+func answered( data []byte ) bool {
+
+	if len(data) < 4 {
+		return false
+	}
+	size := int( binary.BigEndian.Uint32( data[0:4] ) )
+	return size > MAX_RESPONSE_SIZE || len(data) >= 4 + size
+}
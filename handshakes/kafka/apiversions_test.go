@@ -0,0 +1,87 @@
+package kafka
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/smb"
+)
+
+func unhex( s string ) []byte {
+	b, err := hex.DecodeString( s )
+	if err != nil {
+		panic( err )
+	}
+	return b
+}
+
+var (
+	//Produce 0-9, Fetch 0-12, ListOffsets 0-6, Metadata 0-11 and ApiVersions 0-3, as from 2.7
+	apiVersions = unhex( "00000028" + "6c7a7231" + "0000" + "00000005" +
+		"000000000009" + "00010000000c" + "000200000006" + "00030000000b" + "001200000003" )
+	//UNSUPPORTED_VERSION with no APIs
+	unsupported = unhex( "0000000a" + "6c7a7231" + "0023" + "00000000" )
+	//an entry whose versions spell "SMB"
+	smbBytes = unhex( "00000010" + "6c7a7231" + "0000" + "00000001" + "0053" + "4d42" + "0001" )
+)
+
+func TestParseApiVersions( t *testing.T ) {
+
+	m := parseApiVersions( apiVersions )
+	if m == nil || m.ErrorCode != 0 || len(m.APIs) != 5 || m.APIs[API_FETCH].Max != 12 ||
+		m.APIs[API_VERSIONS].Max != 3 || m.MinVersion != "2.7" {
+		t.Errorf( "api versions: %+v", m )
+	}
+	if m := parseApiVersions( unsupported ); m == nil || m.ErrorCode != 35 || m.APIs != nil || m.MinVersion != "" {
+		t.Errorf( "unsupported: %+v", m )
+	}
+
+	var h HandshakeMod
+	for _, v := range [][]byte{
+		nil,
+		apiVersions[:9],
+		//another correlation id
+		unhex( "0000000a" + "00000001" + "0000" + "00000000" ),
+		//a size no ApiVersions response has
+		unhex( "7fffffff" + "6c7a7231" + "0000" ),
+		[]byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ),
+	} {
+		if m := parseApiVersions( v ); m != nil || h.Verify( string(v) ) != "" {
+			t.Errorf( "%x: %+v", v, m )
+		}
+	}
+	for i := range apiVersions {
+		parseApiVersions( apiVersions[:i] )
+		if i >= 4 && answered( apiVersions[:i] ) {
+			t.Errorf( "answered after %d of %d bytes", i, len(apiVersions) )
+		}
+	}
+	if !answered( apiVersions ) || !answered( unsupported ) {
+		t.Error( "not answered" )
+	}
+}
+
+func TestInferRelease( t *testing.T ) {
+
+	for max, release := range map[int16]string{ 0: "", 2: "0.10.0", 4: "0.10.1", 9: "2.0", 13: "3.1", 15: "3.1" } {
+		if got := inferRelease( max ); got != release {
+			t.Errorf( "Fetch v%d: %q, want %q", max, got, release )
+		}
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	smb.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		string(apiVersions): "kafka",
+		string(smbBytes): "kafka",
+		"\x00\x00\x00\x55\xffSMBr": "smb",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%x: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
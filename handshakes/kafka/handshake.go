@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return apiVersionsRequest()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseApiVersions( []byte(data) ) != nil {
+		return "kafka"
+	}
+	return ""
+}
+
+// ApiVersions can span segments (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// supported API versions and the release they imply (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseApiVersions( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "kafka", &h )
+	//smb matches "SMB" anywhere, which a binary frame can hold
+	lzr.AddFingerprintRule( "kafka", lzr.OVERRIDES, "smb" )
+}
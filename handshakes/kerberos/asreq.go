@@ -0,0 +1,165 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+/* an AS-REQ (RFC 4120 5.4.1) for a made up client in a made up realm,
+ * asking for a TGT. over TCP each message has a 4 byte big endian
+ * length in front, over UDP it is bare. a KDC answers with a KRB-ERROR
+ * ([APPLICATION 30]) that gives away its realm and clock, e.g.
+ *
+ *   00 00 00 5c 7e 5a 30 58 a0 03 02 01 05 a1 03 02 01 1e
+ *   a4 11 18 0f "20241003101530Z" a5 05 02 03 0b 2f 3c a6 03 02 01 44
+ *   a9 0c 1b 0a "CORP.LOCAL" aa 1f 30 1d ...
+ *
+ * (error 68, KDC_ERR_WRONG_REALM). an AS-REP ([APPLICATION 11]) is
+ * possible only for a client that needs no preauthentication.
+ */
+const (
+	PVNO				int = 5
+	MSG_AS_REQ			int = 10
+	MSG_AS_REP			int = 11
+	MSG_KRB_ERROR		int = 30
+
+	CLIENT_NAME			string = "lzr"
+	REALM				string = "LZR.INVALID"
+	NONCE				int = 0x6c7a7231
+
+	NT_PRINCIPAL		int = 1
+	NT_SRV_INST			int = 2
+)
+
+var errorNames = map[int]string{
+	6: "KDC_ERR_C_PRINCIPAL_UNKNOWN",
+	7: "KDC_ERR_S_PRINCIPAL_UNKNOWN",
+	14: "KDC_ERR_ETYPE_NOSUPP",
+	18: "KDC_ERR_CLIENT_REVOKED",
+	24: "KDC_ERR_PREAUTH_FAILED",
+	25: "KDC_ERR_PREAUTH_REQUIRED",
+	37: "KRB_AP_ERR_SKEW",
+	60: "KRB_ERR_GENERIC",
+	68: "KDC_ERR_WRONG_REALM",
+}
+
+type kerberos_metadata struct {
+	Message			string		`json:"message"`
+	ErrorCode		*int		`json:"error_code,omitempty"`
+	Error			string		`json:"error,omitempty"`
+	Realm			string		`json:"realm,omitempty"`
+	ServiceName		string		`json:"sname,omitempty"`
+	ServerTime		string		`json:"server_time,omitempty"`
+	ErrorText		string		`json:"e_text,omitempty"`
+}
+
+func principal( nameType int, names ...string ) []byte {
+
+	var strs [][]byte
+	for _, n := range names {
+		strs = append( strs, encode( TAG_GENERAL_STRING, []byte(n) ) )
+	}
+	return encode( TAG_SEQUENCE,
+		encode( context(0), encodeInt( nameType ) ),
+		encode( context(1), encode( TAG_SEQUENCE, strs... ) ),
+	)
+}
+
+func asReq() []byte {
+
+	body := encode( TAG_SEQUENCE,
+		//forwardable, renewable, canonicalize, renewable-ok
+		encode( context(0), encode( TAG_BIT_STRING, []byte{ 0x00, 0x40, 0x81, 0x00, 0x10 } ) ),
+		encode( context(1), principal( NT_PRINCIPAL, CLIENT_NAME ) ),
+		encode( context(2), encode( TAG_GENERAL_STRING, []byte(REALM) ) ),
+		encode( context(3), principal( NT_SRV_INST, "krbtgt", REALM ) ),
+		encode( context(5), encode( TAG_GENERALIZED_TIME, []byte("20370913024805Z") ) ),
+		encode( context(7), encodeInt( NONCE ) ),
+		//aes256, aes128, rc4-hmac
+		encode( context(8), encode( TAG_SEQUENCE, encodeInt( 18 ), encodeInt( 17 ), encodeInt( 23 ) ) ),
+	)
+	return encode( application( MSG_AS_REQ ), encode( TAG_SEQUENCE,
+		encode( context(1), encodeInt( PVNO ) ),
+		encode( context(2), encodeInt( MSG_AS_REQ ) ),
+		encode( context(4), body ),
+	) )
+}
+
+func asReqTCP() []byte {
+	req := asReq()
+	prefix := make( []byte, 4 )
+	binary.BigEndian.PutUint32( prefix, uint32( len(req) ) )
+	return append( prefix, req... )
+}
+
+// the message, without the length TCP puts in front
+func message( data []byte ) []byte {
+	if len(data) > 4 && data[0] == 0 {
+		return data[4:]
+	}
+	return data
+}
+
+func principalName( seq []byte ) string {
+
+	f := fields( seq )
+	strs, ok := f[1]
+	if !ok {
+		return ""
+	}
+	var names []string
+	for rest := strs.value; len(rest) > 0; {
+		t, next, ok := decode( rest )
+		if !ok {
+			break
+		}
+		names = append( names, string( t.value ) )
+		rest = next
+	}
+	return strings.Join( names, "/" )
+}
+
+// nil unless data is a KRB-ERROR or AS-REP
+func parseReply( data []byte ) *kerberos_metadata {
+
+	outer, _, ok := decode( message( data ) )
+	if !ok || ( outer.tag != application( MSG_KRB_ERROR ) && outer.tag != application( MSG_AS_REP ) ) {
+		return nil
+	}
+	seq, _, ok := decode( outer.value )
+	if !ok || seq.tag != TAG_SEQUENCE {
+		return nil
+	}
+	f := fields( seq.value )
+	m := &kerberos_metadata{}
+	if outer.tag == application( MSG_AS_REP ) {
+		//pvno [0], msg-type [1], padata [2], crealm [3]
+		if pvno, ok := f[0]; !ok || integer( pvno.value ) != PVNO {
+			return nil
+		}
+		m.Message = "as_rep"
+		m.Realm = string( f[3].value )
+		return m
+	}
+	if pvno, ok := f[0]; !ok || integer( pvno.value ) != PVNO {
+		return nil
+	}
+	m.Message = "krb_error"
+	if code, ok := f[6]; ok {
+		c := integer( code.value )
+		m.ErrorCode = &c
+		m.Error = errorNames[c]
+	}
+	if stime, ok := f[4]; ok {
+		if t, err := time.Parse( "20060102150405Z", string( stime.value ) ); err == nil {
+			m.ServerTime = t.Format( time.RFC3339 )
+		}
+	}
+	m.Realm = string( f[9].value )
+	if sname, ok := f[10]; ok {
+		m.ServiceName = principalName( sname.value )
+	}
+	m.ErrorText = string( f[11].value )
+	return m
+}
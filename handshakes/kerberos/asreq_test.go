@@ -0,0 +1,99 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func krbError( code int, realm string, extra ...[]byte ) []byte {
+	parts := append( [][]byte{
+		encode( context(0), encodeInt( PVNO ) ),
+		encode( context(1), encodeInt( MSG_KRB_ERROR ) ),
+		encode( context(4), encode( TAG_GENERALIZED_TIME, []byte("20241003101530Z") ) ),
+		encode( context(5), encodeInt( 733500 ) ),
+		encode( context(6), encodeInt( code ) ),
+		encode( context(9), encode( TAG_GENERAL_STRING, []byte(realm) ) ),
+		encode( context(10), principal( NT_SRV_INST, "krbtgt", realm ) ),
+	}, extra... )
+	return encode( application( MSG_KRB_ERROR ), encode( TAG_SEQUENCE, parts... ) )
+}
+
+// the TCP length prefix
+func tcp( msg []byte ) []byte {
+	b := make( []byte, 4 )
+	binary.BigEndian.PutUint32( b, uint32( len(msg) ) )
+	return append( b, msg... )
+}
+
+var (
+	wrongRealm = krbError( 68, "CORP.LOCAL" )
+	preauth = krbError( 25, "CORP.LOCAL",
+		encode( context(11), encode( TAG_GENERAL_STRING, []byte("NEEDED_PREAUTH") ) ) )
+	asRep = encode( application( MSG_AS_REP ), encode( TAG_SEQUENCE,
+		encode( context(0), encodeInt( PVNO ) ),
+		encode( context(1), encodeInt( MSG_AS_REP ) ),
+		encode( context(3), encode( TAG_GENERAL_STRING, []byte("EXAMPLE.ORG") ) ),
+	) )
+)
+
+func TestAsReq( t *testing.T ) {
+
+	req := asReqTCP()
+	if int( binary.BigEndian.Uint32( req[:4] ) ) != len(req) - 4 || req[4] != application( MSG_AS_REQ ) {
+		t.Errorf( "as-req: %x", req )
+	}
+	outer, rest, ok := decode( asReq() )
+	seq, _, _ := decode( outer.value )
+	f := fields( seq.value )
+	if !ok || len(rest) != 0 || integer( f[1].value ) != PVNO || integer( f[2].value ) != MSG_AS_REQ {
+		t.Errorf( "as-req does not decode: %x", asReq() )
+	}
+	body := fields( f[4].value )
+	if string( body[2].value ) != REALM || principalName( body[3].value ) != "krbtgt/" + REALM ||
+		integer( body[7].value ) != NONCE {
+		t.Errorf( "as-req body: %v", body )
+	}
+}
+
+func TestParseReply( t *testing.T ) {
+
+	wrong, needed := 68, 25
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*kerberos_metadata
+	}{
+		{ "wrong realm", tcp( wrongRealm ), &kerberos_metadata{ Message: "krb_error", ErrorCode: &wrong,
+			Error: "KDC_ERR_WRONG_REALM", Realm: "CORP.LOCAL", ServiceName: "krbtgt/CORP.LOCAL",
+			ServerTime: "2024-10-03T10:15:30Z" } },
+		{ "udp", wrongRealm, &kerberos_metadata{ Message: "krb_error", ErrorCode: &wrong,
+			Error: "KDC_ERR_WRONG_REALM", Realm: "CORP.LOCAL", ServiceName: "krbtgt/CORP.LOCAL",
+			ServerTime: "2024-10-03T10:15:30Z" } },
+		{ "preauth required", tcp( preauth ), &kerberos_metadata{ Message: "krb_error", ErrorCode: &needed,
+			Error: "KDC_ERR_PREAUTH_REQUIRED", Realm: "CORP.LOCAL", ServiceName: "krbtgt/CORP.LOCAL",
+			ServerTime: "2024-10-03T10:15:30Z", ErrorText: "NEEDED_PREAUTH" } },
+		{ "as-rep", tcp( asRep ), &kerberos_metadata{ Message: "as_rep", Realm: "EXAMPLE.ORG" } },
+		{ "pvno 4", encode( application( MSG_KRB_ERROR ), encode( TAG_SEQUENCE,
+			encode( context(0), encodeInt( 4 ) ) ) ), nil },
+		{ "no pvno", encode( application( MSG_AS_REP ), encode( TAG_SEQUENCE ) ), nil },
+		{ "not a sequence", encode( application( MSG_KRB_ERROR ), encodeInt( 5 ) ), nil },
+		{ "as-req", asReqTCP(), nil },
+		{ "cut short", tcp( wrongRealm )[:40], nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseReply( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+	}
+	var h HandshakeMod
+	for _, v := range [][]byte{ tcp( wrongRealm ), preauth, tcp( asRep ) } {
+		if h.Verify( string(v) ) != "kerberos" {
+			t.Errorf( "Verify(%x) is not kerberos", v )
+		}
+		for i := range v {
+			parseReply( v[:i] )
+		}
+	}
+}
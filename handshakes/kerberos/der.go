@@ -0,0 +1,112 @@
+package kerberos
+
+/* the DER Kerberos messages need: a tag octet, a short or long form
+ * length and the contents.
+ */
+const (
+	TAG_INTEGER			byte = 0x02
+	TAG_BIT_STRING		byte = 0x03
+	TAG_SEQUENCE		byte = 0x30
+	TAG_GENERAL_STRING	byte = 0x1b
+	TAG_GENERALIZED_TIME	byte = 0x18
+)
+
+type tlv struct {
+	tag				byte
+	value			[]byte
+}
+
+// [n] EXPLICIT
+func context( n int ) byte {
+	return 0xa0 | byte(n)
+}
+
+// [APPLICATION n], constructed
+func application( n int ) byte {
+	return 0x60 | byte(n)
+}
+
+func encodeLength( l int ) []byte {
+
+	if l < 0x80 {
+		return []byte{ byte(l) }
+	}
+	var b []byte
+	for ; l > 0; l >>= 8 {
+		b = append( []byte{ byte(l) }, b... )
+	}
+	return append( []byte{ 0x80 | byte(len(b)) }, b... )
+}
+
+func encode( tag byte, parts ...[]byte ) []byte {
+
+	var value []byte
+	for _, p := range parts {
+		value = append( value, p... )
+	}
+	return append( append( []byte{ tag }, encodeLength( len(value) )... ), value... )
+}
+
+func encodeInt( n int ) []byte {
+
+	b := []byte{ byte(n) }
+	for n >>= 8; n > 0; n >>= 8 {
+		b = append( []byte{ byte(n) }, b... )
+	}
+	if b[0] & 0x80 != 0 {
+		b = append( []byte{ 0 }, b... )
+	}
+	return encode( TAG_INTEGER, b )
+}
+
+func decode( b []byte ) ( tlv, []byte, bool ) {
+
+	if len(b) < 2 {
+		return tlv{}, nil, false
+	}
+	tag, l, rest := b[0], int( b[1] ), b[2:]
+	if l & 0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 || len(rest) < n {
+			return tlv{}, nil, false
+		}
+		l = 0
+		for _, c := range rest[:n] {
+			l = l << 8 | int(c)
+		}
+		rest = rest[n:]
+	}
+	if l < 0 || len(rest) < l {
+		return tlv{}, nil, false
+	}
+	return tlv{ tag: tag, value: rest[:l] }, rest[l:], true
+}
+
+// the fields of a SEQUENCE of [n] EXPLICIT values, by n
+func fields( seq []byte ) map[int]tlv {
+
+	f := make( map[int]tlv )
+	for len(seq) > 0 {
+		t, rest, ok := decode( seq )
+		if !ok || t.tag & 0xe0 != 0xa0 {
+			break
+		}
+		if inner, _, ok := decode( t.value ); ok {
+			f[ int( t.tag & 0x1f ) ] = inner
+		}
+		seq = rest
+	}
+	return f
+}
+
+func integer( b []byte ) int {
+
+	n := 0
+	for i, c := range b {
+		if i == 0 && c & 0x80 != 0 {
+			n = -1
+		}
+		n = n << 8 | int(c)
+	}
+	return n
+}
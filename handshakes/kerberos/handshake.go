@@ -0,0 +1,38 @@
+package kerberos
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return asReqTCP()
+}
+
+// over UDP the AS-REQ goes without the TCP length prefix
+func (h *HandshakeMod) GetUDPData( dst string ) []byte {
+	return asReq()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseReply( []byte(data) ) != nil {
+		return "kerberos"
+	}
+	return ""
+}
+
+// the KDC's realm, clock and error (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseReply( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "kerberos", &h )
+}
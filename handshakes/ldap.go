@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/ldap"
+
+func init() {
+	ldap.RegisterHandshake()
+}
@@ -0,0 +1,90 @@
+package ldap
+
+/* the little BER LDAP needs (RFC 4511 restricts it to definite lengths):
+ * a tag octet, a length (short form, or 0x8n and n big endian octets)
+ * and the contents.
+ */
+const (
+	TAG_INTEGER		byte = 0x02
+	TAG_OCTETS		byte = 0x04
+	TAG_ENUMERATED	byte = 0x0a
+	TAG_SEQUENCE	byte = 0x30
+	TAG_SET			byte = 0x31
+)
+
+type tlv struct {
+	tag				byte
+	value			[]byte
+}
+
+func encodeLength( l int ) []byte {
+
+	if l < 0x80 {
+		return []byte{ byte(l) }
+	}
+	var b []byte
+	for ; l > 0; l >>= 8 {
+		b = append( []byte{ byte(l) }, b... )
+	}
+	return append( []byte{ 0x80 | byte(len(b)) }, b... )
+}
+
+func encode( tag byte, parts ...[]byte ) []byte {
+
+	var value []byte
+	for _, p := range parts {
+		value = append( value, p... )
+	}
+	return append( append( []byte{ tag }, encodeLength( len(value) )... ), value... )
+}
+
+// the TLV at the start of b and what follows it
+func decode( b []byte ) ( tlv, []byte, bool ) {
+
+	if len(b) < 2 {
+		return tlv{}, nil, false
+	}
+	tag, l, rest := b[0], int( b[1] ), b[2:]
+	if l & 0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 || len(rest) < n {
+			return tlv{}, nil, false
+		}
+		l = 0
+		for _, c := range rest[:n] {
+			l = l << 8 | int(c)
+		}
+		rest = rest[n:]
+	}
+	if l < 0 || len(rest) < l {
+		return tlv{}, nil, false
+	}
+	return tlv{ tag: tag, value: rest[:l] }, rest[l:], true
+}
+
+// all TLVs in b, as long as they are whole
+func decodeAll( b []byte ) []tlv {
+
+	var tlvs []tlv
+	for len(b) > 0 {
+		t, rest, ok := decode( b )
+		if !ok {
+			break
+		}
+		tlvs = append( tlvs, t )
+		b = rest
+	}
+	return tlvs
+}
+
+func integer( b []byte ) int {
+
+	n := 0
+	for i, c := range b {
+		if i == 0 && c & 0x80 != 0 {
+			n = -1
+		}
+		n = n << 8 | int(c)
+	}
+	return n
+}
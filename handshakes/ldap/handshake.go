@@ -0,0 +1,38 @@
+package ldap
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return searchRequest()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseResponse( []byte(data) ) != nil || searchReply( []byte(data) ) {
+		return "ldap"
+	}
+	return ""
+}
+
+// read through SearchResultDone (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// naming contexts, versions, SASL mechanisms and AD levels (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseResponse( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "ldap", &h )
+}
@@ -0,0 +1,226 @@
+package ldap
+
+import (
+	"strconv"
+)
+
+/* a search of the root DSE: base "", scope base, filter
+ * (objectClass=*), for the attributes that describe the server. a
+ * directory answers with a SearchResultEntry and a SearchResultDone,
+ * each an LDAPMessage: SEQUENCE { messageID, protocolOp }, e.g.
+ *
+ *   30 26 02 01 01 64 21 04 00 30 1d 30 1b 04 14 "supportedLDAPVersion"
+ *   31 03 04 01 "3"  30 0c 02 01 01 65 07 0a 01 00 04 00 04 00
+ *
+ * a server that will not talk to us may instead send a Notice of
+ * Disconnection, an ExtendedResponse with messageID 0.
+ */
+const (
+	MESSAGE_ID			int = 1
+
+	OP_SEARCH_REQUEST	byte = 0x63
+	OP_SEARCH_ENTRY		byte = 0x64
+	OP_SEARCH_DONE		byte = 0x65
+	OP_EXTENDED_RESP	byte = 0x78
+	FILTER_PRESENT		byte = 0x87
+)
+
+var rootDSEAttributes = []string{
+	"namingContexts", "defaultNamingContext", "supportedLDAPVersion",
+	"supportedSASLMechanisms", "vendorName", "vendorVersion",
+	"dnsHostName", "serverName", "domainFunctionality", "forestFunctionality",
+	"isGlobalCatalogReady", "subschemaSubentry",
+}
+
+// msDS-Behavior-Version of an Active Directory domain or forest
+var functionalLevels = map[string]string{
+	"0": "2000",
+	"1": "2003 interim",
+	"2": "2003",
+	"3": "2008",
+	"4": "2008 R2",
+	"5": "2012",
+	"6": "2012 R2",
+	"7": "2016",
+	"10": "2025",
+}
+
+var resultCodes = map[int]string{
+	0: "success",
+	1: "operationsError",
+	2: "protocolError",
+	8: "strongerAuthRequired",
+	13: "confidentialityRequired",
+	48: "inappropriateAuthentication",
+	49: "invalidCredentials",
+	50: "insufficientAccessRights",
+	52: "unavailable",
+	53: "unwillingToPerform",
+}
+
+type ldap_metadata struct {
+	ResultCode			*int		`json:"result_code,omitempty"`
+	Result				string		`json:"result,omitempty"`
+	DiagnosticMessage	string		`json:"diagnostic_message,omitempty"`
+	LDAPVersions		[]string	`json:"supported_ldap_versions,omitempty"`
+	NamingContexts		[]string	`json:"naming_contexts,omitempty"`
+	DefaultContext		string		`json:"default_naming_context,omitempty"`
+	SASLMechanisms		[]string	`json:"sasl_mechanisms,omitempty"`
+	VendorName			string		`json:"vendor_name,omitempty"`
+	VendorVersion		string		`json:"vendor_version,omitempty"`
+	DNSHostName			string		`json:"dns_host_name,omitempty"`
+	ServerName			string		`json:"server_name,omitempty"`
+	DomainLevel			string		`json:"domain_functionality,omitempty"`
+	ForestLevel			string		`json:"forest_functionality,omitempty"`
+	ActiveDirectory		bool		`json:"active_directory,omitempty"`
+	Disconnected		bool		`json:"disconnected,omitempty"`
+}
+
+func searchRequest() []byte {
+
+	var attrs [][]byte
+	for _, a := range rootDSEAttributes {
+		attrs = append( attrs, encode( TAG_OCTETS, []byte(a) ) )
+	}
+	search := encode( OP_SEARCH_REQUEST,
+		encode( TAG_OCTETS ),					//baseObject ""
+		encode( TAG_ENUMERATED, []byte{ 0 } ),	//baseObject scope
+		encode( TAG_ENUMERATED, []byte{ 0 } ),	//neverDerefAliases
+		encode( TAG_INTEGER, []byte{ 0 } ),		//sizeLimit
+		encode( TAG_INTEGER, []byte{ 0 } ),		//timeLimit
+		encode( 0x01, []byte{ 0 } ),			//typesOnly FALSE
+		encode( FILTER_PRESENT, []byte("objectClass") ),
+		encode( TAG_SEQUENCE, attrs... ),
+	)
+	return encode( TAG_SEQUENCE, encode( TAG_INTEGER, []byte{ byte(MESSAGE_ID) } ), search )
+}
+
+func level( v string ) string {
+	if name, ok := functionalLevels[v]; ok {
+		return name
+	}
+	return v
+}
+
+func ( m *ldap_metadata ) readEntry( entry []byte ) {
+
+	fields := decodeAll( entry )
+	if len(fields) < 2 || fields[1].tag != TAG_SEQUENCE {
+		return
+	}
+	for _, attr := range decodeAll( fields[1].value ) {
+		parts := decodeAll( attr.value )
+		if len(parts) < 2 || parts[1].tag != TAG_SET {
+			continue
+		}
+		var values []string
+		for _, v := range decodeAll( parts[1].value ) {
+			values = append( values, string( v.value ) )
+		}
+		if len(values) == 0 {
+			continue
+		}
+		switch string( parts[0].value ) {
+		case "namingContexts":
+			m.NamingContexts = values
+		case "defaultNamingContext":
+			m.DefaultContext = values[0]
+		case "supportedLDAPVersion":
+			m.LDAPVersions = values
+		case "supportedSASLMechanisms":
+			m.SASLMechanisms = values
+		case "vendorName":
+			m.VendorName = values[0]
+		case "vendorVersion":
+			m.VendorVersion = values[0]
+		case "dnsHostName":
+			m.DNSHostName = values[0]
+		case "serverName":
+			m.ServerName = values[0]
+		case "domainFunctionality":
+			m.DomainLevel = level( values[0] )
+			m.ActiveDirectory = true
+		case "forestFunctionality":
+			m.ForestLevel = level( values[0] )
+			m.ActiveDirectory = true
+		case "isGlobalCatalogReady":
+			m.ActiveDirectory = true
+		}
+	}
+}
+
+// resultCode, matchedDN, diagnosticMessage
+func ( m *ldap_metadata ) readResult( result []byte ) {
+
+	fields := decodeAll( result )
+	if len(fields) < 3 || fields[0].tag != TAG_ENUMERATED {
+		return
+	}
+	code := integer( fields[0].value )
+	m.ResultCode = &code
+	m.Result = resultCodes[code]
+	if m.Result == "" {
+		m.Result = strconv.Itoa( code )
+	}
+	m.DiagnosticMessage = string( fields[2].value )
+}
+
+// nil unless data holds an LDAP answer to our search
+func parseResponse( data []byte ) *ldap_metadata {
+
+	var m *ldap_metadata
+	for _, msg := range decodeAll( data ) {
+		fields := decodeAll( msg.value )
+		if msg.tag != TAG_SEQUENCE || len(fields) < 2 || fields[0].tag != TAG_INTEGER {
+			break
+		}
+		id, op := integer( fields[0].value ), fields[1]
+		switch {
+		case id == MESSAGE_ID && op.tag == OP_SEARCH_ENTRY:
+			if m == nil {
+				m = &ldap_metadata{}
+			}
+			m.readEntry( op.value )
+		case id == MESSAGE_ID && op.tag == OP_SEARCH_DONE:
+			if m == nil {
+				m = &ldap_metadata{}
+			}
+			m.readResult( op.value )
+		case id == 0 && op.tag == OP_EXTENDED_RESP:
+			if m == nil {
+				m = &ldap_metadata{}
+			}
+			m.Disconnected = true
+			m.readResult( op.value )
+		}
+	}
+	return m
+}
+
+// the start of a reply to our search, for entries cut short
+func searchReply( data []byte ) bool {
+
+	if len(data) < 2 || data[0] != TAG_SEQUENCE {
+		return false
+	}
+	rest := data[2:]
+	if data[1] & 0x80 != 0 {
+		n := int( data[1] & 0x7f )
+		if len(rest) < n {
+			return false
+		}
+		rest = rest[n:]
+	}
+	return len(rest) >= 4 && rest[0] == TAG_INTEGER && rest[1] == 1 && int( rest[2] ) == MESSAGE_ID &&
+		( rest[3] == OP_SEARCH_ENTRY || rest[3] == OP_SEARCH_DONE )
+}
+
+// the search is done, or the data is not BER
+func answered( data []byte ) bool {
+
+	if len(data) > 0 && data[0] != TAG_SEQUENCE {
+		return true
+	}
+	m := parseResponse( data )
+	return m != nil && m.ResultCode != nil
+}
@@ -0,0 +1,142 @@
+package ldap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// an LDAPMessage with our message ID
+func message( id byte, op []byte ) []byte {
+	return encode( TAG_SEQUENCE, encode( TAG_INTEGER, []byte{ id } ), op )
+}
+
+func attribute( name string, values ...string ) []byte {
+	var set [][]byte
+	for _, v := range values {
+		set = append( set, encode( TAG_OCTETS, []byte(v) ) )
+	}
+	return encode( TAG_SEQUENCE, encode( TAG_OCTETS, []byte(name) ), encode( TAG_SET, set... ) )
+}
+
+func result( op byte, code byte, diagnostic string ) []byte {
+	return encode( op, encode( TAG_ENUMERATED, []byte{ code } ), encode( TAG_OCTETS ),
+		encode( TAG_OCTETS, []byte(diagnostic) ) )
+}
+
+var (
+	//the example in rootdse.go
+	openldap = []byte( "\x30\x26\x02\x01\x01\x64\x21\x04\x00\x30\x1d\x30\x1b\x04\x14supportedLDAPVersion" +
+		"\x31\x03\x04\x013\x30\x0c\x02\x01\x01\x65\x07\x0a\x01\x00\x04\x00\x04\x00" )
+	activeDirectory = append( message( 1, encode( OP_SEARCH_ENTRY, encode( TAG_OCTETS ), encode( TAG_SEQUENCE,
+		attribute( "namingContexts", "DC=corp,DC=example", "CN=Configuration,DC=corp,DC=example" ),
+		attribute( "defaultNamingContext", "DC=corp,DC=example" ),
+		attribute( "supportedLDAPVersion", "3", "2" ),
+		attribute( "supportedSASLMechanisms", "GSSAPI", "GSS-SPNEGO", "EXTERNAL", "DIGEST-MD5" ),
+		attribute( "dnsHostName", "dc01.corp.example" ),
+		attribute( "domainFunctionality", "7" ),
+		attribute( "forestFunctionality", "11" ),
+		attribute( "subschemaSubentry" ),
+	) ) ), message( 1, result( OP_SEARCH_DONE, 0, "" ) )... )
+	refused = message( 1, result( OP_SEARCH_DONE, 50, "00002024: SecErr: DSID-0C090C2E" ) )
+	notice = message( 0, result( OP_EXTENDED_RESP, 52, "closing" ) )
+)
+
+func TestSearchRequest( t *testing.T ) {
+
+	msg, rest, ok := decode( searchRequest() )
+	fields := decodeAll( msg.value )
+	if !ok || len(rest) != 0 || len(fields) != 2 || integer( fields[0].value ) != MESSAGE_ID ||
+		fields[1].tag != OP_SEARCH_REQUEST || len( decodeAll( fields[1].value ) ) != 8 {
+		t.Errorf( "search request: %x", searchRequest() )
+	}
+}
+
+func TestDecode( t *testing.T ) {
+
+	long := encode( TAG_OCTETS, bytes.Repeat( []byte{ 'a' }, 300 ) )
+	if !bytes.Equal( long[:4], []byte{ TAG_OCTETS, 0x82, 0x01, 0x2c } ) {
+		t.Errorf( "long form length: %x", long[:4] )
+	}
+	if v, rest, ok := decode( long ); !ok || len(v.value) != 300 || len(rest) != 0 {
+		t.Errorf( "decode of the long form failed" )
+	}
+	for _, b := range [][]byte{
+		{},
+		{ 0x04 },
+		{ 0x04, 0x02, 0x00 },
+		{ 0x04, 0x80 },
+		{ 0x04, 0x85, 0x01, 0x00, 0x00, 0x00, 0x00 },
+		{ 0x04, 0x82, 0x01 },
+		{ 0x04, 0x84, 0xff, 0xff, 0xff, 0xff },
+	} {
+		if _, _, ok := decode( b ); ok {
+			t.Errorf( "decode(%x) succeeded", b )
+		}
+	}
+	for b, n := range map[string]int{ "": 0, "\x01": 1, "\x01\x00": 256, "\xff": -1, "\xff\x38": -200 } {
+		if integer( []byte(b) ) != n {
+			t.Errorf( "integer(%x) = %d, want %d", b, integer( []byte(b) ), n )
+		}
+	}
+}
+
+func TestParseResponse( t *testing.T ) {
+
+	success, unavailable, insufficient := 0, 52, 50
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*ldap_metadata
+	}{
+		{ "openldap", openldap, &ldap_metadata{ ResultCode: &success, Result: "success",
+			LDAPVersions: []string{ "3" } } },
+		{ "active directory", activeDirectory, &ldap_metadata{ ResultCode: &success, Result: "success",
+			LDAPVersions: []string{ "3", "2" },
+			NamingContexts: []string{ "DC=corp,DC=example", "CN=Configuration,DC=corp,DC=example" },
+			DefaultContext: "DC=corp,DC=example",
+			SASLMechanisms: []string{ "GSSAPI", "GSS-SPNEGO", "EXTERNAL", "DIGEST-MD5" },
+			DNSHostName: "dc01.corp.example", DomainLevel: "2016", ForestLevel: "11", ActiveDirectory: true } },
+		{ "refused", refused, &ldap_metadata{ ResultCode: &insufficient, Result: "insufficientAccessRights",
+			DiagnosticMessage: "00002024: SecErr: DSID-0C090C2E" } },
+		{ "notice of disconnection", notice, &ldap_metadata{ ResultCode: &unavailable, Result: "unavailable",
+			DiagnosticMessage: "closing", Disconnected: true } },
+		{ "entry only", openldap[:40], &ldap_metadata{ LDAPVersions: []string{ "3" } } },
+		{ "other message id", message( 2, result( OP_SEARCH_DONE, 0, "" ) ), nil },
+		{ "not a sequence", []byte{ 0x04, 0x02, 0x02, 0x01 }, nil },
+		{ "cut short", openldap[:10], nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseResponse( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+	}
+	for i := range activeDirectory {
+		parseResponse( activeDirectory[:i] )
+		answered( activeDirectory[:i] )
+	}
+}
+
+func TestVerify( t *testing.T ) {
+
+	var h HandshakeMod
+	for _, c := range []struct {
+		data		[]byte
+		label		string
+		complete	bool
+	}{
+		{ openldap, "ldap", true },
+		{ refused, "ldap", true },
+		{ notice, "ldap", true },
+		//an entry too long to have arrived whole
+		{ activeDirectory[:20], "ldap", false },
+		{ openldap[:5], "", false },
+		{ searchRequest(), "", false },
+		{ []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), "", true },
+	} {
+		if h.Verify( string(c.data) ) != c.label || h.Complete( string(c.data) ) != c.complete {
+			t.Errorf( "%x: Verify %q, Complete %v", c.data, h.Verify( string(c.data) ), h.Complete( string(c.data) ) )
+		}
+	}
+}
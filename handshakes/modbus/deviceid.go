@@ -0,0 +1,112 @@
+package modbus
+
+import (
+	"encoding/binary"
+)
+
+/* the answer to LZR's Read Device Identification (function 0x2b, MEI
+ * type 0x0e, basic objects from 0). the MBAP header echoes our
+ * transaction id (0x5a47) and protocol 0, and its length counts the
+ * unit id and PDU. the PDU is 0x2b 0x0e, read code, conformity level,
+ * more follows, next object id, number of objects, and the objects as
+ * id, length, value. a device without it answers exception 0xab.
+ *
+ * e.g. a Schneider M221:
+ *   5a 47 00 00 00 33 00 2b 0e 01 01 00 00 03
+ *   00 14 "Schneider Electric  " 01 0b "TM221CE16R " 02 06 "V1.6.0"
+ */
+const (
+	MBAP_LEN			int = 7
+	TRANSACTION_ID		uint16 = 0x5a47
+
+	FUNC_ENCAPSULATED	byte = 0x2b
+	MEI_DEVICE_ID		byte = 0x0e
+	EXCEPTION_BIT		byte = 0x80
+)
+
+var objectNames = map[byte]string{
+	0: "vendor",
+	1: "product_code",
+	2: "revision",
+	3: "vendor_url",
+	4: "product_name",
+	5: "model_name",
+	6: "application_name",
+}
+
+var exceptionNames = map[byte]string{
+	1: "illegal_function",
+	2: "illegal_data_address",
+	3: "illegal_data_value",
+	4: "server_device_failure",
+	6: "server_device_busy",
+	10: "gateway_path_unavailable",
+	11: "gateway_target_no_response",
+}
+
+type modbus_metadata struct {
+	UnitID			byte				`json:"unit_id"`
+	Exception		string				`json:"exception,omitempty"`
+	Conformity		byte				`json:"conformity_level,omitempty"`
+	Objects			map[string]string	`json:"objects,omitempty"`
+}
+
+func trimSpaces( b []byte ) string {
+	for len(b) > 0 && ( b[len(b)-1] == ' ' || b[len(b)-1] == 0 ) {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+// nil unless data is a Modbus/TCP answer to our request
+func parseDeviceID( data []byte ) *modbus_metadata {
+
+	if len(data) < MBAP_LEN + 2 {
+		return nil
+	}
+	be := binary.BigEndian
+	if be.Uint16( data[0:2] ) != TRANSACTION_ID || be.Uint16( data[2:4] ) != 0 {
+		return nil
+	}
+	length := int( be.Uint16( data[4:6] ) )
+	if length < 3 || length > 254 {
+		return nil
+	}
+	m := &modbus_metadata{ UnitID: data[6] }
+	pdu := data[MBAP_LEN:]
+	if len(pdu) > length - 1 {
+		pdu = pdu[:length-1]
+	}
+	switch pdu[0] {
+	case FUNC_ENCAPSULATED | EXCEPTION_BIT:
+		name, ok := exceptionNames[ pdu[1] ]
+		if !ok {
+			name = "unknown"
+		}
+		m.Exception = name
+		return m
+	case FUNC_ENCAPSULATED:
+	default:
+		return nil
+	}
+	if len(pdu) < 7 || pdu[1] != MEI_DEVICE_ID {
+		return nil
+	}
+	m.Conformity = pdu[3]
+	objects := pdu[7:]
+	for n := int( pdu[6] ); n > 0 && len(objects) >= 2; n-- {
+		l := int( objects[1] )
+		if len(objects) < 2 + l {
+			break
+		}
+		name, ok := objectNames[ objects[0] ]
+		if ok {
+			if m.Objects == nil {
+				m.Objects = make( map[string]string )
+			}
+			m.Objects[ name ] = trimSpaces( objects[2:2+l] )
+		}
+		objects = objects[2+l:]
+	}
+	return m
+}
@@ -0,0 +1,47 @@
+package modbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the Schneider M221 of the comment on parseDeviceID
+var m221 = []byte( "\x5a\x47\x00\x00\x00\x33\x00\x2b\x0e\x01\x01\x00\x00\x03" +
+	"\x00\x14Schneider Electric  \x01\x0bTM221CE16R \x02\x06V1.6.0" )
+
+func TestParseDeviceID( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		want			*modbus_metadata
+	}{
+		{ "m221", m221, &modbus_metadata{ Conformity: 1, Objects: map[string]string{
+			"vendor": "Schneider Electric", "product_code": "TM221CE16R", "revision": "V1.6.0" } } },
+		{ "objects cut short", m221[:40], &modbus_metadata{ Conformity: 1, Objects: map[string]string{
+			"vendor": "Schneider Electric" } } },
+		{ "exception", []byte( "\x5a\x47\x00\x00\x00\x03\x01\xab\x01" ), &modbus_metadata{ UnitID: 1, Exception: "illegal_function" } },
+		{ "unknown exception", []byte( "\x5a\x47\x00\x00\x00\x03\x00\xab\x7f" ), &modbus_metadata{ Exception: "unknown" } },
+		{ "other transaction", append( []byte{ 0x00, 0x01 }, m221[2:]... ), nil },
+		{ "other protocol", []byte( "\x5a\x47\x00\x01\x00\x03\x00\xab\x01" ), nil },
+		{ "length 0", []byte( "\x5a\x47\x00\x00\x00\x00\x00\xab\x01" ), nil },
+		{ "length past 254", []byte( "\x5a\x47\x00\x00\x01\x00\x00\xab\x01" ), nil },
+		{ "other function", []byte( "\x5a\x47\x00\x00\x00\x03\x00\x03\x00" ), nil },
+		{ "short pdu", m221[:12], nil },
+		{ "other mei", []byte( "\x5a\x47\x00\x00\x00\x08\x00\x2b\x0d\x01\x01\x00\x00\x00" ), nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		m := parseDeviceID( tt.data )
+		if !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "%s: got %+v, want %+v", tt.name, m, tt.want )
+		}
+		if f := h.Verify( string(tt.data) ); ( f == "modbus" ) != ( tt.want != nil ) {
+			t.Errorf( "%s: Verify = %q", tt.name, f )
+		}
+	}
+	for i := range m221 {
+		parseDeviceID( m221[:i] )
+	}
+}
@@ -1,7 +1,6 @@
 package modbus
 
 import (
-	"bytes"
 	"github.com/stanford-esrg/lzr"
 )
 
@@ -16,16 +15,22 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
-	if len([]byte(data)) < 4 {
-		return ""
-	}
-	if bytes.Equal([]byte(data[0:4]),[]byte{0x5a,0x47,0x00,0x00}) {
+	//our transaction id echoed in a well formed answer
+	if parseDeviceID( []byte(data) ) != nil {
 		return "modbus"
 	}
 	return ""
 
 }
 
+// vendor, product and revision, or the exception (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseDeviceID( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "modbus", &h )
@@ -49,10 +49,21 @@ func (h *HandshakeMod) Verify( data string ) string {
 		strings.Contains( data, "MongoDB" ){
          return "mongodb"
     }
+    if m := parseReply( []byte(data) ); m != nil && ( m.MaxWireVersion != nil || m.Error != "" ) {
+         return "mongodb"
+    }
     return ""
 
 }
 
+// wire versions, replica set and the release they imply (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseReply( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 
 func RegisterHandshake() {
     var h HandshakeMod
@@ -0,0 +1,106 @@
+package mongodb
+
+import (
+	"encoding/binary"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+/* the OP_REPLY to LZR's isMaster: a 16 byte header (length, request
+ * id, response to, opcode 1), response flags (4), cursor id (8),
+ * starting from (4), number returned (4) and the documents, here one.
+ * isMaster does not carry the server version, but maxWireVersion moves
+ * with every release.
+ */
+const (
+	OP_REPLY			uint32 = 1
+	REPLY_HEADER_LEN	int = 36
+)
+
+// the release that introduced each wire version
+var wireVersions = map[int]string{
+	2: "2.6",
+	3: "3.0",
+	4: "3.2",
+	5: "3.4",
+	6: "3.6",
+	7: "4.0",
+	8: "4.2",
+	9: "4.4",
+	13: "5.0",
+	14: "5.1",
+	15: "5.2",
+	16: "5.3",
+	17: "6.0",
+	21: "7.0",
+	25: "8.0",
+}
+
+type is_master struct {
+	IsMaster		*bool		`bson:"ismaster"`
+	MaxBsonSize		int			`bson:"maxBsonObjectSize"`
+	MaxWireVersion	*int		`bson:"maxWireVersion"`
+	MinWireVersion	int			`bson:"minWireVersion"`
+	SetName			string		`bson:"setName"`
+	Msg				string		`bson:"msg"`
+	ReadOnly		bool		`bson:"readOnly"`
+	ErrMsg			string		`bson:"errmsg"`
+	Code			int			`bson:"code"`
+}
+
+type mongodb_metadata struct {
+	IsMaster		*bool		`json:"ismaster,omitempty"`
+	MaxWireVersion	*int		`json:"max_wire_version,omitempty"`
+	MinWireVersion	int			`json:"min_wire_version,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	SetName			string		`json:"set_name,omitempty"`
+	Mongos			bool		`json:"mongos,omitempty"`
+	ReadOnly		bool		`json:"read_only,omitempty"`
+	Error			string		`json:"error,omitempty"`
+	ErrorCode		int			`json:"error_code,omitempty"`
+}
+
+// the newest release at or below wire version v
+func inferVersion( v int ) string {
+
+	for ; v > 0; v-- {
+		if version, ok := wireVersions[v]; ok {
+			return version
+		}
+	}
+	return ""
+}
+
+func parseReply( data []byte ) *mongodb_metadata {
+
+	if len(data) < REPLY_HEADER_LEN + 5 {
+		return nil
+	}
+	le := binary.LittleEndian
+	if le.Uint32( data[12:16] ) != OP_REPLY || int( le.Uint32( data[0:4] ) ) < REPLY_HEADER_LEN + 5 {
+		return nil
+	}
+	doc := data[REPLY_HEADER_LEN:]
+	l := int( le.Uint32( doc[0:4] ) )
+	if l < 5 || l > len(doc) {
+		return nil
+	}
+	var reply is_master
+	if err := bson.Unmarshal( doc[:l], &reply ); err != nil {
+		return nil
+	}
+	m := &mongodb_metadata{
+		IsMaster: reply.IsMaster,
+		MaxWireVersion: reply.MaxWireVersion,
+		MinWireVersion: reply.MinWireVersion,
+		SetName: reply.SetName,
+		Mongos: reply.Msg == "isdbgrid",
+		ReadOnly: reply.ReadOnly,
+		Error: reply.ErrMsg,
+		ErrorCode: reply.Code,
+	}
+	if reply.MaxWireVersion != nil {
+		m.Version = inferVersion( *reply.MaxWireVersion )
+	}
+	return m
+}
@@ -0,0 +1,91 @@
+package mongodb
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// an OP_REPLY carrying doc
+func reply( t *testing.T, doc bson.D ) []byte {
+
+	b, err := bson.Marshal( doc )
+	if err != nil {
+		t.Fatal( err )
+	}
+	r := make( []byte, REPLY_HEADER_LEN )
+	binary.LittleEndian.PutUint32( r[0:4], uint32( REPLY_HEADER_LEN + len(b) ) )
+	binary.LittleEndian.PutUint32( r[12:16], OP_REPLY )
+	binary.LittleEndian.PutUint32( r[32:36], 1 )
+	return append( r, b... )
+}
+
+func TestParseReply( t *testing.T ) {
+
+	primary := reply( t, bson.D{
+		{ Name: "ismaster", Value: true },
+		{ Name: "setName", Value: "rs0" },
+		{ Name: "maxBsonObjectSize", Value: 16777216 },
+		{ Name: "maxWireVersion", Value: 17 },
+		{ Name: "minWireVersion", Value: 0 },
+		{ Name: "ok", Value: 1.0 },
+	} )
+	mongos := reply( t, bson.D{
+		{ Name: "ismaster", Value: true },
+		{ Name: "msg", Value: "isdbgrid" },
+		{ Name: "maxWireVersion", Value: 22 },
+		{ Name: "ok", Value: 1.0 },
+	} )
+	unauthorized := reply( t, bson.D{
+		{ Name: "ok", Value: 0.0 },
+		{ Name: "errmsg", Value: "command isMaster requires authentication" },
+		{ Name: "code", Value: 13 },
+	} )
+	m := parseReply( primary )
+	if m == nil || m.Version != "6.0" || m.SetName != "rs0" || *m.MaxWireVersion != 17 || !*m.IsMaster {
+		t.Errorf( "primary: %+v", m )
+	}
+	if m := parseReply( mongos ); m == nil || !m.Mongos || m.Version != "7.0" {
+		t.Errorf( "mongos: %+v", m )
+	}
+	if m := parseReply( unauthorized ); m == nil || m.ErrorCode != 13 || m.MaxWireVersion != nil {
+		t.Errorf( "unauthorized: %+v", m )
+	}
+
+	var h HandshakeMod
+	for _, v := range [][]byte{ primary, mongos, unauthorized } {
+		if h.Verify( string(v) ) != "mongodb" {
+			t.Errorf( "Verify(%q) is not mongodb", v )
+		}
+		for i := range v {
+			parseReply( v[:i] )
+		}
+		//a document longer than the reply, or one that is not BSON
+		bad := append( []byte{}, v... )
+		binary.LittleEndian.PutUint32( bad[REPLY_HEADER_LEN:], uint32( len(v) ) )
+		if parseReply( bad ) != nil {
+			t.Errorf( "document past the end" )
+		}
+		for i := REPLY_HEADER_LEN + 4; i < len(v); i++ {
+			bad := append( []byte{}, v... )
+			bad[i] ^= 0xff
+			parseReply( bad )
+		}
+	}
+	opMsg := append( []byte{}, primary... )
+	opMsg[12] = 0xdd
+	for _, v := range [][]byte{ primary[:REPLY_HEADER_LEN+4], opMsg, []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ) } {
+		if m := parseReply( v ); m != nil {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+}
+
+func TestInferVersion( t *testing.T ) {
+	for v, want := range map[int]string{ 0: "", 2: "2.6", 10: "4.4", 18: "6.0", 100: "8.0" } {
+		if got := inferVersion( v ); got != want {
+			t.Errorf( "inferVersion(%d) = %q, want %q", v, got, want )
+		}
+	}
+}
@@ -28,6 +28,14 @@ func (h *HandshakeMod) Verify( data string ) string {
 	return ""
 }
 
+// server version and encryption from PRELOGIN (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parsePrelogin( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "mssql", &h )
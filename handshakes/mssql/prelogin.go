@@ -0,0 +1,104 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+/* the server's PRELOGIN response (MS-TDS 2.2.6.5): an 8 byte TDS
+ * header (type 0x04, status, big endian length, ...) and then option
+ * tokens, each a type, a big endian offset and length into the payload,
+ * up to 0xff. VERSION is major, minor, build (big endian) and
+ * subbuild, ENCRYPTION one byte.
+ */
+const (
+	TDS_HEADER_LEN		int = 8
+	TDS_RESPONSE		byte = 0x04
+
+	TOKEN_VERSION		byte = 0x00
+	TOKEN_ENCRYPTION	byte = 0x01
+	TOKEN_INSTOPT		byte = 0x02
+	TOKEN_TERMINATOR	byte = 0xff
+)
+
+var encryptionNames = map[byte]string{
+	0: "off",
+	1: "on",
+	2: "not_supported",
+	3: "required",
+}
+
+// releases by major version (10.50 is 2008 R2)
+var productNames = map[int]string{
+	8: "SQL Server 2000",
+	9: "SQL Server 2005",
+	10: "SQL Server 2008",
+	11: "SQL Server 2012",
+	12: "SQL Server 2014",
+	13: "SQL Server 2016",
+	14: "SQL Server 2017",
+	15: "SQL Server 2019",
+	16: "SQL Server 2022",
+}
+
+type mssql_metadata struct {
+	Version			string		`json:"version,omitempty"`
+	Product			string		`json:"product,omitempty"`
+	Encryption		string		`json:"encryption,omitempty"`
+	Instance		string		`json:"instance,omitempty"`
+}
+
+func parsePrelogin( data []byte ) *mssql_metadata {
+
+	if len(data) < TDS_HEADER_LEN || data[0] != TDS_RESPONSE {
+		return nil
+	}
+	payload := data[TDS_HEADER_LEN:]
+	if l := int( binary.BigEndian.Uint16( data[2:4] ) ); l >= TDS_HEADER_LEN && l - TDS_HEADER_LEN < len(payload) {
+		payload = payload[:l-TDS_HEADER_LEN]
+	}
+	m := &mssql_metadata{}
+	found := false
+	for tokens := payload; len(tokens) > 0 && tokens[0] != TOKEN_TERMINATOR; tokens = tokens[5:] {
+		if len(tokens) < 5 {
+			return nil
+		}
+		off := int( binary.BigEndian.Uint16( tokens[1:3] ) )
+		l := int( binary.BigEndian.Uint16( tokens[3:5] ) )
+		if off + l > len(payload) {
+			continue
+		}
+		value := payload[off:off+l]
+		switch tokens[0] {
+		case TOKEN_VERSION:
+			if l < 6 {
+				return nil
+			}
+			major := int( value[0] )
+			build := binary.BigEndian.Uint16( value[2:4] )
+			m.Version = fmt.Sprintf( "%d.%d.%d", major, value[1], build )
+			m.Product = productNames[ major ]
+			if major == 10 && value[1] == 50 {
+				m.Product = "SQL Server 2008 R2"
+			}
+			found = true
+		case TOKEN_ENCRYPTION:
+			if l >= 1 {
+				if name, ok := encryptionNames[ value[0] ]; ok {
+					m.Encryption = name
+				}
+			}
+		case TOKEN_INSTOPT:
+			for i, c := range value {
+				if c == 0 {
+					m.Instance = string( value[:i] )
+					break
+				}
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	return m
+}
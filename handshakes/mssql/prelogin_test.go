@@ -0,0 +1,61 @@
+package mssql
+
+import (
+	"reflect"
+	"testing"
+)
+
+// SQL Server 2019 RTM: VERSION 15.0.2000, ENCRYPTION off, INSTOPT ""
+var sql2019 = []byte{
+	0x04, 0x01, 0x00, 0x20, 0x00, 0x00, 0x01, 0x00,
+	0x00, 0x00, 0x10, 0x00, 0x06,
+	0x01, 0x00, 0x16, 0x00, 0x01,
+	0x02, 0x00, 0x17, 0x00, 0x01,
+	0xff,
+	0x0f, 0x00, 0x07, 0xd0, 0x00, 0x00,
+	0x00,
+	0x00,
+}
+
+// 2008 R2 SP3 with encryption required
+var sql2008R2 = []byte{
+	0x04, 0x01, 0x00, 0x1a, 0x00, 0x00, 0x01, 0x00,
+	0x00, 0x00, 0x0b, 0x00, 0x06,
+	0x01, 0x00, 0x11, 0x00, 0x01,
+	0xff,
+	0x0a, 0x32, 0x19, 0x28, 0x00, 0x00,
+	0x03,
+}
+
+func TestParsePrelogin( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		want			*mssql_metadata
+	}{
+		{ "2019", sql2019, &mssql_metadata{ Version: "15.0.2000", Product: "SQL Server 2019", Encryption: "off" } },
+		{ "2008 R2", sql2008R2, &mssql_metadata{ Version: "10.50.6440", Product: "SQL Server 2008 R2", Encryption: "required" } },
+		{ "values cut off", sql2019[:26], nil },
+		{ "token cut off", sql2019[:11], nil },
+		{ "header only", sql2019[:8], nil },
+		{ "short version", []byte{ 0x04, 0x01, 0x00, 0x10, 0x00, 0x00, 0x01, 0x00,
+			0x00, 0x00, 0x06, 0x00, 0x01, 0xff, 0x0f, 0x00 }, nil },
+		{ "not a response", append( []byte{ 0x12 }, sql2019[1:]... ), nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	}
+	for _, tt := range tests {
+		if m := parsePrelogin( tt.data ); !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "%s: got %+v, want %+v", tt.name, m, tt.want )
+		}
+	}
+	for _, v := range [][]byte{ sql2019, sql2008R2 } {
+		for i := range v {
+			parsePrelogin( v[:i] )
+		}
+	}
+	var h HandshakeMod
+	if h.Verify( string(sql2019) ) != "mssql" || h.Verify( "\x04\x01" ) != "" {
+		t.Errorf( "Verify" )
+	}
+}
@@ -0,0 +1,142 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+/* what a MySQL server opens with: a handshake v10 packet, or an error
+ * packet when it will not talk to us at all (e.g. 1130, host not
+ * allowed). every packet has a 3 byte little endian length and a
+ * sequence number in front.
+ *
+ * handshake v10: 0x0a, server version (NUL terminated), connection id
+ * (4), auth data (8), 0, capabilities low (2), charset (1), status (2),
+ * capabilities high (2), auth data length (1), reserved (10), more auth
+ * data, auth plugin name (NUL terminated).
+ *
+ * error: 0xff, error code (2), "#" and SQL state (5) from 4.1 on, message.
+ */
+const (
+	PROTOCOL_V10		byte = 0x0a
+	PACKET_ERR			byte = 0xff
+	HEADER_LEN			int = 4
+
+	ER_HOST_IS_BLOCKED		uint16 = 1129
+	ER_HOST_NOT_PRIVILEGED	uint16 = 1130
+)
+
+var capabilityNames = []string{
+	"long_password", "found_rows", "long_flag", "connect_with_db",
+	"no_schema", "compress", "odbc", "local_files",
+	"ignore_space", "protocol_41", "interactive", "ssl",
+	"ignore_sigpipe", "transactions", "reserved", "secure_connection",
+	"multi_statements", "multi_results", "ps_multi_results", "plugin_auth",
+	"connect_attrs", "plugin_auth_lenenc_client_data", "can_handle_expired_passwords", "session_track",
+	"deprecate_eof",
+}
+
+type mysql_metadata struct {
+	Protocol		int			`json:"protocol,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	ConnectionID	uint32		`json:"connection_id,omitempty"`
+	Capabilities	uint32		`json:"capabilities,omitempty"`
+	CapabilityFlags	[]string	`json:"capability_flags,omitempty"`
+	Charset			int			`json:"charset,omitempty"`
+	Status			uint16		`json:"status,omitempty"`
+	AuthPlugin		string		`json:"auth_plugin,omitempty"`
+	ErrorCode		uint16		`json:"error_code,omitempty"`
+	ErrorMessage	string		`json:"error_message,omitempty"`
+}
+
+func cString( b []byte ) ( string, []byte, bool ) {
+	i := strings.IndexByte( string(b), 0 )
+	if i < 0 {
+		return "", nil, false
+	}
+	return string( b[:i] ), b[i+1:], true
+}
+
+func capabilityFlags( caps uint32 ) []string {
+
+	var names []string
+	for i, name := range capabilityNames {
+		if caps & ( 1 << uint(i) ) != 0 {
+			names = append( names, name )
+		}
+	}
+	return names
+}
+
+// the first packet in data, nil unless it is a greeting or an error
+func parseGreeting( data []byte ) *mysql_metadata {
+
+	if len(data) < HEADER_LEN + 1 || data[3] != 0 {
+		return nil
+	}
+	l := int(data[0]) | int(data[1]) << 8 | int(data[2]) << 16
+	payload := data[HEADER_LEN:]
+	if len(payload) > l {
+		payload = payload[:l]
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	switch payload[0] {
+	case PROTOCOL_V10:
+		return parseHandshakeV10( payload )
+	case PACKET_ERR:
+		return parseError( payload )
+	}
+	return nil
+}
+
+func parseHandshakeV10( p []byte ) *mysql_metadata {
+
+	version, rest, ok := cString( p[1:] )
+	if !ok || version == "" {
+		return nil
+	}
+	m := &mysql_metadata{ Protocol: int(PROTOCOL_V10), Version: version }
+	//connection id, auth data, filler, capabilities low
+	if len(rest) < 4 + 8 + 1 + 2 {
+		return m
+	}
+	m.ConnectionID = binary.LittleEndian.Uint32( rest[:4] )
+	rest = rest[4+8+1:]
+	m.Capabilities = uint32( binary.LittleEndian.Uint16( rest[:2] ) )
+	rest = rest[2:]
+	if len(rest) >= 1 + 2 + 2 + 1 + 10 {
+		m.Charset = int( rest[0] )
+		m.Status = binary.LittleEndian.Uint16( rest[1:3] )
+		m.Capabilities |= uint32( binary.LittleEndian.Uint16( rest[3:5] ) ) << 16
+		authL := int( rest[5] )
+		rest = rest[16:]
+		//the rest of the auth data is at least 13 bytes
+		more := authL - 8
+		if more < 13 {
+			more = 13
+		}
+		if len(rest) > more {
+			if name, _, ok := cString( rest[more:] ); ok {
+				m.AuthPlugin = name
+			}
+		}
+	}
+	m.CapabilityFlags = capabilityFlags( m.Capabilities )
+	return m
+}
+
+func parseError( p []byte ) *mysql_metadata {
+
+	if len(p) < 3 {
+		return nil
+	}
+	m := &mysql_metadata{ ErrorCode: binary.LittleEndian.Uint16( p[1:3] ) }
+	msg := p[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		msg = msg[6:]
+	}
+	m.ErrorMessage = string(msg)
+	return m
+}
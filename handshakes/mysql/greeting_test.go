@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"testing"
+)
+
+// a MySQL 8 greeting: v10, "8.0.35", connection 8, caching_sha2_password
+var greeting8 = []byte( "\x4a\x00\x00\x00\x0a8.0.35\x00\x08\x00\x00\x00" +
+	"\x01\x02\x03\x04\x05\x06\x07\x08\x00\xff\xff\xff\x02\x00\xff\xdf\x15" +
+	"\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00" +
+	"\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10\x11\x12\x13\x14\x00" +
+	"caching_sha2_password\x00" )
+
+// 1130, host not allowed, as sent before any greeting
+var notAllowed = []byte( "\x45\x00\x00\x00\xff\x6a\x04" +
+	"Host '192.0.2.1' is not allowed to connect to this MySQL server" )
+
+func TestParseGreeting( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		fingerprint		string
+		version			string
+		errorCode		uint16
+		plugin			string
+	}{
+		{ "greeting", greeting8, "mysql", "8.0.35", 0, "caching_sha2_password" },
+		{ "host not allowed", notAllowed, "mysql", "", ER_HOST_NOT_PRIVILEGED, "" },
+		{ "truncated greeting", greeting8[:20], "", "8.0.35", 0, "" },
+		{ "truncated version", greeting8[:8], "", "", 0, "" },
+		{ "zero length packet", []byte{ 0x00, 0x00, 0x00, 0x00, 0x0a }, "", "", 0, "" },
+		{ "empty", []byte{}, "", "", 0, "" },
+		{ "header only", []byte{ 0x4a, 0x00, 0x00, 0x00 }, "", "", 0, "" },
+		{ "short error", []byte{ 0x02, 0x00, 0x00, 0x00, 0xff, 0x6a }, "", "", 0, "" },
+		{ "sequence 1", []byte( "\x4a\x00\x00\x01\x0a8.0.35\x00" ), "", "", 0, "" },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), "", "", 0, "" },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		if f := h.Verify( string(tt.data) ); f != tt.fingerprint {
+			t.Errorf( "%s: Verify = %q, want %q", tt.name, f, tt.fingerprint )
+		}
+		m := parseGreeting( tt.data )
+		if m == nil {
+			if tt.version != "" || tt.errorCode != 0 {
+				t.Errorf( "%s: no metadata", tt.name )
+			}
+			continue
+		}
+		if m.Version != tt.version || m.ErrorCode != tt.errorCode || m.AuthPlugin != tt.plugin {
+			t.Errorf( "%s: got version %q, error %d, plugin %q", tt.name, m.Version, m.ErrorCode, m.AuthPlugin )
+		}
+	}
+}
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"bytes"
+	"strings"
 	"github.com/stanford-esrg/lzr"
 )
 
@@ -17,6 +18,13 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
 
 func (h *HandshakeMod) Verify( data string ) string {
 
+	//a server refusing us says so in an error packet
+	if m := parseGreeting( []byte(data) ); m != nil && m.ErrorCode != 0 {
+		if m.ErrorCode == ER_HOST_IS_BLOCKED || m.ErrorCode == ER_HOST_NOT_PRIVILEGED ||
+			strings.Contains( m.ErrorMessage, "MySQL" ) || strings.Contains( m.ErrorMessage, "MariaDB" ) {
+			return "mysql"
+		}
+	}
 
 	// standard 4 byte header 5100 0000
     if len([]byte(data)) < 49 {
@@ -29,6 +37,14 @@ func (h *HandshakeMod) Verify( data string ) string {
     return ""
 }
 
+// version, capabilities and auth plugin, or the error (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseGreeting( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 
 func RegisterHandshake() {
 	var h HandshakeMod
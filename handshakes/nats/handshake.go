@@ -0,0 +1,46 @@
+package nats
+
+import (
+	"strings"
+
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+//server first protocol
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return []byte("")
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseInfo( data ) != nil {
+		return "nats"
+	}
+	//an INFO cut short still names itself
+	if strings.HasPrefix( data, INFO_PREFIX + "{" ) && strings.Contains( data, "\"server_id\"" ) {
+		return "nats"
+	}
+	return ""
+}
+
+// read up to the end of the INFO line (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// version, auth and TLS requirements from INFO (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseInfo( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "nats", &h )
+	lzr.AddFingerprintRule( "nats", lzr.OVERRIDES, "pop3" )
+}
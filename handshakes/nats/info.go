@@ -0,0 +1,58 @@
+package nats
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+/* a NATS server greets every client with one INFO line, a JSON object
+ * describing itself:
+ *
+ *   INFO {"server_id":"NCXM...","server_name":"n1","version":"2.10.4",
+ *   "proto":1,"go":"go1.21.3","host":"0.0.0.0","port":4222,"headers":true,
+ *   "auth_required":true,"max_payload":1048576,"jetstream":true}\r\n
+ */
+const INFO_PREFIX string = "INFO "
+
+type nats_metadata struct {
+	ServerID		string		`json:"server_id,omitempty"`
+	ServerName		string		`json:"server_name,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	Proto			int			`json:"proto"`
+	Go				string		`json:"go,omitempty"`
+	Host			string		`json:"host,omitempty"`
+	Port			int			`json:"port,omitempty"`
+	AuthRequired	bool		`json:"auth_required"`
+	TLSRequired		bool		`json:"tls_required"`
+	TLSAvailable	bool		`json:"tls_available,omitempty"`
+	MaxPayload		int64		`json:"max_payload,omitempty"`
+	JetStream		bool		`json:"jetstream,omitempty"`
+	Cluster			string		`json:"cluster,omitempty"`
+}
+
+// the INFO line at the start of data, nil if it is not one or not whole
+func parseInfo( data string ) *nats_metadata {
+
+	if !strings.HasPrefix( data, INFO_PREFIX ) {
+		return nil
+	}
+	line := data[len(INFO_PREFIX):]
+	end := strings.Index( line, "\r\n" )
+	if end < 0 {
+		return nil
+	}
+	m := &nats_metadata{}
+	if err := json.Unmarshal( []byte( line[:end] ), m ); err != nil {
+		return nil
+	}
+	return m
+}
+
+func answered( data string ) bool {
+
+	if strings.HasPrefix( data, INFO_PREFIX ) {
+		return strings.Contains( data, "\r\n" )
+	}
+	//"INF" may still become an INFO
+	return !strings.HasPrefix( INFO_PREFIX, data )
+}
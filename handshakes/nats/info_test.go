@@ -0,0 +1,58 @@
+package nats
+
+import (
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/pop3"
+)
+
+const (
+	info = "INFO {\"server_id\":\"NCXM\",\"server_name\":\"n1\",\"version\":\"2.10.4\",\"proto\":1," +
+		"\"go\":\"go1.21.3\",\"host\":\"0.0.0.0\",\"port\":4222,\"headers\":true,\"auth_required\":true," +
+		"\"max_payload\":1048576,\"jetstream\":true}\r\n"
+	//verbose mode acknowledges each operation
+	verbose = "INFO {\"server_id\":\"NAB\",\"version\":\"2.9.0\",\"proto\":1}\r\n+OK\r\n"
+)
+
+func TestParseInfo( t *testing.T ) {
+
+	m := parseInfo( info )
+	if m == nil || m.ServerID != "NCXM" || m.ServerName != "n1" || m.Version != "2.10.4" || m.Proto != 1 ||
+		m.Port != 4222 || !m.AuthRequired || m.MaxPayload != 1048576 || !m.JetStream {
+		t.Errorf( "info: %+v", m )
+	}
+	var h HandshakeMod
+	for _, v := range []string{
+		"",
+		"INFO {}",
+		"INFO nats\r\n",
+		"+OK\r\n",
+	} {
+		if m := parseInfo( v ); m != nil || h.Verify( v ) != "" {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	//cut short, but still a NATS server
+	if h.Verify( info[:40] ) != "nats" {
+		t.Errorf( "Verify(%q) is not nats", info[:40] )
+	}
+	if answered( info[:40] ) || !answered( info ) || answered( "INF" ) || !answered( "+OK\r\n" ) {
+		t.Errorf( "answered" )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	pop3.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		info: "nats",
+		verbose: "nats",
+		"+OK POP3 ready\r\n": "pop3",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
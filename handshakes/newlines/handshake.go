@@ -2,6 +2,7 @@ package newlines
 
 import (
 	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/banner"
 )
 
 // Handshake implements the lzr.Handshake interface
@@ -14,7 +15,7 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
-    return ""
+	return banner.Classify( data )
 }
 
 func RegisterHandshake() {
@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/opcua"
+
+func init() {
+	opcua.RegisterHandshake()
+}
@@ -0,0 +1,33 @@
+package opcua
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return hello( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseAcknowledge( []byte(data) ) != nil {
+		return "opcua"
+	}
+	return ""
+}
+
+// the server's limits, or its error (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseAcknowledge( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "opcua", &h )
+}
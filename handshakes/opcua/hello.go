@@ -0,0 +1,105 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+/* OPC UA Connection Protocol (Part 6, 7.1.2). every message starts
+ * with a 3 byte type, a chunk type ('F') and a little endian size
+ * counting the whole message. LZR sends a Hello:
+ *
+ *   "HELF" size, protocol version (0), receive and send buffer size,
+ *   max message size, max chunk count (0, no limit), endpoint url
+ *   (opc.tcp:// and the target's address)
+ *
+ * a server answers with an Acknowledge, its own version and limits:
+ *   "ACKF" 1c 00 00 00 00 00 00 00 00 00 01 00 00 00 01 00 00 00 00 01 00 00 00 00
+ * or with an Error and a status code and reason:
+ *   "ERRF" 10 00 00 00 00 00 83 80 00 00 00 00   BadTcpEndpointUrlInvalid
+ */
+const (
+	HEADER_LEN			int = 8
+	ACK_LEN				int = 28
+	ERROR_MIN_LEN		int = 16
+	BUFFER_SIZE			uint32 = 65536
+)
+
+var statusNames = map[uint32]string{
+	0x807d0000: "BadTcpServerTooBusy",
+	0x807e0000: "BadTcpMessageTypeInvalid",
+	0x807f0000: "BadTcpSecureChannelUnknown",
+	0x80800000: "BadTcpMessageTooLarge",
+	0x80810000: "BadTcpNotEnoughResources",
+	0x80820000: "BadTcpInternalError",
+	0x80830000: "BadTcpEndpointUrlInvalid",
+}
+
+type opcua_metadata struct {
+	Message			string		`json:"message"`
+	ProtocolVersion	*uint32		`json:"protocol_version,omitempty"`
+	ReceiveBuffer	uint32		`json:"receive_buffer_size,omitempty"`
+	SendBuffer		uint32		`json:"send_buffer_size,omitempty"`
+	MaxMessageSize	uint32		`json:"max_message_size,omitempty"`
+	MaxChunkCount	uint32		`json:"max_chunk_count,omitempty"`
+	ErrorCode		string		`json:"error_code,omitempty"`
+	Error			string		`json:"error,omitempty"`
+	Reason			string		`json:"reason,omitempty"`
+}
+
+func hello( dst string ) []byte {
+
+	url := "opc.tcp://" + dst
+	if strings.Contains( dst, ":" ) {
+		url = "opc.tcp://[" + dst + "]"
+	}
+	b := make( []byte, 32, 32 + len(url) )
+	copy( b[0:4], "HELF" )
+	le := binary.LittleEndian
+	le.PutUint32( b[4:8], uint32( 32 + len(url) ) )
+	le.PutUint32( b[12:16], BUFFER_SIZE )
+	le.PutUint32( b[16:20], BUFFER_SIZE )
+	le.PutUint32( b[28:32], uint32( len(url) ) )
+	return append( b, url... )
+}
+
+func parseAcknowledge( data []byte ) *opcua_metadata {
+
+	if len(data) < HEADER_LEN {
+		return nil
+	}
+	le := binary.LittleEndian
+	size := int( le.Uint32( data[4:8] ) )
+	switch string( data[0:4] ) {
+	case "ACKF":
+		if size != ACK_LEN || len(data) < ACK_LEN {
+			return nil
+		}
+		version := le.Uint32( data[8:12] )
+		return &opcua_metadata{
+			Message: "acknowledge",
+			ProtocolVersion: &version,
+			ReceiveBuffer: le.Uint32( data[12:16] ),
+			SendBuffer: le.Uint32( data[16:20] ),
+			MaxMessageSize: le.Uint32( data[20:24] ),
+			MaxChunkCount: le.Uint32( data[24:28] ),
+		}
+	case "ERRF":
+		if size < ERROR_MIN_LEN || len(data) < ERROR_MIN_LEN {
+			return nil
+		}
+		code := le.Uint32( data[8:12] )
+		m := &opcua_metadata{
+			Message: "error",
+			ErrorCode: fmt.Sprintf( "0x%08x", code ),
+			Error: statusNames[ code ],
+		}
+		//a null string has length -1
+		if l := int32( le.Uint32( data[12:16] ) ); l > 0 && int(l) <= len(data) - ERROR_MIN_LEN {
+			m.Reason = string( data[ERROR_MIN_LEN:ERROR_MIN_LEN+int(l)] )
+		}
+		return m
+	}
+	return nil
+}
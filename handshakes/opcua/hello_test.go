@@ -0,0 +1,67 @@
+package opcua
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+var (
+	ack = []byte( "ACKF\x1c\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00\x00\x01\x00\x00\x00\x00" )
+	urlInvalid = []byte( "ERRF\x10\x00\x00\x00\x00\x00\x83\x80\x00\x00\x00\x00" )
+	tooBusy = []byte( "ERRF\x18\x00\x00\x00\x00\x00\x7d\x80\x08\x00\x00\x00too busy" )
+)
+
+func TestHello( t *testing.T ) {
+
+	for dst, url := range map[string]string{
+		"192.0.2.1": "opc.tcp://192.0.2.1",
+		"2001:db8::1": "opc.tcp://[2001:db8::1]",
+	} {
+		h := hello( dst )
+		if string( h[:4] ) != "HELF" || int( binary.LittleEndian.Uint32( h[4:8] ) ) != len(h) ||
+			string( h[32:] ) != url {
+			t.Errorf( "hello(%s) = %q", dst, h )
+		}
+	}
+}
+
+func TestParseAcknowledge( t *testing.T ) {
+
+	m := parseAcknowledge( ack )
+	if m == nil || m.Message != "acknowledge" || *m.ProtocolVersion != 0 ||
+		m.ReceiveBuffer != 65536 || m.SendBuffer != 65536 || m.MaxMessageSize != 16777216 {
+		t.Errorf( "ack: %+v", m )
+	}
+	if m := parseAcknowledge( urlInvalid ); m == nil || m.Error != "BadTcpEndpointUrlInvalid" ||
+		m.ErrorCode != "0x80830000" || m.Reason != "" {
+		t.Errorf( "url invalid: %+v", m )
+	}
+	if m := parseAcknowledge( tooBusy ); m == nil || m.Error != "BadTcpServerTooBusy" || m.Reason != "too busy" {
+		t.Errorf( "too busy: %+v", m )
+	}
+	//a reason longer than the message is left out
+	if m := parseAcknowledge( tooBusy[:20] ); m == nil || m.Reason != "" {
+		t.Errorf( "reason cut short: %+v", m )
+	}
+	var h HandshakeMod
+	for _, v := range [][]byte{
+		ack[:27],
+		append( []byte( "ACKF\x20" ), ack[5:]... ),
+		urlInvalid[:15],
+		[]byte( "ERRF\x08\x00\x00\x00\x00\x00\x83\x80\x00\x00\x00\x00" ),
+		[]byte( "HELF\x1c\x00\x00\x00" ),
+		[]byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ),
+	} {
+		if m := parseAcknowledge( v ); m != nil || h.Verify( string(v) ) != "" {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	for _, v := range [][]byte{ ack, urlInvalid, tooBusy } {
+		if h.Verify( string(v) ) != "opcua" {
+			t.Errorf( "Verify(%q) is not opcua", v )
+		}
+		for i := range v {
+			parseAcknowledge( v[:i] )
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package openvpn
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return hardReset()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseReset( []byte(data) ) != nil {
+		return "openvpn"
+	}
+	return ""
+}
+
+// the server's session (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseReset( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "openvpn", &h )
+}
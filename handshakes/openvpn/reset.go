@@ -0,0 +1,82 @@
+package openvpn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+/* OpenVPN over TCP: each packet has a 2 byte big endian length. the
+ * client opens with P_CONTROL_HARD_RESET_CLIENT_V2 (opcode 7, key 0)
+ * from its session id, acking nothing, as packet 0:
+ *
+ *   00 0e 38 6c 7a 72 31 6c 7a 72 31 00 00 00 00 00
+ *
+ * a server without tls-auth or tls-crypt answers with
+ * P_CONTROL_HARD_RESET_SERVER_V2 (opcode 8) from its own session id,
+ * acking our packet 0 and naming our session id:
+ *
+ *   00 1a 40 <8 byte session id> 01 00 00 00 00
+ *   6c 7a 72 31 6c 7a 72 31 00 00 00 00
+ *
+ * with tls-auth or tls-crypt, the unauthenticated reset is dropped.
+ */
+const (
+	HARD_RESET_CLIENT_V2	byte = 7
+	HARD_RESET_SERVER_V2	byte = 8
+
+	SESSION_ID_LEN			int = 8
+	MAX_ACKS				int = 8
+)
+
+var SESSION_ID = []byte{ 0x6c, 0x7a, 0x72, 0x31, 0x6c, 0x7a, 0x72, 0x31 }
+
+type openvpn_metadata struct {
+	KeyID			int			`json:"key_id"`
+	SessionID		string		`json:"session_id"`
+	Acks			int			`json:"acks"`
+	PacketID		uint32		`json:"packet_id"`
+}
+
+func hardReset() []byte {
+
+	p := []byte{ 0, 0, HARD_RESET_CLIENT_V2 << 3 }
+	p = append( p, SESSION_ID... )
+	//no acks, packet id 0
+	p = append( p, 0, 0, 0, 0, 0 )
+	binary.BigEndian.PutUint16( p, uint16( len(p) - 2 ) )
+	return p
+}
+
+// nil unless data starts with a server hard reset acking our session
+func parseReset( data []byte ) *openvpn_metadata {
+
+	if len(data) < 3 {
+		return nil
+	}
+	l := int( binary.BigEndian.Uint16( data ) )
+	p := data[2:]
+	if l > len(p) || l < 1 + SESSION_ID_LEN + 1 {
+		return nil
+	}
+	p = p[:l]
+	if p[0] >> 3 != HARD_RESET_SERVER_V2 {
+		return nil
+	}
+	m := &openvpn_metadata{
+		KeyID: int( p[0] & 0x07 ),
+		SessionID: hex.EncodeToString( p[1:1+SESSION_ID_LEN] ),
+		Acks: int( p[1+SESSION_ID_LEN] ),
+	}
+	p = p[2+SESSION_ID_LEN:]
+	//the acked packet ids, then the session id they belong to
+	if m.Acks < 1 || m.Acks > MAX_ACKS || len(p) < 4 * m.Acks + SESSION_ID_LEN + 4 {
+		return nil
+	}
+	p = p[4*m.Acks:]
+	if !bytes.Equal( p[:SESSION_ID_LEN], SESSION_ID ) {
+		return nil
+	}
+	m.PacketID = binary.BigEndian.Uint32( p[SESSION_ID_LEN:] )
+	return m
+}
@@ -0,0 +1,68 @@
+package openvpn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+var serverID = []byte{ 0x9a, 0x41, 0x07, 0x3c, 0x55, 0x10, 0xe2, 0x8b }
+
+// a server hard reset acking our packet 0, from serverID
+func serverReset( opcode byte, acks int, session []byte, packetID uint32 ) []byte {
+	p := []byte{ 0, 0, opcode << 3 }
+	p = append( p, serverID... )
+	p = append( p, byte(acks) )
+	p = append( p, make( []byte, 4 * acks )... )
+	p = append( p, session... )
+	p = append( p, 0, 0, 0, 0 )
+	binary.BigEndian.PutUint32( p[len(p)-4:], packetID )
+	binary.BigEndian.PutUint16( p, uint16( len(p) - 2 ) )
+	return p
+}
+
+func TestHardReset( t *testing.T ) {
+
+	want := []byte{ 0x00, 0x0e, 0x38, 0x6c, 0x7a, 0x72, 0x31, 0x6c, 0x7a, 0x72, 0x31, 0x00, 0x00, 0x00, 0x00, 0x00 }
+	if !bytes.Equal( hardReset(), want ) {
+		t.Errorf( "hardReset() = %x", hardReset() )
+	}
+}
+
+func TestParseReset( t *testing.T ) {
+
+	reset := serverReset( HARD_RESET_SERVER_V2, 1, SESSION_ID, 0 )
+	//the server's reset and its TLS ServerHello in one segment
+	withMore := append( append( []byte{}, reset... ), 0x00, 0x10, 0x20 )
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*openvpn_metadata
+	}{
+		{ "reset", reset, &openvpn_metadata{ SessionID: "9a41073c5510e28b", Acks: 1 } },
+		{ "more behind it", withMore, &openvpn_metadata{ SessionID: "9a41073c5510e28b", Acks: 1 } },
+		{ "two acks, packet 1", serverReset( HARD_RESET_SERVER_V2, 2, SESSION_ID, 1 ),
+			&openvpn_metadata{ SessionID: "9a41073c5510e28b", Acks: 2, PacketID: 1 } },
+		{ "no acks", serverReset( HARD_RESET_SERVER_V2, 0, nil, 0 ), nil },
+		{ "too many acks", serverReset( HARD_RESET_SERVER_V2, 9, SESSION_ID, 0 ), nil },
+		{ "other session", serverReset( HARD_RESET_SERVER_V2, 1, serverID, 0 ), nil },
+		{ "client reset", serverReset( HARD_RESET_CLIENT_V2, 1, SESSION_ID, 0 ), nil },
+		{ "our own reset", hardReset(), nil },
+		{ "cut short", reset[:len(reset)-1], nil },
+		{ "length 1", []byte{ 0x00, 0x01, 0x40 }, nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseReset( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( string(c.data) ) == "openvpn" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( string(c.data) ) )
+		}
+	}
+	for i := range reset {
+		parseReset( reset[:i] )
+	}
+}
@@ -22,9 +22,23 @@ func (h *HandshakeMod) Verify( data string ) string {
 	if strings.Contains( data, "DESCRIPTION=(" ) && strings.Contains( data, "(EMFI=4)" ) {
          return "oracle"
 	}
+	//a well formed answer to the CONNECT
+	if m := parseTNS( []byte(data) ); m != nil {
+		if m.Type == "accept" || m.Type == "resend" || strings.Contains( m.Description, "DESCRIPTION=(" ) {
+			return "oracle"
+		}
+	}
     return ""
 }
 
+// TNS version, or release and error of a refusal (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseTNS( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "oracle", &h )
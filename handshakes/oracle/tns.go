@@ -0,0 +1,110 @@
+package oracle
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+/* the listener's answer to LZR's CONNECT. every TNS packet opens with
+ * an 8 byte header: length (big endian), packet checksum, type,
+ * reserved, header checksum.
+ *
+ * ACCEPT: version (2) at 8, service options, SDU, TDU, ...
+ * REFUSE: user and system reason, data length (2) at 10, then the
+ * reason, e.g. for an unknown service name:
+ *   00 6e 00 00 04 00 00 00 22 00 00 62 "(DESCRIPTION=(TMP=)(VSNNUM=186647552)(ERR=12514)(ERROR_STACK=..."
+ * RESEND (the whole packet is the header) asks for the CONNECT again,
+ * which newer listeners do for a first CONNECT.
+ */
+const (
+	TNS_HEADER_LEN		int = 8
+
+	TNS_CONNECT			byte = 1
+	TNS_ACCEPT			byte = 2
+	TNS_REFUSE			byte = 4
+	TNS_REDIRECT		byte = 5
+	TNS_RESEND			byte = 11
+)
+
+var packetTypes = map[byte]string{
+	TNS_ACCEPT: "accept",
+	TNS_REFUSE: "refuse",
+	TNS_REDIRECT: "redirect",
+	TNS_RESEND: "resend",
+}
+
+var (
+	vsnnumPattern = regexp.MustCompile( `\(VSNNUM=(\d+)\)` )
+	errPattern = regexp.MustCompile( `\(ERR=(\d+)\)` )
+)
+
+type oracle_metadata struct {
+	Type			string		`json:"type"`
+	TNSVersion		uint16		`json:"tns_version,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	Error			string		`json:"error,omitempty"`
+	Description		string		`json:"description,omitempty"`
+}
+
+/* VSNNUM is the release packed into a decimal number, one nibble or
+ * byte per part: 186647552 = 0x0b200400 = 11.2.0.4.0
+ */
+func vsnnum( s string ) string {
+
+	v, err := strconv.ParseUint( s, 10, 32 )
+	if err != nil || v == 0 {
+		return ""
+	}
+	return fmt.Sprintf( "%d.%d.%d.%d.%d", v >> 24, ( v >> 20 ) & 0xf,
+		( v >> 12 ) & 0xff, ( v >> 8 ) & 0xf, v & 0xff )
+}
+
+func parseTNS( data []byte ) *oracle_metadata {
+
+	if len(data) < TNS_HEADER_LEN {
+		return nil
+	}
+	length := int( binary.BigEndian.Uint16( data[0:2] ) )
+	typ, ok := packetTypes[ data[4] ]
+	if !ok || length < TNS_HEADER_LEN || data[5] != 0 {
+		return nil
+	}
+	m := &oracle_metadata{ Type: typ }
+	body := data[TNS_HEADER_LEN:]
+	if length - TNS_HEADER_LEN < len(body) {
+		body = body[:length-TNS_HEADER_LEN]
+	}
+	switch data[4] {
+	case TNS_ACCEPT:
+		if len(body) < 2 {
+			return nil
+		}
+		m.TNSVersion = binary.BigEndian.Uint16( body[0:2] )
+		//300 (8i) to 319 (23ai) so far
+		if m.TNSVersion < 300 || m.TNSVersion >= 400 {
+			return nil
+		}
+	case TNS_REFUSE, TNS_REDIRECT:
+		offset := 4
+		if data[4] == TNS_REDIRECT {
+			offset = 2
+		}
+		if len(body) < offset {
+			return nil
+		}
+		m.Description = string( body[offset:] )
+		if match := vsnnumPattern.FindStringSubmatch( m.Description ); match != nil {
+			m.Version = vsnnum( match[1] )
+		}
+		if match := errPattern.FindStringSubmatch( m.Description ); match != nil {
+			m.Error = "TNS-" + match[1]
+		}
+	case TNS_RESEND:
+		if length != TNS_HEADER_LEN {
+			return nil
+		}
+	}
+	return m
+}
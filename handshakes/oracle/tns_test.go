@@ -0,0 +1,74 @@
+package oracle
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// a TNS packet of type typ, the length filled in
+func packet( typ byte, body []byte ) []byte {
+	p := []byte{ 0, 0, 0, 0, typ, 0, 0, 0 }
+	binary.BigEndian.PutUint16( p, uint16( TNS_HEADER_LEN + len(body) ) )
+	return append( p, body... )
+}
+
+const unknownService = "(DESCRIPTION=(TMP=)(VSNNUM=186647552)(ERR=12514)(ERROR_STACK=(ERROR=(CODE=12514)(EMFI=4))))"
+
+var (
+	refuse = packet( TNS_REFUSE, append( []byte{ 0x22, 0x00, 0x00, byte( len(unknownService) ) },
+		unknownService... ) )
+	//19c, TNS version 315
+	accept = packet( TNS_ACCEPT, []byte{ 0x01, 0x3b, 0x00, 0x00, 0x20, 0x00, 0xff, 0xff } )
+	resend = packet( TNS_RESEND, nil )
+)
+
+func TestParseTNS( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		fingerprint		string
+		want			*oracle_metadata
+	}{
+		{ "refuse", refuse, "oracle", &oracle_metadata{ Type: "refuse", Version: "11.2.0.4.0",
+			Error: "TNS-12514", Description: unknownService } },
+		{ "accept", accept, "oracle", &oracle_metadata{ Type: "accept", TNSVersion: 315 } },
+		{ "resend", resend, "oracle", &oracle_metadata{ Type: "resend" } },
+		{ "accept, version 200", packet( TNS_ACCEPT, []byte{ 0x00, 0xc8 } ), "", nil },
+		{ "accept cut short", accept[:9], "", nil },
+		{ "resend with a body", packet( TNS_RESEND, []byte{ 0 } ), "", nil },
+		{ "refuse without description", packet( TNS_REFUSE, []byte{ 0x22, 0x00, 0x00, 0x00 } ), "",
+			&oracle_metadata{ Type: "refuse" } },
+		{ "refuse cut short", packet( TNS_REFUSE, []byte{ 0x22 } ), "", nil },
+		{ "length below header", []byte{ 0x00, 0x04, 0x00, 0x00, 0x0b, 0x00, 0x00, 0x00 }, "", nil },
+		{ "connect", packet( TNS_CONNECT, nil ), "", nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), "", nil },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		if m := parseTNS( tt.data ); !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "%s: got %+v, want %+v", tt.name, m, tt.want )
+		}
+		if f := h.Verify( string(tt.data) ); f != tt.fingerprint {
+			t.Errorf( "%s: Verify = %q", tt.name, f )
+		}
+	}
+	for i := range refuse {
+		parseTNS( refuse[:i] )
+	}
+}
+
+func TestVSNNUM( t *testing.T ) {
+
+	for s, v := range map[string]string{
+		"186647552": "11.2.0.4.0",
+		"318767104": "19.0.0.0.0",
+		"0": "",
+		"x": "",
+	} {
+		if got := vsnnum( s ); got != v {
+			t.Errorf( "vsnnum(%s) = %q, want %q", s, got, v )
+		}
+	}
+}
@@ -9,23 +9,40 @@ type HandshakeMod struct {
 }
 
 func (h *HandshakeMod) GetData( dst string ) []byte {
-	data := []byte("\x00\x00\x00\x08\x04\xd2\x16\x2f")
+	//SSLRequest, then a startup in case the answer is no
+	data := append( sslRequest(), startupMessage()... )
     return data
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
 	datab := []byte(data)
-	if len(datab) != 1{
+	// N or S or E, alone as before the startup was sent
+	if len(datab) == 1 {
+		if byte(datab[0]) == byte(0x4e)  || byte(datab[0]) == byte(0x53) ||
+			  byte(datab[0]) == byte(0x45) {
+			 return "postgres"
+		}
 		return ""
 	}
-	// N or S or E
-	if byte(datab[0]) == byte(0x4e)  || byte(datab[0]) == byte(0x53) ||
-		  byte(datab[0]) == byte(0x45) {
-         return "postgres"
+	if parseStartup( datab ) != nil {
+		return "postgres"
 	}
     return ""
 }
 
+// wait for what follows an 'N' (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// SSL support, auth method, and the error if any (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseStartup( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "postgres", &h )
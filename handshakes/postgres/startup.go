@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"encoding/binary"
+	"strings"
+)
+
+/* LZR sends an SSLRequest and, right behind it, a StartupMessage for
+ * user postgres. the server answers the SSLRequest with one byte, 'S'
+ * (go ahead with TLS, the startup is then lost) or 'N', and after 'N'
+ * reads the startup and answers with an authentication request ('R',
+ * the method) or an error ('E'). very old servers answer the
+ * SSLRequest itself with an error.
+ *
+ * backend messages are a type byte and a big endian length (counting
+ * itself), e.g. R 00 00 00 0c 00 00 00 05 + salt asks for md5.
+ */
+const (
+	SSL_REQUEST_CODE	uint32 = 80877103
+	PROTOCOL_3_0		uint32 = 196608
+	STARTUP_USER		string = "postgres"
+
+	SSL_YES				byte = 'S'
+	SSL_NO				byte = 'N'
+	MSG_AUTH			byte = 'R'
+	MSG_ERROR			byte = 'E'
+	MSG_PARAMETER		byte = 'S'
+
+	MAX_MESSAGE_LEN		int = 8192
+)
+
+var authMethods = map[uint32]string{
+	0: "trust",
+	2: "kerberos_v5",
+	3: "cleartext",
+	5: "md5",
+	6: "scm_credential",
+	7: "gss",
+	9: "sspi",
+	10: "sasl",
+}
+
+type postgres_metadata struct {
+	SSL				string		`json:"ssl,omitempty"`		//"supported" or "unsupported"
+	AuthMethod		string		`json:"auth_method,omitempty"`
+	SASLMechanisms	[]string	`json:"sasl_mechanisms,omitempty"`
+	Version			string		`json:"server_version,omitempty"`
+	ErrorCode		string		`json:"error_code,omitempty"`
+	ErrorMessage	string		`json:"error_message,omitempty"`
+}
+
+func sslRequest() []byte {
+	b := make( []byte, 8 )
+	binary.BigEndian.PutUint32( b[0:4], 8 )
+	binary.BigEndian.PutUint32( b[4:8], SSL_REQUEST_CODE )
+	return b
+}
+
+func startupMessage() []byte {
+
+	params := "user\x00" + STARTUP_USER + "\x00\x00"
+	b := make( []byte, 8, 8 + len(params) )
+	binary.BigEndian.PutUint32( b[0:4], uint32( 8 + len(params) ) )
+	binary.BigEndian.PutUint32( b[4:8], PROTOCOL_3_0 )
+	return append( b, params... )
+}
+
+// the backend message at the start of data, if it is all there
+func readMessage( data []byte ) ( byte, []byte, []byte, bool ) {
+
+	if len(data) < 5 {
+		return 0, nil, nil, false
+	}
+	l := int( binary.BigEndian.Uint32( data[1:5] ) )
+	if l < 4 || l > MAX_MESSAGE_LEN || len(data) < 1 + l {
+		return 0, nil, nil, false
+	}
+	return data[0], data[5:1+l], data[1+l:], true
+}
+
+// the fields of an ErrorResponse, by their one letter code
+func errorFields( body []byte ) map[byte]string {
+
+	fields := make( map[byte]string )
+	for len(body) > 1 && body[0] != 0 {
+		end := strings.IndexByte( string(body[1:]), 0 )
+		if end < 0 {
+			break
+		}
+		fields[ body[0] ] = string( body[1:1+end] )
+		body = body[2+end:]
+	}
+	return fields
+}
+
+func ( m *postgres_metadata ) readAuth( body []byte ) {
+
+	if len(body) < 4 {
+		return
+	}
+	code := binary.BigEndian.Uint32( body[:4] )
+	name, ok := authMethods[ code ]
+	if !ok {
+		name = "unknown"
+	}
+	m.AuthMethod = name
+	if code == 10 {
+		for _, mech := range strings.Split( string(body[4:]), "\x00" ) {
+			if mech != "" {
+				m.SASLMechanisms = append( m.SASLMechanisms, mech )
+			}
+		}
+	}
+}
+
+func ( m *postgres_metadata ) readError( body []byte ) {
+	fields := errorFields( body )
+	m.ErrorCode = fields['C']
+	m.ErrorMessage = fields['M']
+}
+
+// nil unless data is a postgres server's answer
+func parseStartup( data []byte ) *postgres_metadata {
+
+	if len(data) == 0 {
+		return nil
+	}
+	m := &postgres_metadata{}
+	switch data[0] {
+	case SSL_YES:
+		if len(data) != 1 {
+			return nil
+		}
+		m.SSL = "supported"
+		return m
+	case SSL_NO:
+		m.SSL = "unsupported"
+		data = data[1:]
+	case MSG_ERROR:
+	default:
+		return nil
+	}
+	for len(data) > 0 {
+		typ, body, rest, ok := readMessage( data )
+		if !ok {
+			break
+		}
+		switch typ {
+		case MSG_AUTH:
+			m.readAuth( body )
+		case MSG_ERROR:
+			m.readError( body )
+		case MSG_PARAMETER:
+			//sent once trusted
+			if kv := strings.SplitN( string(body), "\x00", 3 ); len(kv) >= 2 && kv[0] == "server_version" {
+				m.Version = kv[1]
+			}
+		}
+		data = rest
+	}
+	if m.SSL == "" && m.ErrorCode == "" && m.ErrorMessage == "" {
+		return nil
+	}
+	return m
+}
+
+/* whether the answer is all there: 'S' alone, or 'N' or an error
+ * followed by a whole message.
+ */
+func answered( data []byte ) bool {
+
+	if len(data) == 0 || data[0] == SSL_YES {
+		return true
+	}
+	if data[0] == SSL_NO {
+		data = data[1:]
+	} else if data[0] != MSG_ERROR {
+		return true
+	}
+	_, _, _, ok := readMessage( data )
+	return ok
+}
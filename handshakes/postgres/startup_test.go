@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// a backend message, the length filled in
+func message( typ byte, body string ) []byte {
+	m := []byte{ typ, 0, 0, 0, 0 }
+	binary.BigEndian.PutUint32( m[1:], uint32( 4 + len(body) ) )
+	return append( m, body... )
+}
+
+var (
+	md5Auth = append( []byte( "N" ), message( 'R', "\x00\x00\x00\x05\x01\x02\x03\x04" )... )
+	scramAuth = append( []byte( "N" ), message( 'R', "\x00\x00\x00\x0aSCRAM-SHA-256-PLUS\x00SCRAM-SHA-256\x00\x00" )... )
+	noHBA = append( []byte( "N" ), message( 'E', "SFATAL\x00VFATAL\x00C28000\x00" +
+		"Mno pg_hba.conf entry for host \"192.0.2.1\", user \"postgres\"\x00\x00" )... )
+	oldError = message( 'E', "SFATAL\x00C0A000\x00Munsupported\x00\x00" )
+)
+
+func TestParseStartup( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		want			*postgres_metadata
+	}{
+		{ "md5", md5Auth, &postgres_metadata{ SSL: "unsupported", AuthMethod: "md5" } },
+		{ "scram", scramAuth, &postgres_metadata{ SSL: "unsupported", AuthMethod: "sasl",
+			SASLMechanisms: []string{ "SCRAM-SHA-256-PLUS", "SCRAM-SHA-256" } } },
+		{ "pg_hba", noHBA, &postgres_metadata{ SSL: "unsupported", ErrorCode: "28000",
+			ErrorMessage: "no pg_hba.conf entry for host \"192.0.2.1\", user \"postgres\"" } },
+		{ "error before ssl", oldError, &postgres_metadata{ ErrorCode: "0A000", ErrorMessage: "unsupported" } },
+		{ "ssl", []byte( "S" ), &postgres_metadata{ SSL: "supported" } },
+		{ "ssl and more", []byte( "S\x16\x03\x01" ), nil },
+		{ "no ssl", []byte( "N" ), &postgres_metadata{ SSL: "unsupported" } },
+		{ "auth cut short", md5Auth[:8], &postgres_metadata{ SSL: "unsupported" } },
+		{ "length too small", []byte( "E\x00\x00\x00\x02" ), nil },
+		{ "length too large", []byte( "E\x7f\xff\xff\xffSFATAL" ), nil },
+		{ "empty", []byte{}, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	}
+	for _, tt := range tests {
+		if m := parseStartup( tt.data ); !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "%s: got %+v, want %+v", tt.name, m, tt.want )
+		}
+	}
+	for _, v := range [][]byte{ md5Auth, scramAuth, noHBA, oldError } {
+		for i := range v {
+			parseStartup( v[:i] )
+			answered( v[:i] )
+		}
+		if !answered( v ) {
+			t.Errorf( "%q: not answered", v )
+		}
+	}
+	if answered( md5Auth[:6] ) {
+		t.Errorf( "a partial message is answered" )
+	}
+}
+
+func TestVerify( t *testing.T ) {
+
+	var h HandshakeMod
+	for _, v := range []string{ "N", "S", "E", string(md5Auth), string(noHBA) } {
+		if h.Verify( v ) != "postgres" {
+			t.Errorf( "Verify(%q) is not postgres", v )
+		}
+	}
+	for _, v := range []string{ "", "X", "S\x16\x03", "SSH-2.0-OpenSSH_9.6\r\n" } {
+		if f := h.Verify( v ); f != "" {
+			t.Errorf( "Verify(%q) = %q", v, f )
+		}
+	}
+}
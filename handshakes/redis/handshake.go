@@ -24,9 +24,20 @@ func (h *HandshakeMod) Verify( data string ) string {
 	if strings.Contains( data, "-ERR unknown" ) {
 		return "redis"
 	}
+	if strings.HasPrefix( data, "-NOAUTH Authentication required" ) {
+		return "redis"
+	}
     return ""
 }
 
+// whether PING needs auth (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseReply( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "redis", &h )
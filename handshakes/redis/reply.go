@@ -0,0 +1,38 @@
+package redis
+
+import (
+	"strings"
+)
+
+/* what the reply to PING says about access: "+PONG" when commands run
+ * without auth, "-NOAUTH Authentication required." when a password is
+ * set, "-DENIED Redis is running in protected mode ..." when the server
+ * has no password and only talks to loopback.
+ */
+type redis_metadata struct {
+	AuthRequired	bool		`json:"auth_required"`
+	ProtectedMode	bool		`json:"protected_mode,omitempty"`
+	Error			string		`json:"error,omitempty"`
+}
+
+func parseReply( data string ) *redis_metadata {
+
+	line := data
+	if i := strings.Index( line, "\r\n" ); i >= 0 {
+		line = line[:i]
+	}
+	switch {
+	case strings.HasPrefix( line, "+PONG" ):
+		return &redis_metadata{}
+	case strings.HasPrefix( line, "-NOAUTH" ):
+		return &redis_metadata{ AuthRequired: true, Error: line[1:] }
+	//servers before 6 say it this way
+	case strings.HasPrefix( line, "-ERR operation not permitted" ):
+		return &redis_metadata{ AuthRequired: true, Error: line[1:] }
+	case strings.HasPrefix( line, "-DENIED" ):
+		return &redis_metadata{ ProtectedMode: true, Error: line[1:] }
+	case strings.HasPrefix( line, "-ERR" ):
+		return &redis_metadata{ Error: line[1:] }
+	}
+	return nil
+}
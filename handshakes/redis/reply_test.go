@@ -0,0 +1,37 @@
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReply( t *testing.T ) {
+
+	tests := []struct {
+		data			string
+		fingerprint		string
+		want			*redis_metadata
+	}{
+		{ "+PONG\r\n", "redis", &redis_metadata{} },
+		{ "-NOAUTH Authentication required.\r\n", "redis",
+			&redis_metadata{ AuthRequired: true, Error: "NOAUTH Authentication required." } },
+		{ "-ERR operation not permitted\r\n", "", &redis_metadata{ AuthRequired: true, Error: "ERR operation not permitted" } },
+		{ "-DENIED Redis is running in protected mode because protected mode is enabled\r\n", "redis",
+			&redis_metadata{ ProtectedMode: true, Error: "DENIED Redis is running in protected mode because protected mode is enabled" } },
+		{ "-ERR unknown command 'GET', with args beginning with: \r\n", "redis",
+			&redis_metadata{ Error: "ERR unknown command 'GET', with args beginning with: " } },
+		{ "+PON", "", nil },
+		{ "-", "", nil },
+		{ "", "", nil },
+		{ "HTTP/1.1 400 Bad Request\r\n\r\n", "", nil },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		if m := parseReply( tt.data ); !reflect.DeepEqual( m, tt.want ) {
+			t.Errorf( "parseReply(%q) = %+v, want %+v", tt.data, m, tt.want )
+		}
+		if f := h.Verify( tt.data ); f != tt.fingerprint {
+			t.Errorf( "Verify(%q) = %q, want %q", tt.data, f, tt.fingerprint )
+		}
+	}
+}
@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/rmi"
+
+func init() {
+	rmi.RegisterHandshake()
+}
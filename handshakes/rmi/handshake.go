@@ -0,0 +1,35 @@
+package rmi
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return header()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseAck( []byte(data) ) != nil {
+		return "rmi"
+	}
+	return ""
+}
+
+// the address the registry saw us come from (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseAck( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "rmi", &h )
+	//postgres takes any N, turning down SSL, for its own
+	lzr.AddFingerprintRule( "rmi", lzr.OVERRIDES, "postgres" )
+}
@@ -0,0 +1,72 @@
+package rmi
+
+import (
+	"encoding/binary"
+	"net"
+	"strconv"
+)
+
+/* the JRMP header (Java RMI spec, 10.2): magic "JRMI", version 2 and
+ * the StreamProtocol. an RMI registry acknowledges with ProtocolAck
+ * followed by the client's address as it sees it, a UTF string and a
+ * port, e.g.
+ *
+ *   4e 00 0c "192.168.1.20" 00 00 d4 31
+ *
+ * or refuses the protocol with a lone ProtocolNotSupported (0x4f).
+ */
+const (
+	STREAM_PROTOCOL			byte = 0x4b
+	PROTOCOL_ACK			byte = 0x4e
+	PROTOCOL_NOT_SUPPORTED	byte = 0x4f
+)
+
+type rmi_metadata struct {
+	Acknowledged	bool		`json:"acknowledged"`
+	ClientHost		string		`json:"client_host,omitempty"`
+	ClientPort		*int		`json:"client_port,omitempty"`
+}
+
+func header() []byte {
+	return []byte{ 'J', 'R', 'M', 'I', 0x00, 0x02, STREAM_PROTOCOL }
+}
+
+/* nil unless data is a ProtocolAck, whose host has to be an address or
+ * name (a bare 'N' is postgres turning down SSL), or a lone
+ * ProtocolNotSupported.
+ */
+func parseAck( data []byte ) *rmi_metadata {
+
+	if len(data) == 1 && data[0] == PROTOCOL_NOT_SUPPORTED {
+		return &rmi_metadata{}
+	}
+	if len(data) < 3 || data[0] != PROTOCOL_ACK {
+		return nil
+	}
+	l := int( binary.BigEndian.Uint16( data[1:3] ) )
+	if l == 0 || l > 255 || len(data) < 3 + l {
+		return nil
+	}
+	host := string( data[3:3+l] )
+	if net.ParseIP( host ) == nil && !hostname( host ) {
+		return nil
+	}
+	m := &rmi_metadata{ Acknowledged: true, ClientHost: host }
+	if rest := data[3+l:]; len(rest) >= 4 {
+		port := int( binary.BigEndian.Uint32( rest ) )
+		m.ClientPort = &port
+	}
+	return m
+}
+
+func hostname( s string ) bool {
+
+	for _, c := range s {
+		if !( c == '.' || c == '-' || c >= '0' && c <= '9' ||
+			c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ) {
+			return false
+		}
+	}
+	_, err := strconv.Atoi( s )
+	return err != nil
+}
@@ -0,0 +1,42 @@
+package rmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAck( t *testing.T ) {
+
+	port := 54321
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*rmi_metadata
+	}{
+		{ "ack", []byte( "\x4e\x00\x0c192.168.1.20\x00\x00\xd4\x31" ), &rmi_metadata{ Acknowledged: true,
+			ClientHost: "192.168.1.20", ClientPort: &port } },
+		{ "ipv6", []byte( "\x4e\x00\x0b2001:db8::7\x00\x00\xd4\x31" ), &rmi_metadata{ Acknowledged: true,
+			ClientHost: "2001:db8::7", ClientPort: &port } },
+		{ "hostname without port", []byte( "\x4e\x00\x0bscanner-1.a" ), &rmi_metadata{ Acknowledged: true,
+			ClientHost: "scanner-1.a" } },
+		{ "not supported", []byte{ PROTOCOL_NOT_SUPPORTED }, &rmi_metadata{} },
+		//postgres turning down SSL
+		{ "postgres", []byte( "N" ), nil },
+		{ "numeric host", []byte( "\x4e\x00\x0312345" ), nil },
+		{ "binary host", []byte( "\x4e\x00\x03\x01\x02\x03" ), nil },
+		{ "empty host", []byte( "\x4e\x00\x00\x00\x00\xd4\x31" ), nil },
+		{ "long host", append( []byte( "\x4e\x01\x00" ), make( []byte, 256 )... ), nil },
+		{ "host cut short", []byte( "\x4e\x00\x0c192.168" ), nil },
+		{ "not supported and more", []byte{ PROTOCOL_NOT_SUPPORTED, 0x00 }, nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseAck( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( string(c.data) ) == "rmi" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( string(c.data) ) )
+		}
+	}
+}
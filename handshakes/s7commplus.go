@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/s7commplus"
+
+func init() {
+	s7commplus.RegisterHandshake()
+}
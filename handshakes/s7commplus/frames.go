@@ -0,0 +1,137 @@
+package s7commplus
+
+import (
+	"encoding/binary"
+	"regexp"
+)
+
+/* S7comm-plus (S7-1200/1500) runs over ISO-on-TCP like classic S7:
+ * TPKT (03 00 and a big endian length), then COTP. LZR sends a COTP
+ * Connection Request for the TSAP engineering and HMI tools use,
+ * "SIMATIC-ROOT-HMI", and right behind it, in a COTP Data TPDU
+ * (02 f0 80), the CreateObject of a ServerSession they open with.
+ *
+ * S7comm-plus PDUs start with 0x72 and the protocol version (1, 2 or
+ * 3). a PLC accepts the connection (COTP CC, 0xd0) and answers the
+ * CreateObject with the session's attributes, among them
+ * "1;6ES7 214-1AG40-0XB0 ;V4.2": the order number and firmware.
+ */
+const (
+	TPKT_VERSION		byte = 0x03
+	TPKT_LEN			int = 4
+	COTP_CC				byte = 0xd0
+	COTP_DT				byte = 0xf0
+
+	S7PLUS_ID			byte = 0x72
+)
+
+var connectionRequest = []byte{
+	//TPKT
+	0x03, 0x00, 0x00, 0x24,
+	//COTP CR, dst ref 0, src ref 1, class 0
+	0x1f, 0xe0, 0x00, 0x00, 0x00, 0x01, 0x00,
+	//TPDU size 1024, calling TSAP 0x0600, called TSAP
+	0xc0, 0x01, 0x0a,
+	0xc1, 0x02, 0x06, 0x00,
+	0xc2, 0x10, 'S', 'I', 'M', 'A', 'T', 'I', 'C', '-', 'R', 'O', 'O', 'T', '-', 'H', 'M', 'I',
+}
+
+var createObject = []byte{
+	//request, CreateObject, sequence 1, ObjectNullServerSession, flags
+	0x31, 0x00, 0x00, 0x04, 0xca, 0x00, 0x00, 0x00, 0x01,
+	0x00, 0x00, 0x01, 0x20, 0x36,
+	//ObjectServerSessionContainer, UDInt 0
+	0x00, 0x00, 0x01, 0x1d, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00,
+	//a ClassServerSession object
+	0xa1, 0x00, 0x00, 0x00, 0xd3, 0x82, 0x1f, 0x00, 0x00,
+	//its client RID and client version as WStrings
+	0xa3, 0x81, 0x69, 0x00, 0x15, 0x11,
+	'S', 'e', 'r', 'v', 'e', 'r', 'S', 'e', 's', 's', 'i', 'o', 'n', '_', 'L', 'Z', 'R',
+	0xa3, 0x82, 0x21, 0x00, 0x15, 0x10,
+	'1', ':', ':', ':', '6', '.', '0', ':', ':', ':', 'T', 'C', 'P', '/', 'I', 'P',
+	//end of object
+	0xa2, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+var orderNumber = regexp.MustCompile( `(6ES7 [0-9A-Z]{3}-[0-9A-Z]{5}-[0-9A-Z]{4}) *;V(\d+\.\d+(\.\d+)?)` )
+
+type s7commplus_metadata struct {
+	Accepted		bool		`json:"accepted"`
+	ProtocolVersion	byte		`json:"protocol_version,omitempty"`
+	OrderNumber		string		`json:"order_number,omitempty"`
+	Firmware		string		`json:"firmware,omitempty"`
+}
+
+func request() []byte {
+
+	pdu := []byte{ S7PLUS_ID, 0x01, 0x00, 0x00 }
+	binary.BigEndian.PutUint16( pdu[2:4], uint16( len(createObject) ) )
+	pdu = append( pdu, createObject... )
+	pdu = append( pdu, S7PLUS_ID, 0x01, 0x00, 0x00 )
+
+	data := []byte{ TPKT_VERSION, 0x00, 0x00, 0x00, 0x02, COTP_DT, 0x80 }
+	binary.BigEndian.PutUint16( data[2:4], uint16( len(data) + len(pdu) ) )
+	return append( append( append( []byte{}, connectionRequest... ), data... ), pdu... )
+}
+
+// the COTP TPDUs (length octet on) of the whole TPKTs in data
+func readTPKTs( data []byte ) ( [][]byte, []byte ) {
+
+	var tpdus [][]byte
+	for len(data) >= TPKT_LEN && data[0] == TPKT_VERSION && data[1] == 0 {
+		l := int( binary.BigEndian.Uint16( data[2:4] ) )
+		if l < TPKT_LEN + 2 || len(data) < l {
+			break
+		}
+		tpdus = append( tpdus, data[TPKT_LEN:l] )
+		data = data[l:]
+	}
+	return tpdus, data
+}
+
+// nil unless the connection was accepted and S7comm-plus came back
+func parseResponse( data []byte ) *s7commplus_metadata {
+
+	tpdus, _ := readTPKTs( data )
+	m := &s7commplus_metadata{}
+	for _, tpdu := range tpdus {
+		li := int( tpdu[0] )
+		if len(tpdu) < 1 + li {
+			return nil
+		}
+		switch tpdu[1] {
+		case COTP_CC:
+			m.Accepted = true
+		case COTP_DT:
+			payload := tpdu[1+li:]
+			if len(payload) >= 2 && payload[0] == S7PLUS_ID && m.ProtocolVersion == 0 {
+				m.ProtocolVersion = payload[1]
+			}
+			if match := orderNumber.FindSubmatch( payload ); match != nil && m.OrderNumber == "" {
+				m.OrderNumber = string( match[1] )
+				m.Firmware = "V" + string( match[2] )
+			}
+		}
+	}
+	if !m.Accepted || m.ProtocolVersion < 1 || m.ProtocolVersion > 3 {
+		return nil
+	}
+	return m
+}
+
+/* whether the PLC has answered: LZR waits past the CC for the
+ * S7comm-plus response, but not for anything that is not ISO-on-TCP.
+ */
+func answered( data []byte ) bool {
+
+	if len(data) >= 2 && !( data[0] == TPKT_VERSION && data[1] == 0 ) {
+		return true
+	}
+	tpdus, _ := readTPKTs( data )
+	for _, tpdu := range tpdus {
+		if len(tpdu) < 2 || tpdu[1] != COTP_CC {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package s7commplus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// a TPKT around a COTP TPDU
+func tpkt( cotp ...byte ) []byte {
+	b := []byte{ TPKT_VERSION, 0x00, 0x00, 0x00 }
+	binary.BigEndian.PutUint16( b[2:4], uint16( TPKT_LEN + len(cotp) ) )
+	return append( b, cotp... )
+}
+
+var (
+	cc = tpkt( 0x11, COTP_CC, 0x00, 0x01, 0x00, 0x02, 0x00, 0xc0, 0x01, 0x0a,
+		0xc1, 0x02, 0x06, 0x00, 0xc2, 0x02, 0x01, 0x00 )
+	session = tpkt( append( []byte{ 0x02, COTP_DT, 0x80, S7PLUS_ID, 0x01, 0x00, 0x30, 0x32, 0x00, 0x00, 0x04, 0xca },
+		[]byte( "\xa3\x82\x21\x00\x15\x1c1;6ES7 214-1AG40-0XB0 ;V4.2" )... )... )
+	disconnect = tpkt( 0x06, 0x80, 0x00, 0x00, 0x00, 0x01, 0x00 )
+)
+
+func TestRequest( t *testing.T ) {
+
+	tpdus, rest := readTPKTs( request() )
+	if len(tpdus) != 2 || len(rest) != 0 || tpdus[0][1] != 0xe0 || tpdus[1][1] != COTP_DT ||
+		!bytes.Equal( tpdus[1][3:7], []byte{ S7PLUS_ID, 0x01, 0x00, byte( len(createObject) ) } ) {
+		t.Errorf( "request: %x", request() )
+	}
+}
+
+func TestParseResponse( t *testing.T ) {
+
+	data := append( append( []byte{}, cc... ), session... )
+	m := parseResponse( data )
+	if m == nil || !m.Accepted || m.ProtocolVersion != 1 || m.OrderNumber != "6ES7 214-1AG40-0XB0" ||
+		m.Firmware != "V4.2" {
+		t.Errorf( "session: %+v", m )
+	}
+	var h HandshakeMod
+	if h.Verify( string(data) ) != "s7commplus" || !h.Complete( string(data) ) {
+		t.Errorf( "Verify or Complete failed on %x", data )
+	}
+	//a classic S7 PLC accepts the connection but does not speak S7comm-plus
+	classic := append( append( []byte{}, cc... ), tpkt( 0x02, COTP_DT, 0x80, 0x32, 0x03, 0x00, 0x00 )... )
+	for _, v := range [][]byte{
+		cc,
+		session,
+		classic,
+		disconnect,
+		data[:len(data)-1],
+		tpkt( 0x40, COTP_CC ),
+		[]byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ),
+	} {
+		if m := parseResponse( v ); m != nil || h.Verify( string(v) ) != "" {
+			t.Errorf( "%x: %+v", v, m )
+		}
+	}
+	for i := range data {
+		parseResponse( data[:i] )
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		[]byte
+		answered	bool
+	}{
+		{ nil, false },
+		{ cc, false },
+		{ cc[:5], false },
+		{ append( append( []byte{}, cc... ), session... ), true },
+		{ append( append( []byte{}, cc... ), session[:10]... ), false },
+		{ disconnect, true },
+		{ []byte( "HTTP/1.1" ), true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%x) = %v", c.data, !c.answered )
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package s7commplus
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseResponse( []byte(data) ) != nil {
+		return "s7commplus"
+	}
+	return ""
+}
+
+// wait for the CreateObject response behind the CC (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// protocol version, order number and firmware (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseResponse( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "s7commplus", &h )
+}
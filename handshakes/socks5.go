@@ -0,0 +1,7 @@
+package handshakes
+
+import "github.com/stanford-esrg/lzr/handshakes/socks5"
+
+func init() {
+	socks5.RegisterHandshake()
+}
@@ -0,0 +1,55 @@
+package socks5
+
+/* the SOCKS5 greeting (RFC 1928 3) offers no authentication and
+ * username/password:
+ *
+ *   05 02 00 02
+ *
+ * the server selects one in exactly two bytes, version 5 and the
+ * method, e.g. 05 02, or 05 ff when it accepts none of them. a SOCKS4
+ * server may reject the greeting with a SOCKS4 reply, 00 5b, which
+ * makes it socks4.
+ */
+const (
+	VERSION				byte = 0x05
+	NO_AUTH				byte = 0x00
+	USERNAME_PASSWORD	byte = 0x02
+	NO_ACCEPTABLE		byte = 0xff
+
+	SOCKS4_REJECTED		byte = 0x5b
+)
+
+var methodNames = map[byte]string{
+	NO_AUTH: "no_auth",
+	USERNAME_PASSWORD: "username_password",
+	NO_ACCEPTABLE: "no_acceptable_methods",
+}
+
+type socks5_metadata struct {
+	Version			int			`json:"version"`
+	Method			string		`json:"method,omitempty"`
+}
+
+func greeting() []byte {
+	return []byte{ VERSION, 2, NO_AUTH, USERNAME_PASSWORD }
+}
+
+// nil unless data is a method selection (or a SOCKS4 rejection)
+func parseSelection( data []byte ) *socks5_metadata {
+
+	if len(data) != 2 {
+		return nil
+	}
+	if data[0] == 0x00 && data[1] == SOCKS4_REJECTED {
+		return &socks5_metadata{ Version: 4 }
+	}
+	if data[0] != VERSION {
+		return nil
+	}
+	//the server may only pick what was offered
+	name, ok := methodNames[ data[1] ]
+	if !ok {
+		return nil
+	}
+	return &socks5_metadata{ Version: 5, Method: name }
+}
@@ -0,0 +1,42 @@
+package socks5
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestGreeting( t *testing.T ) {
+	if !bytes.Equal( greeting(), []byte{ 0x05, 0x02, 0x00, 0x02 } ) {
+		t.Errorf( "greeting() = %x", greeting() )
+	}
+}
+
+func TestParseSelection( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		[]byte
+		want		*socks5_metadata
+		label		string
+	}{
+		{ []byte{ 0x05, 0x00 }, &socks5_metadata{ Version: 5, Method: "no_auth" }, "socks5" },
+		{ []byte{ 0x05, 0x02 }, &socks5_metadata{ Version: 5, Method: "username_password" }, "socks5" },
+		{ []byte{ 0x05, 0xff }, &socks5_metadata{ Version: 5, Method: "no_acceptable_methods" }, "socks5" },
+		{ []byte{ 0x00, 0x5b }, &socks5_metadata{ Version: 4 }, "socks4" },
+		//GSSAPI was not offered
+		{ []byte{ 0x05, 0x01 }, nil, "" },
+		{ []byte{ 0x04, 0x00 }, nil, "" },
+		{ []byte{ 0x05 }, nil, "" },
+		{ []byte{ 0x05, 0x00, 0x00 }, nil, "" },
+		{ nil, nil, "" },
+		{ []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil, "" },
+	} {
+		if got := parseSelection( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%x: got %+v, want %+v", c.data, got, c.want )
+		}
+		var h HandshakeMod
+		if got := h.Verify( string(c.data) ); got != c.label {
+			t.Errorf( "%x: Verify %q, want %q", c.data, got, c.label )
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package socks5
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return greeting()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	m := parseSelection( []byte(data) )
+	if m == nil {
+		return ""
+	}
+	if m.Version == 4 {
+		return "socks4"
+	}
+	return "socks5"
+}
+
+// the selected authentication method (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseSelection( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "socks5", &h )
+	//telnet takes the 0xff of 05 ff for IAC
+	lzr.AddFingerprintRule( "socks5", lzr.OVERRIDES, "telnet" )
+}
@@ -17,22 +17,84 @@ func (h *HandshakeMod) GetData( dst string ) []byte {
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
-	if data == "" || !isASCII(data) {
+	if data == "" {
 		return ""
 	}
-
-	dl :=  ToLower(data)
-	if strings.Contains( dl, "ssh" ) &&
-		!strings.Contains( dl, "not implemented") &&
-		!strings.Contains( dl, "bad") {
+	//the identification line, possibly cut short
+	if _, ok := parseIdentification( data ); ok || strings.HasPrefix( data, "SSH-" ) {
 		return "ssh"
 	}
     return ""
 }
 
+/* read on through the server's KEXINIT (lzr.StreamingHandshake), which
+ * comes right after the identification. SSH-1 has none, and a partial
+ * line that is not an identification is not waited on.
+ */
+func (h *HandshakeMod) Complete( data string ) bool {
+
+	id, ok := parseIdentification( data )
+	if !ok {
+		return !strings.Contains( data, "SSH-" ) || len(data) > MAX_IDENT_OFFSET
+	}
+	if id.protocol != "2.0" && id.protocol != "1.99" {
+		return true
+	}
+	_, whole := readPacket( []byte( data[id.end:] ) )
+	return whole
+}
+
+type ssh_metadata struct {
+	Protocol		string			`json:"protocol"`
+	Software		string			`json:"software"`
+	Product			string			`json:"product,omitempty"`
+	ProductVersion	string			`json:"product_version,omitempty"`
+	Comments		string			`json:"comments,omitempty"`
+	Kex				*kex_metadata	`json:"kexinit,omitempty"`
+}
+
+type kex_metadata struct {
+	Kex				[]string		`json:"kex_algorithms"`
+	HostKey			[]string		`json:"host_key_algorithms"`
+	Ciphers			[]string		`json:"ciphers"`
+	MACs			[]string		`json:"macs"`
+	Compression		[]string		`json:"compression"`
+	HASSH			string			`json:"hassh"`
+	HASSHString		string			`json:"hassh_string"`
+}
+
+// identification and, if it arrived, KEXINIT with HASSH (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+
+	id, ok := parseIdentification( data )
+	if !ok {
+		return nil
+	}
+	m := &ssh_metadata{
+		Protocol: id.protocol,
+		Software: id.software,
+		Comments: id.comments,
+	}
+	m.Product, m.ProductVersion = splitSoftware( id.software )
+	if payload, ok := readPacket( []byte( data[id.end:] ) ); ok {
+		if k, ok := parseKexinit( payload ); ok {
+			m.Kex = &kex_metadata{
+				Kex: k.kex,
+				HostKey: k.hostKey,
+				Ciphers: k.ciphersS2C,
+				MACs: k.macsS2C,
+				Compression: k.compressionS2C,
+			}
+			m.Kex.HASSH, m.Kex.HASSHString = hasshServer( k )
+		}
+	}
+	return m
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "ssh", &h )
+	lzr.AddFingerprintRule( "ssh", lzr.REFINES, "ftp" )
 }
 
 //more efficient string toLower
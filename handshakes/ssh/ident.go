@@ -0,0 +1,63 @@
+package ssh
+
+import (
+	"strings"
+)
+
+/* the identification string a server opens with (RFC 4253, 4.2):
+ *
+ *   SSH-protoversion-softwareversion SP comments CR LF
+ *
+ * e.g. "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6". other lines may come
+ * before it, the binary packet protocol (and KEXINIT) right after it.
+ */
+type identification struct {
+	protocol		string
+	software		string
+	comments		string
+	end				int		//where the binary packets start
+}
+
+// at most how far into a response the identification may be
+const MAX_IDENT_OFFSET = 1024
+
+// the identification line in data, if there is a whole one
+func parseIdentification( data string ) ( *identification, bool ) {
+
+	start := 0
+	for !strings.HasPrefix( data[start:], "SSH-" ) {
+		nl := strings.Index( data[start:], "\n" )
+		if nl < 0 || start + nl + 1 > MAX_IDENT_OFFSET {
+			return nil, false
+		}
+		start += nl + 1
+	}
+	nl := strings.Index( data[start:], "\n" )
+	if nl < 0 {
+		return nil, false
+	}
+	line := strings.TrimRight( data[start:start+nl], "\r" )
+	fields := strings.SplitN( line[len("SSH-"):], "-", 2 )
+	if len(fields) != 2 || fields[0] == "" || fields[1] == "" || !isASCII( line ) {
+		return nil, false
+	}
+	id := &identification{ protocol: fields[0], end: start + nl + 1 }
+	id.software = fields[1]
+	if sp := strings.Index( id.software, " " ); sp >= 0 {
+		id.software, id.comments = id.software[:sp], strings.TrimSpace( id.software[sp+1:] )
+	}
+	return id, true
+}
+
+/* "OpenSSH_8.9p1" is OpenSSH 8.9p1 and "dropbear_2020.81" Dropbear
+ * 2020.81; software not named that way has no version.
+ */
+func splitSoftware( software string ) ( string, string ) {
+
+	for _, sep := range []string{ "_", "-" } {
+		if i := strings.Index( software, sep ); i > 0 && i < len(software) - 1 {
+			return software[:i], software[i+1:]
+		}
+	}
+	return software, ""
+}
@@ -0,0 +1,67 @@
+package ssh
+
+import (
+	"testing"
+)
+
+const (
+	openSSH = "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.6\r\n"
+	dropbear = "SSH-2.0-dropbear_2020.81\r\n"
+)
+
+func TestParseIdentification( t *testing.T ) {
+
+	for data, want := range map[string]identification{
+		openSSH: { protocol: "2.0", software: "OpenSSH_8.9p1", comments: "Ubuntu-3ubuntu0.6", end: len(openSSH) },
+		dropbear: { protocol: "2.0", software: "dropbear_2020.81", end: len(dropbear) },
+		//a bare LF, and an SSH-1 server
+		"SSH-1.5-Cisco-1.25\n": { protocol: "1.5", software: "Cisco-1.25", end: 19 },
+		"SSH-1.99-OpenSSH_3.9p1\r\n\x00\x00": { protocol: "1.99", software: "OpenSSH_3.9p1", end: 24 },
+		//lines before the identification (RFC 4253, 4.2)
+		"Welcome to host1\r\nAuthorized use only\r\n" + openSSH: {
+			protocol: "2.0", software: "OpenSSH_8.9p1", comments: "Ubuntu-3ubuntu0.6", end: 39 + len(openSSH),
+		},
+	} {
+		id, ok := parseIdentification( data )
+		if !ok || *id != want {
+			t.Errorf( "%q: %+v, want %+v", data, id, want )
+		}
+	}
+
+	for _, data := range []string{
+		"",
+		//cut short
+		"SSH-2.0-OpenSSH_8.9p1",
+		"Welcome\r\n",
+		//no software
+		"SSH-2.0-\r\n",
+		"SSH-2.0\r\n",
+		"SSH--OpenSSH\r\n",
+		"SSH-2.0-OpenSSH_8.9p1 \xc3\xa9\r\n",
+		"HTTP/1.1 400 Bad Request\r\n\r\n",
+		//the identification too far in
+		string( make( []byte, MAX_IDENT_OFFSET ) ) + "\n" + openSSH,
+	} {
+		if id, ok := parseIdentification( data ); ok {
+			t.Errorf( "%q: %+v", data, id )
+		}
+	}
+}
+
+func TestSplitSoftware( t *testing.T ) {
+
+	for software, want := range map[string][2]string{
+		"OpenSSH_8.9p1": { "OpenSSH", "8.9p1" },
+		"dropbear_2020.81": { "dropbear", "2020.81" },
+		"Cisco-1.25": { "Cisco", "1.25" },
+		"libssh_0.9.6": { "libssh", "0.9.6" },
+		"RomSShell_5.40": { "RomSShell", "5.40" },
+		"libssh": { "libssh", "" },
+		"OpenSSH_": { "OpenSSH_", "" },
+		"_8.9": { "_8.9", "" },
+	} {
+		if product, version := splitSoftware( software ); product != want[0] || version != want[1] {
+			t.Errorf( "%s: %q %q, want %q", software, product, version, want )
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package ssh
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+/* the server's KEXINIT, the first binary packet after the
+ * identification (RFC 4253, 6 and 7.1):
+ *
+ *   uint32 packet_length, byte padding_length, payload, padding
+ *
+ * with the payload byte SSH_MSG_KEXINIT, a 16 byte cookie and ten
+ * name-lists (uint32 length, comma separated names).
+ */
+const (
+	MSG_KEXINIT			byte = 20
+	COOKIE_LEN			int = 16
+	MAX_PACKET_LEN		int = 35000
+)
+
+type kexinit struct {
+	kex					[]string
+	hostKey				[]string
+	ciphersC2S			[]string
+	ciphersS2C			[]string
+	macsC2S				[]string
+	macsS2C				[]string
+	compressionC2S		[]string
+	compressionS2C		[]string
+}
+
+// the payload of the binary packet at the start of data
+func readPacket( data []byte ) ( []byte, bool ) {
+
+	if len(data) < 5 {
+		return nil, false
+	}
+	l := int( binary.BigEndian.Uint32( data[:4] ) )
+	padding := int( data[4] )
+	if l < 1 + padding || l > MAX_PACKET_LEN || len(data) < 4 + l {
+		return nil, false
+	}
+	return data[5:4+l-padding], true
+}
+
+func readNameList( b []byte ) ( []string, []byte, bool ) {
+
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	l := int( binary.BigEndian.Uint32( b[:4] ) )
+	if len(b) < 4 + l {
+		return nil, nil, false
+	}
+	names := string( b[4:4+l] )
+	if names == "" {
+		return []string{}, b[4+l:], true
+	}
+	return strings.Split( names, "," ), b[4+l:], true
+}
+
+func parseKexinit( payload []byte ) ( *kexinit, bool ) {
+
+	if len(payload) < 1 + COOKIE_LEN || payload[0] != MSG_KEXINIT {
+		return nil, false
+	}
+	k := &kexinit{}
+	lists := []*[]string{
+		&k.kex, &k.hostKey,
+		&k.ciphersC2S, &k.ciphersS2C,
+		&k.macsC2S, &k.macsS2C,
+		&k.compressionC2S, &k.compressionS2C,
+	}
+	rest := payload[1+COOKIE_LEN:]
+	for _, list := range lists {
+		var ok bool
+		if *list, rest, ok = readNameList( rest ); !ok {
+			return nil, false
+		}
+	}
+	return k, true
+}
+
+// HASSH of a server: md5 of "kex;ciphers;macs;compression", server to client
+func hasshServer( k *kexinit ) ( string, string ) {
+
+	s := strings.Join( []string{
+		strings.Join( k.kex, "," ),
+		strings.Join( k.ciphersS2C, "," ),
+		strings.Join( k.macsS2C, "," ),
+		strings.Join( k.compressionS2C, "," ),
+	}, ";" )
+	sum := md5.Sum( []byte(s) )
+	return hex.EncodeToString( sum[:] ), s
+}
@@ -0,0 +1,192 @@
+package ssh
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/ftp"
+)
+
+// the server to client lists are also sent client to server
+type algorithms struct {
+	kex, hostKey, ciphers, macs, compression string
+}
+
+var (
+	//OpenSSH 8.9p1 (Ubuntu 22.04) defaults
+	openSSHAlgorithms = algorithms{
+		kex: "curve25519-sha256,curve25519-sha256@libssh.org,ecdh-sha2-nistp256,ecdh-sha2-nistp384," +
+			"ecdh-sha2-nistp521,sntrup761x25519-sha512@openssh.com,diffie-hellman-group-exchange-sha256," +
+			"diffie-hellman-group16-sha512,diffie-hellman-group18-sha512,diffie-hellman-group14-sha256",
+		hostKey: "rsa-sha2-512,rsa-sha2-256,ecdsa-sha2-nistp256,ssh-ed25519",
+		ciphers: "chacha20-poly1305@openssh.com,aes128-ctr,aes192-ctr,aes256-ctr," +
+			"aes128-gcm@openssh.com,aes256-gcm@openssh.com",
+		macs: "umac-64-etm@openssh.com,umac-128-etm@openssh.com,hmac-sha2-256-etm@openssh.com," +
+			"hmac-sha2-512-etm@openssh.com,hmac-sha1-etm@openssh.com,umac-64@openssh.com," +
+			"umac-128@openssh.com,hmac-sha2-256,hmac-sha2-512,hmac-sha1",
+		compression: "none,zlib@openssh.com",
+	}
+	openSSHHASSH = "699519fdcc30cbcd093d5cd01e4b1d56"
+	//Dropbear 2020.81 defaults
+	dropbearAlgorithms = algorithms{
+		kex: "curve25519-sha256,curve25519-sha256@libssh.org,ecdh-sha2-nistp521,ecdh-sha2-nistp384," +
+			"ecdh-sha2-nistp256,diffie-hellman-group14-sha256,diffie-hellman-group14-sha1,kexguess2@matt.ucc.asn.au",
+		hostKey: "ecdsa-sha2-nistp256,ssh-rsa",
+		ciphers: "aes128-ctr,aes256-ctr",
+		macs: "hmac-sha1,hmac-sha2-256",
+		compression: "zlib@openssh.com,none",
+	}
+	dropbearHASSH = "a1596641404be2af3b56c1f1edadb910"
+)
+
+func uint32be( v int ) []byte {
+	b := make( []byte, 4 )
+	binary.BigEndian.PutUint32( b, uint32(v) )
+	return b
+}
+
+func nameList( names string ) []byte {
+	return append( uint32be( len(names) ), names... )
+}
+
+// a KEXINIT payload, cookie and all
+func kexinitPayload( a algorithms ) []byte {
+
+	payload := append( []byte{ MSG_KEXINIT }, "0123456789abcdef"... )
+	for _, names := range []string{
+		a.kex, a.hostKey,
+		a.ciphers, a.ciphers,
+		a.macs, a.macs,
+		a.compression, a.compression,
+		"", "",
+	} {
+		payload = append( payload, nameList( names )... )
+	}
+	//first_kex_packet_follows and reserved
+	return append( payload, 0, 0, 0, 0, 0 )
+}
+
+// the payload as a binary packet, padded to a multiple of 8 with at least 4 bytes
+func packet( payload []byte ) []byte {
+
+	padding := 8 - ( 5 + len(payload) ) % 8
+	if padding < 4 {
+		padding += 8
+	}
+	p := uint32be( 1 + len(payload) + padding )
+	p = append( p, byte(padding) )
+	p = append( p, payload... )
+	return append( p, make( []byte, padding )... )
+}
+
+func TestReadPacket( t *testing.T ) {
+
+	payload := kexinitPayload( openSSHAlgorithms )
+	p := packet( payload )
+	if got, ok := readPacket( append( p, "next"... ) ); !ok || string(got) != string(payload) {
+		t.Errorf( "packet: %x", got )
+	}
+
+	for _, data := range [][]byte{
+		nil,
+		p[:4],
+		//truncated
+		p[:len(p)-1],
+		p[:len(p)/2],
+		//more padding than packet
+		{ 0, 0, 0, 4, 8, 0, 0, 0 },
+		//longer than any packet
+		append( uint32be( MAX_PACKET_LEN + 1 ), make( []byte, MAX_PACKET_LEN + 1 )... ),
+	} {
+		if got, ok := readPacket( data ); ok {
+			t.Errorf( "%x: %x", data, got )
+		}
+	}
+}
+
+func TestParseKexinit( t *testing.T ) {
+
+	for _, v := range []struct {
+		a		algorithms
+		hassh	string
+	}{
+		{ openSSHAlgorithms, openSSHHASSH },
+		{ dropbearAlgorithms, dropbearHASSH },
+	} {
+		k, ok := parseKexinit( kexinitPayload( v.a ) )
+		if !ok {
+			t.Fatalf( "%s: not parsed", v.hassh )
+		}
+		if strings.Join( k.kex, "," ) != v.a.kex || strings.Join( k.hostKey, "," ) != v.a.hostKey ||
+			strings.Join( k.ciphersS2C, "," ) != v.a.ciphers || strings.Join( k.macsS2C, "," ) != v.a.macs ||
+			strings.Join( k.compressionS2C, "," ) != v.a.compression {
+			t.Errorf( "%s: %+v", v.hassh, k )
+		}
+		hash, s := hasshServer( k )
+		if want := v.a.kex + ";" + v.a.ciphers + ";" + v.a.macs + ";" + v.a.compression; s != want || hash != v.hassh {
+			t.Errorf( "hassh %s %q, want %s %q", hash, s, v.hassh, want )
+		}
+	}
+
+	payload := kexinitPayload( dropbearAlgorithms )
+	for _, p := range [][]byte{
+		nil,
+		payload[:COOKIE_LEN],
+		//SSH_MSG_KEXDH_REPLY
+		append( []byte{ 31 }, payload[1:]... ),
+		//a name-list cut short
+		payload[:1+COOKIE_LEN+4+10],
+		//the server to client compression cut short
+		payload[:len(payload)-5-8-len(dropbearAlgorithms.compression)],
+	} {
+		if k, ok := parseKexinit( p ); ok {
+			t.Errorf( "%x: %+v", p, k )
+		}
+	}
+}
+
+func TestMetadata( t *testing.T ) {
+
+	var h HandshakeMod
+	banner := "Welcome\r\n" + openSSH
+	data := banner + string( packet( kexinitPayload( openSSHAlgorithms ) ) )
+	for i := range data {
+		if h.Complete( data[:i] ) && i > len(banner) {
+			t.Errorf( "complete after %d of %d bytes", i, len(data) )
+		}
+	}
+	if !h.Complete( data ) || h.Verify( data ) != "ssh" {
+		t.Error( "not an ssh response" )
+	}
+	m, _ := h.Metadata( data ).( *ssh_metadata )
+	if m == nil || m.Product != "OpenSSH" || m.ProductVersion != "8.9p1" || m.Comments != "Ubuntu-3ubuntu0.6" ||
+		m.Kex == nil || m.Kex.HASSH != openSSHHASSH {
+		t.Errorf( "metadata: %+v", m )
+	}
+
+	//SSH-1 has no KEXINIT to wait on, a truncated one is left out
+	data = dropbear + string( packet( kexinitPayload( dropbearAlgorithms ) )[:40] )
+	if m, _ := h.Metadata( data ).( *ssh_metadata ); m == nil || m.Product != "dropbear" || m.Kex != nil {
+		t.Errorf( "truncated: %+v", m )
+	}
+	if !h.Complete( "SSH-1.5-Cisco-1.25\n" ) || h.Complete( data ) {
+		t.Error( "complete" )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	ftp.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		openSSH: "ssh",
+		dropbear: "ssh",
+		"220 ProFTPD Server ready\r\n": "ftp",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package stomp
+
+import (
+	"strings"
+)
+
+/* STOMP frames are a command line, header lines ("key:value"), a blank
+ * line, a body and a NUL. LZR sends a CONNECT accepting every version,
+ * and a broker answers with CONNECTED, or with ERROR when it wants
+ * credentials:
+ *
+ *   CONNECTED\nserver:ActiveMQ/5.18.3\nheart-beat:0,0\nsession:ID:b1-1\nversion:1.2\n\n\x00
+ *   ERROR\nmessage:Access refused for user 'guest'\ncontent-type:text/plain\nversion:1.0,1.1,1.2\n\n...\x00
+ */
+const (
+	CMD_CONNECTED		string = "CONNECTED"
+	CMD_ERROR			string = "ERROR"
+)
+
+type stomp_metadata struct {
+	Command			string		`json:"command"`
+	Version			string		`json:"version,omitempty"`
+	Server			string		`json:"server,omitempty"`
+	Product			string		`json:"product,omitempty"`
+	ProductVersion	string		`json:"product_version,omitempty"`
+	HeartBeat		string		`json:"heart_beat,omitempty"`
+	Message			string		`json:"message,omitempty"`
+}
+
+func connectFrame( dst string ) []byte {
+	return []byte( "CONNECT\naccept-version:1.0,1.1,1.2\nhost:" + dst + "\n\n\x00" )
+}
+
+// nil unless data starts with a CONNECTED or ERROR frame with headers
+func parseFrame( data string ) *stomp_metadata {
+
+	data = strings.ReplaceAll( data, "\r\n", "\n" )
+	lines := strings.Split( data, "\n" )
+	if len(lines) < 2 || ( lines[0] != CMD_CONNECTED && lines[0] != CMD_ERROR ) {
+		return nil
+	}
+	m := &stomp_metadata{ Command: lines[0] }
+	headers := 0
+	for _, line := range lines[1:] {
+		i := strings.IndexByte( line, ':' )
+		if line == "" || i <= 0 {
+			break
+		}
+		headers++
+		key, value := line[:i], line[i+1:]
+		switch key {
+		case "version":
+			m.Version = value
+		case "server":
+			m.Server = value
+			m.Product, m.ProductVersion = value, ""
+			if j := strings.IndexByte( value, '/' ); j >= 0 {
+				m.Product, m.ProductVersion = value[:j], value[j+1:]
+			}
+		case "heart-beat":
+			m.HeartBeat = value
+		case "message":
+			m.Message = value
+		}
+	}
+	//a CONNECTED always has a header, an ERROR has at least its message
+	if headers == 0 {
+		return nil
+	}
+	return m
+}
+
+// a frame ends with a NUL
+func answered( data string ) bool {
+
+	if strings.IndexByte( data, 0 ) >= 0 {
+		return true
+	}
+	for _, cmd := range []string{ CMD_CONNECTED, CMD_ERROR } {
+		if strings.HasPrefix( data, cmd ) || strings.HasPrefix( cmd, data ) {
+			return false
+		}
+	}
+	return true
+}
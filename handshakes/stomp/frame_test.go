@@ -0,0 +1,59 @@
+package stomp
+
+import (
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/http"
+	"github.com/stanford-esrg/lzr/handshakes/memcached_binary"
+)
+
+const (
+	connected = "CONNECTED\nserver:ActiveMQ/5.18.3\nheart-beat:0,0\nsession:ID:b1-1\nversion:1.2\n\n\x00"
+	//RabbitMQ puts the reason in an HTML body, and ends lines with CRLF
+	accessRefused = "ERROR\r\nmessage:Access refused for user 'guest'\r\ncontent-type:text/plain\r\n" +
+		"version:1.0,1.1,1.2\r\n\r\n<html><body>Access refused</body></html>\x00"
+)
+
+func TestParseFrame( t *testing.T ) {
+
+	m := parseFrame( connected )
+	if m == nil || m.Command != CMD_CONNECTED || m.Version != "1.2" || m.Product != "ActiveMQ" ||
+		m.ProductVersion != "5.18.3" || m.HeartBeat != "0,0" {
+		t.Errorf( "connected: %+v", m )
+	}
+	m = parseFrame( accessRefused )
+	if m == nil || m.Command != CMD_ERROR || m.Message != "Access refused for user 'guest'" {
+		t.Errorf( "error: %+v", m )
+	}
+	for _, v := range []string{
+		"",
+		"CONNECTED",
+		"CONNECTED\n\n\x00",
+		"ERROR\r\n",
+		"HTTP/1.1 400 Bad Request\r\n\r\n",
+	} {
+		if m := parseFrame( v ); m != nil {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	if answered( connected[:10] ) || !answered( connected ) || !answered( "SSH-2.0-OpenSSH\r\n" ) {
+		t.Errorf( "answered" )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	http.RegisterHandshake()
+	memcached_binary.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		connected: "stomp",
+		accessRefused: "stomp",
+		"ERROR\r\n": "memcached_binary",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package stomp
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return connectFrame( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseFrame( data ) != nil {
+		return "stomp"
+	}
+	return ""
+}
+
+// read up to the frame's NUL (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// negotiated version and the broker's server header (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseFrame( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "stomp", &h )
+	lzr.AddFingerprintRule( "stomp", lzr.OVERRIDES, "http" )
+	lzr.AddFingerprintRule( "stomp", lzr.OVERRIDES, "memcached_binary" )
+}
@@ -4,7 +4,6 @@ import (
 	"strings"
 	"bytes"
 	"github.com/stanford-esrg/lzr"
-	"math/rand"
 )
 
 // Handshake implements the lzr.Handshake interface
@@ -12,14 +11,20 @@ type HandshakeMod struct {
 }
 
 func (h *HandshakeMod) GetData( dst string ) []byte {
+	return clientHello( lzr.GetTLSProfile( dst ) )
+}
+
+// keep reading through the certificate (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return complete( []byte(data) )
+}
 
-	data := []byte("\x16\x03\x01\x00\x75\x01\x00\x00\x71\x03\x03")
-	token := make([]byte, 32)
-	rand.Read(token)
-	data2 := []byte("\x00\x00\x1a\xc0\x2f\xc0\x2b\xc0\x11\xc0\x07\xc0\x13\xc0\x09\xc0\x14\xc0\x0a\x00\x05\x00\x2f\x00\x35\xc0\x12\x00\x0a\x01\x00\x00\x2e\x00\x05\x00\x05\x01\x00\x00\x00\x00\x00\x0a\x00\x08\x00\x06\x00\x17\x00\x18\x00\x19\x00\x0b\x00\x02\x01\x00\x00\x0d\x00\x0a\x00\x08\x04\x01\x04\x03\x02\x01\x02\x03\xff\x01\x00\x01\x00")
-	data = append(data, token...)
-	data = append(data, data2...)
-	return data
+// negotiated parameters, JA3S and leaf certificate (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := analyze( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
@@ -66,5 +71,9 @@ func (h *HandshakeMod) Verify( data string ) string {
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "tls", &h )
+	//tls/http, tls/imap and so on
+	lzr.AddHandshakeWrapper( "tls", wrap )
+	//probs tls with HTTPS text
+	lzr.AddFingerprintRule( "tls", lzr.REFINES, "http" )
 }
 
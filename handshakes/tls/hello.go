@@ -0,0 +1,140 @@
+package tls
+
+import (
+	"crypto/rand"
+
+	"github.com/stanford-esrg/lzr"
+)
+
+const (
+	recordHandshake		byte = 0x16
+	recordChangeCipher	byte = 0x14
+	recordAlert			byte = 0x15
+	recordApplication	byte = 0x17
+
+	typeClientHello		byte = 1
+	typeServerHello		byte = 2
+	typeCertificate		byte = 11
+	typeServerHelloDone	byte = 14
+
+	extServerName		uint16 = 0
+	extStatusRequest	uint16 = 5
+	extSupportedGroups	uint16 = 10
+	extPointFormats		uint16 = 11
+	extSignatureAlgs	uint16 = 13
+	extALPN				uint16 = 16
+	extSupportedVersions	uint16 = 43
+	extPSKModes			uint16 = 45
+	extKeyShare			uint16 = 51
+	extRenegotiation	uint16 = 0xff01
+
+	versionTLS12		uint16 = 0x0303
+	versionTLS13		uint16 = 0x0304
+	groupX25519			uint16 = 0x001d
+)
+
+// what LZR has always offered, ECDHE first
+var cipherSuites12 = []uint16{
+	0xc02f, 0xc02b, 0xc011, 0xc007, 0xc013, 0xc009, 0xc014, 0xc00a,
+	0x0005, 0x002f, 0x0035, 0xc012, 0x000a,
+}
+
+var cipherSuites13 = []uint16{ 0x1301, 0x1302, 0x1303 }
+
+var groups12 = []uint16{ 0x0017, 0x0018, 0x0019 }
+
+var signatureAlgs12 = []uint16{ 0x0401, 0x0403, 0x0201, 0x0203 }
+
+// rsa_pss_rsae and ecdsa with sha256..512 for 1.3 servers
+var signatureAlgs13 = []uint16{ 0x0804, 0x0805, 0x0806, 0x0503, 0x0603 }
+
+func put16( b []byte, v uint16 ) []byte {
+	return append( b, byte(v >> 8), byte(v) )
+}
+
+// v with a 1, 2 or 3 byte length in front
+func withLength( n int, v []byte ) []byte {
+
+	out := make( []byte, n, n + len(v) )
+	l := len(v)
+	for i := n - 1; i >= 0; i-- {
+		out[i] = byte(l)
+		l >>= 8
+	}
+	return append( out, v... )
+}
+
+func list16( vs []uint16 ) []byte {
+
+	var b []byte
+	for _, v := range vs {
+		b = put16( b, v )
+	}
+	return b
+}
+
+func extension( typ uint16, body []byte ) []byte {
+	return append( put16( nil, typ ), withLength( 2, body )... )
+}
+
+func randomBytes( n int ) []byte {
+	b := make( []byte, n )
+	rand.Read( b )
+	return b
+}
+
+/* a ClientHello for the profile. without SNI, ALPN or 1.3 it is the
+ * same ClientHello LZR has always sent, down to the extension order.
+ */
+func clientHello( profile lzr.TLSProfile ) []byte {
+
+	ciphers := cipherSuites12
+	groups := groups12
+	sigAlgs := signatureAlgs12
+	sessionID := []byte{}
+	if profile.TLS13 {
+		ciphers = append( append( []uint16{}, cipherSuites13... ), cipherSuites12... )
+		groups = append( []uint16{ groupX25519 }, groups12... )
+		sigAlgs = append( append( []uint16{}, signatureAlgs13... ), signatureAlgs12... )
+		//middlebox compatibility mode
+		sessionID = randomBytes( 32 )
+	}
+
+	var exts []byte
+	if profile.ServerName != "" {
+		name := append( []byte{ 0 }, withLength( 2, []byte(profile.ServerName) )... )
+		exts = append( exts, extension( extServerName, withLength( 2, name ) )... )
+	}
+	exts = append( exts, extension( extStatusRequest, []byte{ 1, 0, 0, 0, 0 } )... )
+	exts = append( exts, extension( extSupportedGroups, withLength( 2, list16( groups ) ) )... )
+	exts = append( exts, extension( extPointFormats, []byte{ 1, 0 } )... )
+	exts = append( exts, extension( extSignatureAlgs, withLength( 2, list16( sigAlgs ) ) )... )
+	if len(profile.ALPN) > 0 {
+		var protos []byte
+		for _, p := range profile.ALPN {
+			protos = append( protos, withLength( 1, []byte(p) )... )
+		}
+		exts = append( exts, extension( extALPN, withLength( 2, protos ) )... )
+	}
+	if profile.TLS13 {
+		exts = append( exts, extension( extSupportedVersions,
+			withLength( 1, list16( []uint16{ versionTLS13, versionTLS12 } ) ) )... )
+		exts = append( exts, extension( extPSKModes, []byte{ 1, 1 } )... )
+		//any 32 bytes are an x25519 public key, the handshake never gets further
+		share := append( put16( nil, groupX25519 ), withLength( 2, randomBytes( 32 ) )... )
+		exts = append( exts, extension( extKeyShare, withLength( 2, share ) )... )
+	}
+	exts = append( exts, extension( extRenegotiation, []byte{ 0 } )... )
+
+	body := put16( nil, versionTLS12 )
+	body = append( body, randomBytes( 32 )... )
+	body = append( body, withLength( 1, sessionID )... )
+	body = append( body, withLength( 2, list16( ciphers ) )... )
+	body = append( body, 1, 0 )
+	body = append( body, withLength( 2, exts )... )
+
+	hello := append( []byte{ typeClientHello }, withLength( 3, body )... )
+	record := []byte{ recordHandshake, 0x03, 0x01 }
+	record = append( record, withLength( 2, hello )... )
+	return record
+}
@@ -0,0 +1,312 @@
+package tls
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* tls_metadata is what LZR reports of a TLS server: the negotiated
+ * parameters from its ServerHello, the JA3S of that ServerHello and,
+ * up to TLS 1.2, the leaf certificate it sent in the clear.
+ */
+type tls_metadata struct {
+	Version			string			`json:"version,omitempty"`
+	Cipher			string			`json:"cipher,omitempty"`
+	CipherID		uint16			`json:"cipher_id,omitempty"`
+	Extensions		[]uint16		`json:"extensions,omitempty"`
+	ALPN			string			`json:"alpn,omitempty"`
+	JA3S			string			`json:"ja3s,omitempty"`
+	JA3SString		string			`json:"ja3s_string,omitempty"`
+	Alert			string			`json:"alert,omitempty"`
+	ChainLength		int				`json:"chain_length,omitempty"`
+	Certificate		*certificate_metadata	`json:"certificate,omitempty"`
+}
+
+type certificate_metadata struct {
+	Subject			string			`json:"subject"`
+	Issuer			string			`json:"issuer"`
+	SANs			[]string		`json:"sans,omitempty"`
+	NotBefore		time.Time		`json:"not_before"`
+	NotAfter		time.Time		`json:"not_after"`
+	SHA256			string			`json:"sha256"`
+	ParseError		string			`json:"parse_error,omitempty"`
+}
+
+type server_hello struct {
+	version			uint16		//legacy_version, what JA3S uses
+	negotiated		uint16		//supported_versions when present
+	cipher			uint16
+	extensions		[]uint16
+	alpn			string
+}
+
+/* transcript is a response split into TLS records. handshake holds
+ * the plaintext handshake records back to back, messages may span
+ * records.
+ */
+type transcript struct {
+	notTLS			bool
+	handshake		[]byte
+	alert			[]byte
+	encrypted		bool		//change cipher spec or application data seen
+}
+
+func readRecords( data []byte ) transcript {
+
+	var t transcript
+	//decide early, a short banner must not wait for five bytes
+	if len(data) > 0 && ( data[0] < recordChangeCipher || data[0] > recordApplication ||
+		( len(data) > 1 && data[1] != 0x03 ) ) {
+		t.notTLS = true
+		return t
+	}
+	for len(data) >= 5 {
+		typ := data[0]
+		if typ < recordChangeCipher || typ > recordApplication || data[1] != 0x03 {
+			return t
+		}
+		l := int(data[3]) << 8 | int(data[4])
+		if len(data) < 5 + l {
+			break
+		}
+		body := data[5:5+l]
+		switch typ {
+		case recordHandshake:
+			t.handshake = append( t.handshake, body... )
+		case recordAlert:
+			if t.alert == nil && len(body) >= 2 {
+				t.alert = body[:2]
+			}
+		default:
+			t.encrypted = true
+		}
+		data = data[5+l:]
+	}
+	return t
+}
+
+// whole handshake messages by type, the first of each
+func ( t transcript ) messages() map[byte][]byte {
+
+	msgs := make( map[byte][]byte )
+	hs := t.handshake
+	for len(hs) >= 4 {
+		l := int(hs[1]) << 16 | int(hs[2]) << 8 | int(hs[3])
+		if len(hs) < 4 + l {
+			break
+		}
+		if _, ok := msgs[ hs[0] ]; !ok {
+			msgs[ hs[0] ] = hs[4:4+l]
+		}
+		hs = hs[4+l:]
+	}
+	return msgs
+}
+
+func parseServerHello( body []byte ) ( *server_hello, bool ) {
+
+	if len(body) < 35 {
+		return nil, false
+	}
+	sh := &server_hello{ version: uint16(body[0]) << 8 | uint16(body[1]) }
+	sh.negotiated = sh.version
+	rest := body[34:]
+	sidL := int(rest[0])
+	if len(rest) < 1 + sidL + 3 {
+		return nil, false
+	}
+	rest = rest[1+sidL:]
+	sh.cipher = uint16(rest[0]) << 8 | uint16(rest[1])
+	rest = rest[3:]
+	if len(rest) < 2 {
+		return sh, true
+	}
+	extL := int(rest[0]) << 8 | int(rest[1])
+	rest = rest[2:]
+	if len(rest) < extL {
+		return nil, false
+	}
+	exts := rest[:extL]
+	for len(exts) >= 4 {
+		typ := uint16(exts[0]) << 8 | uint16(exts[1])
+		l := int(exts[2]) << 8 | int(exts[3])
+		if len(exts) < 4 + l {
+			return nil, false
+		}
+		ext := exts[4:4+l]
+		sh.extensions = append( sh.extensions, typ )
+		switch typ {
+		case extSupportedVersions:
+			if len(ext) == 2 {
+				sh.negotiated = uint16(ext[0]) << 8 | uint16(ext[1])
+			}
+		case extALPN:
+			if len(ext) >= 3 && len(ext) >= 3 + int(ext[2]) {
+				sh.alpn = string( ext[3:3+int(ext[2])] )
+			}
+		}
+		exts = exts[4+l:]
+	}
+	return sh, true
+}
+
+// the DER certificates of a TLS 1.2 (or older) Certificate message
+func parseCertificates( body []byte ) [][]byte {
+
+	if len(body) < 3 {
+		return nil
+	}
+	l := int(body[0]) << 16 | int(body[1]) << 8 | int(body[2])
+	body = body[3:]
+	if len(body) < l {
+		return nil
+	}
+	body = body[:l]
+	var certs [][]byte
+	for len(body) >= 3 {
+		cl := int(body[0]) << 16 | int(body[1]) << 8 | int(body[2])
+		if len(body) < 3 + cl {
+			break
+		}
+		certs = append( certs, body[3:3+cl] )
+		body = body[3+cl:]
+	}
+	return certs
+}
+
+func versionName( v uint16 ) string {
+
+	switch v {
+	case 0x0300:
+		return "SSL 3.0"
+	case 0x0301:
+		return "TLS 1.0"
+	case 0x0302:
+		return "TLS 1.1"
+	case 0x0303:
+		return "TLS 1.2"
+	case 0x0304:
+		return "TLS 1.3"
+	}
+	return fmt.Sprintf( "0x%04x", v )
+}
+
+var alertNames = map[byte]string{
+	0: "close_notify",
+	10: "unexpected_message",
+	40: "handshake_failure",
+	47: "illegal_parameter",
+	50: "decode_error",
+	70: "protocol_version",
+	71: "insufficient_security",
+	80: "internal_error",
+	86: "inappropriate_fallback",
+	112: "unrecognized_name",
+	120: "no_application_protocol",
+}
+
+func alertName( code byte ) string {
+	if name, ok := alertNames[code]; ok {
+		return name
+	}
+	return "alert_" + strconv.Itoa( int(code) )
+}
+
+// JA3S: md5 of "version,cipher,ext-ext-..." in decimal
+func ja3s( sh *server_hello ) ( string, string ) {
+
+	exts := make( []string, len(sh.extensions) )
+	for i, e := range sh.extensions {
+		exts[i] = strconv.Itoa( int(e) )
+	}
+	s := fmt.Sprintf( "%d,%d,%s", sh.version, sh.cipher, strings.Join( exts, "-" ) )
+	sum := md5.Sum( []byte(s) )
+	return hex.EncodeToString( sum[:] ), s
+}
+
+func certificateMetadata( der []byte ) *certificate_metadata {
+
+	sum := sha256.Sum256( der )
+	m := &certificate_metadata{ SHA256: hex.EncodeToString( sum[:] ) }
+	cert, err := x509.ParseCertificate( der )
+	if err != nil {
+		m.ParseError = err.Error()
+		return m
+	}
+	m.Subject = cert.Subject.String()
+	m.Issuer = cert.Issuer.String()
+	m.NotBefore = cert.NotBefore
+	m.NotAfter = cert.NotAfter
+	m.SANs = append( m.SANs, cert.DNSNames... )
+	for _, ip := range cert.IPAddresses {
+		m.SANs = append( m.SANs, ip.String() )
+	}
+	m.SANs = append( m.SANs, cert.EmailAddresses... )
+	for _, uri := range cert.URIs {
+		m.SANs = append( m.SANs, uri.String() )
+	}
+	return m
+}
+
+// nil when the response holds neither a ServerHello nor an alert
+func analyze( data []byte ) *tls_metadata {
+
+	t := readRecords( data )
+	if t.notTLS {
+		return nil
+	}
+	m := &tls_metadata{}
+	if t.alert != nil {
+		m.Alert = alertName( t.alert[1] )
+	}
+	msgs := t.messages()
+	if body, ok := msgs[ typeServerHello ]; ok {
+		if sh, ok := parseServerHello( body ); ok {
+			m.Version = versionName( sh.negotiated )
+			m.CipherID = sh.cipher
+			m.Cipher = gotls.CipherSuiteName( sh.cipher )
+			m.Extensions = sh.extensions
+			m.ALPN = sh.alpn
+			m.JA3S, m.JA3SString = ja3s( sh )
+		}
+	}
+	if body, ok := msgs[ typeCertificate ]; ok {
+		if certs := parseCertificates( body ); len(certs) > 0 {
+			m.ChainLength = len(certs)
+			m.Certificate = certificateMetadata( certs[0] )
+		}
+	}
+	if m.Version == "" && m.Alert == "" {
+		return nil
+	}
+	return m
+}
+
+/* whether the server has said all it will in the clear: the hello
+ * through ServerHelloDone up to 1.2, just the ServerHello for 1.3
+ * (the rest is encrypted), or an alert.
+ */
+func complete( data []byte ) bool {
+
+	t := readRecords( data )
+	if t.notTLS || t.alert != nil || t.encrypted {
+		return true
+	}
+	msgs := t.messages()
+	if _, ok := msgs[ typeServerHelloDone ]; ok {
+		return true
+	}
+	if body, ok := msgs[ typeServerHello ]; ok {
+		if sh, ok := parseServerHello( body ); ok && sh.negotiated == versionTLS13 {
+			return true
+		}
+	}
+	return false
+}
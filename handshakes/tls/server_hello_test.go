@@ -0,0 +1,155 @@
+package tls
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func unhex( s string ) []byte {
+	b, err := hex.DecodeString( s )
+	if err != nil {
+		panic( err )
+	}
+	return b
+}
+
+func withRecord( typ byte, body []byte ) []byte {
+	return append( []byte{ typ, 0x03, 0x03, byte( len(body) >> 8 ), byte( len(body) ) }, body... )
+}
+
+func withMessage( typ byte, body []byte ) []byte {
+	return append( []byte{ typ, byte( len(body) >> 16 ), byte( len(body) >> 8 ), byte( len(body) ) }, body... )
+}
+
+var (
+	//ECDHE-RSA-AES128-GCM-SHA256 with renegotiation_info, ec_point_formats and ALPN h2
+	serverHello12 = unhex( "0200003c03031111111111111111111111111111111111111111111111111111111111111111" +
+		"00c02f000014ff01000100000b00020100001000050003026832" )
+	//self-signed ed25519, CN and DNS SAN lzr.example, IP SAN 192.0.2.1
+	leafDER = unhex( "3082014b3081fea003020102020101300506032b657030163114301206035504030c0b6c7a722e6578616d706c65301e170d3236313031383139323330385a170d3336313031353139323330385a30163114301206035504030c0b6c7a722e6578616d706c65302a300506032b6570032100dd92a592fb5986d2bb35a369c464962cc3728bcb00ca3a520b641dfb1b9ae4f5a371306f301d0603551d0e041604148ef8434a7f05259d3913c9d36b41a6994ed472b5301f0603551d230418301680148ef8434a7f05259d3913c9d36b41a6994ed472b5300f0603551d130101ff040530030101ff301c0603551d1104153013820b6c7a722e6578616d706c658704c0000201300506032b657003410095934bc9d900cc88f66cfa987b4acbfb9657441b5594ec6b6407a7302ff0c96da425fcaf673c5301a04b254e0bd36bb0a95632e7a200aeeefb84477fc31e1209" )
+	leafSHA256 = "e6a33dfa972a6f5785497900ecf2289179507d4ca1a5252b8e8a04287676262c"
+	//TLS_AES_128_GCM_SHA256 with supported_versions and key_share, then CCS and encrypted data
+	tls13 = unhex( "160303007a0200007603031111111111111111111111111111111111111111111111111111111111111111" +
+		"202222222222222222222222222222222222222222222222222222222222222222130100002e002b00020304" +
+		"00330024001d00203333333333333333333333333333333333333333333333333333333333333333" +
+		"14030300010117030300054444444444" )
+	//TLS 1.0, AES128-SHA, no extensions at all
+	tls10 = unhex( "160301002a0200002603011111111111111111111111111111111111111111111111111111111111111111" +
+		"00002f00" )
+	handshakeFailure = unhex( "15030300020228" )
+)
+
+// ServerHello, Certificate and ServerHelloDone in one record
+func tls12() []byte {
+	cert := withMessage( typeCertificate, withLength( 3, withLength( 3, leafDER ) ) )
+	done := withMessage( typeServerHelloDone, nil )
+	return withRecord( recordHandshake, append( append( append( []byte{}, serverHello12... ), cert... ), done... ) )
+}
+
+func TestAnalyzeTLS12( t *testing.T ) {
+
+	m := analyze( tls12() )
+	if m == nil {
+		t.Fatal( "no metadata" )
+	}
+	if m.Version != "TLS 1.2" || m.CipherID != 0xc02f || m.Cipher != "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256" ||
+		m.ALPN != "h2" || m.Alert != "" {
+		t.Errorf( "hello: %+v", m )
+	}
+	if m.JA3SString != "771,49199,65281-11-16" || m.JA3S != "1089ea6f0461a29006cc96dfe7a11d80" {
+		t.Errorf( "ja3s: %s %s", m.JA3SString, m.JA3S )
+	}
+	c := m.Certificate
+	if m.ChainLength != 1 || c == nil || c.Subject != "CN=lzr.example" || c.Issuer != "CN=lzr.example" ||
+		c.SHA256 != leafSHA256 || len(c.SANs) != 2 || c.SANs[0] != "lzr.example" || c.SANs[1] != "192.0.2.1" ||
+		c.ParseError != "" {
+		t.Errorf( "certificate: %+v", c )
+	}
+	if !complete( tls12() ) {
+		t.Error( "not complete through ServerHelloDone" )
+	}
+	//the same messages without ServerHelloDone wait for more
+	if complete( withRecord( recordHandshake, serverHello12 ) ) {
+		t.Error( "complete before ServerHelloDone" )
+	}
+}
+
+func TestAnalyzeTLS13( t *testing.T ) {
+
+	m := analyze( tls13 )
+	if m == nil || m.Version != "TLS 1.3" || m.Cipher != "TLS_AES_128_GCM_SHA256" || m.Certificate != nil {
+		t.Fatalf( "hello: %+v", m )
+	}
+	//JA3S takes the legacy version
+	if m.JA3SString != "771,4865,43-51" || m.JA3S != "f4febc55ea12b31ae17cfb7e614afda8" {
+		t.Errorf( "ja3s: %s %s", m.JA3SString, m.JA3S )
+	}
+	//the certificate is encrypted, the ServerHello alone is all there is
+	if !complete( tls13[:5+0x7a] ) {
+		t.Error( "not complete after a 1.3 ServerHello" )
+	}
+}
+
+func TestAnalyzeAlert( t *testing.T ) {
+
+	m := analyze( handshakeFailure )
+	if m == nil || m.Alert != "handshake_failure" || m.Version != "" || m.JA3S != "" {
+		t.Errorf( "alert: %+v", m )
+	}
+	if !complete( handshakeFailure ) {
+		t.Error( "not complete after an alert" )
+	}
+}
+
+func TestAnalyzeTruncated( t *testing.T ) {
+
+	full := tls12()
+	for _, n := range []int{ 1, 5, 20, len(full) / 2, len(full) - 1 } {
+		if m := analyze( full[:n] ); m != nil {
+			t.Errorf( "%d of %d bytes: %+v", n, len(full), m )
+		}
+		if complete( full[:n] ) {
+			t.Errorf( "%d of %d bytes: complete", n, len(full) )
+		}
+	}
+	//not TLS at all is complete, and has nothing to analyze
+	if m := analyze( []byte( "SSH-2.0-OpenSSH_9.6\r\n" ) ); m != nil || !complete( []byte( "SSH" ) ) {
+		t.Errorf( "ssh: %+v", m )
+	}
+}
+
+func TestParseServerHello( t *testing.T ) {
+
+	sh, ok := parseServerHello( tls10[9:] )
+	if !ok || sh.version != 0x0301 || sh.negotiated != 0x0301 || sh.cipher != 0x002f || len(sh.extensions) != 0 {
+		t.Fatalf( "tls 1.0: %+v", sh )
+	}
+	if h, s := ja3s( sh ); s != "769,47," || h != "18e962e106761869a61045bed0e81c2c" {
+		t.Errorf( "ja3s: %s %s", s, h )
+	}
+	body := serverHello12[4:]
+	for i := 0; i < len(body); i++ {
+		//a hello may end after the compression method (38 bytes) but not inside its extensions
+		if _, ok := parseServerHello( body[:i] ); ok && ( i < 38 || i > 39 ) {
+			t.Errorf( "parsed %d of %d bytes", i, len(body) )
+		}
+	}
+}
+
+func TestParseCertificates( t *testing.T ) {
+
+	two := withLength( 3, append( withLength( 3, leafDER ), withLength( 3, []byte{ 0x30, 0x00 } )... ) )
+	certs := parseCertificates( two )
+	if len(certs) != 2 || len(certs[0]) != len(leafDER) || len(certs[1]) != 2 {
+		t.Fatalf( "%d certificates", len(certs) )
+	}
+	if m := certificateMetadata( certs[1] ); m.ParseError == "" || m.SHA256 == "" {
+		t.Errorf( "bad certificate: %+v", m )
+	}
+	if certs := parseCertificates( two[:len(two)-1] ); certs != nil {
+		t.Errorf( "truncated list: %d certificates", len(certs) )
+	}
+	if certs := parseCertificates( nil ); certs != nil {
+		t.Errorf( "empty: %d certificates", len(certs) )
+	}
+}
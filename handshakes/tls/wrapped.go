@@ -0,0 +1,215 @@
+package tls
+
+import (
+	gotls "crypto/tls"
+	"net"
+
+	"github.com/stanford-esrg/lzr"
+)
+
+/* "tls/<inner>" handshakes: a real TLS handshake over the flow, then
+ * the inner handshake inside it. the fingerprint is "tls/" and what
+ * the inner response is, or the negotiated ALPN protocol when the
+ * response says nothing, e.g. tls/http, tls/imap, tls/mqtt.
+ */
+
+// what to offer over ALPN for an inner handshake (without -tlsALPN)
+var innerALPN = map[string][]string{
+	"http": { "http/1.1" },
+	"ftp": { "ftp" },
+	"imap": { "imap" },
+	"pop3": { "pop3" },
+	"mqtt": { "mqtt" },
+	"postgres": { "postgresql" },
+}
+
+// fingerprints of negotiated ALPN protocols
+var alpnFingerprints = map[string]string{
+	"http/1.0": "http",
+	"http/1.1": "http",
+	"h2": "http",
+	"ftp": "ftp",
+	"imap": "imap",
+	"pop3": "pop3",
+	"mqtt": "mqtt",
+	"postgresql": "postgres",
+	"xmpp-client": "xmpp",
+	"xmpp-server": "xmpp",
+	"managesieve": "managesieve",
+	"dot": "dns",
+	"coap": "coap",
+}
+
+type wrapped_handshake struct {
+	name			string
+	inner			lzr.Handshake
+}
+
+type wrapped_metadata struct {
+	TLS				*tls_metadata	`json:"tls,omitempty"`
+	HandshakeError	string			`json:"handshake_error,omitempty"`
+	Truncated		bool			`json:"truncated,omitempty"`		//tls is from the first MAX_RESPONSE_BYTES
+	Inner			interface{}		`json:"inner,omitempty"`
+}
+
+/* keeps what the target sends during the handshake, to read its
+ * ServerHello after the fact. only whole records are analyzed, and
+ * received stops at MAX_RESPONSE_BYTES.
+ */
+type recording_conn struct {
+	net.Conn
+	received		[]byte
+	records			int			//received[:records] is whole TLS records
+	truncated		bool
+	stopped			bool
+}
+
+func ( c *recording_conn ) Read( b []byte ) ( int, error ) {
+
+	n, err := c.Conn.Read( b )
+	if c.stopped {
+		return n, err
+	}
+	keep := n
+	if room := lzr.MAX_RESPONSE_BYTES - len(c.received); keep > room {
+		keep = room
+		c.truncated = true
+	}
+	c.received = append( c.received, b[:keep]... )
+	for len(c.received) - c.records >= 5 {
+		l := int(c.received[c.records+3]) << 8 | int(c.received[c.records+4])
+		if len(c.received) - c.records < 5 + l {
+			break
+		}
+		c.records += 5 + l
+	}
+	return n, err
+}
+
+// the whole records received so far, recording nothing after
+func ( c *recording_conn ) stop() []byte {
+	c.stopped = true
+	return c.received[:c.records]
+}
+
+func wrap( name string, inner lzr.Handshake ) lzr.Handshake {
+	return &wrapped_handshake{ name: name, inner: inner }
+}
+
+// sent when there is no session to run, e.g. to HyperACKtive probes
+func ( w *wrapped_handshake ) GetData( dst string ) []byte {
+	return clientHello( lzr.GetTLSProfile( dst ) )
+}
+
+// a session fingerprints its own response
+func ( w *wrapped_handshake ) Verify( data string ) string {
+	return ""
+}
+
+func ( w *wrapped_handshake ) config( dst string ) *gotls.Config {
+
+	profile := lzr.GetTLSProfile( dst )
+	config := &gotls.Config{
+		InsecureSkipVerify: true,
+		ServerName: profile.ServerName,
+		NextProtos: profile.ALPN,
+		MinVersion: gotls.VersionTLS10,
+		MaxVersion: gotls.VersionTLS12,
+	}
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = innerALPN[ w.name ]
+	}
+	if profile.TLS13 {
+		config.MaxVersion = gotls.VersionTLS13
+	}
+	return config
+}
+
+// what the inner handshake gets back over conn
+func ( w *wrapped_handshake ) probe( conn net.Conn, dst string ) string {
+
+	if payload := w.inner.GetData( dst ); len(payload) > 0 {
+		if _, err := conn.Write( payload ); err != nil {
+			return ""
+		}
+	}
+	sh, streaming := w.inner.( lzr.StreamingHandshake )
+	var response []byte
+	buf := make( []byte, 4096 )
+	for len(response) < lzr.MAX_RESPONSE_BYTES {
+		n, err := conn.Read( buf )
+		response = append( response, buf[:n]... )
+		if err != nil || ( len(response) > 0 && ( !streaming || sh.Complete( string(response) ) ) ) {
+			break
+		}
+	}
+	return string(response)
+}
+
+// the negotiated parameters, with the JA3S of the ServerHello
+func connectionMetadata( hello []byte, state gotls.ConnectionState ) *tls_metadata {
+
+	m := analyze( hello )
+	if m == nil {
+		m = &tls_metadata{}
+	}
+	m.Version = versionName( state.Version )
+	m.CipherID = state.CipherSuite
+	m.Cipher = gotls.CipherSuiteName( state.CipherSuite )
+	m.ALPN = state.NegotiatedProtocol
+	if len(state.PeerCertificates) > 0 {
+		m.ChainLength = len(state.PeerCertificates)
+		m.Certificate = certificateMetadata( state.PeerCertificates[0].Raw )
+	}
+	return m
+}
+
+func fingerprint( response string, alpn string ) string {
+
+	if response != "" {
+		if f := lzr.MatchFingerprint( response ); f != "unknown" {
+			return "tls/" + f
+		}
+	}
+	if f, ok := alpnFingerprints[ alpn ]; ok {
+		return "tls/" + f
+	}
+	if response != "" {
+		return "tls/unknown"
+	}
+	return "tls"
+}
+
+// implements lzr.SessionHandshake
+func ( w *wrapped_handshake ) Run( conn net.Conn, dst string ) lzr.SessionResult {
+
+	rec := &recording_conn{ Conn: conn }
+	tlsConn := gotls.Client( rec, w.config( dst ) )
+	m := &wrapped_metadata{}
+	if err := tlsConn.Handshake(); err != nil {
+		//whatever answered the ClientHello is fingerprinted as usual
+		m.HandshakeError = err.Error()
+		m.TLS = analyze( rec.stop() )
+		m.Truncated = rec.truncated
+		return lzr.SessionResult{ Data: string(rec.received), Metadata: m }
+	}
+	hello := rec.stop()
+	m.Truncated = rec.truncated
+	state := tlsConn.ConnectionState()
+	m.TLS = connectionMetadata( hello, state )
+
+	response := w.probe( tlsConn, dst )
+	if mh, ok := w.inner.( lzr.MetadataHandshake ); ok && response != "" {
+		m.Inner = mh.Metadata( response )
+	}
+	result := lzr.SessionResult{
+		Data: response,
+		Fingerprint: fingerprint( response, state.NegotiatedProtocol ),
+		Metadata: m,
+	}
+	//the handshake alone is an answer
+	if result.Data == "" {
+		result.Data = string(hello)
+	}
+	return result
+}
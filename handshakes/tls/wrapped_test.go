@@ -0,0 +1,75 @@
+package tls
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+)
+
+// reads r a few bytes at a time
+type trickle_conn struct {
+	net.Conn
+	r				io.Reader
+	chunk			int
+}
+
+func ( c *trickle_conn ) Read( b []byte ) ( int, error ) {
+	if len(b) > c.chunk {
+		b = b[:c.chunk]
+	}
+	return c.r.Read( b )
+}
+
+func record( typ byte, body []byte ) []byte {
+	return append( []byte{ typ, 0x03, 0x03, byte( len(body) >> 8 ), byte( len(body) ) }, body... )
+}
+
+func TestRecordingConnWholeRecords( t *testing.T ) {
+
+	first := record( recordHandshake, bytes.Repeat( []byte{ 1 }, 40 ) )
+	second := record( recordHandshake, bytes.Repeat( []byte{ 2 }, 300 ) )
+	data := append( append( []byte{}, first... ), second[:100]... )
+	rec := &recording_conn{ Conn: &trickle_conn{ r: bytes.NewReader( data ), chunk: 7 } }
+	buf := make( []byte, 4096 )
+	for {
+		if _, err := rec.Read( buf ); err != nil {
+			break
+		}
+	}
+	if !bytes.Equal( rec.stop(), first ) || rec.truncated {
+		t.Fatalf( "kept %d of %d bytes as whole records", rec.records, len(rec.received) )
+	}
+	//nothing is recorded once stopped
+	rec.Conn = &trickle_conn{ r: bytes.NewReader( second ), chunk: 7 }
+	rec.Read( buf )
+	if len(rec.received) != len(data) {
+		t.Errorf( "recorded %d bytes after stop", len(rec.received) - len(data) )
+	}
+}
+
+func TestRecordingConnCap( t *testing.T ) {
+
+	big := bytes.Repeat( record( recordHandshake, make( []byte, 16384 ) ), lzr.MAX_RESPONSE_BYTES / 16384 + 1 )
+	rec := &recording_conn{ Conn: &trickle_conn{ r: bytes.NewReader( big ), chunk: 5000 } }
+	buf := make( []byte, 5000 )
+	total := 0
+	for {
+		n, err := rec.Read( buf )
+		total += n
+		if err != nil {
+			break
+		}
+	}
+	if total != len(big) {
+		t.Errorf( "read %d of %d bytes", total, len(big) )
+	}
+	if len(rec.received) != lzr.MAX_RESPONSE_BYTES || !rec.truncated {
+		t.Errorf( "kept %d bytes, truncated %v", len(rec.received), rec.truncated )
+	}
+	if rec.records % ( 5 + 16384 ) != 0 || rec.records > lzr.MAX_RESPONSE_BYTES {
+		t.Errorf( "whole records end at %d", rec.records )
+	}
+}
@@ -0,0 +1,233 @@
+package tor
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"time"
+)
+
+/* the link protocol handshake of a Tor ORPort (tor-spec 4), inside TLS
+ * (as tls/tor). the client's VERSIONS cell has a 2 byte circuit id,
+ * command 7 and a 2 byte length, offering versions 3 to 5:
+ *
+ *   00 00 07 00 06 00 03 00 04 00 05
+ *
+ * a relay answers with its own VERSIONS, then, with 4 byte circuit ids
+ * from version 4 on, its CERTS, AUTH_CHALLENGE and NETINFO cells, e.g.
+ *
+ *   00 00 07 00 06 00 03 00 04 00 05
+ *   00 00 00 00 81 <length> 05 01 <length> <link certificate> 02 ...
+ *   00 00 00 00 82 00 26 <32 byte challenge> 00 02 00 01 00 03
+ *   00 00 00 00 08 <timestamp> 04 04 <our address> 01 04 04 <its address> ...
+ *
+ * NETINFO is a fixed size cell, 509 bytes of payload.
+ */
+const (
+	VERSIONS			byte = 7
+	NETINFO				byte = 8
+	CERTS				byte = 129
+	AUTH_CHALLENGE		byte = 130
+
+	PAYLOAD_LEN			int = 509
+	CERT_RSA_IDENTITY	byte = 2
+	ADDR_IPV4			byte = 4
+	ADDR_IPV6			byte = 6
+)
+
+// link protocol versions we speak
+var OFFERED = []uint16{ 3, 4, 5 }
+
+type cell struct {
+	command			byte
+	payload			[]byte
+}
+
+type tor_metadata struct {
+	Versions		[]int		`json:"versions"`
+	LinkProtocol	int			`json:"link_protocol,omitempty"`
+	CertTypes		[]int		`json:"cert_types,omitempty"`
+	Fingerprint		string		`json:"fingerprint,omitempty"`
+	AuthMethods		[]int		`json:"auth_methods,omitempty"`
+	ServerTime		string		`json:"server_time,omitempty"`
+	OtherAddress	string		`json:"other_address,omitempty"`
+	Addresses		[]string	`json:"addresses,omitempty"`
+	netinfo			bool
+}
+
+func versions() []byte {
+
+	c := []byte{ 0, 0, VERSIONS, 0, byte( 2 * len(OFFERED) ) }
+	for _, v := range OFFERED {
+		c = append( c, byte( v >> 8 ), byte(v) )
+	}
+	return c
+}
+
+// commands 7 and from 128 on carry their length
+func variable( command byte ) bool {
+	return command == VERSIONS || command >= 128
+}
+
+// the whole cells at the start of data, with circuit ids of idLen bytes
+func readCells( data []byte, idLen int ) []cell {
+
+	var cells []cell
+	for len(data) > idLen {
+		command := data[idLen]
+		p := data[idLen+1:]
+		l := PAYLOAD_LEN
+		if variable( command ) {
+			if len(p) < 2 {
+				break
+			}
+			l, p = int( binary.BigEndian.Uint16( p ) ), p[2:]
+		}
+		if len(p) < l {
+			break
+		}
+		cells = append( cells, cell{ command: command, payload: p[:l] } )
+		data = p[l:]
+	}
+	return cells
+}
+
+// the relay's identity fingerprint, from its RSA identity certificate
+func fingerprint( der []byte ) string {
+
+	cert, err := x509.ParseCertificate( der )
+	if err != nil {
+		return ""
+	}
+	key, ok := cert.PublicKey.( *rsa.PublicKey )
+	if !ok {
+		return ""
+	}
+	sum := sha1.Sum( x509.MarshalPKCS1PublicKey( key ) )
+	return strings.ToUpper( hex.EncodeToString( sum[:] ) )
+}
+
+func ( m *tor_metadata ) readCerts( p []byte ) {
+
+	if len(p) < 1 {
+		return
+	}
+	n, p := int( p[0] ), p[1:]
+	for i := 0; i < n && len(p) >= 3; i++ {
+		t, l := p[0], int( binary.BigEndian.Uint16( p[1:] ) )
+		if len(p) < 3 + l {
+			return
+		}
+		m.CertTypes = append( m.CertTypes, int(t) )
+		if t == CERT_RSA_IDENTITY {
+			m.Fingerprint = fingerprint( p[3:3+l] )
+		}
+		p = p[3+l:]
+	}
+}
+
+func ( m *tor_metadata ) readAuthChallenge( p []byte ) {
+
+	if len(p) < 34 {
+		return
+	}
+	n, p := int( binary.BigEndian.Uint16( p[32:] ) ), p[34:]
+	for i := 0; i < n && len(p) >= 2; i++ {
+		m.AuthMethods = append( m.AuthMethods, int( binary.BigEndian.Uint16( p ) ) )
+		p = p[2:]
+	}
+}
+
+// a type, length and value address, empty if of another type
+func address( p []byte ) ( string, []byte, bool ) {
+
+	if len(p) < 2 || len(p) < 2 + int(p[1]) {
+		return "", nil, false
+	}
+	t, v, rest := p[0], p[2:2+int(p[1])], p[2+int(p[1]):]
+	if ( t == ADDR_IPV4 && len(v) == 4 ) || ( t == ADDR_IPV6 && len(v) == 16 ) {
+		return net.IP(v).String(), rest, true
+	}
+	return "", rest, true
+}
+
+func ( m *tor_metadata ) readNetinfo( p []byte ) {
+
+	m.netinfo = true
+	if len(p) < 4 {
+		return
+	}
+	if ts := binary.BigEndian.Uint32( p ); ts != 0 {
+		m.ServerTime = time.Unix( int64(ts), 0 ).UTC().Format( time.RFC3339 )
+	}
+	other, p, ok := address( p[4:] )
+	if !ok || len(p) < 1 {
+		return
+	}
+	m.OtherAddress = other
+	n, p := int( p[0] ), p[1:]
+	for i := 0; i < n; i++ {
+		var a string
+		if a, p, ok = address( p ); !ok {
+			return
+		}
+		if a != "" {
+			m.Addresses = append( m.Addresses, a )
+		}
+	}
+}
+
+// nil unless data starts with a VERSIONS cell
+func parseCells( data []byte ) *tor_metadata {
+
+	if len(data) < 5 || data[0] != 0 || data[1] != 0 || data[2] != VERSIONS {
+		return nil
+	}
+	l := int( binary.BigEndian.Uint16( data[3:] ) )
+	if l == 0 || l % 2 != 0 || len(data) < 5 + l {
+		return nil
+	}
+	m := &tor_metadata{}
+	for p := data[5:5+l]; len(p) > 0; p = p[2:] {
+		v := int( binary.BigEndian.Uint16( p ) )
+		//link protocols are numbered from 1, there are a handful
+		if v == 0 || v > 0xff {
+			return nil
+		}
+		m.Versions = append( m.Versions, v )
+		for _, o := range OFFERED {
+			if v == int(o) && v > m.LinkProtocol {
+				m.LinkProtocol = v
+			}
+		}
+	}
+	idLen := 2
+	if m.LinkProtocol >= 4 {
+		idLen = 4
+	}
+	for _, c := range readCells( data[5+l:], idLen ) {
+		switch c.command {
+		case CERTS:
+			m.readCerts( c.payload )
+		case AUTH_CHALLENGE:
+			m.readAuthChallenge( c.payload )
+		case NETINFO:
+			m.readNetinfo( c.payload )
+		}
+	}
+	return m
+}
+
+// the relay has sent NETINFO, the end of its side of the handshake
+func answered( data []byte ) bool {
+
+	if len(data) >= 3 && ( data[0] != 0 || data[1] != 0 || data[2] != VERSIONS ) {
+		return true
+	}
+	m := parseCells( data )
+	return m != nil && m.netinfo
+}
@@ -0,0 +1,131 @@
+package tor
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a cell with a 4 byte circuit id 0
+func encodeCell( command byte, payload []byte ) []byte {
+	c := []byte{ 0, 0, 0, 0, command }
+	if variable( command ) {
+		c = append( c, byte( len(payload) >> 8 ), byte( len(payload) ) )
+	} else {
+		payload = append( payload, make( []byte, PAYLOAD_LEN - len(payload) )... )
+	}
+	return append( c, payload... )
+}
+
+func identity( t *testing.T ) ( []byte, string ) {
+	key, err := rsa.GenerateKey( rand.Reader, 1024 )
+	if err != nil {
+		t.Fatal( err )
+	}
+	tmpl := &x509.Certificate{ SerialNumber: big.NewInt( 1 ), Subject: pkix.Name{ CommonName: "www.example.net" },
+		NotBefore: time.Unix( 1700000000, 0 ), NotAfter: time.Unix( 1800000000, 0 ) }
+	der, err := x509.CreateCertificate( rand.Reader, tmpl, tmpl, &key.PublicKey, key )
+	if err != nil {
+		t.Fatal( err )
+	}
+	sum := sha1.Sum( x509.MarshalPKCS1PublicKey( &key.PublicKey ) )
+	return der, strings.ToUpper( hex.EncodeToString( sum[:] ) )
+}
+
+func relayCells( der []byte ) []byte {
+	certs := []byte{ 2, 1, 0, 4, 0xde, 0xad, 0xbe, 0xef, CERT_RSA_IDENTITY, byte( len(der) >> 8 ), byte( len(der) ) }
+	certs = append( certs, der... )
+	challenge := append( make( []byte, 32 ), 0, 2, 0, 1, 0, 3 )
+	netinfo := []byte{ 0x66, 0xfe, 0x6e, 0xc2, ADDR_IPV4, 4, 198, 51, 100, 7, 2,
+		ADDR_IPV4, 4, 192, 0, 2, 1 }
+	netinfo = append( append( netinfo, ADDR_IPV6, 16 ), bytes.Repeat( []byte{ 0x20 }, 16 )... )
+	return bytes.Join( [][]byte{
+		{ 0, 0, VERSIONS, 0, 6, 0, 3, 0, 4, 0, 5 },
+		encodeCell( CERTS, certs ),
+		encodeCell( AUTH_CHALLENGE, challenge ),
+		encodeCell( NETINFO, netinfo ),
+	}, nil )
+}
+
+func TestVersions( t *testing.T ) {
+	if !bytes.Equal( versions(), []byte{ 0x00, 0x00, 0x07, 0x00, 0x06, 0x00, 0x03, 0x00, 0x04, 0x00, 0x05 } ) {
+		t.Errorf( "versions() = %x", versions() )
+	}
+}
+
+func TestParseCells( t *testing.T ) {
+
+	der, fp := identity( t )
+	relay := relayCells( der )
+	full := &tor_metadata{ Versions: []int{ 3, 4, 5 }, LinkProtocol: 5, CertTypes: []int{ 1, 2 },
+		Fingerprint: fp, AuthMethods: []int{ 1, 3 }, ServerTime: "2024-10-03T10:15:30Z",
+		OtherAddress: "198.51.100.7", Addresses: []string{ "192.0.2.1", "2020:2020:2020:2020:2020:2020:2020:2020" },
+		netinfo: true }
+	for _, c := range []struct {
+		name		string
+		data		[]byte
+		want		*tor_metadata
+	}{
+		{ "relay", relay, full },
+		{ "netinfo cut short", relay[:len(relay)-1], &tor_metadata{ Versions: []int{ 3, 4, 5 }, LinkProtocol: 5,
+			CertTypes: []int{ 1, 2 }, Fingerprint: fp, AuthMethods: []int{ 1, 3 } } },
+		//an old relay: link protocol 3 keeps 2 byte circuit ids
+		{ "version 3", []byte{ 0, 0, VERSIONS, 0, 4, 0, 1, 0, 3, 0, 0, CERTS, 0, 1, 0 },
+			&tor_metadata{ Versions: []int{ 1, 3 }, LinkProtocol: 3 } },
+		{ "nothing in common", []byte{ 0, 0, VERSIONS, 0, 2, 0, 2 }, &tor_metadata{ Versions: []int{ 2 } } },
+		{ "version 0", []byte{ 0, 0, VERSIONS, 0, 2, 0, 0 }, nil },
+		{ "version 256", []byte{ 0, 0, VERSIONS, 0, 2, 1, 0 }, nil },
+		{ "odd length", []byte{ 0, 0, VERSIONS, 0, 3, 0, 3, 0 }, nil },
+		{ "no versions", []byte{ 0, 0, VERSIONS, 0, 0 }, nil },
+		{ "versions cut short", relay[:8], nil },
+		{ "our own circuit", []byte{ 0, 1, VERSIONS, 0, 2, 0, 3 }, nil },
+		{ "empty", nil, nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	} {
+		if got := parseCells( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( string(c.data) ) == "tor" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( string(c.data) ) )
+		}
+	}
+	for i := range relay {
+		parseCells( relay[:i] )
+	}
+	if !answered( relay ) || answered( relay[:len(relay)-1] ) || answered( relay[:2] ) ||
+		!answered( []byte( "HTTP/1.1" ) ) {
+		t.Errorf( "answered is wrong" )
+	}
+}
+
+func TestAddress( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		[]byte
+		address		string
+		rest		int
+		ok			bool
+	}{
+		{ []byte{ ADDR_IPV4, 4, 192, 0, 2, 1, 0xff }, "192.0.2.1", 1, true },
+		//a hostname, skipped
+		{ []byte{ 0, 3, 'a', 'b', 'c' }, "", 0, true },
+		{ []byte{ ADDR_IPV4, 3, 192, 0, 2 }, "", 0, true },
+		{ []byte{ ADDR_IPV6, 16, 0 }, "", 0, false },
+		{ []byte{ ADDR_IPV4 }, "", 0, false },
+	} {
+		a, rest, ok := address( c.data )
+		if a != c.address || len(rest) != c.rest || ok != c.ok {
+			t.Errorf( "address(%x) = %q, %x, %v", c.data, a, rest, ok )
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package tor
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+// run it inside TLS, as tls/tor, like relays expect
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return versions()
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseCells( []byte(data) ) != nil {
+		return "tor"
+	}
+	return ""
+}
+
+// read through NETINFO (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( []byte(data) )
+}
+
+// link protocol, relay fingerprint and addresses (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseCells( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "tor", &h )
+}
@@ -0,0 +1,39 @@
+package winrm
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return request( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseIdentify( data ) != nil {
+		return "winrm"
+	}
+	return ""
+}
+
+// the IdentifyResponse may be split over segments (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// product vendor and version, security profiles or auth schemes (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseIdentify( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "winrm", &h )
+	lzr.AddFingerprintRule( "winrm", lzr.REFINES, "http" )
+}
@@ -0,0 +1,143 @@
+package winrm
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* a WS-Management Identify (DMTF DSP0226 11) on /wsman, which WinRM
+ * answers without authentication when asked with the WSMANIDENTIFY
+ * header, e.g.
+ *
+ *   HTTP/1.1 200
+ *   Content-Type: application/soap+xml;charset=UTF-8
+ *   Server: Microsoft-HTTPAPI/2.0
+ *
+ *   <s:Envelope ...><s:Header/><s:Body><wsmid:IdentifyResponse ...>
+ *   <wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion>
+ *   <wsmid:ProductVendor>Microsoft Corporation</wsmid:ProductVendor>
+ *   <wsmid:ProductVersion>OS: 10.0.17763 SP: 0.0 Stack: 3.0</wsmid:ProductVersion>
+ *   <wsmid:SecurityProfiles><wsmid:SecurityProfileName>...</wsmid:SecurityProfileName>
+ *   </wsmid:SecurityProfiles></wsmid:IdentifyResponse></s:Body></s:Envelope>
+ *
+ * a listener that wants credentials even for Identify answers 401 with
+ * the schemes it takes (Negotiate, Kerberos, Basic, ...). openwsman
+ * and Intel AMT answer Identify too, as other vendors.
+ */
+const (
+	PATH				string = "/wsman"
+	IDENTIFY			string = `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" ` +
+		`xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+		`<s:Header/><s:Body><wsmid:Identify/></s:Body></s:Envelope>`
+)
+
+var productVersion = regexp.MustCompile( `OS: ([0-9.]+)(?: SP: ([0-9.]+))?(?: Stack: ([0-9.]+))?` )
+
+// namespaces are left out so that any prefix matches
+type envelope struct {
+	ProtocolVersion		string		`xml:"Body>IdentifyResponse>ProtocolVersion"`
+	ProductVendor		string		`xml:"Body>IdentifyResponse>ProductVendor"`
+	ProductVersion		string		`xml:"Body>IdentifyResponse>ProductVersion"`
+	SecurityProfiles	[]string	`xml:"Body>IdentifyResponse>SecurityProfiles>SecurityProfileName"`
+}
+
+type winrm_metadata struct {
+	Status				int			`json:"status"`
+	Server				string		`json:"server,omitempty"`
+	ProtocolVersion		string		`json:"protocol_version,omitempty"`
+	ProductVendor		string		`json:"product_vendor,omitempty"`
+	ProductVersion		string		`json:"product_version,omitempty"`
+	OSVersion			string		`json:"os_version,omitempty"`
+	ServicePack			string		`json:"service_pack,omitempty"`
+	Stack				string		`json:"stack,omitempty"`
+	SecurityProfiles	[]string	`json:"security_profiles,omitempty"`
+	AuthSchemes			[]string	`json:"auth_schemes,omitempty"`
+}
+
+func request( dst string ) []byte {
+
+	req, _ := http.NewRequest( "POST", PATH, strings.NewReader( IDENTIFY ) )
+	req.Host = dst
+	req.Header.Add( "Host", dst )
+	req.Header.Set( "User-Agent", "Mozilla/5.0 zgrab/0.x" )
+	req.Header.Set( "Content-Type", "application/soap+xml;charset=UTF-8" )
+	req.Header.Set( "Content-Length", strconv.Itoa( len(IDENTIFY) ) )
+	req.Header.Set( "WSMANIDENTIFY", "unauthenticated" )
+	data, _ := httputil.DumpRequest( req, true )
+	return data
+}
+
+// the response and as much of its body as arrived
+func readResponse( data string ) ( *http.Response, []byte, error ) {
+
+	resp, err := http.ReadResponse( bufio.NewReader( strings.NewReader( data ) ), nil )
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := io.ReadAll( resp.Body )
+	return resp, body, err
+}
+
+// the scheme of each WWW-Authenticate, e.g. Negotiate for "Negotiate"
+func authSchemes( h http.Header ) []string {
+
+	var schemes []string
+	for _, v := range h.Values( "Www-Authenticate" ) {
+		if f := strings.Fields( v ); len(f) > 0 {
+			schemes = append( schemes, f[0] )
+		}
+	}
+	return schemes
+}
+
+/* nil unless the response is an IdentifyResponse, or an http.sys 401
+ * to our POST that asks for Windows authentication.
+ */
+func parseIdentify( data string ) *winrm_metadata {
+
+	resp, body, _ := readResponse( data )
+	if resp == nil {
+		return nil
+	}
+	m := &winrm_metadata{
+		Status: resp.StatusCode,
+		Server: resp.Header.Get( "Server" ),
+		AuthSchemes: authSchemes( resp.Header ),
+	}
+	var e envelope
+	if xml.Unmarshal( body, &e ) == nil && e.ProtocolVersion != "" {
+		m.ProtocolVersion = e.ProtocolVersion
+		m.ProductVendor = e.ProductVendor
+		m.ProductVersion = e.ProductVersion
+		m.SecurityProfiles = e.SecurityProfiles
+		if match := productVersion.FindStringSubmatch( e.ProductVersion ); match != nil {
+			m.OSVersion, m.ServicePack, m.Stack = match[1], match[2], match[3]
+		}
+		return m
+	}
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix( m.Server, "Microsoft-HTTPAPI/" ) {
+		return nil
+	}
+	for _, s := range m.AuthSchemes {
+		if s == "Negotiate" || s == "Kerberos" {
+			return m
+		}
+	}
+	return nil
+}
+
+// the headers are in and so is the body, by Content-Length or chunking
+func answered( data string ) bool {
+
+	if !strings.HasPrefix( data, "HTTP/" ) && !strings.HasPrefix( "HTTP/", data ) {
+		return true
+	}
+	_, _, err := readResponse( data )
+	return err == nil
+}
@@ -0,0 +1,103 @@
+package winrm
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func response( status string, headers string, body string ) string {
+	return "HTTP/1.1 " + status + "\r\n" + headers + "Content-Length: " + strconv.Itoa( len(body) ) +
+		"\r\n\r\n" + body
+}
+
+func identifyResponse( vendor string, version string, profiles ...string ) string {
+	body := `<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xml:lang="en-US"><s:Header/>` +
+		`<s:Body><wsmid:IdentifyResponse xmlns:wsmid="http://schemas.dmtf.org/wbem/wsman/identity/1/wsmanidentity.xsd">` +
+		`<wsmid:ProtocolVersion>http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd</wsmid:ProtocolVersion>` +
+		`<wsmid:ProductVendor>` + vendor + `</wsmid:ProductVendor>` +
+		`<wsmid:ProductVersion>` + version + `</wsmid:ProductVersion><wsmid:SecurityProfiles>`
+	for _, p := range profiles {
+		body += `<wsmid:SecurityProfileName>` + p + `</wsmid:SecurityProfileName>`
+	}
+	return body + `</wsmid:SecurityProfiles></wsmid:IdentifyResponse></s:Body></s:Envelope>`
+}
+
+var (
+	spnego = "http://schemas.dmtf.org/wbem/wsman/1/wsman/secprofile/http/spnego-kerberos"
+	windows = response( "200 ", "Content-Type: application/soap+xml;charset=UTF-8\r\nServer: Microsoft-HTTPAPI/2.0\r\n",
+		identifyResponse( "Microsoft Corporation", "OS: 10.0.17763 SP: 0.0 Stack: 3.0", spnego ) )
+	openwsman = response( "200 OK", "Server: openwsman\r\nContent-Type: application/soap+xml;charset=UTF-8\r\n",
+		identifyResponse( "Openwsman Project", "2.6.8" ) )
+	unauthorized = response( "401 ", "Server: Microsoft-HTTPAPI/2.0\r\nWWW-Authenticate: Negotiate\r\n" +
+		"WWW-Authenticate: Kerberos\r\n", "" )
+	basicOnly = response( "401 Unauthorized", "Server: Microsoft-HTTPAPI/2.0\r\nWWW-Authenticate: Basic realm=\"WSMAN\"\r\n", "" )
+	notFound = response( "404 Not Found", "Server: Microsoft-HTTPAPI/2.0\r\n", "<h1>Not Found</h1>" )
+	iis = response( "401 Unauthorized", "Server: Microsoft-IIS/10.0\r\nWWW-Authenticate: Negotiate\r\n", "" )
+)
+
+func TestRequest( t *testing.T ) {
+
+	req := string( request( "192.0.2.1" ) )
+	if !strings.HasPrefix( req, "POST /wsman HTTP/1.1\r\n" ) || !strings.Contains( req, "Host: 192.0.2.1\r\n" ) ||
+		!strings.Contains( req, "Wsmanidentify: unauthenticated\r\n" ) ||
+		strings.Count( req, "Content-Length: " + strconv.Itoa( len(IDENTIFY) ) + "\r\n" ) != 1 ||
+		!strings.HasSuffix( req, "\r\n\r\n" + IDENTIFY ) {
+		t.Errorf( "request: %q", req )
+	}
+}
+
+func TestParseIdentify( t *testing.T ) {
+
+	for _, c := range []struct {
+		name		string
+		data		string
+		want		*winrm_metadata
+	}{
+		{ "windows", windows, &winrm_metadata{ Status: 200, Server: "Microsoft-HTTPAPI/2.0",
+			ProtocolVersion: "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd",
+			ProductVendor: "Microsoft Corporation", ProductVersion: "OS: 10.0.17763 SP: 0.0 Stack: 3.0",
+			OSVersion: "10.0.17763", ServicePack: "0.0", Stack: "3.0", SecurityProfiles: []string{ spnego } } },
+		{ "openwsman", openwsman, &winrm_metadata{ Status: 200, Server: "openwsman",
+			ProtocolVersion: "http://schemas.dmtf.org/wbem/wsman/1/wsman.xsd",
+			ProductVendor: "Openwsman Project", ProductVersion: "2.6.8" } },
+		{ "unauthorized", unauthorized, &winrm_metadata{ Status: 401, Server: "Microsoft-HTTPAPI/2.0",
+			AuthSchemes: []string{ "Negotiate", "Kerberos" } } },
+		{ "basic only", basicOnly, nil },
+		{ "not found", notFound, nil },
+		{ "iis", iis, nil },
+		{ "body cut short", windows[:len(windows)-40], nil },
+		{ "headers cut short", windows[:30], nil },
+		{ "empty", "", nil },
+		{ "ssh", "SSH-2.0-OpenSSH_8.9\r\n", nil },
+	} {
+		if got := parseIdentify( c.data ); !reflect.DeepEqual( got, c.want ) {
+			t.Errorf( "%s: got %+v, want %+v", c.name, got, c.want )
+		}
+		var h HandshakeMod
+		if ( h.Verify( c.data ) == "winrm" ) != ( c.want != nil ) {
+			t.Errorf( "%s: Verify %q", c.name, h.Verify( c.data ) )
+		}
+	}
+}
+
+func TestAnswered( t *testing.T ) {
+
+	for _, c := range []struct {
+		data		string
+		answered	bool
+	}{
+		{ "", false },
+		{ "HTT", false },
+		{ windows[:60], false },
+		{ windows[:len(windows)-1], false },
+		{ windows, true },
+		{ unauthorized, true },
+		{ "SSH-2.0-OpenSSH_8.9\r\n", true },
+	} {
+		if answered( c.data ) != c.answered {
+			t.Errorf( "answered(%q) = %v", c.data, !c.answered )
+		}
+	}
+}
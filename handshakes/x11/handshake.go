@@ -9,16 +9,27 @@ type HandshakeMod struct {
 }
 
 func (h *HandshakeMod) GetData( dst string ) []byte {
+	//little endian, protocol 11.0, no authorization
 	data := []byte("\x6c\x00\x0b\x00\x00\x00\x00\x00\x00\x00\x00\x00")
     return data
 }
 
 func (h *HandshakeMod) Verify( data string ) string {
+	if parseSetup( []byte(data) ) != nil {
+		return "x11"
+	}
     return ""
 }
 
+// status, version, vendor or reason (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseSetup( []byte(data) ); m != nil {
+		return m
+	}
+	return nil
+}
+
 func RegisterHandshake() {
 	var h HandshakeMod
 	lzr.AddHandshake( "x11", &h )
 }
-
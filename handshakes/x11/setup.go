@@ -0,0 +1,135 @@
+package x11
+
+import (
+	"encoding/binary"
+	"strconv"
+)
+
+/* the connection setup reply (X11 protocol, section 8). its byte order
+ * is the one the request asked for, little endian ('l') for LZR:
+ *
+ *   0        status: 0 failed, 1 success, 2 authenticate
+ *   1        failed: length of the reason
+ *   2-3      protocol major version (failed, success)
+ *   4-5      protocol minor version (failed, success)
+ *   6-7      length of what follows, in 4 byte units
+ *   8-       failed: the reason
+ *            authenticate: the reason, padded
+ *            success: release (8-11), ..., vendor length (24-25),
+ *            vendor from 40
+ *
+ * e.g. a server refusing LZR's unauthenticated connection:
+ *   00 16 0b 00 00 00 06 00 "No protocol specified\n" 00 00
+ */
+const (
+	STATUS_FAILED		byte = 0
+	STATUS_SUCCESS		byte = 1
+	STATUS_AUTHENTICATE	byte = 2
+
+	PROTOCOL_MAJOR		uint16 = 11
+	SETUP_HEADER_LEN	int = 8
+	SUCCESS_FIXED_LEN	int = 40
+)
+
+var statusNames = map[byte]string{
+	STATUS_FAILED: "failed",
+	STATUS_SUCCESS: "success",
+	STATUS_AUTHENTICATE: "authenticate",
+}
+
+type x11_metadata struct {
+	Status			string		`json:"status"`
+	Version			string		`json:"version,omitempty"`
+	Vendor			string		`json:"vendor,omitempty"`
+	Release			uint32		`json:"release,omitempty"`
+	Reason			string		`json:"reason,omitempty"`
+}
+
+func printable( b []byte ) bool {
+	for _, c := range b {
+		if ( c < 0x20 || c > 0x7e ) && c != '\n' && c != '\r' && c != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// trailing padding and newlines off a reason
+func trimReason( b []byte ) string {
+	for len(b) > 0 && ( b[len(b)-1] == 0 || b[len(b)-1] == '\n' || b[len(b)-1] == '\r' ) {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+/* the setup reply at the start of data, nil if it is not one. only
+ * what the first segment holds needs to be there, the rest of a long
+ * success reply (screens, formats) is not read.
+ */
+func parseSetup( data []byte ) *x11_metadata {
+
+	if len(data) < SETUP_HEADER_LEN {
+		return nil
+	}
+	status, ok := statusNames[ data[0] ]
+	if !ok {
+		return nil
+	}
+	le := binary.LittleEndian
+	major, minor := le.Uint16( data[2:4] ), le.Uint16( data[4:6] )
+	extra := int( le.Uint16( data[6:8] ) ) * 4
+	body := data[SETUP_HEADER_LEN:]
+	if len(body) > extra {
+		body = body[:extra]
+	}
+	m := &x11_metadata{ Status: status }
+
+	switch data[0] {
+	case STATUS_FAILED:
+		reasonL := int( data[1] )
+		if major != PROTOCOL_MAJOR || reasonL > extra {
+			return nil
+		}
+		if reasonL > len(body) {
+			reasonL = len(body)
+		}
+		if !printable( body[:reasonL] ) {
+			return nil
+		}
+		m.Version = strconv.Itoa( int(major) ) + "." + strconv.Itoa( int(minor) )
+		m.Reason = trimReason( body[:reasonL] )
+	case STATUS_SUCCESS:
+		if major != PROTOCOL_MAJOR || extra < SUCCESS_FIXED_LEN - SETUP_HEADER_LEN {
+			return nil
+		}
+		m.Version = strconv.Itoa( int(major) ) + "." + strconv.Itoa( int(minor) )
+		if len(data) < SUCCESS_FIXED_LEN {
+			return m
+		}
+		m.Release = le.Uint32( data[8:12] )
+		vendorL := int( le.Uint16( data[24:26] ) )
+		vendor := data[SUCCESS_FIXED_LEN:]
+		if vendorL > len(vendor) {
+			vendorL = len(vendor)
+		}
+		vendor = trimZeros( vendor[:vendorL] )
+		if !printable( vendor ) {
+			return nil
+		}
+		m.Vendor = string( vendor )
+	case STATUS_AUTHENTICATE:
+		//bytes 1-5 are unused, so the reason must carry it
+		if extra == 0 || len(body) == 0 || !printable( trimZeros( body ) ) {
+			return nil
+		}
+		m.Reason = trimReason( body )
+	}
+	return m
+}
+
+func trimZeros( b []byte ) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package x11
+
+import (
+	"testing"
+)
+
+// the refusal of the comment on parseSetup
+var refused = []byte( "\x00\x16\x0b\x00\x00\x00\x06\x00No protocol specified\n\x00\x00" )
+
+// success: 11.0, release 12101004, vendor "The X.Org Foundation"
+var accepted = append( []byte{
+	0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x0d, 0x00,
+	0x8c, 0xa5, 0xb8, 0x00, 0x00, 0x00, 0x20, 0x00, 0xff, 0xff, 0x1f, 0x00,
+	0x00, 0x01, 0x00, 0x00, 0x14, 0x00, 0xff, 0xff, 0x01, 0x07, 0x00, 0x00,
+	0x20, 0x20, 0x08, 0xff, 0x00, 0x00, 0x00, 0x00 },
+	[]byte( "The X.Org Foundation" )... )
+
+var authenticate = []byte( "\x02\x00\x00\x00\x00\x00\x08\x00Invalid MIT-MAGIC-COOKIE-1 key\x00\x00" )
+
+func TestParseSetup( t *testing.T ) {
+
+	tests := []struct {
+		name			string
+		data			[]byte
+		want			*x11_metadata
+	}{
+		{ "failed", refused, &x11_metadata{ Status: "failed", Version: "11.0", Reason: "No protocol specified" } },
+		{ "success", accepted, &x11_metadata{ Status: "success", Version: "11.0", Release: 12101004, Vendor: "The X.Org Foundation" } },
+		{ "success, first bytes", accepted[:12], &x11_metadata{ Status: "success", Version: "11.0" } },
+		{ "authenticate", authenticate, &x11_metadata{ Status: "authenticate", Reason: "Invalid MIT-MAGIC-COOKIE-1 key" } },
+		{ "failed, cut short", refused[:12], &x11_metadata{ Status: "failed", Version: "11.0", Reason: "No p" } },
+		{ "header only", refused[:7], nil },
+		{ "wrong major", []byte( "\x00\x04\x0a\x00\x00\x00\x01\x00oops" ), nil },
+		{ "reason past length", []byte( "\x00\x10\x0b\x00\x00\x00\x01\x00oops" ), nil },
+		{ "binary reason", []byte( "\x00\x04\x0b\x00\x00\x00\x01\x00\x01\x02\x03\x04" ), nil },
+		{ "success too short", []byte( "\x01\x00\x0b\x00\x00\x00\x01\x00\x00\x00\x00\x00" ), nil },
+		{ "empty authenticate", []byte( "\x02\x00\x00\x00\x00\x00\x00\x00" ), nil },
+		{ "unknown status", []byte( "\x03\x00\x0b\x00\x00\x00\x00\x00" ), nil },
+		{ "http", []byte( "HTTP/1.1 400 Bad Request\r\n\r\n" ), nil },
+	}
+	var h HandshakeMod
+	for _, tt := range tests {
+		m := parseSetup( tt.data )
+		f := h.Verify( string(tt.data) )
+		if tt.want == nil {
+			if m != nil || f != "" {
+				t.Errorf( "%s: got %q %+v", tt.name, f, m )
+			}
+			continue
+		}
+		if f != "x11" || m == nil || *m != *tt.want {
+			t.Errorf( "%s: got %q %+v, want %+v", tt.name, f, m, tt.want )
+		}
+	}
+	for _, v := range [][]byte{ refused, accepted, authenticate } {
+		for i := range v {
+			parseSetup( v[:i] )
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package xmpp
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return streamHeader( dst )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseStream( data ) != nil {
+		return "xmpp"
+	}
+	return ""
+}
+
+// read through the stream features (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// served domain, STARTTLS and SASL requirements (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseStream( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "xmpp", &h )
+	lzr.AddFingerprintRule( "xmpp", lzr.OVERRIDES, "http" )
+}
@@ -0,0 +1,151 @@
+package xmpp
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+/* RFC 6120: LZR opens a client stream to the target's address, and the
+ * server opens its own stream and lists the stream features, or opens
+ * one only to close it with a stream error:
+ *
+ *   <?xml version='1.0'?><stream:stream xmlns='jabber:client'
+ *   xmlns:stream='http://etherx.jabber.org/streams' id='1c2f' from='example.net'
+ *   version='1.0' xml:lang='en'><stream:features><starttls
+ *   xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls><mechanisms
+ *   xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism>
+ *   </mechanisms></stream:features>
+ *
+ * servers do not name their software before authentication, but the
+ * stream says which domain they serve and what they require.
+ */
+const STREAMS_NS string = "http://etherx.jabber.org/streams"
+
+type xmpp_metadata struct {
+	From			string		`json:"from,omitempty"`
+	ID				string		`json:"id,omitempty"`
+	Version			string		`json:"version,omitempty"`
+	Lang			string		`json:"lang,omitempty"`
+	StartTLS		string		`json:"starttls,omitempty"`		//"offered" or "required"
+	SASLMechanisms	[]string	`json:"sasl_mechanisms,omitempty"`
+	Compression		[]string	`json:"compression,omitempty"`
+	Features		[]string	`json:"features,omitempty"`
+	StreamError		string		`json:"stream_error,omitempty"`
+	ErrorText		string		`json:"error_text,omitempty"`
+}
+
+func streamHeader( dst string ) []byte {
+	return []byte( "<?xml version='1.0'?><stream:stream to='" + dst + "' xmlns='jabber:client' " +
+		"xmlns:stream='" + STREAMS_NS + "' version='1.0'>" )
+}
+
+func isStreamElement( name xml.Name, local string ) bool {
+	return name.Local == local && ( name.Space == STREAMS_NS || name.Space == "stream" )
+}
+
+/* what the server's stream says so far, nil if data does not open one.
+ * the stream never closes while LZR listens, so the decoder's error at
+ * the end of data is expected. the decoder skips text before the first
+ * element, so data must start with markup (an HTTP page quoting a
+ * stream is not one).
+ */
+func parseStream( data string ) *xmpp_metadata {
+
+	if !strings.HasPrefix( strings.TrimSpace( data ), "<" ) {
+		return nil
+	}
+	decoder := xml.NewDecoder( strings.NewReader( data ) )
+	decoder.Strict = false
+	var m *xmpp_metadata
+	var path []string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		switch t := token.( type ) {
+		case xml.StartElement:
+			parent := ""
+			if len(path) > 0 {
+				parent = path[len(path)-1]
+			}
+			path = append( path, t.Name.Local )
+			if m == nil {
+				if !isStreamElement( t.Name, "stream" ) {
+					return nil
+				}
+				m = &xmpp_metadata{}
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "from":
+						m.From = a.Value
+					case "id":
+						m.ID = a.Value
+					case "version":
+						m.Version = a.Value
+					case "lang":
+						m.Lang = a.Value
+					}
+				}
+				continue
+			}
+			switch {
+			case parent == "features":
+				m.Features = append( m.Features, t.Name.Local )
+				if t.Name.Local == "starttls" {
+					m.StartTLS = "offered"
+				}
+			case parent == "starttls" && t.Name.Local == "required":
+				m.StartTLS = "required"
+			case parent == "error" && t.Name.Local != "text" && m.StreamError == "":
+				m.StreamError = t.Name.Local
+			}
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		case xml.CharData:
+			if m == nil || len(path) < 2 {
+				continue
+			}
+			text := strings.TrimSpace( string(t) )
+			switch {
+			case path[len(path)-1] == "mechanism":
+				m.SASLMechanisms = append( m.SASLMechanisms, text )
+			case path[len(path)-1] == "method" && path[len(path)-2] == "compression":
+				m.Compression = append( m.Compression, text )
+			case path[len(path)-1] == "text" && path[len(path)-2] == "error":
+				m.ErrorText = text
+			}
+		}
+	}
+	return m
+}
+
+// the features are listed, the stream is closed, or it is not a stream
+func answered( data string ) bool {
+
+	if !strings.HasPrefix( strings.TrimSpace( data ), "<" ) {
+		return true
+	}
+	decoder := xml.NewDecoder( strings.NewReader( data ) )
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.( xml.StartElement ); ok {
+			if !isStreamElement( start.Name, "stream" ) {
+				return true
+			}
+			break
+		}
+	}
+	for _, end := range []string{ "</stream:features>", "<stream:features/>", "</stream:error>", "</stream:stream>" } {
+		if strings.Contains( data, end ) {
+			return true
+		}
+	}
+	return false
+}
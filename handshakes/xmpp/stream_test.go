@@ -0,0 +1,62 @@
+package xmpp
+
+import (
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/http"
+)
+
+const (
+	features = "<?xml version='1.0'?><stream:stream xmlns='jabber:client' " +
+		"xmlns:stream='http://etherx.jabber.org/streams' id='1c2f' from='example.net' " +
+		"version='1.0' xml:lang='en'><stream:features><starttls " +
+		"xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls><mechanisms " +
+		"xmlns='urn:ietf:params:xml:ns:xmpp-sasl'><mechanism>PLAIN</mechanism>" +
+		"</mechanisms></stream:features>"
+	//the error text quotes the HTTP request the server was sent
+	hostUnknown = "<stream:stream xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>" +
+		"<stream:error><host-unknown xmlns='urn:ietf:params:xml:ns:xmpp-streams'/>" +
+		"<text xmlns='urn:ietf:params:xml:ns:xmpp-streams'>GET / HTTP/1.1 <html></text>" +
+		"</stream:error></stream:stream>"
+)
+
+func TestParseStream( t *testing.T ) {
+
+	m := parseStream( features )
+	if m == nil || m.From != "example.net" || m.ID != "1c2f" || m.StartTLS != "required" ||
+		len(m.SASLMechanisms) != 1 || m.SASLMechanisms[0] != "PLAIN" {
+		t.Errorf( "features: %+v", m )
+	}
+	if m := parseStream( "\r\n" + hostUnknown ); m == nil || m.StreamError != "host-unknown" {
+		t.Errorf( "error: %+v", m )
+	}
+	for _, v := range []string{
+		"",
+		"<html><body>stream</body></html>",
+		//a web page serving a stream is http
+		"HTTP/1.1 200 OK\r\nContent-Type: text/xml\r\n\r\n" + features,
+	} {
+		if m := parseStream( v ); m != nil {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	for i := range features {
+		parseStream( features[:i] )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	http.RegisterHandshake()
+	RegisterHandshake()
+	for data, fingerprint := range map[string]string{
+		features: "xmpp",
+		hostUnknown: "xmpp",
+		"HTTP/1.1 200 OK\r\nContent-Type: text/xml\r\n\r\n" + features: "http",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
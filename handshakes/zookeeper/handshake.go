@@ -0,0 +1,42 @@
+package zookeeper
+
+import (
+	"github.com/stanford-esrg/lzr"
+)
+
+// Handshake implements the lzr.Handshake interface
+type HandshakeMod struct {
+}
+
+func (h *HandshakeMod) GetData( dst string ) []byte {
+	return []byte( SRVR )
+}
+
+func (h *HandshakeMod) Verify( data string ) string {
+	if parseSrvr( data ) != nil {
+		return "zookeeper"
+	}
+	return ""
+}
+
+// read the whole srvr output (lzr.StreamingHandshake)
+func (h *HandshakeMod) Complete( data string ) bool {
+	return answered( data )
+}
+
+// version, mode and size of the ensemble member (lzr.MetadataHandshake)
+func (h *HandshakeMod) Metadata( data string ) interface{} {
+	if m := parseSrvr( data ); m != nil {
+		return m
+	}
+	return nil
+}
+
+func RegisterHandshake() {
+	var h HandshakeMod
+	lzr.AddHandshake( "zookeeper", &h )
+	//the build string is free text, these match on a keyword anywhere
+	lzr.AddFingerprintRule( "zookeeper", lzr.OVERRIDES, "telnet" )
+	lzr.AddFingerprintRule( "zookeeper", lzr.OVERRIDES, "pop3" )
+	lzr.AddFingerprintRule( "zookeeper", lzr.OVERRIDES, "redis" )
+}
@@ -0,0 +1,104 @@
+package zookeeper
+
+import (
+	"strconv"
+	"strings"
+)
+
+/* the four letter word "srvr" makes ZooKeeper describe itself and close
+ * the connection:
+ *
+ *   Zookeeper version: 3.8.3-6ad6d364c7c0bcf0de452d54ebefa3058098ab56, built on 2023-10-05 10:34 UTC
+ *   Latency min/avg/max: 0/0.0/0
+ *   Received: 1
+ *   Sent: 0
+ *   Connections: 1
+ *   Outstanding: 0
+ *   Zxid: 0x0
+ *   Mode: standalone
+ *   Node count: 5
+ *
+ * from 3.5.3 on, words left out of 4lw.commands.whitelist (all but srvr
+ * by default) are refused: "srvr is not executed because it is not in
+ * the whitelist."
+ */
+const (
+	SRVR				string = "srvr"
+	VERSION_PREFIX		string = "Zookeeper version: "
+	NOT_WHITELISTED		string = "is not executed because it is not in the whitelist"
+)
+
+type zookeeper_metadata struct {
+	Version			string		`json:"version,omitempty"`
+	Build			string		`json:"build,omitempty"`
+	BuiltOn			string		`json:"built_on,omitempty"`
+	Mode			string		`json:"mode,omitempty"`
+	Connections		*int		`json:"connections,omitempty"`
+	NodeCount		*int		`json:"node_count,omitempty"`
+	Zxid			string		`json:"zxid,omitempty"`
+	Refused			bool		`json:"refused,omitempty"`
+}
+
+func count( s string ) *int {
+	n, err := strconv.Atoi( s )
+	if err != nil {
+		return nil
+	}
+	return &n
+}
+
+// the refusal names the word LZR sent: "srvr is not executed..."
+func refused( data string ) bool {
+	return strings.HasPrefix( data, SRVR + " " + NOT_WHITELISTED )
+}
+
+func parseSrvr( data string ) *zookeeper_metadata {
+
+	if refused( data ) {
+		return &zookeeper_metadata{ Refused: true }
+	}
+	if !strings.HasPrefix( data, VERSION_PREFIX ) {
+		return nil
+	}
+	m := &zookeeper_metadata{}
+	for _, line := range strings.Split( data, "\n" ) {
+		i := strings.Index( line, ": " )
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], strings.TrimSpace( line[i+2:] )
+		switch key {
+		case "Zookeeper version":
+			//version-commit, built on date
+			if j := strings.Index( value, ", built on " ); j >= 0 {
+				m.BuiltOn = value[j+len(", built on "):]
+				value = value[:j]
+			}
+			m.Version = value
+			if j := strings.IndexByte( value, '-' ); j >= 0 {
+				m.Version, m.Build = value[:j], value[j+1:]
+			}
+		case "Mode":
+			m.Mode = value
+		case "Connections":
+			m.Connections = count( value )
+		case "Node count":
+			m.NodeCount = count( value )
+		case "Zxid":
+			m.Zxid = value
+		}
+	}
+	return m
+}
+
+// the output ends with the node count, and the server closes after it
+func answered( data string ) bool {
+
+	if refused( data ) {
+		return true
+	}
+	if strings.HasPrefix( data, VERSION_PREFIX ) {
+		return strings.Contains( data, "Node count: " ) && strings.HasSuffix( data, "\n" )
+	}
+	return !strings.HasPrefix( VERSION_PREFIX, data )
+}
@@ -0,0 +1,65 @@
+package zookeeper
+
+import (
+	"testing"
+
+	"github.com/stanford-esrg/lzr"
+	"github.com/stanford-esrg/lzr/handshakes/pop3"
+	"github.com/stanford-esrg/lzr/handshakes/redis"
+	"github.com/stanford-esrg/lzr/handshakes/telnet"
+)
+
+const (
+	standalone = "Zookeeper version: 3.8.3-6ad6d364c7c0bcf0de452d54ebefa3058098ab56, built on 2023-10-05 10:34 UTC\n" +
+		"Latency min/avg/max: 0/0.0/0\nReceived: 1\nSent: 0\nConnections: 1\nOutstanding: 0\n" +
+		"Zxid: 0x0\nMode: standalone\nNode count: 5\n"
+	notWhitelisted = "srvr is not executed because it is not in the whitelist.\n"
+)
+
+func TestParseSrvr( t *testing.T ) {
+
+	m := parseSrvr( standalone )
+	if m == nil || m.Version != "3.8.3" || m.Build != "6ad6d364c7c0bcf0de452d54ebefa3058098ab56" ||
+		m.BuiltOn != "2023-10-05 10:34 UTC" || m.Mode != "standalone" || m.Connections == nil ||
+		*m.Connections != 1 || m.NodeCount == nil || *m.NodeCount != 5 || m.Zxid != "0x0" {
+		t.Errorf( "standalone: %+v", m )
+	}
+	if m := parseSrvr( notWhitelisted ); m == nil || !m.Refused {
+		t.Errorf( "refused: %+v", m )
+	}
+	var h HandshakeMod
+	for _, v := range []string{
+		"",
+		"Zookeeper",
+		//a page quoting the refusal is not ZooKeeper refusing us
+		"HTTP/1.1 200 OK\r\n\r\n" + notWhitelisted,
+		"mntr is not executed because it is not in the whitelist.\n",
+	} {
+		if m := parseSrvr( v ); m != nil || h.Verify( v ) != "" {
+			t.Errorf( "%q: %+v", v, m )
+		}
+	}
+	if answered( standalone[:40] ) || !answered( standalone ) || !answered( notWhitelisted ) {
+		t.Errorf( "answered" )
+	}
+}
+
+func TestFingerprint( t *testing.T ) {
+
+	telnet.RegisterHandshake()
+	pop3.RegisterHandshake()
+	redis.RegisterHandshake()
+	RegisterHandshake()
+	//a vendor build naming what it bundles
+	vendor := "Zookeeper version: 3.4.6-Redis-telnet+OK, built on 02/20/2014 09:09 GMT\nMode: standalone\nNode count: 4\n"
+	for data, fingerprint := range map[string]string{
+		standalone: "zookeeper",
+		vendor: "zookeeper",
+		notWhitelisted: "zookeeper",
+		"+OK POP3 ready\r\n": "pop3",
+	} {
+		if got := lzr.MatchFingerprint( data ); got != fingerprint {
+			t.Errorf( "%q: %s, want %s", data, got, fingerprint )
+		}
+	}
+}
@@ -0,0 +1,374 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+/* the state map knows about one saddr:sport at a time, the host cache
+ * remembers what every port of the same saddr has taught us so far:
+ * its middlebox verdict, which ports answered and with what, and how many
+ * SYNs LZR has spent on it. policies (-hostBudget, -hostIdenticalPorts)
+ * use it to stop spending handshakes on hosts that will not tell us more.
+ * hosts outlive their flows: the cache holds the -hostCacheSize most
+ * recently used ones, each for at most -hostCacheTTL after its last use,
+ * and only when something reads it (see hostCacheEnabled).
+ */
+type host_knowledge struct {
+
+	mu					sync.Mutex
+	Saddr				string				`json:"saddr"`
+	Ports				[]int				`json:"ports"`
+	PortsResponded		int					`json:"ports_responded"`
+	SYNs				int					`json:"syns"`
+	Fingerprints		map[string]int		`json:"fingerprints,omitempty"`
+	Middlebox			*middlebox_verdict	`json:"middlebox,omitempty"`
+	Uniform				bool				`json:"uniform"`
+	BudgetExhausted		bool				`json:"budget_exhausted"`
+	SkippedHandshakes	int					`json:"skipped_handshakes"`
+
+	addr				netip.Addr
+	seen				map[int]bool
+	responses			map[uint64]int
+	flows				int			//ports in flight, never evicted while > 0
+	lastUsed			time.Time
+}
+
+// the cache is split by address so workers rarely wait on each other
+const HOST_CACHE_SHARDS = 64
+
+type host_cache_shard struct {
+	sync.Mutex
+	hosts			map[netip.Addr]*list.Element	//of *host_knowledge
+	lru				*list.List		//most recently used at the front
+	seen			map[netip.Addr]struct{}		//every host ever cached
+}
+
+type host_cache []*host_cache_shard
+
+var hostCache = newHostCache()
+
+func newHostCache() host_cache {
+	c := make( host_cache, HOST_CACHE_SHARDS )
+	for i := range c {
+		c[i] = &host_cache_shard{
+			hosts: make( map[netip.Addr]*list.Element ),
+			lru: list.New(),
+			seen: make( map[netip.Addr]struct{} ),
+		}
+	}
+	return c
+}
+
+func ( c host_cache ) shard( addr netip.Addr ) *host_cache_shard {
+	return c[ flow_key{ addr: addr }.hash() % HOST_CACHE_SHARDS ]
+}
+
+// the host summary file, written to as hosts leave the cache
+var hostRecords struct {
+	sync.Mutex
+	fw		*file_writer
+}
+
+func hostCacheEnabled() bool {
+	return getHostBudget() > 0 || getHostIdenticalPorts() > 0 ||
+		getHostSummary() != "" || HyperACKtiveFiltering()
+}
+
+// h is past -hostCacheTTL and nothing of it is in flight, h.mu held
+func ( h *host_knowledge ) expired( now time.Time ) bool {
+	ttl := time.Duration( getHostCacheTTL() ) * time.Second
+	return h.flows == 0 && ttl > 0 && now.Sub( h.lastUsed ) > ttl
+}
+
+/* the host's entry, marked used. with create a missing (or expired)
+ * host gets a new one and, with join, a port in flight. hosts pushed
+ * out by it are returned to be written to the host summary.
+ */
+func ( s *host_cache_shard ) lookup( addr netip.Addr, create bool, join bool ) ( *host_knowledge, []*host_knowledge ) {
+
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	var evicted []*host_knowledge
+	if e, ok := s.hosts[addr]; ok {
+		h := e.Value.(*host_knowledge)
+		h.mu.Lock()
+		if !h.expired( now ) {
+			if join {
+				h.flows += 1
+			}
+			h.lastUsed = now
+			h.mu.Unlock()
+			s.lru.MoveToFront( e )
+			return h, nil
+		}
+		h.mu.Unlock()
+		s.lru.Remove( e )
+		delete( s.hosts, addr )
+		evicted = append( evicted, h )
+	}
+	if !create {
+		return nil, evicted
+	}
+
+	h := &host_knowledge{
+		Saddr: addr.String(),
+		addr: addr,
+		seen: make( map[int]bool ),
+		responses: make( map[uint64]int ),
+		lastUsed: now,
+	}
+	if join {
+		h.flows = 1
+	}
+	s.hosts[addr] = s.lru.PushFront( h )
+	s.seen[addr] = struct{}{}
+
+	//least recently used first, hosts with ports in flight stay
+	if getHostCacheSize() <= 0 {
+		return h, evicted
+	}
+	max := ( getHostCacheSize() + HOST_CACHE_SHARDS - 1 ) / HOST_CACHE_SHARDS
+	e := s.lru.Back()
+	for len(s.hosts) > max && e != nil && e != s.hosts[addr] {
+		prev := e.Prev()
+		old := e.Value.(*host_knowledge)
+		old.mu.Lock()
+		idle := old.flows == 0
+		old.mu.Unlock()
+		if idle {
+			s.lru.Remove( e )
+			delete( s.hosts, old.addr )
+			evicted = append( evicted, old )
+		}
+		e = prev
+	}
+	return h, evicted
+}
+
+func hostLookup( addr netip.Addr, create bool, join bool ) *host_knowledge {
+
+	h, evicted := hostCache.shard( addr ).lookup( addr, create, join )
+	for _, old := range evicted {
+		old.retire()
+	}
+	return h
+}
+
+func hostInfo( addr netip.Addr ) *host_knowledge {
+	return hostLookup( addr, true, false )
+}
+
+// a port of the host is in flight, nil when nothing reads the cache
+func joinHost( addr netip.Addr ) *host_knowledge {
+
+	if !hostCacheEnabled() {
+		return nil
+	}
+	return hostLookup( addr, true, true )
+}
+
+// a port of the host is done, fold what it answered into the host
+func ( h *host_knowledge ) leave( packet *packet_metadata ) {
+
+	h.mu.Lock()
+	h.note( packet )
+	h.flows -= 1
+	h.lastUsed = time.Now()
+	h.mu.Unlock()
+}
+
+/* the host left the cache, write its summary record. a host that
+ * comes back after that starts over, and gets another record.
+ */
+func ( h *host_knowledge ) retire() {
+
+	hostRecords.Lock()
+	defer hostRecords.Unlock()
+	if hostRecords.fw == nil {
+		return
+	}
+	if err := writeHostRecord( hostRecords.fw, h ); err != nil {
+		fmt.Fprintln(os.Stderr, "--Error writing host summary:", err)
+	}
+}
+
+// verdicts per IP so later ports of the same host are not probed again
+func cachedMiddlebox( addr netip.Addr ) ( *middlebox_verdict, bool ) {
+
+	host := hostLookup( addr, false, false )
+	if host == nil {
+		return nil, false
+	}
+	host.mu.Lock()
+	defer host.mu.Unlock()
+	if host.Middlebox == nil {
+		return nil, false
+	}
+	cached := *host.Middlebox
+	cached.Cached = true
+	return &cached, true
+}
+
+// the latest verdict from the host's probes, for its later ports
+func rememberMiddlebox( addr netip.Addr, v *middlebox_verdict ) {
+
+	if !hostCacheEnabled() {
+		return
+	}
+	h := hostInfo( addr )
+	h.mu.Lock()
+	h.Middlebox = v
+	h.mu.Unlock()
+}
+
+// spend n SYNs on the host if the budget allows it
+func ( h *host_knowledge ) reserve( n int ) bool {
+
+	if getHostBudget() > 0 && h.SYNs + n > getHostBudget() {
+		h.BudgetExhausted = true
+		return false
+	}
+	h.SYNs += n
+	return true
+}
+
+/* whether the target may try its next handshake. remaining is how many
+ * handshakes are left and is counted as skipped when the answer is no.
+ */
+func hostAllowsHandshake( packet *packet_metadata, remaining int ) bool {
+
+	if getHostBudget() == 0 && getHostIdenticalPorts() == 0 {
+		return true
+	}
+	h := hostInfo( packet.targetAddr() )
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ( getHostIdenticalPorts() > 0 && h.Uniform ) || !h.reserve( 1 ) {
+		h.SkippedHandshakes += remaining
+		return false
+	}
+	return true
+}
+
+// HyperACKtive probes are all or nothing, a partial set would skew the verdict
+func hostAllowsProbes( packet *packet_metadata, n int ) bool {
+
+	if getHostBudget() == 0 && getHostIdenticalPorts() == 0 {
+		return true
+	}
+	h := hostInfo( packet.targetAddr() )
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if getHostIdenticalPorts() > 0 && h.Uniform {
+		return false
+	}
+	return h.reserve( n )
+}
+
+// fold a finished target into what we know about its host, h.mu held
+func ( h *host_knowledge ) note( packet *packet_metadata ) {
+
+	if !h.seen[ packet.Sport ] {
+		h.seen[ packet.Sport ] = true
+		h.Ports = append( h.Ports, packet.Sport )
+	}
+	data, candidates := packet.Data, []string(nil)
+	if data != "" {
+		candidates = packet.candidates()
+	} else {
+		for _, a := range packet.Attempts {
+			if a.Outcome == OUTCOME_DATA {
+				data = a.Data
+			}
+		}
+		candidates = matchFingerprints( data )
+	}
+	if data == "" {
+		return
+	}
+	h.PortsResponded += 1
+	if fingerprint := resolveFingerprint( candidates ); fingerprint != "" {
+		if h.Fingerprints == nil {
+			h.Fingerprints = make( map[string]int )
+		}
+		h.Fingerprints[ fingerprint ] += 1
+	}
+
+	hash := fnv.New64a()
+	hash.Write( []byte( data ) )
+	sum := hash.Sum64()
+	h.responses[ sum ] += 1
+	if getHostIdenticalPorts() > 0 && h.responses[ sum ] >= getHostIdenticalPorts() {
+		h.Uniform = true
+	}
+}
+
+func writeHostRecord( fw *file_writer, h *host_knowledge ) error {
+
+	h.mu.Lock()
+	sort.Ints( h.Ports )
+	out, err := json.Marshal( h )
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	w, err := fw.Writer()
+	if err == nil {
+		_, err = w.Write( append( out, '\n' ) )
+	}
+	return err
+}
+
+// the hosts still cached at the end of the scan
+func writeHostRecords( fw *file_writer ) error {
+
+	for _, s := range hostCache {
+		s.Lock()
+		for e := s.lru.Back(); e != nil; e = e.Prev() {
+			if err := writeHostRecord( fw, e.Value.(*host_knowledge) ); err != nil {
+				s.Unlock()
+				return err
+			}
+		}
+		s.Unlock()
+	}
+	return nil
+}
+
+// distinct hosts, however often they left the cache and came back
+func countHosts() int {
+
+	n := 0
+	for _, s := range hostCache {
+		s.Lock()
+		n += len(s.seen)
+		s.Unlock()
+	}
+	return n
+}
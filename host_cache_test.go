@@ -0,0 +1,130 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// a host policy on, an empty cache of at most size hosts kept for ttl seconds
+func testHostPolicy( t *testing.T, identical int, size int, ttl int ) {
+
+	savedIdentical, savedSize, savedTTL, savedCache := *hostIdenticalPorts, *hostCacheSize, *hostCacheTTL, hostCache
+	*hostIdenticalPorts, *hostCacheSize, *hostCacheTTL, hostCache = identical, size, ttl, newHostCache()
+	t.Cleanup( func() {
+		*hostIdenticalPorts, *hostCacheSize, *hostCacheTTL, hostCache = savedIdentical, savedSize, savedTTL, savedCache
+	} )
+}
+
+func cached( addr netip.Addr ) bool {
+	return hostLookup( addr, false, false ) != nil
+}
+
+func TestHostCacheOff( t *testing.T ) {
+
+	testHostPolicy( t, 0, 1000, 0 )
+	addr := netip.MustParseAddr( "192.0.2.1" )
+	if h := joinHost( addr ); h != nil {
+		t.Fatal( "joined a host with no host policy on" )
+	}
+	if cached( addr ) {
+		t.Fatal( "cached a host with no host policy on" )
+	}
+}
+
+func TestHostCacheOutlivesFlows( t *testing.T ) {
+
+	testHostPolicy( t, 2, 1000, 0 )
+	addr := netip.MustParseAddr( "192.0.2.2" )
+	first := joinHost( addr )
+	first.leave( &packet_metadata{ Sport: 80, Data: "same" } )
+	if !cached( addr ) {
+		t.Fatal( "dropped a host once its port finished" )
+	}
+	second := joinHost( addr )
+	if second != first {
+		t.Fatal( "a later port of the host got a new entry" )
+	}
+	second.leave( &packet_metadata{ Sport: 8080, Data: "same" } )
+	if !first.Uniform || first.PortsResponded != 2 || len(first.Ports) != 2 {
+		t.Fatalf( "ports folded: uniform %v, responded %d, ports %v", first.Uniform, first.PortsResponded, first.Ports )
+	}
+	if countHosts() != 1 {
+		t.Fatalf( "%d hosts, want 1", countHosts() )
+	}
+}
+
+// addresses landing in the same shard of the cache
+func sameShard( n int ) []netip.Addr {
+
+	var addrs []netip.Addr
+	want := hostCache.shard( netip.MustParseAddr( "198.51.100.0" ) )
+	for addr := netip.MustParseAddr( "198.51.100.0" ); len(addrs) < n; addr = addr.Next() {
+		if hostCache.shard( addr ) == want {
+			addrs = append( addrs, addr )
+		}
+	}
+	return addrs
+}
+
+func TestHostCacheEvictsLeastRecentlyUsed( t *testing.T ) {
+
+	//two hosts per shard
+	testHostPolicy( t, 2, 2 * HOST_CACHE_SHARDS, 0 )
+	addrs := sameShard( 4 )
+
+	busy := joinHost( addrs[0] )
+	joinHost( addrs[1] ).leave( &packet_metadata{ Sport: 80 } )
+	joinHost( addrs[2] ).leave( &packet_metadata{ Sport: 80 } )
+	if !cached( addrs[0] ) || cached( addrs[1] ) || !cached( addrs[2] ) {
+		t.Fatal( "did not drop the least recently used idle host" )
+	}
+
+	//a port in flight keeps its host
+	busy.leave( &packet_metadata{ Sport: 80 } )
+	hostInfo( addrs[2] )
+	joinHost( addrs[3] ).leave( &packet_metadata{ Sport: 80 } )
+	if cached( addrs[0] ) || !cached( addrs[2] ) || !cached( addrs[3] ) {
+		t.Fatal( "kept a host over a more recently used one" )
+	}
+
+	//coming back does not count a host twice
+	joinHost( addrs[1] ).leave( &packet_metadata{ Sport: 443 } )
+	if countHosts() != 4 {
+		t.Fatalf( "%d hosts, want 4", countHosts() )
+	}
+}
+
+func TestHostCacheTTL( t *testing.T ) {
+
+	testHostPolicy( t, 2, 1000, 60 )
+	addr := netip.MustParseAddr( "192.0.2.3" )
+	h := joinHost( addr )
+	h.lastUsed = time.Now().Add( -time.Hour )
+	if !cached( addr ) {
+		t.Fatal( "expired a host with a port in flight" )
+	}
+	h.leave( &packet_metadata{ Sport: 80 } )
+	h.lastUsed = time.Now().Add( -time.Hour )
+	if cached( addr ) {
+		t.Fatal( "kept a host past -hostCacheTTL" )
+	}
+	if again := joinHost( addr ); again == h {
+		t.Fatal( "an expired host was reused" )
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+/* ICMP errors quote the header of the packet that caused them.
+ * turn that quote back into the flow it belongs to, from the
+ * target's point of view like every other received packet,
+ * so the flow can end right away instead of timing out.
+ */
+
+// only the errors that tell us something about the target
+const ICMP_BPF_FILTER = "icmp[icmptype] == icmp-unreach or icmp[icmptype] == icmp-timxceed or " +
+	"(icmp6 and (ip6[40] == 1 or ip6[40] == 3))"
+
+// map an ICMPv4 error to the outcome of the flow it ends, "" to ignore it
+func icmpv4Outcome( typ uint8, code uint8 ) string {
+
+	switch typ {
+	case layers.ICMPv4TypeDestinationUnreachable:
+		switch code {
+		case layers.ICMPv4CodeProtocol, layers.ICMPv4CodePort:
+			return OUTCOME_PORT_UNREACHABLE
+		case layers.ICMPv4CodeNet, layers.ICMPv4CodeHost, layers.ICMPv4CodeSourceRoutingFailed,
+			layers.ICMPv4CodeNetUnknown, layers.ICMPv4CodeHostUnknown, layers.ICMPv4CodeSourceIsolated,
+			layers.ICMPv4CodeNetTOS, layers.ICMPv4CodeHostTOS:
+			return OUTCOME_HOST_UNREACHABLE
+		case layers.ICMPv4CodeNetAdminProhibited, layers.ICMPv4CodeHostAdminProhibited,
+			layers.ICMPv4CodeCommAdminProhibited, layers.ICMPv4CodeHostPrecedence,
+			layers.ICMPv4CodePrecedenceCutoff:
+			return OUTCOME_PROHIBITED
+		}
+	case layers.ICMPv4TypeTimeExceeded:
+		if code == layers.ICMPv4CodeTTLExceeded {
+			return OUTCOME_TTL_EXCEEDED
+		}
+	}
+	return ""
+}
+
+func icmpv6Outcome( typ uint8, code uint8 ) string {
+
+	switch typ {
+	case layers.ICMPv6TypeDestinationUnreachable:
+		switch code {
+		case layers.ICMPv6CodePortUnreachable:
+			return OUTCOME_PORT_UNREACHABLE
+		case layers.ICMPv6CodeNoRouteToDst, layers.ICMPv6CodeBeyondScopeOfSrc,
+			layers.ICMPv6CodeAddressUnreachable:
+			return OUTCOME_HOST_UNREACHABLE
+		case layers.ICMPv6CodeAdminProhibited, layers.ICMPv6CodeSrcAddressFailedPolicy,
+			layers.ICMPv6CodeRejectRouteToDst:
+			return OUTCOME_PROHIBITED
+		}
+	case layers.ICMPv6TypeTimeExceeded:
+		if code == layers.ICMPv6CodeHopLimitExceeded {
+			return OUTCOME_TTL_EXCEEDED
+		}
+	}
+	return ""
+}
+
+/* build the packet of the quoted flow. quote starts at the quoted
+ * IP header, only its addresses and the first 8 bytes of the
+ * transport header are needed: the ports and, over TCP, the sequence
+ * number that ties the error to a segment we sent (RFC 5927).
+ */
+func readICMPQuote( outcome string, from string, ttl uint8, quote []byte, v6 bool,
+	eth *layers.Ethernet ) *packet_metadata {
+
+	var proto layers.IPProtocol
+	var saddr, daddr net.IP
+	hlen := 0
+	if v6 {
+		if len(quote) < 48 {
+			return nil
+		}
+		hlen = 40
+		proto = layers.IPProtocol( quote[6] )
+		saddr, daddr = net.IP( quote[24:40] ), net.IP( quote[8:24] )
+	} else {
+		if len(quote) < 20 {
+			return nil
+		}
+		hlen = int(quote[0] & 0x0f) * 4
+		if hlen < 20 || len(quote) < hlen + 8 {
+			return nil
+		}
+		proto = layers.IPProtocol( quote[9] )
+		saddr, daddr = net.IP( quote[16:20] ), net.IP( quote[12:16] )
+	}
+
+	transport := ""
+	switch proto {
+	case layers.IPProtocolTCP:
+		transport = TRANSPORT_TCP
+	case layers.IPProtocolUDP:
+		transport = TRANSPORT_UDP
+	default:
+		return nil
+	}
+
+	return &packet_metadata{
+		Smac: learnMac( eth ),
+		saddr: binaryAddr( saddr ),
+		daddr: binaryAddr( daddr ),
+		TTL: ttl,
+		Sport: int( binary.BigEndian.Uint16( quote[hlen+2:hlen+4] ) ),
+		Dport: int( binary.BigEndian.Uint16( quote[hlen:hlen+2] ) ),
+		Transport: transport,
+		ICMPError: outcome,
+		ICMPFrom: from,
+		ICMPSeq: binary.BigEndian.Uint32( quote[hlen+4:hlen+8] ),
+		Timestamp: time.Now(),
+		RecvTime: time.Now(),
+		Processing: true,
+	}
+}
+
+func ReadICMPLayers( ip *layers.IPv4, icmp *layers.ICMPv4, eth *layers.Ethernet ) *packet_metadata {
+
+	outcome := icmpv4Outcome( icmp.TypeCode.Type(), icmp.TypeCode.Code() )
+	if outcome == "" {
+		return nil
+	}
+	return readICMPQuote( outcome, ip.SrcIP.String(), ip.TTL, icmp.Payload, false, eth )
+}
+
+func ReadICMPv6Layers( ip *layers.IPv6, icmp *layers.ICMPv6, eth *layers.Ethernet ) *packet_metadata {
+
+	outcome := icmpv6Outcome( icmp.TypeCode.Type(), icmp.TypeCode.Code() )
+	if outcome == "" || len(icmp.Payload) < 4 {
+		return nil
+	}
+	//4 unused bytes before the quote
+	return readICMPQuote( outcome, ip.SrcIP.String(), ip.HopLimit, icmp.Payload[4:], true, eth )
+}
+
+// the flow is over, whatever handshake it was on
+func handleICMPError( packet *packet_metadata, ipMeta * pState, writingQueue chan *packet_metadata ) {
+
+	packet.syncHandshakeNum( ipMeta.getHandshake( packet ) )
+	isHyperACKtive := ipMeta.getHyperACKtiveStatus( packet )
+	ipMeta.recordAttempt( packet )
+	packet = ipMeta.remove( packet )
+	//HyperACKtive probes are never recorded
+	if isHyperACKtive {
+		return
+	}
+	if !RecordOnlyData() {
+		writingQueue <- packet
+	} else {
+		addToSummary( packet )
+	}
+}
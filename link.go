@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+/* the link layer LZR reads and writes on. -linkType auto picks it from
+ * the capture handle, -vlan tags (and expects) 802.1Q frames.
+ */
+const (
+	LINK_AUTO		string = "auto"
+	LINK_ETHERNET	string = "ethernet"
+	LINK_RAW		string = "raw"
+	LINK_SLL		string = "sll"
+	LINK_NULL		string = "null"
+)
+
+var (
+	linkType	string = LINK_ETHERNET
+	vlanIDs		[]uint16
+)
+
+// outer tag first, at most two (QinQ)
+func parseVLANs( list string ) ( []uint16, error ) {
+
+	if list == "" {
+		return nil, nil
+	}
+	var ids []uint16
+	for _, s := range strings.Split( list, "," ) {
+		id, err := strconv.Atoi( strings.TrimSpace( s ) )
+		if err != nil || id < 0 || id > 4095 {
+			return nil, fmt.Errorf("bad VLAN id %q", s)
+		}
+		ids = append( ids, uint16(id) )
+	}
+	if len(ids) > 2 {
+		return nil, fmt.Errorf("at most two VLAN tags (outer,inner), got %d", len(ids))
+	}
+	return ids, nil
+}
+
+func linkTypeFor( lt layers.LinkType ) ( string, error ) {
+
+	switch lt {
+	case layers.LinkTypeEthernet:
+		return LINK_ETHERNET, nil
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4:
+		return LINK_RAW, nil
+	case layers.LinkTypeLinuxSLL:
+		return LINK_SLL, nil
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		return LINK_NULL, nil
+	}
+	return "", fmt.Errorf("unsupported link type %v", lt)
+}
+
+// resolve -linkType once the capture handle is open
+func initLinkLayer( captured layers.LinkType ) error {
+
+	vlans, err := parseVLANs( getVLANs() )
+	if err != nil {
+		return err
+	}
+	vlanIDs = vlans
+
+	requested := getLinkType()
+	if requested == LINK_AUTO {
+		if requested, err = linkTypeFor( captured ); err != nil {
+			return err
+		}
+	}
+	switch requested {
+	case LINK_ETHERNET, LINK_RAW, LINK_SLL, LINK_NULL:
+	default:
+		return fmt.Errorf("unknown link type %q", requested)
+	}
+	if len(vlanIDs) > 0 && requested != LINK_ETHERNET {
+		return fmt.Errorf("VLAN tags need an ethernet link, not %s", requested)
+	}
+	linkType = requested
+	resetLinkHeader()
+	return nil
+}
+
+/* layers to put in front of the IP header of every frame we send.
+ * a cooked (sll) capture cannot be written to, the interface
+ * behind it is expected to be ethernet.
+ */
+func constructLinkLayers() []gopacket.SerializableLayer {
+
+	switch linkType {
+	case LINK_RAW:
+		return nil
+	case LINK_NULL:
+		return []gopacket.SerializableLayer{ &layers.Loopback{ Family: layers.ProtocolFamilyIPv4 } }
+	}
+
+	eth := constructEthLayer()
+	if len(vlanIDs) == 0 {
+		return []gopacket.SerializableLayer{ eth }
+	}
+	link := []gopacket.SerializableLayer{ eth }
+	//802.1ad outer tag when stacking two
+	eth.EthernetType = layers.EthernetTypeDot1Q
+	if len(vlanIDs) == 2 {
+		eth.EthernetType = layers.EthernetTypeQinQ
+	}
+	for i, id := range vlanIDs {
+		tag := &layers.Dot1Q{ VLANIdentifier: id, Type: layers.EthernetTypeIPv4 }
+		if i < len(vlanIDs) - 1 {
+			tag.Type = layers.EthernetTypeDot1Q
+		}
+		link = append( link, tag )
+	}
+	return link
+}
+
+/* the serialized link layers, built once and prepended to every
+ * frame. rebuilt after the gateway MAC or link type changes.
+ */
+type link_header struct {
+	built		bool
+	bytes		[]byte
+}
+
+var linkHeaderCache atomic.Value
+
+func resetLinkHeader() {
+	linkHeaderCache.Store( link_header{} )
+}
+
+func linkHeader() []byte {
+
+	if hdr, ok := linkHeaderCache.Load().( link_header ); ok && hdr.built {
+		return hdr.bytes
+	}
+	hdr := link_header{ built: true, bytes: buildLinkHeader() }
+	linkHeaderCache.Store( hdr )
+	return hdr.bytes
+}
+
+func buildLinkHeader() []byte {
+
+	link := constructLinkLayers()
+	if len(link) == 0 {
+		return nil
+	}
+	//a body long enough that ethernet does not pad, cut off after
+	body := make( []byte, 64 )
+	buffer := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers( buffer, gopacket.SerializeOptions{},
+		append( link, gopacket.Payload(body) )...); err != nil {
+		log.Fatal(err)
+	}
+	frame := buffer.Bytes()
+	return append( []byte(nil), frame[:len(frame)-len(body)]... )
+}
+
+// match frames with our tags too
+func vlanFilter( filter string ) string {
+
+	tagged := "(" + filter + ")"
+	for range vlanIDs {
+		tagged = "vlan and " + tagged
+	}
+	if len(vlanIDs) == 0 {
+		return filter
+	}
+	return "(" + filter + ") or (" + tagged + ")"
+}
@@ -0,0 +1,339 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket/layers"
+)
+
+/* HyperACKtive filtering sends SYNs (and then the same handshake data)
+ * to random ports of the host next to the real one. comparing how those
+ * probes are answered against the real port tells real services apart
+ * from middleboxes that answer for every port.
+ */
+const (
+	MIDDLEBOX_ACKING_FIREWALL	string = "acking-firewall"
+	MIDDLEBOX_TARPIT			string = "tarpit"
+	MIDDLEBOX_LOAD_BALANCER		string = "load-balancer"
+	MIDDLEBOX_REAL_SERVICE		string = "real-service"
+)
+
+// probes stay this far from the real port and from each other
+var PROBE_PORT_SPACING int = 32
+
+// -haf above this is refused, spaced probes would not fit in the ephemeral ports
+const MAX_PROBES int = 64
+
+// random draws per probe before settling for fewer probes
+const PROBE_PORT_TRIES int = 16
+
+// what one port (the real one or a probe) answered with
+type probe_response struct {
+	Sport			int
+	SynAck			bool
+	Window			int
+	TTL				uint8
+	Options			string
+	Data			string
+}
+
+// what a flow keeps for -haf, only allocated by the flows that use it
+type probe_state struct {
+	RespNum				int				//probes that SYN-ACKed
+	ParentSport			int				//set on the probes
+	Real				probe_response	//compared against the HyperACKtive probes
+	Probes				[]probe_response
+	Middlebox			*middlebox_verdict
+}
+
+func ( ps *packet_state ) probes() *probe_state {
+	e := ps.extra()
+	if e.HAF == nil {
+		e.HAF = &probe_state{}
+	}
+	return e.HAF
+}
+
+type middlebox_evidence struct {
+	ProbePorts			[]int		`json:"probe_ports"`
+	ProbesAnswered		int			`json:"probes_answered"`
+	SameWindow			bool		`json:"same_window"`
+	SameTTL				bool		`json:"same_ttl"`
+	SameOptions			bool		`json:"same_options"`
+	CannedPayload		bool		`json:"canned_payload"`
+	ZeroWindowOnly		bool		`json:"zero_window_only"`
+}
+
+type middlebox_verdict struct {
+	Classification		string				`json:"classification"`
+	Cached				bool				`json:"cached,omitempty"`
+	Evidence			middlebox_evidence	`json:"evidence"`
+}
+
+func ( v *middlebox_verdict ) ackingFirewall() bool {
+	return v != nil && ( v.Classification == MIDDLEBOX_ACKING_FIREWALL ||
+		v.Classification == MIDDLEBOX_TARPIT )
+}
+
+// compact signature of the options in a SYN-ACK, without per-connection values
+func tcpOptionsSignature( opts []layers.TCPOption ) string {
+
+	sig := make( []string, 0, len(opts) )
+	for _, o := range opts {
+		switch o.OptionType {
+		case layers.TCPOptionKindMSS:
+			if len(o.OptionData) == 2 {
+				sig = append( sig, "mss:" + strconv.Itoa( int(binary.BigEndian.Uint16( o.OptionData )) ) )
+				continue
+			}
+		case layers.TCPOptionKindWindowScale:
+			if len(o.OptionData) == 1 {
+				sig = append( sig, "ws:" + strconv.Itoa( int(o.OptionData[0]) ) )
+				continue
+			}
+		}
+		sig = append( sig, strconv.Itoa( int(o.OptionType) ) )
+	}
+	return strings.Join( sig, "," )
+}
+
+/* random, non-adjacent ports to probe next to the real one, skipping
+ * ports of the host already in flight (a real target or another probe).
+ * can return fewer than n when the draws keep landing on those.
+ */
+func probePorts( ipMeta * pState, packet *packet_metadata, n int ) []int {
+
+	ports := make( []int, 0, n )
+	near := func( a int, b int ) bool {
+		d := a - b
+		return d > -PROBE_PORT_SPACING && d < PROBE_PORT_SPACING
+	}
+	for tries := 0; len(ports) < n && tries < n * PROBE_PORT_TRIES; tries++ {
+		p := 1024 + rand.Intn( 65535 - 1024 )
+		ok := !near( p, packet.Sport )
+		for _, o := range ports {
+			ok = ok && !near( p, o )
+		}
+		if ok && !ipMeta.Has( constructParentKey( packet, p ) ) {
+			ports = append( ports, p )
+		}
+	}
+	return ports
+}
+
+func responseFrom( packet *packet_metadata ) probe_response {
+	return probe_response{
+		Sport: packet.Sport,
+		SynAck: packet.SYN && packet.ACK,
+		Window: packet.Window,
+		TTL: packet.TTL,
+		Options: packet.TCPOptions,
+	}
+}
+
+func ( ipMeta * pState ) recordProbesSent( p *packet_metadata, ports []int ) bool {
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		probes := make( []probe_response, len(ports) )
+		for i, port := range ports {
+			probes[i].Sport = port
+		}
+		ps.probes().Probes = probes
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+// fewer than -haf when probePorts ran short
+func ( ipMeta * pState ) getProbesSent( p *packet_metadata ) int {
+	if ps, ok := ipMeta.Get( constructKey(p) ); ok && ps.haf() != nil {
+		return len( ps.haf().Probes )
+	}
+	return 0
+}
+
+func ( ipMeta * pState ) setMiddlebox( p *packet_metadata, v *middlebox_verdict ) bool {
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		ps.probes().Middlebox = v
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+// the real port's SYN-ACK, taken for the handshake the probes were sent with
+func ( ipMeta * pState ) recordRealSynAck( p *packet_metadata ) bool {
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		ps.probes().Real = responseFrom( p )
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+func ( ipMeta * pState ) recordRealData( p *packet_metadata ) bool {
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if ok {
+		ps.probes().Real.Data = p.Data
+		ipMeta.Insert( pKey, ps )
+	}
+	return ok
+}
+
+// probes report into the state of the flow they were sent for
+func ( ipMeta * pState ) recordProbe( p *packet_metadata, parentSport int ) bool {
+	pKey := constructParentKey(p, parentSport)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok || ps.haf() == nil {
+		return false
+	}
+	probes := ps.haf().Probes
+	for i := range probes {
+		if probes[i].Sport != p.Sport {
+			continue
+		}
+		if p.SYN && p.ACK {
+			probes[i] = responseFrom( p )
+		} else if p.hasData() {
+			probes[i].Data = p.Data
+		}
+	}
+	ipMeta.Insert( pKey, ps )
+	return true
+}
+
+// anyData is whether the real port ever returned data, for any handshake
+func classifyMiddlebox( real probe_response, probes []probe_response, anyData bool ) *middlebox_verdict {
+
+	ev := middlebox_evidence{
+		ProbePorts: []int{},
+		SameWindow: true,
+		SameTTL: true,
+		SameOptions: true,
+		ZeroWindowOnly: real.SynAck && real.Window == 0,
+	}
+	probeData := false
+	for _, pr := range probes {
+		ev.ProbePorts = append( ev.ProbePorts, pr.Sport )
+		if !pr.SynAck {
+			continue
+		}
+		ev.ProbesAnswered += 1
+		ev.SameWindow = ev.SameWindow && pr.Window == real.Window
+		ev.SameTTL = ev.SameTTL && pr.TTL == real.TTL
+		ev.SameOptions = ev.SameOptions && pr.Options == real.Options
+		ev.ZeroWindowOnly = ev.ZeroWindowOnly && pr.Window == 0
+		if pr.Data != "" {
+			probeData = true
+			if pr.Data == real.Data {
+				ev.CannedPayload = true
+			}
+		}
+	}
+	v := &middlebox_verdict{ Evidence: ev }
+	if ev.ProbesAnswered == 0 {
+		ev.SameWindow, ev.SameTTL, ev.SameOptions, ev.ZeroWindowOnly = false, false, false, false
+		v.Evidence = ev
+		v.Classification = MIDDLEBOX_REAL_SERVICE
+		return v
+	}
+	switch {
+	// accepts everywhere but never lets any data through
+	case ev.ZeroWindowOnly || ( !anyData && !probeData && ev.ProbesAnswered == len(probes) ):
+		v.Classification = MIDDLEBOX_TARPIT
+	// every port serves the same thing
+	case ev.CannedPayload:
+		v.Classification = MIDDLEBOX_ACKING_FIREWALL
+	// the probes were answered by a different stack than the real port
+	case !ev.SameTTL || !ev.SameOptions:
+		v.Classification = MIDDLEBOX_LOAD_BALANCER
+	// the same stack answers for every port
+	case ev.ProbesAnswered == len(probes) && ev.SameWindow:
+		v.Classification = MIDDLEBOX_ACKING_FIREWALL
+	default:
+		v.Classification = MIDDLEBOX_REAL_SERVICE
+	}
+	return v
+}
+
+/* decide (or reuse) the verdict of a flow. once every probe has
+ * answered, or the flow is done, it goes straight into the host cache
+ * so the host's other ports are not probed again.
+ */
+func ( ipMeta * pState ) middleboxVerdict( p *packet_metadata, done bool ) *middlebox_verdict {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok || ps.haf() == nil {
+		return nil
+	}
+	haf := ps.haf()
+	if haf.Middlebox != nil {
+		return haf.Middlebox
+	}
+	if len(haf.Probes) == 0 {
+		return nil
+	}
+	v := classifyMiddlebox( haf.Real, haf.Probes, ps.Data )
+	if done || haf.RespNum > len(haf.Probes) {
+		rememberMiddlebox( p.targetAddr(), v )
+	}
+	return v
+}
+
+// probes are never recorded, they only feed their parent's evidence
+func handleProbe( opts *options, packet *packet_metadata, ipMeta * pState, timeoutQueue chan *packet_metadata,
+	retransmitQueue chan *packet_metadata, writingQueue chan *packet_metadata ) {
+
+	parentSport := ipMeta.getParentSport( packet )
+
+	if packet.hasData() {
+		ipMeta.recordProbe( packet, parentSport )
+		closeConnection( packet, ipMeta, writingQueue, false, true )
+		return
+	}
+	if packet.RST || packet.FIN {
+		closeConnection( packet, ipMeta, writingQueue, false, true )
+		return
+	}
+	if packet.SYN && packet.ACK {
+		ipMeta.incEphemeralResp( packet, parentSport )
+		ipMeta.recordProbe( packet, parentSport )
+		if packet.windowZero() {
+			closeConnection( packet, ipMeta, writingQueue, false, true )
+			return
+		}
+		// send the same handshake data to catch canned payloads
+		SendAck( opts, packet, ipMeta, timeoutQueue, retransmitQueue, writingQueue,
+			true, false, ACK )
+		return
+	}
+	if packet.ACK {
+		packet.updateResponse(DATA)
+		packet.updateTimestamp()
+		ipMeta.update(packet)
+		timeoutQueue <-packet
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"testing"
+)
+
+func TestProbePortsSkipInFlight( t *testing.T ) {
+
+	saved := PROBE_PORT_SPACING
+	PROBE_PORT_SPACING = 1
+	t.Cleanup( func() { PROBE_PORT_SPACING = saved } )
+
+	ipMeta := NewpState()
+	real := &packet_metadata{ Saddr: "192.0.2.1", Sport: 443 }
+	for port := 1024; port < 65535; port++ {
+		if port != 40000 {
+			ipMeta.Insert( newFlowKey( real.Saddr, port ), &packet_state{} )
+		}
+	}
+	// only one port is free, the draws give up instead of spinning
+	ports := probePorts( &ipMeta, real, 2 )
+	for _, port := range ports {
+		if port != 40000 {
+			t.Fatalf( "probed port %d, already in flight", port )
+		}
+	}
+	if len(ports) > 1 {
+		t.Fatalf( "probed %v", ports )
+	}
+}
+
+func TestMiddleboxVerdictCachedForHost( t *testing.T ) {
+
+	testHostPolicy( t, 2, 1000, 0 )
+	ipMeta := NewpState()
+	real := &packet_metadata{ Sport: 443, Window: 1024, TTL: 60, SYN: true, ACK: true }
+	real.setTarget( "192.0.2.4" )
+	ipMeta.Insert( constructKey( real ), &packet_state{ Flow: flowRecordOf( real ) } )
+	ipMeta.recordRealSynAck( real )
+	ipMeta.recordProbesSent( real, []int{ 20000, 30000 } )
+	for _, port := range []int{ 20000, 30000 } {
+		probe := *real
+		probe.Sport = port
+		ipMeta.recordProbe( &probe, real.Sport )
+	}
+
+	//the probes answered like the real port, but not all are counted in yet
+	if v := ipMeta.middleboxVerdict( real, false ); v == nil || !v.ackingFirewall() {
+		t.Fatalf( "verdict %+v", v )
+	}
+	if _, ok := cachedMiddlebox( real.targetAddr() ); ok {
+		t.Fatal( "cached a verdict before every probe answered" )
+	}
+	for i := 0; i < 3; i++ {
+		ipMeta.incEphemeralResp( real, real.Sport )
+	}
+	ipMeta.middleboxVerdict( real, false )
+	if v, ok := cachedMiddlebox( real.targetAddr() ); !ok || !v.Cached || !v.ackingFirewall() {
+		t.Fatalf( "host verdict %+v", v )
+	}
+}
@@ -19,9 +19,9 @@ import (
 	"encoding/json"
 	"log"
 	"os"
-	"bufio"
 	"time"
 	"fmt"
+	"strings"
 )
 
 var (
@@ -30,7 +30,8 @@ var (
 
 type output_file struct {
 
-	F	 *bufio.Writer
+	Sinks	[]OutputSink
+	Hosts	*file_writer
 }
 
 type summary struct {
@@ -44,11 +45,22 @@ type summary struct {
 	Fin				int
 	Resp_ack		int
 	HyperACKtive	int
+	ICMP			map[string]int	`json:",omitempty"`
+	WriteErrors		int
+	Hosts			int
+	Middlebox		map[string]int	`json:",omitempty"`
+	Timings			map[string]map[string]float64	`json:",omitempty"`
+	FlowsHighWater	int64
+	HeapHighWaterMB	uint64
+	InputDropped	int64
+	InputBlocked	float64		//seconds
+	SessionsRefused	int64
 }
 
 
 func Summarize( t time.Duration ) {
 	fmt.Fprintln(os.Stderr, "Runtime:", t)
+	finalizeSummary()
 	out, _ := json.Marshal( summaryLZR )
 	fmt.Fprintln(os.Stderr, string(out))
 	//print out fingerprints
@@ -57,9 +69,24 @@ func Summarize( t time.Duration ) {
 	}
 }
 
+// fill in the parts of the summary that are computed at the end
+func finalizeSummary() {
+	summaryLZR.Timings = timingPercentiles()
+	summaryLZR.Hosts = countHosts()
+	flowLimits.summarize( summaryLZR )
+	sessions.summarize( summaryLZR )
+}
+
 func addToSummary( packet *packet_metadata ) {
 
 	summaryLZR.TotalResponses  += 1
+	addTimingToSummary( packet.Timing )
+	if packet.Middlebox != nil {
+		if summaryLZR.Middlebox == nil {
+			summaryLZR.Middlebox = make( map[string]int )
+		}
+		summaryLZR.Middlebox[ packet.Middlebox.Classification ] += 1
+	}
 
 	if packet.HyperACKtive {
 		summaryLZR.HyperACKtive +=1
@@ -83,6 +110,12 @@ func addToSummary( packet *packet_metadata ) {
 	if packet.Data != "" {
 		summaryLZR.Data += 1
 	}
+	if packet.ICMPError != "" {
+		if summaryLZR.ICMP == nil {
+			summaryLZR.ICMP = make( map[string]int )
+		}
+		summaryLZR.ICMP[ packet.ICMPError ] += 1
+	}
 	if  !packet.SYN	&& packet.ACK {
 		summaryLZR.Resp_ack += 1
 	}
@@ -90,7 +123,12 @@ func addToSummary( packet *packet_metadata ) {
 
 func ( f *output_file ) Record( packet *packet_metadata, handshakes []string ) {
 
-	packet.fingerprintData()
+	if Aggregate() && len(packet.Attempts) > 0 {
+		packet.Fingerprint, packet.FingerprintCandidates = reconcileFingerprints( packet.Attempts )
+		fingerprintMap[packet.Fingerprint] += 1
+	} else {
+		packet.fingerprintData()
+	}
 
 	if FeedZGrab() {
 		if packet.Fingerprint != "" {
@@ -100,41 +138,76 @@ func ( f *output_file ) Record( packet *packet_metadata, handshakes []string ) {
 
 	addToSummary( packet )
 
-	out, _ := json.Marshal( packet )
-	_,err := (f.F).WriteString( string(out) )
-	if err != nil {
-		f.F.Flush()
-		panic(err)
-		log.Fatal(err)
-	}
-	_,err = (f.F).WriteString( "\n" )
-	if err != nil {
-		f.F.Flush()
-		panic(err)
-		log.Fatal(err)
+	record := newResultRecord( packet, handshakes )
+	for _, sink := range f.Sinks {
+		if err := sink.Write( record ); err != nil {
+			summaryLZR.WriteErrors += 1
+			fmt.Fprintln(os.Stderr, "--Error writing result:", err)
+		}
 	}
 	return
 }
 
+func ( f *output_file ) Flush() {
+
+	for _, sink := range f.Sinks {
+		if err := sink.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "--Error flushing output:", err)
+		}
+	}
+}
 
-func InitFile( fname string ) *output_file {
+func ( f *output_file ) Close() {
 
-	var f *os.File
-	if fname == "-" {
-		f = os.Stdout
-	} else {
-		file, err := os.OpenFile( fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777 )
+	for _, sink := range f.Sinks {
+		if err := sink.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "--Error closing output:", err)
+		}
+	}
+	if f.Hosts != nil {
+		hostRecords.Lock()
+		hostRecords.fw = nil
+		hostRecords.Unlock()
+		if err := writeHostRecords( f.Hosts ); err != nil {
+			fmt.Fprintln(os.Stderr, "--Error writing host summary:", err)
+		}
+		if err := f.Hosts.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "--Error closing host summary:", err)
+		}
+	}
+}
+
+
+func InitFile( opts *options ) *output_file {
+
+	o := &output_file{}
+
+	// -f is always written as json, -outputs adds to it
+	specs := append( []string{ "json:" + opts.Filename }, opts.Outputs... )
+	stdout := 0
+	for _, spec := range specs {
+		if strings.HasSuffix( spec, ":-" ) {
+			stdout += 1
+		}
+	}
+	if stdout > 1 {
+		log.Fatal("only one output sink can write to standard output")
+	}
+	for _, spec := range specs {
+		sink, err := newOutputSink( opts, spec )
 		if err != nil {
-			panic(err)
 			log.Fatal(err)
 		}
-		f = file
+		o.Sinks = append( o.Sinks, sink )
 	}
-
-	o := &output_file{
-		F: bufio.NewWriter(f),
+	if opts.HostSummary != "" {
+		fw, err := newFileWriter( opts.HostSummary, compressionFor( opts.Compress, opts.HostSummary ), 0, 0, nil )
+		if err != nil {
+			log.Fatal(err)
+		}
+		o.Hosts = fw
+		hostRecords.fw = fw
 	}
 
 	return o
 }
-
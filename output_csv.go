@@ -0,0 +1,96 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csv with a header row and a user selected set of columns
+type csv_sink struct {
+	fw			*file_writer
+	fields		[]*result_field
+}
+
+// keep binary payloads on one printable line
+func csvEscape( data string ) string {
+	q := strconv.Quote( data )
+	return q[1:len(q)-1]
+}
+
+func csvValue( v interface{} ) string {
+
+	switch t := v.(type) {
+	case string:
+		return csvEscape( t )
+	case time.Time:
+		return t.Format( time.RFC3339Nano )
+	case int, uint8, bool:
+		return fmt.Sprint( t )
+	}
+	// nested values are kept as json
+	out, _ := json.Marshal( v )
+	return string(out)
+}
+
+func newCSVSink( path string, fields []*result_field, rotateMB int, rotateSec int ) ( *csv_sink, error ) {
+
+	names := make( []string, len(fields) )
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	// every rotated file gets its own header
+	header := func( w io.Writer ) error {
+		cw := csv.NewWriter( w )
+		cw.Write( names )
+		cw.Flush()
+		return cw.Error()
+	}
+	fw, err := newFileWriter( path, compressionFor( "", path ), rotateMB, rotateSec, header )
+	if err != nil {
+		return nil, err
+	}
+	return &csv_sink{ fw: fw, fields: fields }, nil
+}
+
+func ( s *csv_sink ) Write( record *result_record ) error {
+
+	row := make( []string, len(s.fields) )
+	for i, f := range s.fields {
+		row[i] = csvValue( f.Get( record ) )
+	}
+	w, err := s.fw.Writer()
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter( w )
+	cw.Write( row )
+	cw.Flush()
+	return cw.Error()
+}
+
+func ( s *csv_sink ) Flush() error {
+	return s.fw.Flush()
+}
+
+func ( s *csv_sink ) Close() error {
+	return s.fw.Close()
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+// newline-delimited json, optionally compressed
+type json_sink struct {
+	fw			*file_writer
+	fields		[]*result_field
+}
+
+func newJSONSink( path string, fields []*result_field, compress string, rotateMB int, rotateSec int ) ( *json_sink, error ) {
+
+	// every json record carries its schema version
+	if fields[0].Name != "schema_version" {
+		version, _ := getResultField( "schema_version" )
+		fields = append( []*result_field{ version }, fields... )
+	}
+	fw, err := newFileWriter( path, compress, rotateMB, rotateSec, nil )
+	if err != nil {
+		return nil, err
+	}
+	return &json_sink{ fw: fw, fields: fields }, nil
+}
+
+func ( s *json_sink ) Write( record *result_record ) error {
+
+	out, err := record.marshalFields( s.fields )
+	if err != nil {
+		return err
+	}
+	w, err := s.fw.Writer()
+	if err != nil {
+		return err
+	}
+	out = append( out, '\n' )
+	_, err = w.Write( out )
+	return err
+}
+
+func ( s *json_sink ) Flush() error {
+	return s.fw.Flush()
+}
+
+func ( s *json_sink ) Close() error {
+	return s.fw.Close()
+}
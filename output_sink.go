@@ -0,0 +1,272 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	COMPRESS_NONE	string = "none"
+	COMPRESS_GZIP	string = "gzip"
+	COMPRESS_ZSTD	string = "zstd"
+)
+
+// OutputSink is a destination for result records.
+// Several sinks can be attached to the same scan.
+type OutputSink interface {
+	Write( record *result_record ) error
+	Flush() error
+	Close() error
+}
+
+// parse a single type:path sink description
+func newOutputSink( opts *options, spec string ) ( OutputSink, error ) {
+
+	s := strings.SplitN( spec, ":", 2 )
+	if len(s) != 2 || s[1] == "" {
+		return nil, fmt.Errorf("bad output sink %q, expecting type:path", spec)
+	}
+	stype, path := s[0], s[1]
+
+	fields, err := parseResultFields( opts.OutputFields )
+	if err != nil {
+		return nil, err
+	}
+
+	switch stype {
+	case "json":
+		return newJSONSink( path, fields, compressionFor( opts.Compress, path ), opts.RotateSize, opts.RotateInterval )
+	case "csv":
+		if opts.CSVFields != "" {
+			if fields, err = parseResultFields( opts.CSVFields ); err != nil {
+				return nil, err
+			}
+		}
+		return newCSVSink( path, fields, opts.RotateSize, opts.RotateInterval )
+	case "sqlite":
+		return newSQLiteSink( path, fields, false )
+	case "sqlite-summary":
+		return newSQLiteSink( path, fields, true )
+	case "zgrab2":
+		return newZGrab2Sink( path )
+	}
+	return nil, fmt.Errorf("unknown output sink type %q", stype)
+}
+
+// an explicit -compress wins, otherwise go by the file extension
+func compressionFor( compress string, path string ) string {
+
+	if compress != "" {
+		return compress
+	}
+	if strings.HasSuffix( path, ".gz" ) {
+		return COMPRESS_GZIP
+	}
+	if strings.HasSuffix( path, ".zst" ) {
+		return COMPRESS_ZSTD
+	}
+	return COMPRESS_NONE
+}
+
+/* file_writer handles the parts shared by every file sink:
+ * opening, compressing, buffering and rotating.
+ * path "-" writes to stdout and never rotates.
+ */
+type file_writer struct {
+
+	path			string
+	compress		string
+	rotateBytes		int64
+	rotateEvery		time.Duration
+	onOpen			func( w io.Writer ) error
+
+	file			*os.File
+	zstd			*exec.Cmd
+	encoder			io.WriteCloser
+	buf				*bufio.Writer
+	written			int64
+	opened			time.Time
+}
+
+func newFileWriter( path string, compress string, rotateMB int, rotateSec int,
+	onOpen func( w io.Writer ) error ) ( *file_writer, error ) {
+
+	switch compress {
+	case COMPRESS_NONE, COMPRESS_GZIP, COMPRESS_ZSTD:
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compress)
+	}
+	// checked before any file is created, rather than when the first one is
+	if compress == COMPRESS_ZSTD {
+		if _, err := exec.LookPath( "zstd" ); err != nil {
+			return nil, fmt.Errorf("zstd compression needs the zstd tool: %v", err)
+		}
+	}
+
+	fw := &file_writer{
+		path: path,
+		compress: compress,
+		rotateBytes: int64(rotateMB) * 1024 * 1024,
+		rotateEvery: time.Duration(rotateSec) * time.Second,
+		onOpen: onOpen,
+	}
+	if path == "-" {
+		fw.rotateBytes = 0
+		fw.rotateEvery = 0
+	}
+	if err := fw.open(); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// name of the file to open next, timestamped when rotating
+func ( fw *file_writer ) nextName() string {
+
+	if fw.rotateBytes == 0 && fw.rotateEvery == 0 {
+		return fw.path
+	}
+	ext := ""
+	base := fw.path
+	for _, e := range []string{ ".gz", ".zst" } {
+		if strings.HasSuffix( base, e ) {
+			ext = e + ext
+			base = strings.TrimSuffix( base, e )
+		}
+	}
+	ext = filepath.Ext( base ) + ext
+	base = strings.TrimSuffix( base, filepath.Ext( base ) )
+
+	stamp := time.Now().Format("20060102150405")
+	name := base + "." + stamp + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat( name ); os.IsNotExist( err ) {
+			return name
+		}
+		name = fmt.Sprintf( "%s.%s-%d%s", base, stamp, i, ext )
+	}
+}
+
+func ( fw *file_writer ) open() error {
+
+	var out io.Writer
+	if fw.path == "-" {
+		fw.file = os.Stdout
+	} else {
+		file, err := os.OpenFile( fw.nextName(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644 )
+		if err != nil {
+			return err
+		}
+		fw.file = file
+	}
+	out = fw.file
+
+	switch fw.compress {
+	case COMPRESS_GZIP:
+		fw.encoder = gzip.NewWriter( fw.file )
+		out = fw.encoder
+	case COMPRESS_ZSTD:
+		// no zstd encoder in the standard library, stream through the zstd tool
+		fw.zstd = exec.Command( "zstd", "-q", "-c" )
+		fw.zstd.Stdout = fw.file
+		fw.zstd.Stderr = os.Stderr
+		stdin, err := fw.zstd.StdinPipe()
+		if err != nil {
+			return err
+		}
+		if err := fw.zstd.Start(); err != nil {
+			return fmt.Errorf("starting zstd: %v", err)
+		}
+		fw.encoder = stdin
+		out = stdin
+	}
+
+	fw.buf = bufio.NewWriter( out )
+	fw.written = 0
+	fw.opened = time.Now()
+	if fw.onOpen != nil {
+		return fw.onOpen( fw.buf )
+	}
+	return nil
+}
+
+func ( fw *file_writer ) needsRotation() bool {
+
+	if fw.rotateBytes > 0 && fw.written >= fw.rotateBytes {
+		return true
+	}
+	if fw.rotateEvery > 0 && time.Since( fw.opened ) >= fw.rotateEvery {
+		return true
+	}
+	return false
+}
+
+// Writer returns the buffered writer to use for the next record,
+// rotating the underlying file first if it is due
+func ( fw *file_writer ) Writer() ( io.Writer, error ) {
+
+	if fw.needsRotation() {
+		if err := fw.Close(); err != nil {
+			return nil, err
+		}
+		if err := fw.open(); err != nil {
+			return nil, err
+		}
+	}
+	return fw, nil
+}
+
+func ( fw *file_writer ) Write( p []byte ) ( int, error ) {
+	n, err := fw.buf.Write( p )
+	fw.written += int64(n)
+	return n, err
+}
+
+func ( fw *file_writer ) Flush() error {
+	return fw.buf.Flush()
+}
+
+func ( fw *file_writer ) Close() error {
+
+	if err := fw.buf.Flush(); err != nil {
+		return err
+	}
+	if fw.encoder != nil {
+		if err := fw.encoder.Close(); err != nil {
+			return err
+		}
+		fw.encoder = nil
+	}
+	if fw.zstd != nil {
+		if err := fw.zstd.Wait(); err != nil {
+			return fmt.Errorf("zstd: %v", err)
+		}
+		fw.zstd = nil
+	}
+	if fw.file == os.Stdout {
+		return nil
+	}
+	return fw.file.Close()
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var (
+	SQLITE_BATCH int = 1000
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS results (
+	schema_version TEXT, saddr TEXT, daddr TEXT, sport INTEGER, dport INTEGER,
+	fingerprint TEXT, handshake TEXT, outcome TEXT, window INTEGER, ttl INTEGER,
+	acked INTEGER, acking_firewall INTEGER, data BLOB, timestamp TEXT, record TEXT
+);
+CREATE INDEX IF NOT EXISTS results_saddr ON results(saddr);
+CREATE INDEX IF NOT EXISTS results_sport ON results(sport);
+CREATE INDEX IF NOT EXISTS results_fingerprint ON results(fingerprint);
+CREATE TABLE IF NOT EXISTS summary ( name TEXT PRIMARY KEY, value );
+CREATE TABLE IF NOT EXISTS fingerprints ( fingerprint TEXT PRIMARY KEY, count INTEGER );
+`
+
+const sqliteInsert = `INSERT INTO results VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+/* sqlite_sink writes a results table (unless summaryOnly) and, when the
+ * scan finishes, the summary and fingerprint counts. results are
+ * inserted SQLITE_BATCH to a transaction, through a prepared statement.
+ */
+type sqlite_sink struct {
+	db				*sql.DB
+	tx				*sql.Tx
+	insert			*sql.Stmt
+	fields			[]*result_field
+	summaryOnly		bool
+	pending			int
+}
+
+func newSQLiteSink( path string, fields []*result_field, summaryOnly bool ) ( *sqlite_sink, error ) {
+
+	db, err := sql.Open( "sqlite3", path )
+	if err != nil {
+		return nil, err
+	}
+	// one connection, so every transaction sees the same database
+	db.SetMaxOpenConns( 1 )
+	if _, err := db.Exec( sqliteSchema ); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating sqlite tables: %v", err)
+	}
+	return &sqlite_sink{
+		db: db,
+		fields: fields,
+		summaryOnly: summaryOnly,
+	}, nil
+}
+
+func ( s *sqlite_sink ) Write( record *result_record ) error {
+
+	if s.summaryOnly {
+		return nil
+	}
+	// the full selected record is kept alongside the indexed columns
+	out, err := record.marshalFields( s.fields )
+	if err != nil {
+		return err
+	}
+	if s.tx == nil {
+		if s.tx, err = s.db.Begin(); err != nil {
+			return err
+		}
+		if s.insert, err = s.tx.Prepare( sqliteInsert ); err != nil {
+			return err
+		}
+	}
+	// data can hold arbitrary bytes so it goes in as a blob
+	_, err = s.insert.Exec(
+		record.SchemaVersion, record.Saddr, record.Daddr, record.Sport, record.Dport,
+		record.Fingerprint, record.Handshake, record.Outcome, record.Window, record.TTL,
+		record.ACKed, record.AckingFirewall, []byte(record.Data),
+		record.Timestamp.Format( time.RFC3339Nano ), string(out) )
+	if err != nil {
+		return err
+	}
+	s.pending += 1
+	if s.pending >= SQLITE_BATCH {
+		return s.Flush()
+	}
+	return nil
+}
+
+func ( s *sqlite_sink ) Flush() error {
+
+	if s.tx == nil {
+		return nil
+	}
+	tx := s.tx
+	s.tx, s.insert, s.pending = nil, nil, 0
+	return tx.Commit()
+}
+
+// a summary value as sqlite should store it: numbers as numbers, the rest as JSON text
+func summaryValue( raw json.RawMessage ) interface{} {
+
+	var n json.Number
+	if json.Unmarshal( raw, &n ) != nil {
+		return string(raw)
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	if f, err := n.Float64(); err == nil {
+		return f
+	}
+	return string(raw)
+}
+
+func ( s *sqlite_sink ) writeSummary() error {
+
+	finalizeSummary()
+	out, err := json.Marshal( summaryLZR )
+	if err != nil {
+		return err
+	}
+	counts := make( map[string]json.RawMessage )
+	if err := json.Unmarshal( out, &counts ); err != nil {
+		return err
+	}
+	names := make( []string, 0, len(counts) )
+	for name := range counts {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.Exec( "INSERT OR REPLACE INTO summary VALUES (?,?)", name, summaryValue( counts[name] ) ); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	fingerprints := GetFingerprints()
+	for _, fp := range sortedKeys( fingerprints ) {
+		if _, err := tx.Exec( "INSERT OR REPLACE INTO fingerprints VALUES (?,?)", fp, fingerprints[fp] ); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func ( s *sqlite_sink ) Close() error {
+
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	if err := s.writeSummary(); err != nil {
+		return err
+	}
+	return s.db.Close()
+}
+
+func sortedKeys( m map[string]int ) []string {
+	keys := make( []string, 0, len(m) )
+	for k := range m {
+		keys = append( keys, k )
+	}
+	sort.Strings( keys )
+	return keys
+}
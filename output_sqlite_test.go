@@ -0,0 +1,65 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteSinkStoresRawValues( t *testing.T ) {
+
+	path := filepath.Join( t.TempDir(), "results.db" )
+	s, err := newSQLiteSink( path, resultFields, false )
+	if err != nil {
+		t.Fatal( err )
+	}
+	// quotes and bytes that are not text go in as they are
+	record := &result_record{
+		Saddr: "192.0.2.1",
+		Sport: 80,
+		Fingerprint: "it's',--",
+		Data: "\x00\xffHTTP/1.1 200 OK\r\n",
+		Timestamp: time.Unix( 0, 0 ),
+	}
+	if err := s.Write( record ); err != nil {
+		t.Fatal( err )
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal( err )
+	}
+
+	db, err := sql.Open( "sqlite3", path )
+	if err != nil {
+		t.Fatal( err )
+	}
+	defer db.Close()
+	var fingerprint string
+	var data []byte
+	if err := db.QueryRow( "SELECT fingerprint, data FROM results WHERE saddr = ?", "192.0.2.1" ).
+		Scan( &fingerprint, &data ); err != nil {
+		t.Fatal( err )
+	}
+	if fingerprint != record.Fingerprint || string(data) != record.Data {
+		t.Fatalf( "got %q %q", fingerprint, data )
+	}
+	var count int
+	if err := db.QueryRow( "SELECT count(*) FROM summary" ).Scan( &count ); err != nil || count == 0 {
+		t.Fatalf( "summary rows: %d, %v", count, err )
+	}
+}
@@ -16,7 +16,6 @@ limitations under the License.
 package lzr
 
 import (
-	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"time"
 	"encoding/json"
@@ -24,6 +23,8 @@ import (
 	"math"
 	"strings"
 	"strconv"
+	"net"
+	"net/netip"
 	//"fmt"
 	//"os"
 )
@@ -36,21 +37,97 @@ var (
 
 )
 
+/* packet_state is a flow's entry in the state map. it is fixed size,
+ * what grows with what the flow does hangs off Extra.
+ */
 type packet_state struct {
 	HandshakeNum		int
 	Ack					bool
 	Data				bool
 	HyperACKtive		bool
-	EphemeralFilters	[]packet_metadata
-	EphemeralRespNum	int
-	ParentSport			int			//used for filter packets
-	Packet				*packet_metadata
+	PayloadL			int			//data sent in the current handshake
+	Timing				flow_timing
+	Flow				flow_record
+	Extra				*flow_extra	//nil until the flow needs one
+}
+
+/* flow_extra holds what not every flow has: the handshakes it is done
+ * with, a response coming in over several segments, -haf probes and
+ * its host's entry in the host cache.
+ */
+type flow_extra struct {
+	Attempts			[]handshake_attempt
+	Response			[]byte		//collected so far for a StreamingHandshake
+	HAF					*probe_state		//nil unless the flow sent or is a -haf probe
+	Host				*host_knowledge		//nil for probes or when no host policy is on
+}
+
+// the flow's extra state, allocated on first use
+func ( ps *packet_state ) extra() *flow_extra {
+	if ps.Extra == nil {
+		ps.Extra = &flow_extra{}
+	}
+	return ps.Extra
+}
+
+func ( ps *packet_state ) attempts() []handshake_attempt {
+	if ps.Extra == nil {
+		return nil
+	}
+	return ps.Extra.Attempts
+}
+
+func ( ps *packet_state ) haf() *probe_state {
+	if ps.Extra == nil {
+		return nil
+	}
+	return ps.Extra.HAF
+}
+
+/* flow_record is what the state map keeps of the last packet sent
+ * or received on a flow: fixed size and free of strings and pointers,
+ * so what a flow in flight costs is known up front. the target's
+ * address and port are the map key and not repeated here.
+ */
+type flow_record struct {
+	Daddr				[16]byte	//our address, As16
+	Seqnum				uint32
+	Acknum				uint32
+	LZRResponseL		uint32
+	Dport				uint16
+	Expected			uint8
+	UDP					bool
+	Processing			bool
+}
+
+// ExpectedRToLZR values, indexed by flow_record.Expected
+var expectedCodes = []*string{ nil, &ACK, &SYN_ACK, &DATA }
+
+func expectedCode( expected string ) uint8 {
+	for i, e := range expectedCodes {
+		if e != nil && *e == expected {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+func flowRecordOf( p *packet_metadata ) flow_record {
+	return flow_record{
+		Daddr: p.localAddr().As16(),
+		Seqnum: uint32(p.Seqnum),
+		Acknum: uint32(p.Acknum),
+		LZRResponseL: uint32(p.LZRResponseL),
+		Dport: uint16(p.Dport),
+		Expected: expectedCode( p.ExpectedRToLZR ),
+		UDP: p.isUDP(),
+		Processing: p.Processing,
+	}
 }
 
 type packet_metadata struct {
 
 	Smac				string		`json:"-"`
-	Dmac				string		`json:"-"`
 	Saddr				string		`json:"saddr"`
 	Daddr				string		`json:"daddr"`
 	Sport				int			`json:"sport"`
@@ -59,6 +136,7 @@ type packet_metadata struct {
 	Acknum				int			`json:"acknum"`
 	Window				int			`json:"window"`
 	TTL					uint8		`json:"ttl"`
+	TCPOptions			string		`json:"-"`
 	Counter				int
 
 	ACK					bool
@@ -77,29 +155,90 @@ type packet_metadata struct {
 	Data				string		`json:"data,omitempty"`
 	Processing			bool		`json:"-"`
 	HyperACKtive		bool		`json:"ackingFirewall,omitempty"`
+	Attempts			[]handshake_attempt	`json:"-"`
+	FingerprintCandidates	[]string	`json:"-"`
+	RecvTime			time.Time	`json:"-"`
+	Timing				*timing_record	`json:"-"`
+	Middlebox			*middlebox_verdict	`json:"-"`
+	Transport			string		`json:"-"`
+	ICMPError			string		`json:"-"`
+	ICMPFrom			string		`json:"-"`
+	ICMPSeq				uint32		`json:"-"`	//of the quoted segment we sent
+	Session				*SessionResult	`json:"-"`
+
+	//Saddr and Daddr as decoded, so the state map key needs no parsing
+	saddr				netip.Addr
+	daddr				netip.Addr
+}
+
+func binaryAddr( ip net.IP ) netip.Addr {
+	addr, _ := netip.AddrFromSlice( ip )
+	return addr.Unmap()
+}
+
+// set where Saddr is, before the packet is shared
+func ( packet *packet_metadata ) setTarget( saddr string ) {
+	packet.Saddr = saddr
+	packet.saddr, _ = netip.ParseAddr( saddr )
+	packet.saddr = packet.saddr.Unmap()
+}
+
+// our side of the flow, as the source pool hands it out
+func ( packet *packet_metadata ) setSource( daddr string, local flow_key ) {
+	packet.Daddr, packet.daddr, packet.Dport = daddr, local.addr, int(local.port)
+}
+
+func ( packet *packet_metadata ) localAddr() netip.Addr {
+	if packet.daddr.IsValid() {
+		return packet.daddr
+	}
+	addr, _ := netip.ParseAddr( packet.Daddr )
+	return addr.Unmap()
+}
+
+func ( packet *packet_metadata ) targetAddr() netip.Addr {
+	if packet.saddr.IsValid() {
+		return packet.saddr
+	}
+	addr, _ := netip.ParseAddr( packet.Saddr )
+	return addr.Unmap()
+}
+
+/* decoding leaves Saddr and Daddr empty, most captured packets are
+ * not ours. they are written out once a packet turns out to be.
+ */
+func ( packet *packet_metadata ) formatAddrs() {
+	if packet.Saddr == "" && packet.saddr.IsValid() {
+		packet.Saddr = packet.saddr.String()
+	}
+	if packet.Daddr == "" && packet.daddr.IsValid() {
+		packet.Daddr = packet.daddr.String()
+	}
 }
 
 
 func ReadLayers( ip *layers.IPv4, tcp *layers.TCP, eth *layers.Ethernet ) *packet_metadata {
 
+	now := time.Now()
 	packet := &packet_metadata{
-		Smac: eth.SrcMAC.String(),
-		Dmac: eth.DstMAC.String(),
-		Saddr: ip.SrcIP.String(),
-		Daddr: ip.DstIP.String(),
+		Smac: learnMac( eth ),
+		saddr: binaryAddr( ip.SrcIP ),
+		daddr: binaryAddr( ip.DstIP ),
 		TTL: ip.TTL,
 		Sport: int(tcp.SrcPort),
 		Dport: int(tcp.DstPort),
 		Seqnum: int(tcp.Seq),
 		Acknum: int(tcp.Ack),
 		Window: int(tcp.Window),
+		TCPOptions: tcpOptionsSignature( tcp.Options ),
 		ACK: tcp.ACK,
 		SYN: tcp.SYN,
 		RST: tcp.RST,
 		FIN: tcp.FIN,
 		PUSH: tcp.PSH,
 		Data: string(tcp.Payload),
-		Timestamp: time.Now(),
+		Timestamp: now,
+		RecvTime: now,
 		Counter: 0,
 		Processing: true,
 		HandshakeNum: 0,
@@ -107,24 +246,25 @@ func ReadLayers( ip *layers.IPv4, tcp *layers.TCP, eth *layers.Ethernet ) *packe
 	return packet
 }
 
-func convertToPacketM( packet *gopacket.Packet ) *packet_metadata {
+func ReadUDPLayers( ip *layers.IPv4, udp *layers.UDP, eth *layers.Ethernet ) *packet_metadata {
 
-	tcpLayer := (*packet).Layer(layers.LayerTypeTCP)
-	if tcpLayer != nil {
-		tcp, _ := tcpLayer.(*layers.TCP)
-		ipLayer := (*packet).Layer(layers.LayerTypeIPv4)
-		if ipLayer != nil {
-			ip, _ := ipLayer.(*layers.IPv4)
-
-			ethLayer := (*packet).Layer(layers.LayerTypeEthernet)
-			if ethLayer != nil {
-				eth, _ := ethLayer.(*layers.Ethernet)
-				metapacket := ReadLayers(ip,tcp,eth)
-				return metapacket
-			}
-		}
+	now := time.Now()
+	packet := &packet_metadata{
+		Smac: learnMac( eth ),
+		saddr: binaryAddr( ip.SrcIP ),
+		daddr: binaryAddr( ip.DstIP ),
+		TTL: ip.TTL,
+		Sport: int(udp.SrcPort),
+		Dport: int(udp.DstPort),
+		Data: string(udp.Payload),
+		Transport: TRANSPORT_UDP,
+		Timestamp: now,
+		RecvTime: now,
+		Counter: 0,
+		Processing: true,
+		HandshakeNum: 0,
 	}
-	return nil
+	return packet
 }
 
 func convertFromZMapToPacket( input string ) *packet_metadata	{
@@ -132,6 +272,8 @@ func convertFromZMapToPacket( input string ) *packet_metadata	{
 	synack := &packet_metadata{}
 	//expecting ip,sequence number, acknumber,windowsize, sport, dport
 	err := json.Unmarshal( []byte(input),synack )
+	synack.setTarget( synack.Saddr )
+	synack.daddr = synack.localAddr()
 	synack.Processing = true
     synack.SYN = true
     synack.ACK = true
@@ -159,7 +301,7 @@ func convertFromInputListToPacket( input string ) *packet_metadata {
 		panic("Wrong input list format")
 		panic("BAD STUFF IS ABOUT TO HAPPEN")
 	}
-	if getHostMacAddr() == "" {
+	if getHostMacAddr() == "" && linkType != LINK_RAW && linkType != LINK_NULL {
 		panic("Gateway Mac Address required")
 	}
 	if getSourceIP() == "" {
@@ -169,10 +311,6 @@ func convertFromInputListToPacket( input string ) *packet_metadata {
 	//note that source and dest are inverted
 	syn := &packet_metadata{
 		Smac: source_mac,
-		Dmac: getHostMacAddr(),
-        Saddr: saddr,
-        Daddr: getSourceIP(),
-		Dport: randInt(32768, 61000, t.UnixNano()),
         Sport: sport,
 		Seqnum: int(math.Mod(float64(t.UnixNano()),65535)),
         Acknum: 0,
@@ -184,6 +322,14 @@ func convertFromInputListToPacket( input string ) *packet_metadata {
         HandshakeNum: 0,
         ExpectedRToLZR: SYN_ACK,
     }
+	syn.setTarget( saddr )
+	//waits while every source ip:port is talking to this target
+	allocateSource( syn )
+	if UDPMode() {
+		syn.Transport = TRANSPORT_UDP
+		syn.SYN = false
+		syn.ExpectedRToLZR = DATA
+	}
 
 	return syn
 }
@@ -194,16 +340,16 @@ func randInt(min int, max int, cur int64) int {
 }
 
 //create a packet to filter out nets like canada
-func createFilterPacket( packet *packet_metadata ) *packet_metadata {
+func createFilterPacket( packet *packet_metadata, port int ) *packet_metadata {
 
 	t := time.Now()
 	packetFilter := &packet_metadata{
 		Smac: packet.Smac,
-		Dmac: packet.Dmac,
 		Saddr: packet.Saddr,
+		saddr: packet.saddr,
 		Daddr: packet.Daddr,
-		Dport: int(math.Mod(float64(packet.Dport),65535)+1),
-		Sport: randInt(32768, 61000, t.UnixNano()),
+		daddr: packet.daddr,
+		Sport: port,
 		Seqnum: int(math.Mod(float64(t.UnixNano()),65535)),
 		Acknum: 0,
 		Window: packet.Window,
@@ -215,6 +361,7 @@ func createFilterPacket( packet *packet_metadata ) *packet_metadata {
 		HyperACKtive: true,
 		ExpectedRToLZR: SYN_ACK,
 	}
+	allocateSource( packetFilter )
 	return packetFilter
 
 }
@@ -222,11 +369,9 @@ func createFilterPacket( packet *packet_metadata ) *packet_metadata {
 
 func ( packet * packet_metadata ) updatePacketFlow()  {
 
-	//creating a new sourceport to send from 
-	//and incrementing the handshake we are trying
+	//incrementing the handshake we are trying
+	//(renewSource already moved it to a new source ip:port)
 
-	newsrcprt := math.Mod(float64(packet.Dport),65535)+1
-	packet.Dport = int(newsrcprt)
 	packet.HandshakeNum += 1
 	packet.Counter = 0
 	packet.ExpectedRToLZR = SYN_ACK
@@ -234,6 +379,7 @@ func ( packet * packet_metadata ) updatePacketFlow()  {
 	packet.Acknum = 0
 	packet.Data = ""
 	packet.Fingerprint = ""
+	packet.Session = nil
 	packet.SYN = false
 	packet.ACK = false
 	packet.PUSH = false
@@ -327,9 +473,20 @@ func (packet * packet_metadata) getSourceMac() string {
 
 }
 
+// what the response could be, unless its session already decided
+func (packet * packet_metadata) candidates() []string {
+
+	if packet.Session != nil && packet.Session.Fingerprint != "" {
+		return []string{ packet.Session.Fingerprint }
+	}
+	return matchFingerprints( packet.Data )
+}
+
 func (packet * packet_metadata) fingerprintData() {
 
-	packet.Fingerprint = fingerprintResponse( packet.Data )
+	packet.FingerprintCandidates = packet.candidates()
+	packet.Fingerprint = resolveFingerprint( packet.FingerprintCandidates )
+	fingerprintMap[packet.Fingerprint] += 1
 
 }
 
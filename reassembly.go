@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"log"
+)
+
+/* responses of StreamingHandshakes are collected segment by segment,
+ * in order: a segment that does not follow the last one fails
+ * verification and the host retransmits it once we do not ACK it.
+ */
+
+// most response bytes collected for one handshake
+var MAX_RESPONSE_BYTES = 65536
+
+// frames must not be cut short while collecting responses
+const STREAM_SNAPSHOT_LEN int32 = 65535
+
+func streamingHandshake( opts *options, handshakeNum int ) ( StreamingHandshake, bool ) {
+
+	if handshakeNum < 0 || handshakeNum >= len(opts.Handshakes) {
+		return nil, false
+	}
+	h, ok := GetHandshake( opts.Handshakes[ handshakeNum ] )
+	if !ok {
+		return nil, false
+	}
+	sh, ok := h.( StreamingHandshake )
+	return sh, ok
+}
+
+// sessions need whole segments as much as streaming handshakes do
+func anyStreamingHandshake( names []string ) bool {
+
+	for _, name := range names {
+		if h, ok := GetHandshake( name ); ok {
+			if _, ok := h.( StreamingHandshake ); ok {
+				return true
+			}
+			if _, ok := h.( SessionHandshake ); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// everything received so far for the current handshake, with p's data
+func ( ipMeta * pState ) appendResponse( p *packet_metadata ) string {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok {
+		return p.Data
+	}
+	e := ps.extra()
+	e.Response = append( e.Response, p.Data... )
+	ipMeta.Insert( pKey, ps )
+	return string( e.Response )
+}
+
+// what has been collected of a response still coming in, if any
+func ( ipMeta * pState ) partialResponse( p *packet_metadata ) ( string, bool ) {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok || ps.Extra == nil || len(ps.Extra.Response) == 0 {
+		return "", false
+	}
+	return string( ps.Extra.Response ), true
+}
+
+/* true once packet.Data holds the whole response. otherwise the
+ * segment is acknowledged and the flow waits for the next one.
+ */
+func collectResponse( opts *options, packet *packet_metadata, ipMeta * pState,
+	handshakeNum int, timeoutQueue chan *packet_metadata ) bool {
+
+	sh, ok := streamingHandshake( opts, handshakeNum )
+	if !ok {
+		return true
+	}
+	segmentL := len(packet.Data)
+	packet.Data = ipMeta.appendResponse( packet )
+	if packet.FIN || packet.RST || len(packet.Data) >= MAX_RESPONSE_BYTES || sh.Complete( packet.Data ) {
+		return true
+	}
+
+	ack := constructAck( packet, packet.Seqnum + segmentL )
+	if err := ack.send(); err != nil {
+		log.Fatal(err)
+	}
+	//the next segment starts right after this one
+	packet.Seqnum += segmentL - 1
+	packet.LZRResponseL = 0
+	packet.updateResponse( DATA )
+	packet.updateTimestamp()
+	ipMeta.update( packet )
+	timeoutQueue <- packet
+	return false
+}
@@ -0,0 +1,361 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/* result_record is the stable, versioned shape of what LZR writes out.
+ * it is decoupled from packet_metadata so that internal bookkeeping
+ * can change without breaking downstream parsers.
+ * bump the minor version when adding fields and the major version
+ * when renaming or removing them.
+ */
+const RESULT_SCHEMA_VERSION = "1.7"
+
+type tcp_flags struct {
+	SYN		bool	`json:"syn"`
+	ACK		bool	`json:"ack"`
+	RST		bool	`json:"rst"`
+	FIN		bool	`json:"fin"`
+	PSH		bool	`json:"psh"`
+}
+
+type result_record struct {
+	SchemaVersion		string
+	Saddr				string
+	Daddr				string
+	Sport				int
+	Dport				int
+	Transport			string
+	Fingerprint			string
+	Candidates			[]string
+	Handshake			string
+	Outcome				string
+	ICMPFrom			string
+	Data				string
+	Metadata			map[string]interface{}
+	Window				int
+	TTL					uint8
+	Flags				tcp_flags
+	ACKed				bool
+	AckingFirewall		bool
+	Middlebox			*middlebox_verdict
+	Handshakes			[]handshake_attempt
+	Timing				*timing_record
+	Timestamp			time.Time
+}
+
+// possible values of result_record.Outcome
+const (
+	OUTCOME_DATA		string = "data"
+	OUTCOME_NO_SYNACK	string = "no_synack"
+	OUTCOME_ZERO_WINDOW	string = "zero_window"
+	OUTCOME_RST			string = "rst"
+	OUTCOME_FIN			string = "fin"
+	OUTCOME_TIMEOUT		string = "timeout"
+	OUTCOME_PORT_UNREACHABLE	string = "port_unreachable"
+	OUTCOME_HOST_UNREACHABLE	string = "host_unreachable"
+	OUTCOME_PROHIBITED			string = "prohibited"
+	OUTCOME_TTL_EXCEEDED		string = "ttl_exceeded"
+)
+
+func packetOutcome( packet *packet_metadata ) string {
+
+	switch {
+	case packet.hasData():
+		return OUTCOME_DATA
+	case packet.ICMPError != "":
+		return packet.ICMPError
+	case packet.RST:
+		return OUTCOME_RST
+	case packet.FIN:
+		return OUTCOME_FIN
+	case packet.windowZero():
+		return OUTCOME_ZERO_WINDOW
+	case packet.ExpectedRToLZR == SYN_ACK:
+		return OUTCOME_NO_SYNACK
+	}
+	return OUTCOME_TIMEOUT
+}
+
+func newResultRecord( packet *packet_metadata, handshakes []string ) *result_record {
+
+	packet.formatAddrs()
+	r := &result_record{
+		SchemaVersion: RESULT_SCHEMA_VERSION,
+		Saddr: packet.Saddr,
+		Daddr: packet.Daddr,
+		Sport: packet.Sport,
+		Dport: packet.Dport,
+		Transport: TRANSPORT_TCP,
+		Fingerprint: packet.Fingerprint,
+		Candidates: packet.FingerprintCandidates,
+		Outcome: packetOutcome( packet ),
+		ICMPFrom: packet.ICMPFrom,
+		Data: packet.Data,
+		Window: packet.Window,
+		TTL: packet.TTL,
+		Flags: tcp_flags{
+			SYN: packet.SYN,
+			ACK: packet.ACK,
+			RST: packet.RST,
+			FIN: packet.FIN,
+			PSH: packet.PUSH,
+		},
+		ACKed: packet.ACKed,
+		AckingFirewall: packet.HyperACKtive,
+		Middlebox: packet.Middlebox,
+		Timestamp: time.Now(),
+	}
+	if packet.isUDP() {
+		r.Transport = TRANSPORT_UDP
+	}
+	if packet.HandshakeNum >= 0 && packet.HandshakeNum < len(handshakes) {
+		r.Handshake = handshakes[ packet.HandshakeNum ]
+	}
+	r.Metadata = handshakeMetadata( r.Handshake, r.Data )
+	if packet.Session != nil && packet.Session.Metadata != nil {
+		r.Metadata = map[string]interface{}{ r.Handshake: packet.Session.Metadata }
+	}
+	r.Timing = packet.Timing
+	r.Handshakes = packet.Attempts
+	//a lone attempt is the record itself, its data is not repeated
+	if len(r.Handshakes) == 0 {
+		attempt := handshake_attempt{
+			Handshake: r.Handshake,
+			PayloadLength: packet.LZRResponseL,
+			Outcome: r.Outcome,
+		}
+		if packet.hasData() {
+			attempt.Fingerprint = r.Fingerprint
+			attempt.Candidates = r.Candidates
+		}
+		r.Handshakes = []handshake_attempt{ attempt }
+	}
+	return r
+}
+
+/* the field registry drives field selection (-outputFields),
+ * the csv columns and the published json schema
+ */
+type result_field struct {
+	Name			string
+	Type			string
+	Nullable		bool		//the value can also be null
+	Format			string
+	Formats			[]string	//any one of these formats
+	Description		string
+	Properties		[]*result_field
+	Items			*result_field
+	Get				func( r *result_record ) interface{}
+}
+
+var resultFields = []*result_field{
+	{ Name: "schema_version", Type: "string", Description: "version of this result schema",
+		Get: func( r *result_record ) interface{} { return r.SchemaVersion } },
+	{ Name: "saddr", Type: "string", Formats: []string{ "ipv4", "ipv6" }, Description: "address of the scanned host",
+		Get: func( r *result_record ) interface{} { return r.Saddr } },
+	{ Name: "daddr", Type: "string", Formats: []string{ "ipv4", "ipv6" }, Description: "local address the scan was sent from",
+		Get: func( r *result_record ) interface{} { return r.Daddr } },
+	{ Name: "sport", Type: "integer", Description: "port of the scanned service",
+		Get: func( r *result_record ) interface{} { return r.Sport } },
+	{ Name: "dport", Type: "integer", Description: "local port used for the last handshake",
+		Get: func( r *result_record ) interface{} { return r.Dport } },
+	{ Name: "transport", Type: "string", Description: "tcp, or udp when scanning with -udp",
+		Get: func( r *result_record ) interface{} { return r.Transport } },
+	{ Name: "fingerprint", Type: "string", Description: "protocol identified from the response, unknown if none matched",
+		Get: func( r *result_record ) interface{} { return r.Fingerprint } },
+	{ Name: "fingerprint_candidates", Type: "array", Description: "every fingerprint that matched the response, fingerprint is the one that won",
+		Items: &result_field{ Type: "string" },
+		Get: func( r *result_record ) interface{} {
+			if r.Candidates == nil {
+				return []string{}
+			}
+			return r.Candidates
+		} },
+	{ Name: "handshake", Type: "string", Description: "handshake that produced this record",
+		Get: func( r *result_record ) interface{} { return r.Handshake } },
+	{ Name: "outcome", Type: "string", Description: "how the connection ended: data, no_synack, zero_window, rst, fin, timeout, or from an ICMP error port_unreachable, host_unreachable, prohibited or ttl_exceeded",
+		Get: func( r *result_record ) interface{} { return r.Outcome } },
+	{ Name: "icmp_from", Type: "string", Description: "address that sent the ICMP error ending the flow (the target or a router on the path), empty otherwise",
+		Get: func( r *result_record ) interface{} { return r.ICMPFrom } },
+	{ Name: "data", Type: "string", Description: "payload returned by the host",
+		Get: func( r *result_record ) interface{} { return r.Data } },
+	{ Name: "metadata", Type: "object", Nullable: true, Description: "what the handshake extracted from the response beyond a fingerprint, keyed by handshake name (e.g. tls), null if nothing",
+		Get: func( r *result_record ) interface{} { return r.Metadata } },
+	{ Name: "window", Type: "integer", Description: "tcp window of the last packet received",
+		Get: func( r *result_record ) interface{} { return r.Window } },
+	{ Name: "ttl", Type: "integer", Description: "ip ttl of the last packet received",
+		Get: func( r *result_record ) interface{} { return r.TTL } },
+	{ Name: "flags", Type: "object", Description: "tcp flags of the last packet received",
+		Properties: []*result_field{
+			{ Name: "syn", Type: "boolean" }, { Name: "ack", Type: "boolean" },
+			{ Name: "rst", Type: "boolean" }, { Name: "fin", Type: "boolean" },
+			{ Name: "psh", Type: "boolean" },
+		},
+		Get: func( r *result_record ) interface{} { return r.Flags } },
+	{ Name: "acked", Type: "boolean", Description: "host acknowledged the data LZR sent",
+		Get: func( r *result_record ) interface{} { return r.ACKed } },
+	{ Name: "acking_firewall", Type: "boolean", Description: "host answered the HyperACKtive filtering probes",
+		Get: func( r *result_record ) interface{} { return r.AckingFirewall } },
+	{ Name: "middlebox", Type: "object", Nullable: true, Description: "what answers for this port according to the HyperACKtive probes (-haf), null when not probed",
+		Properties: []*result_field{
+			{ Name: "classification", Type: "string", Description: "acking-firewall, tarpit, load-balancer or real-service" },
+			{ Name: "cached", Type: "boolean", Description: "verdict reused from an earlier port of the same host" },
+			{ Name: "evidence", Type: "object", Properties: []*result_field{
+				{ Name: "probe_ports", Type: "array", Items: &result_field{ Type: "integer" } },
+				{ Name: "probes_answered", Type: "integer" },
+				{ Name: "same_window", Type: "boolean" },
+				{ Name: "same_ttl", Type: "boolean" },
+				{ Name: "same_options", Type: "boolean" },
+				{ Name: "canned_payload", Type: "boolean" },
+				{ Name: "zero_window_only", Type: "boolean" },
+			} },
+		},
+		Get: func( r *result_record ) interface{} { return r.Middlebox } },
+	{ Name: "handshakes", Type: "array", Description: "every handshake attempted against the target, in order",
+		Items: &result_field{ Type: "object",
+			Properties: []*result_field{
+				{ Name: "handshake", Type: "string", Description: "name of the handshake" },
+				{ Name: "payload_length", Type: "integer", Description: "bytes of handshake data sent" },
+				{ Name: "outcome", Type: "string", Description: "how this handshake ended, same values as outcome" },
+				{ Name: "data", Type: "string", Description: "payload returned for this handshake, left out when it is the record's data" },
+				{ Name: "fingerprint", Type: "string", Description: "protocol identified from this handshake's response" },
+				{ Name: "candidates", Type: "array", Items: &result_field{ Type: "string" },
+					Description: "every fingerprint that matched this handshake's response" },
+			},
+		},
+		Get: func( r *result_record ) interface{} {
+			if r.Handshakes == nil {
+				return []handshake_attempt{}
+			}
+			return r.Handshakes
+		} },
+	{ Name: "timing", Type: "object", Nullable: true, Description: "per-target timings, null if the target was never tracked",
+		Properties: []*result_field{
+			{ Name: "syn_ack_rtt_ms", Type: "number", Description: "SYN to SYN-ACK round trip, only when LZR sent the SYN" },
+			{ Name: "first_byte_ms", Type: "number", Description: "handshake data sent to first response byte" },
+			{ Name: "syn_retransmits", Type: "integer", Description: "SYNs re-sent over all handshakes" },
+			{ Name: "data_retransmits", Type: "integer", Description: "handshake data re-sent over all handshakes" },
+			{ Name: "duration_ms", Type: "number", Description: "time from the first packet to the end of the flow" },
+		},
+		Get: func( r *result_record ) interface{} { return r.Timing } },
+	{ Name: "timestamp", Type: "string", Format: "date-time", Description: "time the record was written",
+		Get: func( r *result_record ) interface{} { return r.Timestamp } },
+}
+
+func getResultField( name string ) ( *result_field, bool ) {
+	for _, f := range resultFields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// parseResultFields turns a comma-separated selector into fields,
+// "*" or "" selects everything
+func parseResultFields( selector string ) ( []*result_field, error ) {
+
+	if selector == "" || selector == "*" {
+		return resultFields, nil
+	}
+	fields := []*result_field{}
+	for _, name := range strings.Split( selector, "," ) {
+		f, ok := getResultField( strings.TrimSpace( name ) )
+		if !ok {
+			return nil, fmt.Errorf("unknown output field %q", name)
+		}
+		fields = append( fields, f )
+	}
+	return fields, nil
+}
+
+// marshal only the selected fields, in the order given
+func ( r *result_record ) marshalFields( fields []*result_field ) ( []byte, error ) {
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		v, err := json.Marshal( f.Get( r ) )
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString( `"` + f.Name + `":` )
+		buf.Write( v )
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func schemaProperty( f *result_field ) map[string]interface{} {
+
+	p := map[string]interface{}{ "type": f.Type }
+	if f.Nullable {
+		p["type"] = []string{ f.Type, "null" }
+	}
+	if f.Format != "" {
+		p["format"] = f.Format
+	}
+	if len(f.Formats) > 0 {
+		formats := []map[string]string{}
+		for _, format := range f.Formats {
+			formats = append( formats, map[string]string{ "format": format } )
+		}
+		p["anyOf"] = formats
+	}
+	if f.Description != "" {
+		p["description"] = f.Description
+	}
+	if len(f.Properties) > 0 {
+		props := make( map[string]interface{} )
+		for _, sub := range f.Properties {
+			props[ sub.Name ] = schemaProperty( sub )
+		}
+		p["properties"] = props
+	}
+	if f.Items != nil {
+		p["items"] = schemaProperty( f.Items )
+	}
+	return p
+}
+
+// ResultSchema returns the JSON Schema describing result records
+func ResultSchema() ( []byte, error ) {
+
+	props := make( map[string]interface{} )
+	for _, f := range resultFields {
+		props[ f.Name ] = schemaProperty( f )
+	}
+	schema := map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$id": "https://github.com/stanford-esrg/lzr/schema/result-" + RESULT_SCHEMA_VERSION + ".json",
+		"title": "LZR result",
+		"type": "object",
+		"properties": props,
+		"required": []string{ "schema_version" },
+	}
+	return json.MarshalIndent( schema, "", "  " )
+}
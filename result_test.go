@@ -0,0 +1,79 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// every field that can be null in a record says so in the schema
+func TestResultSchemaNullable( t *testing.T ) {
+
+	out, err := ResultSchema()
+	if err != nil {
+		t.Fatal( err )
+	}
+	var schema struct {
+		Properties	map[string]struct {
+			Type	interface{}		`json:"type"`
+			AnyOf	[]map[string]string	`json:"anyOf"`
+		}	`json:"properties"`
+	}
+	if err := json.Unmarshal( out, &schema ); err != nil {
+		t.Fatal( err )
+	}
+
+	record, err := (&result_record{}).marshalFields( resultFields )
+	if err != nil {
+		t.Fatal( err )
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal( record, &values ); err != nil {
+		t.Fatal( err )
+	}
+	for name, value := range values {
+		if value != nil {
+			continue
+		}
+		want := []interface{}{ "object", "null" }
+		if got := schema.Properties[name].Type; !reflect.DeepEqual( got, want ) {
+			t.Errorf( "%s is null in a record but has type %v", name, got )
+		}
+	}
+
+	for _, name := range []string{ "saddr", "daddr" } {
+		want := []map[string]string{ { "format": "ipv4" }, { "format": "ipv6" } }
+		if got := schema.Properties[name].AnyOf; !reflect.DeepEqual( got, want ) {
+			t.Errorf( "%s formats: %v", name, got )
+		}
+	}
+}
+
+// a record without earlier attempts does not carry its response twice
+func TestResultSyntheticAttemptOmitsData( t *testing.T ) {
+
+	packet := &packet_metadata{ Saddr: "192.0.2.1", Sport: 80, Daddr: "198.51.100.1", Dport: 40000,
+		Data: "HTTP/1.1 200 OK\r\n\r\n", Fingerprint: "http", ACK: true }
+	r := newResultRecord( packet, []string{ "http" } )
+	if len(r.Handshakes) != 1 || r.Handshakes[0].Data != "" || r.Handshakes[0].Handshake != "http" {
+		t.Errorf( "handshakes: %+v", r.Handshakes )
+	}
+	if r.Data != packet.Data {
+		t.Errorf( "data: %q", r.Data )
+	}
+}
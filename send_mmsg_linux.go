@@ -0,0 +1,126 @@
+// +build linux
+
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+/* packet_sender writes frames with sendmmsg(2) on an AF_PACKET socket
+ * that is never bound to a protocol, so it has no receive ring and
+ * the kernel never queues captured packets to it. a batch of frames
+ * costs one system call.
+ */
+type packet_sender struct {
+	fd			int
+	ifindex		int32
+	raw			bool			//frames start at the IP header
+	msgs		[]mmsghdr
+	iovs		[]unix.Iovec
+	names		[]unix.RawSockaddrLinklayer
+}
+
+// struct mmsghdr, which x/sys does not define
+type mmsghdr struct {
+	hdr			unix.Msghdr
+	len			uint32
+}
+
+func openSender( device string, raw bool, batch int ) ( *packet_sender, error ) {
+
+	iface, err := net.InterfaceByName( device )
+	if err != nil {
+		return nil, err
+	}
+	fd, err := unix.Socket( unix.AF_PACKET, unix.SOCK_RAW | unix.SOCK_CLOEXEC, 0 )
+	if err != nil {
+		return nil, err
+	}
+	return &packet_sender{
+		fd: fd,
+		ifindex: int32( iface.Index ),
+		raw: raw,
+		msgs: make( []mmsghdr, batch ),
+		iovs: make( []unix.Iovec, batch ),
+		names: make( []unix.RawSockaddrLinklayer, batch ),
+	}, nil
+}
+
+// the ethertype of a frame, as sll_protocol wants it (network order)
+func ( s *packet_sender ) protocol( frame []byte, proto *uint16 ) {
+
+	p := (*[2]byte)( unsafe.Pointer( proto ) )[:]
+	switch {
+	case !s.raw && len(frame) >= 14:
+		copy( p, frame[12:14] )
+	case s.raw && len(frame) > 0 && frame[0] >> 4 == 6:
+		binary.BigEndian.PutUint16( p, unix.ETH_P_IPV6 )
+	default:
+		binary.BigEndian.PutUint16( p, unix.ETH_P_IP )
+	}
+}
+
+/* send writes frames (at most the batch size) and returns how many
+ * went out. a frame the kernel refuses is reported and skipped.
+ */
+func ( s *packet_sender ) send( frames []*[]byte ) int {
+
+	n := len(frames)
+	if n > len(s.msgs) {
+		n = len(s.msgs)
+	}
+	for i := 0; i < n; i++ {
+		frame := *frames[i]
+		s.names[i] = unix.RawSockaddrLinklayer{ Family: unix.AF_PACKET, Ifindex: s.ifindex }
+		s.protocol( frame, &s.names[i].Protocol )
+		s.iovs[i].Base = &frame[0]
+		s.iovs[i].SetLen( len(frame) )
+		s.msgs[i].hdr = unix.Msghdr{
+			Name: (*byte)( unsafe.Pointer( &s.names[i] ) ),
+			Namelen: unix.SizeofSockaddrLinklayer,
+			Iov: &s.iovs[i],
+		}
+		s.msgs[i].hdr.SetIovlen( 1 )
+	}
+	sent := 0
+	for sent < n {
+		r, _, errno := unix.Syscall6( unix.SYS_SENDMMSG, uintptr( s.fd ),
+			uintptr( unsafe.Pointer( &s.msgs[sent] ) ), uintptr( n - sent ), 0, 0, 0 )
+		switch {
+		case errno == unix.EINTR || errno == unix.EAGAIN || errno == unix.ENOBUFS:
+			continue
+		case errno != 0:
+			//sendmmsg only fails on the first message of the call
+			fmt.Fprintln(os.Stderr, "--Error sending:", errno)
+			sent += 1
+		default:
+			sent += int(r)
+		}
+	}
+	return n
+}
+
+func ( s *packet_sender ) Close() error {
+	return unix.Close( s.fd )
+}
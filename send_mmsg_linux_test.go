@@ -0,0 +1,118 @@
+// +build linux
+
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"os"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket/afpacket"
+)
+
+/* sending SYNs on loopback (or $LZR_BENCH_DEVICE) through sendmmsg in
+ * batches, one frame per call, and the TPACKET socket the sender used
+ * before. needs CAP_NET_RAW, skipped without it. etc/bench_veth.sh
+ * runs a whole scan instead.
+ */
+func benchDevice() string {
+	if device := os.Getenv( "LZR_BENCH_DEVICE" ); device != "" {
+		return device
+	}
+	return "lo"
+}
+
+func benchSYNs( b *testing.B, n int ) []*[]byte {
+
+	benchLink( b )
+	p := benchPacket()
+	frames := make( []*[]byte, n )
+	for i := range frames {
+		p.Sport = 1024 + i
+		builder := constructSYN( p )
+		frame := append( []byte{}, builder.Bytes()... )
+		builder.release()
+		frames[i] = &frame
+	}
+	return frames
+}
+
+func benchSendmmsg( b *testing.B, batch int ) {
+
+	s, err := openSender( benchDevice(), false, batch )
+	if err != nil {
+		b.Skip( "no AF_PACKET socket:", err )
+	}
+	defer s.Close()
+	frames := benchSYNs( b, batch )
+	b.ResetTimer()
+	for i := 0; i < b.N; i += batch {
+		s.send( frames )
+	}
+}
+
+func BenchmarkSendmmsg( b *testing.B ) {
+	benchSendmmsg( b, AFPACKET_SEND_BATCH )
+}
+
+func BenchmarkSendmmsgUnbatched( b *testing.B ) {
+	benchSendmmsg( b, 1 )
+}
+
+func BenchmarkSendTPacketLegacy( b *testing.B ) {
+
+	tx, err := afpacket.NewTPacket(
+		afpacket.OptInterface( benchDevice() ),
+		afpacket.OptPollTimeout( 100 * time.Millisecond ),
+		afpacket.OptTPacketVersion( afpacket.TPacketVersion3 ),
+	)
+	if err != nil {
+		b.Skip( "no AF_PACKET socket:", err )
+	}
+	defer tx.Close()
+	frames := benchSYNs( b, 1 )
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.WritePacketData( *frames[0] ); err != nil {
+			b.Fatal( err )
+		}
+	}
+}
+
+func TestSenderProtocol( t *testing.T ) {
+
+	tests := []struct {
+		raw		bool
+		frame	[]byte
+		want	[2]byte
+	}{
+		{ false, []byte{ 12: 0x86, 13: 0xdd }, [2]byte{ 0x86, 0xdd } },
+		{ false, []byte{ 12: 0x81, 13: 0x00 }, [2]byte{ 0x81, 0x00 } },
+		{ true, []byte{ 0x45 }, [2]byte{ 0x08, 0x00 } },
+		{ true, []byte{ 0x60 }, [2]byte{ 0x86, 0xdd } },
+	}
+	for _, test := range tests {
+		var proto uint16
+		s := &packet_sender{ raw: test.raw }
+		s.protocol( test.frame, &proto )
+		if got := *(*[2]byte)( unsafe.Pointer( &proto ) ); got != test.want {
+			t.Errorf( "raw %v, frame %x: got %x, want %x", test.raw, test.frame, got, test.want )
+		}
+	}
+}
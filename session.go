@@ -0,0 +1,478 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* SessionHandshake is for handshakes that hold a conversation instead
+ * of sending one payload, e.g. a TLS handshake and a probe inside it.
+ * once the target SYN-ACKs, Run gets the flow as a net.Conn carried
+ * over LZR's raw socket (a minimal userspace TCP: in order delivery,
+ * retransmission of unacknowledged data, no congestion control).
+ * Run must return by the connection's deadline.
+ */
+type SessionHandshake interface {
+	Run( conn net.Conn, dst string ) SessionResult
+}
+
+// what a session reports in place of the first response segment
+type SessionResult struct {
+	Data			string		//the response, empty for none
+	Fingerprint		string		//"" to fingerprint Data like any response
+	Metadata		interface{}	//reported under the handshake's name
+}
+
+// largest segment a session sends, and the window it advertises
+var SESSION_MSS = 1200
+var SESSION_WINDOW uint16 = 65535
+
+var errConnReset = errors.New("connection reset by peer")
+
+/* tcp_conn is one flow seen as a net.Conn. the handshake's goroutine
+ * reads and writes, pcap workers deliver the target's segments.
+ */
+type tcp_conn struct {
+	mu				sync.Mutex
+	wake			chan struct{}	//closed and replaced on every change
+	done			chan struct{}	//closed by Close
+	flow			packet_metadata	//addresses and ports, as a received packet
+	target			flow_key
+	source			flow_key		//our end of the flow
+	sndUna			uint32
+	sndNxt			uint32
+	rcvNxt			uint32
+	unacked			[]byte
+	received		[]byte
+	firstByte		time.Time
+	eof				bool
+	reset			bool
+	closed			bool
+	sent			int
+	readDeadline	time.Time
+	writeDeadline	time.Time
+	local			net.Addr
+	remote			net.Addr
+}
+
+func newTCPConn( synack *packet_metadata ) *tcp_conn {
+
+	c := &tcp_conn{
+		wake: make( chan struct{} ),
+		done: make( chan struct{} ),
+		flow: *synack,
+		target: constructKey( synack ),
+		source: flow_key{ addr: synack.localAddr(), port: uint16( synack.Dport ) },
+		sndUna: uint32( synack.Acknum ),
+		sndNxt: uint32( synack.Acknum ),
+		rcvNxt: uint32( synack.Seqnum + 1 ),
+		local: &net.TCPAddr{ IP: net.ParseIP( synack.Daddr ), Port: synack.Dport },
+		remote: &net.TCPAddr{ IP: net.ParseIP( synack.Saddr ), Port: synack.Sport },
+	}
+	c.flow.Data = ""
+	return c
+}
+
+// sequence number a comes after b
+func seqAfter( a uint32, b uint32 ) bool {
+	return int32( a - b ) > 0
+}
+
+// wake up waiting readers, c.mu held
+func ( c *tcp_conn ) changed() {
+	close( c.wake )
+	c.wake = make( chan struct{} )
+}
+
+// c.mu held
+func ( c *tcp_conn ) send( seq uint32, payload []byte, push bool ) {
+
+	segment := constructSegment( &c.flow, seq, c.rcvNxt, payload, push )
+	if err := segment.send(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// everything sent and not yet acknowledged, again. c.mu held
+func ( c *tcp_conn ) retransmit() {
+
+	for off := 0; off < len(c.unacked); off += SESSION_MSS {
+		end := off + SESSION_MSS
+		if end > len(c.unacked) {
+			end = len(c.unacked)
+		}
+		c.send( c.sndUna + uint32(off), c.unacked[off:end], end == len(c.unacked) )
+	}
+}
+
+/* resend what the target has not acknowledged every interval that it
+ * acknowledges nothing new, until the conn is closed.
+ */
+func ( c *tcp_conn ) retransmitter( interval time.Duration ) {
+
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker( interval )
+	defer ticker.Stop()
+	var lastUna uint32
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		if len(c.unacked) > 0 && c.sndUna == lastUna {
+			c.retransmit()
+		}
+		lastUna = c.sndUna
+		c.mu.Unlock()
+	}
+}
+
+// a segment from the target
+func ( c *tcp_conn ) deliver( p *packet_metadata ) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	if p.RST {
+		c.reset = true
+		c.changed()
+		return
+	}
+	//our ACK of the SYN-ACK went missing
+	if p.SYN {
+		c.send( c.sndNxt, nil, false )
+		return
+	}
+	if p.ACK {
+		ack := uint32( p.Acknum )
+		if seqAfter( ack, c.sndUna ) && !seqAfter( ack, c.sndNxt ) {
+			c.unacked = c.unacked[ ack - c.sndUna: ]
+			c.sndUna = ack
+		}
+	}
+	data := []byte( p.Data )
+	seq := uint32( p.Seqnum )
+	//keep only what follows what we have, anything out of order is resent
+	if len(data) > 0 && !seqAfter( seq, c.rcvNxt ) && seqAfter( seq + uint32(len(data)), c.rcvNxt ) {
+		data = data[ c.rcvNxt - seq: ]
+		if c.firstByte.IsZero() {
+			c.firstByte = p.RecvTime
+		}
+		//what does not fit is neither kept nor acknowledged, the target
+		//resends it once Read has made room
+		if room := MAX_RESPONSE_BYTES - len(c.received); len(data) > room {
+			data = data[:room]
+		}
+		c.received = append( c.received, data... )
+		c.rcvNxt += uint32( len(data) )
+	}
+	if p.FIN && seq + uint32( len(p.Data) ) == c.rcvNxt && !c.eof {
+		c.rcvNxt += 1
+		c.eof = true
+	}
+	if len(p.Data) > 0 || p.FIN {
+		c.send( c.sndNxt, nil, false )
+	}
+	c.changed()
+}
+
+// how long to wait for a change before deadline, c.mu held
+func waitFor( deadline time.Time ) ( <-chan time.Time, *time.Timer, bool ) {
+
+	if deadline.IsZero() {
+		return nil, nil, true
+	}
+	d := time.Until( deadline )
+	if d <= 0 {
+		return nil, nil, false
+	}
+	t := time.NewTimer( d )
+	return t.C, t, true
+}
+
+func ( c *tcp_conn ) Read( b []byte ) ( int, error ) {
+
+	for {
+		c.mu.Lock()
+		switch {
+		case len(c.received) > 0:
+			n := copy( b, c.received )
+			c.received = c.received[n:]
+			c.mu.Unlock()
+			return n, nil
+		case c.closed:
+			c.mu.Unlock()
+			return 0, net.ErrClosed
+		case c.reset:
+			c.mu.Unlock()
+			return 0, errConnReset
+		case c.eof:
+			c.mu.Unlock()
+			return 0, io.EOF
+		}
+		expired, timer, ok := waitFor( c.readDeadline )
+		wake := c.wake
+		c.mu.Unlock()
+		if !ok {
+			return 0, os.ErrDeadlineExceeded
+		}
+		select {
+		case <-wake:
+		case <-expired:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+func ( c *tcp_conn ) Write( b []byte ) ( int, error ) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case c.closed:
+		return 0, net.ErrClosed
+	case c.reset:
+		return 0, errConnReset
+	case !c.writeDeadline.IsZero() && time.Now().After( c.writeDeadline ):
+		return 0, os.ErrDeadlineExceeded
+	}
+	for off := 0; off < len(b); off += SESSION_MSS {
+		end := off + SESSION_MSS
+		if end > len(b) {
+			end = len(b)
+		}
+		c.send( c.sndNxt, b[off:end], end == len(b) )
+		c.sndNxt += uint32( end - off )
+	}
+	c.unacked = append( c.unacked, b... )
+	c.sent += len(b)
+	return len(b), nil
+}
+
+// the flow itself is reset by LZR once the session is over
+func ( c *tcp_conn ) Close() error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close( c.done )
+		c.changed()
+	}
+	return nil
+}
+
+func ( c *tcp_conn ) LocalAddr() net.Addr {
+	return c.local
+}
+
+func ( c *tcp_conn ) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func ( c *tcp_conn ) SetDeadline( t time.Time ) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	c.changed()
+	return nil
+}
+
+func ( c *tcp_conn ) SetReadDeadline( t time.Time ) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	c.changed()
+	return nil
+}
+
+func ( c *tcp_conn ) SetWriteDeadline( t time.Time ) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return nil
+}
+
+// the flows with a session running, by target
+type session_table struct {
+	sync.Mutex
+	active			int64
+	started			int64		//sessions not yet finished, up to -maxSessions
+	refused			int64
+	conns			map[flow_key]*tcp_conn
+}
+
+var sessions = &session_table{ conns: make( map[flow_key]*tcp_conn ) }
+
+func ( t *session_table ) add( p *packet_metadata, c *tcp_conn ) {
+
+	t.Lock()
+	t.conns[ constructKey(p) ] = c
+	atomic.StoreInt64( &t.active, int64( len(t.conns) ) )
+	t.Unlock()
+}
+
+func ( t *session_table ) remove( p *packet_metadata ) {
+
+	t.Lock()
+	delete( t.conns, constructKey(p) )
+	atomic.StoreInt64( &t.active, int64( len(t.conns) ) )
+	t.Unlock()
+}
+
+func ( t *session_table ) get( p *packet_metadata ) *tcp_conn {
+
+	if atomic.LoadInt64( &t.active ) == 0 {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	return t.conns[ constructKey(p) ]
+}
+
+// p was sent from the target's ip:port to the session's own
+func ( c *tcp_conn ) owns( p *packet_metadata ) bool {
+	return constructKey( p ) == c.target &&
+		flow_key{ addr: p.localAddr(), port: uint16( p.Dport ) } == c.source
+}
+
+// whether p belongs to a running session, which then takes it
+func ( t *session_table ) deliver( p *packet_metadata ) bool {
+
+	c := t.get( p )
+	if c == nil || p.isUDP() || p.ICMPError != "" || !c.owns( p ) {
+		return false
+	}
+	c.deliver( p )
+	return true
+}
+
+func ( t *session_table ) running( p *packet_metadata ) bool {
+	return t.get( p ) != nil
+}
+
+// a slot for one more session, unless -maxSessions are running
+func ( t *session_table ) acquire() bool {
+
+	max := int64( getMaxSessions() )
+	if atomic.AddInt64( &t.started, 1 ) > max && max > 0 {
+		atomic.AddInt64( &t.started, -1 )
+		atomic.AddInt64( &t.refused, 1 )
+		return false
+	}
+	return true
+}
+
+func ( t *session_table ) release() {
+	atomic.AddInt64( &t.started, -1 )
+}
+
+func ( t *session_table ) summarize( s *summary ) {
+	s.SessionsRefused = atomic.LoadInt64( &t.refused )
+}
+
+/* run h on the flow synack opened. it gets as long as the handshake
+ * would have with every retransmission, after which the flow is
+ * finished like any other: with the session's response or, without
+ * one, by moving on to the next handshake. with -maxSessions running
+ * the flow moves on right away.
+ */
+func startSession( opts *options, h SessionHandshake, synack *packet_metadata, ipMeta * pState,
+	timeoutQueue chan *packet_metadata, writingQueue chan *packet_metadata ) {
+
+	synack.updateResponse( DATA )
+	synack.updateTimestamp()
+	ipMeta.update( synack )
+	if !sessions.acquire() {
+		handleExpired( opts, synack, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+	ipMeta.markDataSent( synack, false )
+
+	c := newTCPConn( synack )
+	c.SetDeadline( time.Now().Add( time.Duration( opts.Timeout * ( opts.RetransmitNum + 1 ) ) * time.Second ) )
+	sessions.add( synack, c )
+	go c.retransmitter( time.Duration( opts.RetransmitSec ) * time.Second )
+
+	packet := c.flow
+	go func() {
+		defer sessions.release()
+		result := h.Run( c, packet.Saddr )
+		c.Close()
+		finishSession( opts, &packet, c, result, ipMeta, timeoutQueue, writingQueue )
+	}()
+}
+
+func finishSession( opts *options, packet *packet_metadata, c *tcp_conn, result SessionResult,
+	ipMeta * pState, timeoutQueue chan *packet_metadata, writingQueue chan *packet_metadata ) {
+
+	//take the flow like a worker would
+	if !ipMeta.WaitStartProcessing( packet ) {
+		sessions.remove( packet )
+		return
+	}
+	defer ipMeta.FinishProcessing( packet )
+	sessions.remove( packet )
+
+	c.mu.Lock()
+	packet.Seqnum = int( c.rcvNxt ) - 1
+	packet.Acknum = int( c.sndNxt )
+	packet.RST = c.reset
+	packet.FIN = c.eof
+	packet.RecvTime = c.firstByte
+	packet.LZRResponseL = c.sent
+	c.mu.Unlock()
+	packet.SYN = false
+	packet.ACK = true
+	ipMeta.updatePayloadL( packet, packet.LZRResponseL )
+
+	handshakeNum := ipMeta.getHandshake( packet )
+	if result.Data == "" {
+		handleExpired( opts, packet, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+	packet.Data = result.Data
+	packet.Session = &result
+	ipMeta.markFirstByte( packet )
+	if handshakeNum == 1 && HyperACKtiveFiltering() {
+		ipMeta.recordRealData( packet )
+	}
+	finishResponse( opts, packet, ipMeta, handshakeNum, timeoutQueue, writingQueue,
+		ipMeta.getHyperACKtiveStatus( packet ) )
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+func sessionSynack() *packet_metadata {
+	p := &packet_metadata{ Daddr: "198.51.100.1", Sport: 443, Dport: 40000, Seqnum: 5000, Acknum: 1001,
+		SYN: true, ACK: true }
+	p.setTarget( "192.0.2.1" )
+	return p
+}
+
+func TestSessionDeliverMatchesFlow( t *testing.T ) {
+
+	synack := sessionSynack()
+	c := newTCPConn( synack )
+	sessions.add( synack, c )
+	defer sessions.remove( synack )
+
+	ack := func( daddr string, dport int ) *packet_metadata {
+		p := &packet_metadata{ Daddr: daddr, Sport: 443, Dport: dport, Seqnum: 5001, Acknum: 1001, ACK: true }
+		p.setTarget( "192.0.2.1" )
+		return p
+	}
+	if sessions.deliver( ack( "198.51.100.1", 40001 ) ) {
+		t.Error( "took a segment to another local port" )
+	}
+	if sessions.deliver( ack( "198.51.100.2", 40000 ) ) {
+		t.Error( "took a segment to another local address" )
+	}
+	if !sessions.deliver( ack( "198.51.100.1", 40000 ) ) {
+		t.Error( "refused a segment of the session's flow" )
+	}
+}
+
+// keeps the frames LZR would have sent, raw IP with no link header
+type sent_frames struct {
+	frames			[][]byte
+}
+
+func ( s *sent_frames ) WritePacketData( data []byte ) error {
+	s.frames = append( s.frames, append( []byte(nil), data... ) )
+	return nil
+}
+
+func ( s *sent_frames ) SetBPFFilter( filter string ) error { return nil }
+func ( s *sent_frames ) LinkType() layers.LinkType { return layers.LinkTypeRaw }
+func ( s *sent_frames ) Close() {}
+
+func withSentFrames( t *testing.T ) *sent_frames {
+
+	s := &sent_frames{}
+	savedHandle, savedLink := handle, linkType
+	handle, linkType = s, LINK_RAW
+	resetLinkHeader()
+	t.Cleanup( func() {
+		handle, linkType = savedHandle, savedLink
+		resetLinkHeader()
+	} )
+	return s
+}
+
+// the ack number of a sent IPv4/TCP frame
+func sentAck( frame []byte ) uint32 {
+	hlen := int( frame[0] & 0x0f ) * 4
+	return binary.BigEndian.Uint32( frame[hlen+8:hlen+12] )
+}
+
+func TestSessionDeliverStopsAtBuffer( t *testing.T ) {
+
+	sent := withSentFrames( t )
+	c := newTCPConn( sessionSynack() )
+	segment := func( seq int, data string ) *packet_metadata {
+		p := &packet_metadata{ Sport: 443, Dport: 40000, Seqnum: seq, Acknum: 1001, ACK: true, Data: data }
+		p.setTarget( "192.0.2.1" )
+		return p
+	}
+
+	data := strings.Repeat( "x", MAX_RESPONSE_BYTES + 100 )
+	c.deliver( segment( 5001, data ) )
+	if len(c.received) != MAX_RESPONSE_BYTES || c.rcvNxt != uint32( 5001 + MAX_RESPONSE_BYTES ) {
+		t.Fatalf( "kept %d bytes, rcvNxt %d", len(c.received), c.rcvNxt )
+	}
+	if len(sent.frames) != 1 || sentAck( sent.frames[0] ) != c.rcvNxt {
+		t.Fatalf( "acknowledged past what was kept: %d frames", len(sent.frames) )
+	}
+
+	//the rest once there is room, and nothing beyond
+	c.deliver( segment( 5001 + MAX_RESPONSE_BYTES, "y" ) )
+	if c.rcvNxt != uint32( 5001 + MAX_RESPONSE_BYTES ) {
+		t.Fatalf( "took data into a full buffer, rcvNxt %d", c.rcvNxt )
+	}
+	c.Read( make( []byte, 100 ) )
+	c.deliver( segment( 5001, data ) )
+	if len(c.received) != MAX_RESPONSE_BYTES || c.rcvNxt != uint32( 5001 + len(data) ) {
+		t.Fatalf( "kept %d bytes, rcvNxt %d after a read", len(c.received), c.rcvNxt )
+	}
+}
+
+func TestSessionSlots( t *testing.T ) {
+
+	saved := *maxSessions
+	*maxSessions = 2
+	defer func() { *maxSessions = saved }()
+
+	if !sessions.acquire() || !sessions.acquire() {
+		t.Fatal( "refused a session under -maxSessions" )
+	}
+	if sessions.acquire() {
+		t.Fatal( "ran more than -maxSessions" )
+	}
+	sessions.release()
+	if !sessions.acquire() {
+		t.Fatal( "refused a session after one finished" )
+	}
+	sessions.release()
+	sessions.release()
+	s := &summary{}
+	sessions.summarize( s )
+	if s.SessionsRefused != 1 {
+		t.Errorf( "refused %d, want 1", s.SessionsRefused )
+	}
+}
+
+func TestSessionRetransmitterStopsOnClose( t *testing.T ) {
+
+	c := newTCPConn( sessionSynack() )
+	stopped := make( chan struct{} )
+	go func() {
+		c.retransmitter( time.Hour )
+		close( stopped )
+	}()
+	c.Close()
+	select {
+	case <-stopped:
+	case <-time.After( time.Second ):
+		t.Fatal( "retransmitter still running after Close" )
+	}
+}
+
+func TestWaitStartProcessing( t *testing.T ) {
+
+	ipMeta := NewpState()
+	p := sessionSynack()
+	ipMeta.Insert( constructKey( p ), &packet_state{ Flow: flowRecordOf( p ) } )
+	if _, started := ipMeta.IsStartProcessing( p ); !started {
+		t.Fatal( "could not take an idle flow" )
+	}
+
+	taken := make( chan bool )
+	go func() {
+		taken <- ipMeta.WaitStartProcessing( p )
+	}()
+	select {
+	case <-taken:
+		t.Fatal( "took a flow another thread is processing" )
+	case <-time.After( 20 * time.Millisecond ):
+	}
+	ipMeta.FinishProcessing( p )
+	if ok := <-taken; !ok {
+		t.Fatal( "did not take the flow once it was released" )
+	}
+
+	go func() {
+		taken <- ipMeta.WaitStartProcessing( p )
+	}()
+	ipMeta.Remove( constructKey( p ) )
+	if ok := <-taken; ok {
+		t.Fatal( "took a flow that is gone" )
+	}
+}
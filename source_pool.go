@@ -0,0 +1,276 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// largest CIDR -sourceIP expands
+const MAX_SOURCE_IPS = 65536
+
+var SOURCE_SHARD_COUNT = 256
+
+/* source_tuple is a flow's full 4-tuple: our ip:port and the
+ * target's. remember that in packet_metadata our side is Daddr/Dport.
+ */
+type source_tuple struct {
+	local		flow_key
+	target		flow_key
+}
+
+// the tuples in use towards the targets that hash to this shard
+type source_shard struct {
+	sync.Mutex
+	free		*sync.Cond
+	inUse		map[source_tuple]bool
+}
+
+/* source_pool hands out the local ip:port every flow (and every
+ * handshake of a flow) sends from. a tuple is claimed when its flow
+ * enters pState and released when it leaves or moves on to the next
+ * handshake, so no two in-flight flows share a 4-tuple. the same
+ * local ip:port may talk to many targets at once. the pool is
+ * sharded by target and a shared cursor rotates over the endpoints,
+ * so the first candidate is nearly always free.
+ */
+type source_pool struct {
+	ips			[]string
+	addrs		[]netip.Addr
+	minPort		int
+	maxPort		int
+	next		uint64
+	shards		[]*source_shard
+}
+
+var sources = newSourcePool()
+
+func newSourcePool() *source_pool {
+
+	s := &source_pool{
+		minPort: 32768,
+		maxPort: 61000,
+		shards: make( []*source_shard, SOURCE_SHARD_COUNT ),
+	}
+	for i := range s.shards {
+		shard := &source_shard{ inUse: make( map[source_tuple]bool ) }
+		shard.free = sync.NewCond( &shard.Mutex )
+		s.shards[i] = shard
+	}
+	return s
+}
+
+// comma-separated addresses and CIDRs
+func parseSourceIPs( list string ) ( []string, error ) {
+
+	var ips []string
+	for _, s := range strings.Split( list, "," ) {
+		s = strings.TrimSpace( s )
+		if s == "" {
+			continue
+		}
+		if !strings.Contains( s, "/" ) {
+			ip := net.ParseIP( s ).To4()
+			if ip == nil {
+				return nil, fmt.Errorf("bad source IP %q", s)
+			}
+			ips = append( ips, ip.String() )
+			continue
+		}
+		_, cidr, err := net.ParseCIDR( s )
+		if err != nil || cidr.IP.To4() == nil {
+			return nil, fmt.Errorf("bad source CIDR %q", s)
+		}
+		ones, bits := cidr.Mask.Size()
+		size := 1 << uint(bits - ones)
+		if len(ips) + size > MAX_SOURCE_IPS {
+			return nil, fmt.Errorf("source CIDR %q has more than %d addresses", s, MAX_SOURCE_IPS)
+		}
+		first := binary.BigEndian.Uint32( cidr.IP.To4() )
+		for i := 0; i < size; i++ {
+			//skip network and broadcast addresses unless it is a /31 or /32
+			if size > 2 && ( i == 0 || i == size - 1 ) {
+				continue
+			}
+			ip := make( net.IP, 4 )
+			binary.BigEndian.PutUint32( ip, first + uint32(i) )
+			ips = append( ips, ip.String() )
+		}
+	}
+	return ips, nil
+}
+
+// "min-max"
+func parsePortRange( r string ) ( int, int, error ) {
+
+	s := strings.SplitN( r, "-", 2 )
+	if len(s) != 2 {
+		return 0, 0, fmt.Errorf("bad source port range %q, expecting min-max", r)
+	}
+	min, err1 := strconv.Atoi( strings.TrimSpace( s[0] ) )
+	max, err2 := strconv.Atoi( strings.TrimSpace( s[1] ) )
+	if err1 != nil || err2 != nil || min < 1 || max > 65535 || min > max {
+		return 0, 0, fmt.Errorf("bad source port range %q", r)
+	}
+	return min, max, nil
+}
+
+/* only called before scanning starts, the pool's configuration is
+ * read without locks after that.
+ */
+func initSourcePool( ipList string, portRange string ) error {
+
+	ips, err := parseSourceIPs( ipList )
+	if err != nil {
+		return err
+	}
+	min, max, err := parsePortRange( portRange )
+	if err != nil {
+		return err
+	}
+	sources.ips = ips
+	sources.addrs = make( []netip.Addr, len(ips) )
+	for i, ip := range ips {
+		sources.addrs[i], _ = netip.ParseAddr( ip )
+	}
+	sources.minPort = min
+	sources.maxPort = max
+	return nil
+}
+
+func sourceTuple( p *packet_metadata ) source_tuple {
+	return source_tuple{ local: flow_key{ addr: p.localAddr(), port: uint16(p.Dport) }, target: constructKey( p ) }
+}
+
+func ( s *source_pool ) shard( target flow_key ) *source_shard {
+	return s.shards[ uint( target.hash() ) % uint( len(s.shards) ) ]
+}
+
+/* the next free endpoint towards target, other than skip, rotating
+ * over the source IPs. fallbackIP is used when no -sourceIP was given
+ * (e.g. the address ZMap scanned from). the shard is locked.
+ */
+func ( s *source_pool ) take( shard *source_shard, target flow_key, fallbackIP string,
+	skip source_tuple ) ( string, flow_key, bool ) {
+
+	ips, addrs := s.ips, s.addrs
+	if len(ips) == 0 {
+		addr, _ := netip.ParseAddr( fallbackIP )
+		ips, addrs = []string{ fallbackIP }, []netip.Addr{ addr }
+	}
+	nips := uint64( len(ips) )
+	nports := uint64( s.maxPort - s.minPort + 1 )
+	start := atomic.AddUint64( &s.next, 1 )
+	for i := uint64(0); i < nips * nports; i++ {
+		n := start + i
+		ip, port := n % nips, s.minPort + int( n / nips % nports )
+		t := source_tuple{ local: flow_key{ addr: addrs[ip], port: uint16(port) }, target: target }
+		if shard.inUse[t] || t == skip {
+			continue
+		}
+		shard.inUse[t] = true
+		return ips[ip], t.local, true
+	}
+	return "", flow_key{}, false
+}
+
+/* give a new target its first endpoint. when every endpoint is
+ * already talking to this target, wait for one to be released.
+ */
+func ( s *source_pool ) allocate( p *packet_metadata ) {
+
+	target := constructKey( p )
+	shard := s.shard( target )
+	shard.Lock()
+	defer shard.Unlock()
+	for {
+		if ip, local, ok := s.take( shard, target, p.Daddr, source_tuple{} ); ok {
+			p.setSource( ip, local )
+			return
+		}
+		shard.free.Wait()
+	}
+}
+
+/* move a flow to a fresh endpoint. its old one is kept only when
+ * there is no other, so the next handshake never reuses the tuple
+ * of the last unless it has to.
+ */
+func ( s *source_pool ) renew( p *packet_metadata ) {
+
+	old := sourceTuple( p )
+	shard := s.shard( old.target )
+	shard.Lock()
+	defer shard.Unlock()
+	delete( shard.inUse, old )
+	ip, local, ok := s.take( shard, old.target, p.Daddr, old )
+	if !ok {
+		shard.inUse[old] = true
+		return
+	}
+	shard.free.Broadcast()
+	p.setSource( ip, local )
+}
+
+// the tuple ZMap (or a queued target) already uses
+func ( s *source_pool ) claim( p *packet_metadata ) {
+
+	t := sourceTuple( p )
+	shard := s.shard( t.target )
+	shard.Lock()
+	shard.inUse[t] = true
+	shard.Unlock()
+}
+
+func ( s *source_pool ) release( p *packet_metadata ) {
+
+	t := sourceTuple( p )
+	shard := s.shard( t.target )
+	shard.Lock()
+	if shard.inUse[t] {
+		delete( shard.inUse, t )
+		shard.free.Broadcast()
+	}
+	shard.Unlock()
+}
+
+func ( s *source_pool ) InUse() int {
+
+	n := 0
+	for _, shard := range s.shards {
+		shard.Lock()
+		n += len(shard.inUse)
+		shard.Unlock()
+	}
+	return n
+}
+
+// give a new target its first endpoint
+func allocateSource( p *packet_metadata ) {
+	sources.allocate( p )
+}
+
+// move a flow to a fresh endpoint for its next handshake
+func ( ipMeta * pState ) renewSource( p *packet_metadata ) {
+	sources.renew( p )
+}
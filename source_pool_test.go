@@ -0,0 +1,117 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testPool( t *testing.T, ipList string, portRange string ) {
+
+	saved := sources
+	sources = newSourcePool()
+	t.Cleanup( func() { sources = saved } )
+	if err := initSourcePool( ipList, portRange ); err != nil {
+		t.Fatal( err )
+	}
+}
+
+func target( ip string, port int ) *packet_metadata {
+	return &packet_metadata{ Saddr: ip, Sport: port }
+}
+
+func TestSourcePoolSharesLocalEndpoints( t *testing.T ) {
+
+	testPool( t, "192.0.2.10", "40000-40000" )
+	a, b := target( "198.51.100.1", 80 ), target( "198.51.100.2", 80 )
+	allocateSource( a )
+	allocateSource( b )
+	if a.Daddr != "192.0.2.10" || a.Dport != 40000 || b.Dport != 40000 {
+		t.Errorf( "got %s:%d and %s:%d", a.Daddr, a.Dport, b.Daddr, b.Dport )
+	}
+	if sources.InUse() != 2 {
+		t.Errorf( "%d tuples in use", sources.InUse() )
+	}
+}
+
+func TestSourcePoolRotates( t *testing.T ) {
+
+	testPool( t, "192.0.2.10,192.0.2.11", "40000-40001" )
+	seen := make( map[string]bool )
+	for i := 0; i < 4; i++ {
+		p := target( "198.51.100.1", 80 )
+		allocateSource( p )
+		seen[ p.Daddr + ":" + strconv.Itoa( p.Dport ) ] = true
+	}
+	if len(seen) != 4 || sources.InUse() != 4 {
+		t.Errorf( "%d different endpoints, %d in use", len(seen), sources.InUse() )
+	}
+}
+
+func TestSourcePoolRenew( t *testing.T ) {
+
+	testPool( t, "192.0.2.10", "40000-40001" )
+	p := target( "198.51.100.1", 80 )
+	allocateSource( p )
+	for i := 0; i < 5; i++ {
+		before := p.Dport
+		sources.renew( p )
+		if p.Dport == before || sources.InUse() != 1 {
+			t.Fatalf( "renew kept %d, %d in use", p.Dport, sources.InUse() )
+		}
+	}
+	//a pool of one keeps its endpoint
+	testPool( t, "192.0.2.10", "40000-40000" )
+	p = target( "198.51.100.1", 80 )
+	allocateSource( p )
+	sources.renew( p )
+	if p.Dport != 40000 || sources.InUse() != 1 {
+		t.Errorf( "renew moved to %d, %d in use", p.Dport, sources.InUse() )
+	}
+	sources.release( p )
+	if sources.InUse() != 0 {
+		t.Errorf( "%d in use after release", sources.InUse() )
+	}
+}
+
+func TestSourcePoolWaits( t *testing.T ) {
+
+	testPool( t, "192.0.2.10", "40000-40000" )
+	first := target( "198.51.100.1", 80 )
+	allocateSource( first )
+	done := make( chan *packet_metadata )
+	go func() {
+		p := target( "198.51.100.1", 80 )
+		allocateSource( p )
+		done <- p
+	}()
+	select {
+	case <-done:
+		t.Fatal( "allocated a tuple that is in use" )
+	case <-time.After( 50 * time.Millisecond ):
+	}
+	sources.release( first )
+	select {
+	case p := <-done:
+		if p.Dport != 40000 {
+			t.Errorf( "got port %d", p.Dport )
+		}
+	case <-time.After( time.Second ):
+		t.Fatal( "still waiting after release" )
+	}
+}
@@ -16,8 +16,9 @@ limitations under the License.
 package lzr
 
 import (
-	"strconv"
 	"fmt"
+	"net/netip"
+	"time"
 )
 
 /* keeps state by storing the packet that was received 
@@ -31,12 +32,53 @@ func ConstructPacketStateMap( opts *options ) pState {
 }
 
 
-func constructKey( packet *packet_metadata ) string {
-	return packet.Saddr + ":" + strconv.Itoa(packet.Sport)
+/* flow_key identifies a flow by the target's address and port.
+ * comparable and fixed size, so building one for every lookup on
+ * the hot path allocates nothing (unlike "saddr:sport" strings).
+ */
+type flow_key struct {
+	addr		netip.Addr
+	port		uint16
+}
+
+func newFlowKey( ip string, port int ) flow_key {
+	addr, _ := netip.ParseAddr( ip )
+	return flow_key{ addr: addr.Unmap(), port: uint16(port) }
 }
 
-func constructParentKey( packet *packet_metadata, parentSport int ) string {
-    return packet.Saddr + ":" + strconv.Itoa(parentSport)
+// the decoded address when there is one, parsing Saddr otherwise
+func constructKey( packet *packet_metadata ) flow_key {
+	return constructParentKey( packet, packet.Sport )
+}
+
+func constructParentKey( packet *packet_metadata, parentSport int ) flow_key {
+	if packet.saddr.IsValid() {
+		return flow_key{ addr: packet.saddr, port: uint16(parentSport) }
+	}
+	return newFlowKey( packet.Saddr, parentSport )
+}
+
+// fnv-1a over the address bytes and the port, to pick a shard
+func ( k flow_key ) hash() uint32 {
+	hash := uint32(2166136261)
+	const prime32 = uint32(16777619)
+	var b []byte
+	if k.addr.Is4() {
+		a := k.addr.As4()
+		b = a[:]
+	} else {
+		a := k.addr.As16()
+		b = a[:]
+	}
+	for i := 0; i < len(b); i++ {
+		hash ^= uint32(b[i])
+		hash *= prime32
+	}
+	hash ^= uint32(k.port >> 8)
+	hash *= prime32
+	hash ^= uint32(k.port & 0xff)
+	hash *= prime32
+	return hash
 }
 
 
@@ -48,13 +90,13 @@ func (ipMeta * pState) metaContains( p * packet_metadata ) bool {
 }
 
 
-func (ipMeta * pState) find(p * packet_metadata) ( *packet_metadata, bool ) {
+func (ipMeta * pState) find(p * packet_metadata) ( flow_record, bool ) {
 	pKey := constructKey(p)
 	ps, ok := ipMeta.Get(pKey)
 	if ok {
-		return ps.Packet, ok
+		return ps.Flow, ok
 	}
-	return nil,ok
+	return flow_record{},ok
 }
 
 func (ipMeta * pState) update( p * packet_metadata ) {
@@ -62,13 +104,20 @@ func (ipMeta * pState) update( p * packet_metadata ) {
 	pKey := constructKey(p)
 	ps, ok := ipMeta.Get(pKey)
 	if !ok {
+		sources.claim( p )
 		ps = &packet_state {
-			Packet: p,
+			Flow: flowRecordOf( p ),
 			Ack: false,
 			HandshakeNum: 0,
+			Timing: flow_timing{ Start: time.Now() },
+		}
+		if !p.HyperACKtive {
+			if h := joinHost( p.targetAddr() ); h != nil {
+				ps.extra().Host = h
+			}
 		}
 	} else {
-		ps.Packet = p
+		ps.Flow = flowRecordOf( p )
 	}
 	ipMeta.Insert( pKey, ps )
 }
@@ -79,6 +128,9 @@ func (ipMeta * pState) incHandshake( p * packet_metadata ) bool {
 	ps, ok := ipMeta.Get(pKey)
 	if ok {
 		ps.HandshakeNum += 1
+		if ps.Extra != nil {
+			ps.Extra.Response = nil
+		}
 		ipMeta.Insert( pKey, ps )
 	}
 	return ok
@@ -107,7 +159,7 @@ func (ipMeta * pState) incEphemeralResp( p * packet_metadata, sport int) bool {
     pKey := constructParentKey(p, sport)
     ps, ok := ipMeta.Get(pKey)
     if ok {
-        ps.EphemeralRespNum += 1
+        ps.probes().RespNum += 1
         ipMeta.Insert( pKey, ps )
     }
     return ok
@@ -117,8 +169,8 @@ func (ipMeta * pState) incEphemeralResp( p * packet_metadata, sport int) bool {
 func (ipMeta * pState) getEphemeralRespNum( p * packet_metadata ) int {
     pKey := constructKey(p)
     ps, ok := ipMeta.Get(pKey)
-    if ok {
-        return ps.EphemeralRespNum
+    if ok && ps.haf() != nil {
+        return ps.haf().RespNum
     }
     return 0
 }
@@ -146,7 +198,7 @@ func (ipMeta * pState) setParentSport( p * packet_metadata, sport int ) bool {
     pKey := constructKey(p)
     ps, ok := ipMeta.Get(pKey)
     if ok {
-        ps.ParentSport = sport
+        ps.probes().ParentSport = sport
         ipMeta.Insert( pKey, ps )
     }
     return ok
@@ -155,36 +207,13 @@ func (ipMeta * pState) setParentSport( p * packet_metadata, sport int ) bool {
 func (ipMeta * pState) getParentSport( p * packet_metadata) int {
     pKey := constructKey(p)
     ps, ok := ipMeta.Get(pKey)
-    if ok {
-        return ps.ParentSport
+    if ok && ps.haf() != nil {
+        return ps.haf().ParentSport
 	}
 	return 0
 }
 
 
-func (ipMeta * pState) recordEphemeral( p * packet_metadata, ephemerals []packet_metadata ) bool {
-
-    pKey := constructKey(p)
-    ps, ok := ipMeta.Get(pKey)
-    if ok {
-		ps.EphemeralFilters = append( ps.EphemeralFilters, ephemerals... )
-        ipMeta.Insert( pKey, ps )
-    }
-	return ok
-
-}
-
-func (ipMeta * pState) getEphemeralFilters( p * packet_metadata ) ([]packet_metadata, bool) {
-
-    pKey := constructKey(p)
-    ps, ok := ipMeta.Get(pKey)
-    if ok {
-		return ps.EphemeralFilters, ok
-    }
-    return nil, ok
-
-}
-
 func (ipMeta * pState) updateData( p * packet_metadata ) bool {
     pKey := constructKey(p)
     ps, ok := ipMeta.Get(pKey)
@@ -215,37 +244,36 @@ func (ipMeta * pState) getHandshake( p * packet_metadata ) int {
 	return 0
 }
 
-func (ipMeta * pState) incrementCounter( p * packet_metadata ) bool {
-
-	pKey := constructKey(p)
-	ps, ok := ipMeta.Get(pKey)
-	if !ok {
-		return false
-	}
-	ps.Packet.incrementCounter()
-	ipMeta.Insert( pKey, ps )
-	return true
-
-}
-
-
 func (ipMeta * pState) remove( packet *packet_metadata ) *packet_metadata {
 	packet.ACKed = ipMeta.getAck( packet )
 	packetKey := constructKey(packet)
+	if ps, ok := ipMeta.Get(packetKey); ok {
+		packet.Attempts = ps.attempts()
+		ps.Timing.End = time.Now()
+		packet.Timing = ps.Timing.record()
+		if !ps.HyperACKtive {
+			packet.Middlebox = ipMeta.middleboxVerdict( packet, true )
+		}
+		if ps.Extra != nil && ps.Extra.Host != nil {
+			ps.Extra.Host.leave( packet )
+		}
+	}
 	ipMeta.Remove( packetKey )
+	sources.release( packet )
 	return packet
 }
 
-func verifySA( pMap *packet_metadata, pRecv *packet_metadata ) bool {
+func verifySA( pMap flow_record, pRecv *packet_metadata ) bool {
 
+	seqnum, acknum := int(pMap.Seqnum), int(pMap.Acknum)
 	if pRecv.SYN && pRecv.ACK {
-		if ( pRecv.Acknum == pMap.Seqnum + 1 ) {
+		if ( pRecv.Acknum == seqnum + 1 ) {
 			return true
 		}
 	} else {
 
-		if ((pRecv.Seqnum == ( pMap.Seqnum )) || (pRecv.Seqnum == ( pMap.Seqnum + 1 ))) {
-			if ( pRecv.Acknum == ( pMap.Acknum + pMap.LZRResponseL ) ) {
+		if ((pRecv.Seqnum == ( seqnum )) || (pRecv.Seqnum == ( seqnum + 1 ))) {
+			if ( pRecv.Acknum == ( acknum + int(pMap.LZRResponseL) ) ) {
 				return true
 			}
 			if pRecv.Acknum == 0 { //for RSTs
@@ -257,6 +285,25 @@ func verifySA( pMap *packet_metadata, pRecv *packet_metadata ) bool {
 
 }
 
+/* an ICMP error about a TCP flow quotes the sequence number of the
+ * segment that caused it: our SYN, or what we sent after the SYN-ACK
+ * (RFC 5927). anyone can claim addresses and ports.
+ */
+func verifyQuote( pMap flow_record, pRecv *packet_metadata ) bool {
+
+	seq := pRecv.ICMPSeq
+	if pMap.Expected == expectedCode( SYN_ACK ) {
+		return seq == pMap.Seqnum
+	}
+	sent := pMap.LZRResponseL
+	if c := sessions.get( pRecv ); c != nil {
+		c.mu.Lock()
+		sent = c.sndNxt - pMap.Acknum
+		c.mu.Unlock()
+	}
+	return !seqAfter( pMap.Acknum, seq ) && !seqAfter( seq, pMap.Acknum + sent )
+}
+
 //TODO: eventually remove the act of updating packet with hyperactive flag to 
 // another packet func
 func ( ipMeta * pState ) verifyScanningIP( pRecv *packet_metadata ) bool {
@@ -267,12 +314,19 @@ func ( ipMeta * pState ) verifyScanningIP( pRecv *packet_metadata ) bool {
 	if !ok {
 		return false
 	}
-	pMap := ps.Packet
+	pMap := ps.Flow
 
 	//second check that 4-tuple matches with default packet
-	if (( pMap.Saddr == pRecv.Saddr ) && (pMap.Dport == pRecv.Dport) &&
-		(pMap.Sport == pRecv.Sport) ) {
+	//(saddr and sport are the key)
+	if pMap.Daddr == pRecv.localAddr().As16() && int(pMap.Dport) == pRecv.Dport {
 
+		//no sequence numbers to check over UDP
+		if pMap.UDP == pRecv.isUDP() && pRecv.isUDP() {
+			return true
+		}
+		if pRecv.ICMPError != "" {
+			return !pMap.UDP && verifyQuote( pMap, pRecv )
+		}
 		if verifySA( pMap, pRecv) {
 			return true
 		}
@@ -286,7 +340,7 @@ func ( ipMeta * pState ) verifyScanningIP( pRecv *packet_metadata ) bool {
 		pRecv.HyperACKtive = false
 		return false
 	}
-	pMap = ps.Packet
+	pMap = ps.Flow
 
 	if verifySA( pMap, pRecv) {
 		return true
@@ -294,14 +348,14 @@ func ( ipMeta * pState ) verifyScanningIP( pRecv *packet_metadata ) bool {
 	pRecv.HyperACKtive = false
 	*/
 	if DebugOn() {
-		fmt.Println(pMap.Saddr, "====")
+		fmt.Println(pRecv.saddr, "====")
 		fmt.Println("recv seq num:", pRecv.Seqnum)
 		fmt.Println("stored seqnum: ", pMap.Seqnum)
 		fmt.Println("recv ack num:", pRecv.Acknum)
 		fmt.Println("stored acknum: ", pMap.Acknum)
 		fmt.Println("received response length: ",len(pRecv.Data))
 		fmt.Println("stored response length: ",pMap.LZRResponseL)
-		fmt.Println(pMap.Saddr ,"====")
+		fmt.Println(pRecv.saddr ,"====")
 	}
 	return false
 
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestVerifyScanningIPChecksDaddr( t *testing.T ) {
+
+	ipMeta := NewpState()
+	sent := &packet_metadata{ Saddr: "192.0.2.1", Sport: 80, Daddr: "198.51.100.1", Dport: 40000,
+		Seqnum: 1000, ExpectedRToLZR: SYN_ACK }
+	ipMeta.Insert( constructKey( sent ), &packet_state{ Flow: flowRecordOf( sent ) } )
+
+	synack := func( daddr string ) *packet_metadata {
+		p := &packet_metadata{ Daddr: daddr, Sport: 80, Dport: 40000, Acknum: 1001, SYN: true, ACK: true }
+		p.setTarget( "192.0.2.1" )
+		return p
+	}
+	if !ipMeta.verifyScanningIP( synack( "198.51.100.1" ) ) {
+		t.Fatal( "rejected the SYN-ACK to our address" )
+	}
+	if ipMeta.verifyScanningIP( synack( "198.51.100.2" ) ) {
+		t.Fatal( "accepted a SYN-ACK to another address" )
+	}
+}
+
+// the IPv4 and first 8 TCP header bytes of a segment we sent, as an ICMP error quotes them
+func icmpQuote( seq uint32 ) []byte {
+
+	quote := make( []byte, 28 )
+	quote[0], quote[9] = 0x45, 6
+	copy( quote[12:16], []byte{ 198, 51, 100, 1 } )
+	copy( quote[16:20], []byte{ 192, 0, 2, 1 } )
+	binary.BigEndian.PutUint16( quote[20:22], 40000 )
+	binary.BigEndian.PutUint16( quote[22:24], 80 )
+	binary.BigEndian.PutUint32( quote[24:28], seq )
+	return quote
+}
+
+func TestVerifyScanningIPChecksICMPQuote( t *testing.T ) {
+
+	ipMeta := NewpState()
+	sent := &packet_metadata{ Saddr: "192.0.2.1", Sport: 80, Daddr: "198.51.100.1", Dport: 40000,
+		Seqnum: 1000, ExpectedRToLZR: SYN_ACK }
+	ipMeta.Insert( constructKey( sent ), &packet_state{ Flow: flowRecordOf( sent ) } )
+
+	icmp := func( seq uint32 ) *packet_metadata {
+		return readICMPQuote( OUTCOME_HOST_UNREACHABLE, "203.0.113.1", 60, icmpQuote( seq ), false, &layers.Ethernet{} )
+	}
+	if p := icmp( 1000 ); p == nil || p.saddr.String() != "192.0.2.1" || p.Dport != 40000 || !ipMeta.verifyScanningIP( p ) {
+		t.Fatal( "rejected an error quoting our SYN" )
+	}
+	if ipMeta.verifyScanningIP( icmp( 4242 ) ) {
+		t.Fatal( "accepted an error quoting a SYN we did not send" )
+	}
+	if readICMPQuote( OUTCOME_HOST_UNREACHABLE, "203.0.113.1", 60, icmpQuote( 1000 )[:24], false, &layers.Ethernet{} ) != nil {
+		t.Fatal( "read a quote without the sequence number" )
+	}
+
+	//after the SYN-ACK, anything from our first byte to the end of the handshake
+	synack := &packet_metadata{ Saddr: "192.0.2.1", Sport: 80, Daddr: "198.51.100.1", Dport: 40000,
+		Seqnum: 7000, Acknum: 1001, LZRResponseL: 18, ExpectedRToLZR: DATA }
+	ipMeta.Insert( constructKey( synack ), &packet_state{ Flow: flowRecordOf( synack ) } )
+	for seq, want := range map[uint32]bool{ 1000: false, 1001: true, 1019: true, 1020: false, 7001: false } {
+		if got := ipMeta.verifyScanningIP( icmp( seq ) ); got != want {
+			t.Errorf( "quoted seq %d: %v, want %v", seq, got, want )
+		}
+	}
+}
+
+func TestPlainFlowHasNoExtra( t *testing.T ) {
+
+	ipMeta := NewpState()
+	sent := &packet_metadata{ Sport: 80, Daddr: "198.51.100.1", Dport: 40000, Seqnum: 1000,
+		ExpectedRToLZR: SYN_ACK }
+	sent.setTarget( "192.0.2.1" )
+	ipMeta.update( sent )
+	ps, _ := ipMeta.Get( constructKey( sent ) )
+	if ps.Extra != nil {
+		t.Fatalf( "a flow waiting on its SYN-ACK has extra state: %+v", ps.Extra )
+	}
+	ipMeta.recordAttempt( sent )
+	if ps, _ = ipMeta.Get( constructKey( sent ) ); len( ps.attempts() ) != 1 || ps.haf() != nil {
+		t.Fatalf( "attempts %d, probes %+v", len( ps.attempts() ), ps.haf() )
+	}
+}
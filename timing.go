@@ -0,0 +1,220 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+/* flow_timing follows a target across all of its handshakes.
+ * round trips are only measured for phases that were not
+ * retransmitted (Karn's algorithm), since a late answer cannot
+ * be matched to the right send otherwise.
+ */
+type flow_timing struct {
+	Start				time.Time
+	End					time.Time
+	SynAckRTT			time.Duration
+	FirstByte			time.Duration
+	SynRetransmits		int
+	DataRetransmits		int
+
+	synSent				time.Time
+	synRetransmitted	bool
+	dataSent			time.Time
+	dataRetransmitted	bool
+}
+
+// timing as written in the result record, in milliseconds
+type timing_record struct {
+	SynAckRTT			*float64	`json:"syn_ack_rtt_ms,omitempty"`
+	FirstByte			*float64	`json:"first_byte_ms,omitempty"`
+	SynRetransmits		int			`json:"syn_retransmits"`
+	DataRetransmits		int			`json:"data_retransmits"`
+	Duration			float64		`json:"duration_ms"`
+}
+
+func toMs( d time.Duration ) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func ( t *flow_timing ) record() *timing_record {
+
+	if t == nil {
+		return nil
+	}
+	r := &timing_record{
+		SynRetransmits: t.SynRetransmits,
+		DataRetransmits: t.DataRetransmits,
+		Duration: toMs( t.End.Sub( t.Start ) ),
+	}
+	if t.SynAckRTT > 0 {
+		rtt := toMs( t.SynAckRTT )
+		r.SynAckRTT = &rtt
+	}
+	if t.FirstByte > 0 {
+		fb := toMs( t.FirstByte )
+		r.FirstByte = &fb
+	}
+	return r
+}
+
+// a SYN went out, retransmit is set when it is a repeat of the last one
+func ( ipMeta * pState ) markSynSent( p *packet_metadata, retransmit bool ) {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok {
+		return
+	}
+	if retransmit {
+		ps.Timing.SynRetransmits += 1
+		ps.Timing.synRetransmitted = true
+	} else {
+		ps.Timing.synRetransmitted = false
+	}
+	ps.Timing.synSent = time.Now()
+}
+
+func ( ipMeta * pState ) markSynAck( p *packet_metadata ) {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok || ps.Timing.synSent.IsZero() {
+		return
+	}
+	if ps.Timing.SynAckRTT == 0 && !ps.Timing.synRetransmitted {
+		ps.Timing.SynAckRTT = p.RecvTime.Sub( ps.Timing.synSent )
+	}
+	ps.Timing.synSent = time.Time{}
+}
+
+func ( ipMeta * pState ) markDataSent( p *packet_metadata, retransmit bool ) {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok {
+		return
+	}
+	if retransmit {
+		ps.Timing.DataRetransmits += 1
+		ps.Timing.dataRetransmitted = true
+		return
+	}
+	ps.Timing.dataRetransmitted = false
+	ps.Timing.dataSent = time.Now()
+}
+
+func ( ipMeta * pState ) markFirstByte( p *packet_metadata ) {
+
+	pKey := constructKey(p)
+	ps, ok := ipMeta.Get(pKey)
+	if !ok || ps.Timing.dataSent.IsZero() {
+		return
+	}
+	if ps.Timing.FirstByte == 0 && !ps.Timing.dataRetransmitted {
+		ps.Timing.FirstByte = p.RecvTime.Sub( ps.Timing.dataSent )
+	}
+}
+
+/* percentile_sampler keeps a bounded uniform sample
+ * (reservoir sampling) so percentiles don't cost memory per target
+ */
+var TIMING_SAMPLES int = 100000
+
+type percentile_sampler struct {
+	sync.Mutex
+	seen		int
+	samples		[]float64
+}
+
+func ( s *percentile_sampler ) add( v float64 ) {
+
+	s.Lock()
+	defer s.Unlock()
+	s.seen += 1
+	if len(s.samples) < TIMING_SAMPLES {
+		s.samples = append( s.samples, v )
+		return
+	}
+	if i := rand.Intn( s.seen ); i < TIMING_SAMPLES {
+		s.samples[i] = v
+	}
+}
+
+func ( s *percentile_sampler ) percentiles() map[string]float64 {
+
+	s.Lock()
+	defer s.Unlock()
+	if len(s.samples) == 0 {
+		return nil
+	}
+	sorted := append( []float64{}, s.samples... )
+	sort.Float64s( sorted )
+	at := func( q float64 ) float64 {
+		i := int( math.Ceil( q * float64(len(sorted)) ) ) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	return map[string]float64{
+		"count": float64( s.seen ),
+		"p50": at( 0.50 ),
+		"p90": at( 0.90 ),
+		"p99": at( 0.99 ),
+		"max": sorted[ len(sorted)-1 ],
+	}
+}
+
+var (
+	synAckRTTs		= &percentile_sampler{}
+	firstBytes		= &percentile_sampler{}
+	durations		= &percentile_sampler{}
+)
+
+func addTimingToSummary( t *timing_record ) {
+
+	if t == nil {
+		return
+	}
+	if t.SynAckRTT != nil {
+		synAckRTTs.add( *t.SynAckRTT )
+	}
+	if t.FirstByte != nil {
+		firstBytes.add( *t.FirstByte )
+	}
+	durations.add( t.Duration )
+}
+
+func timingPercentiles() map[string]map[string]float64 {
+
+	p := make( map[string]map[string]float64 )
+	for name, s := range map[string]*percentile_sampler{
+		"syn_ack_rtt_ms": synAckRTTs,
+		"first_byte_ms": firstBytes,
+		"duration_ms": durations,
+	} {
+		if pct := s.percentiles(); pct != nil {
+			p[name] = pct
+		}
+	}
+	return p
+}
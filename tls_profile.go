@@ -0,0 +1,56 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"net/netip"
+	"strings"
+)
+
+const TLS_SNI_TARGET = "target"
+
+/* TLSProfile is what the TLS handshakes put in their ClientHello,
+ * set with -tlsSNI, -tlsALPN and -tls13
+ */
+type TLSProfile struct {
+	ServerName		string
+	ALPN			[]string
+	TLS13			bool
+}
+
+// the profile for a ClientHello sent to dst
+func GetTLSProfile( dst string ) TLSProfile {
+
+	p := TLSProfile{ TLS13: tls13 != nil && *tls13 }
+	if tlsSNI != nil {
+		p.ServerName = *tlsSNI
+		//RFC 6066 does not allow IP literals as a server name
+		if p.ServerName == TLS_SNI_TARGET {
+			p.ServerName = dst
+			if _, err := netip.ParseAddr( dst ); err == nil {
+				p.ServerName = ""
+			}
+		}
+	}
+	if tlsALPN != nil && *tlsALPN != "" {
+		for _, proto := range strings.Split( *tlsALPN, "," ) {
+			if proto = strings.TrimSpace( proto ); proto != "" {
+				p.ALPN = append( p.ALPN, proto )
+			}
+		}
+	}
+	return p
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"testing"
+)
+
+func TestTLSProfileServerName( t *testing.T ) {
+
+	saved := tlsSNI
+	defer func() { tlsSNI = saved }()
+
+	for _, c := range []struct{
+		sni			string
+		dst			string
+		want		string
+	}{
+		{ "", "192.0.2.1", "" },
+		{ "example.com", "192.0.2.1", "example.com" },
+		{ TLS_SNI_TARGET, "example.com", "example.com" },
+		//no IP literals in SNI
+		{ TLS_SNI_TARGET, "192.0.2.1", "" },
+		{ TLS_SNI_TARGET, "2001:db8::1", "" },
+	} {
+		sni := c.sni
+		tlsSNI = &sni
+		if got := GetTLSProfile( c.dst ).ServerName; got != c.want {
+			t.Errorf( "-tlsSNI %q to %s: %q, want %q", c.sni, c.dst, got, c.want )
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"log"
+)
+
+/* UDP mode (-udp) sends the handshake payload straight to ip:port,
+ * there is no connection to set up. a target is done when it answers
+ * with data, when an ICMP port unreachable comes back, or when every
+ * handshake has timed out after its retransmissions.
+ */
+const (
+	TRANSPORT_TCP	string = "tcp"
+	TRANSPORT_UDP	string = "udp"
+)
+
+// UDPHandshake is implemented by handshakes whose payload is framed
+// differently over UDP (e.g. DNS drops the TCP length prefix)
+type UDPHandshake interface {
+	GetUDPData( dst string ) []byte
+}
+
+func udpPayload( handshake Handshake, dst string ) []byte {
+
+	if h, ok := handshake.(UDPHandshake); ok {
+		return h.GetUDPData( dst )
+	}
+	return handshake.GetData( dst )
+}
+
+func (packet * packet_metadata) isUDP() bool {
+	return packet.Transport == TRANSPORT_UDP
+}
+
+func SendUDP( opts *options, packet *packet_metadata, ipMeta * pState,
+	timeoutQueue chan *packet_metadata ) {
+
+	handshakeNum := ipMeta.getHandshake( packet )
+	handshake, _ := GetHandshake( opts.Handshakes[ handshakeNum ] )
+
+	datagram, payload := constructUDP( handshake, packet )
+	packet.updateResponse( DATA )
+	packet.updateResponseL( payload )
+	packet.updateTimestamp()
+	ipMeta.update( packet )
+	ipMeta.updatePayloadL( packet, len(payload) )
+	err := datagram.send()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ipMeta.markDataSent( packet, packet.Counter > 0 )
+
+	//wait for a response, HandleTimeout retransmits
+	packet.updateTimestamp()
+	ipMeta.FinishProcessing( packet )
+	timeoutQueue <- packet
+}
+
+// send the first (or next) handshake to a target over whichever transport it uses
+func sendHandshake( opts *options, packet *packet_metadata, ipMeta * pState,
+	timeoutQueue chan *packet_metadata ) {
+
+	if packet.isUDP() {
+		SendUDP( opts, packet, ipMeta, timeoutQueue )
+		return
+	}
+	SendSyn( packet, ipMeta, timeoutQueue )
+}
+
+// a datagram or ICMP error matched to a UDP target
+func handleUDP( opts *options, packet *packet_metadata, ipMeta * pState,
+	timeoutQueue chan *packet_metadata, writingQueue chan *packet_metadata ) {
+
+	if packet.ICMPError != "" {
+		//nothing listens, no other handshake will change that
+		handleICMPError( packet, ipMeta, writingQueue )
+		return
+	}
+	handshakeNum := ipMeta.getHandshake( packet )
+	if !packet.hasData() {
+		return
+	}
+
+	ipMeta.markFirstByte( packet )
+	packet.updateResponse( DATA )
+	ipMeta.updateData( packet )
+
+	if ForceAllHandshakes() {
+		handleExpired( opts, packet, ipMeta, timeoutQueue, writingQueue )
+		return
+	}
+	packet.syncHandshakeNum( handshakeNum )
+	closeUDP( packet, ipMeta, writingQueue )
+}
+
+// like closeConnection, minus the RST
+func closeUDP( packet *packet_metadata, ipMeta * pState, writingQueue chan *packet_metadata ) {
+
+	ipMeta.recordAttempt( packet )
+	packet = ipMeta.remove( packet )
+	if !( !packet.hasData() && RecordOnlyData() ) {
+		writingQueue <- packet
+	} else {
+		addToSummary( packet )
+	}
+}
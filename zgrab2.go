@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+/* zgrab2_module maps an LZR fingerprint onto the zgrab2 module (and flags)
+ * that completes the L7 handshake for it. each entry becomes one section
+ * of the generated multiple-module ini, selected per target by its trigger.
+ */
+type zgrab2_module struct {
+	Fingerprint		string
+	Trigger			string
+	Module			string
+	Flags			[][2]string
+	Match			func( r *result_record ) bool
+}
+
+/* first matching entry wins, so more specific ones go first. what runs
+ * inside TLS is only known from a tls/<inner> fingerprint. a fingerprint
+ * without an entry falls back to its parent, so http/jenkins is http,
+ * tls/http/jenkins is tls/http and any other tls/<inner> is tls.
+ */
+var zgrab2Modules = []*zgrab2_module{
+	{ Fingerprint: "tls", Trigger: "tls", Module: "tls" },
+	{ Fingerprint: "tls/http", Trigger: "https", Module: "http", Flags: [][2]string{ {"use-https", "true"} } },
+	{ Fingerprint: "tls/imap", Trigger: "imaps", Module: "imap", Flags: [][2]string{ {"imaps", "true"} } },
+	{ Fingerprint: "tls/pop3", Trigger: "pop3s", Module: "pop3", Flags: [][2]string{ {"pop3s", "true"} } },
+	{ Fingerprint: "tls/smtp", Trigger: "smtps", Module: "smtp", Flags: [][2]string{ {"smtps", "true"} } },
+	{ Fingerprint: "tls/ftp", Trigger: "ftps", Module: "ftp", Flags: [][2]string{ {"implicit-tls", "true"} } },
+	{ Fingerprint: "ssl", Trigger: "tls", Module: "tls" },
+	{ Fingerprint: "http", Trigger: "http", Module: "http" },
+	{ Fingerprint: "kubernetes", Trigger: "kubernetes", Module: "http",
+		Flags: [][2]string{ {"use-https", "true"}, {"endpoint", `"/version"`} } },
+	{ Fingerprint: "docker", Trigger: "docker", Module: "http", Flags: [][2]string{ {"endpoint", `"/version"`} } },
+	{ Fingerprint: "etcd", Trigger: "etcd", Module: "http", Flags: [][2]string{ {"endpoint", `"/version"`} } },
+	{ Fingerprint: "winrm", Trigger: "winrm", Module: "http", Flags: [][2]string{ {"endpoint", `"/wsman"`} } },
+	{ Fingerprint: "http_proxy", Trigger: "http", Module: "http" },
+	{ Fingerprint: "ipp", Trigger: "ipp", Module: "ipp" },
+	{ Fingerprint: "ssh", Trigger: "ssh", Module: "ssh", Flags: [][2]string{ {"userauth", "true"} } },
+	{ Fingerprint: "ftp", Trigger: "ftp", Module: "ftp" },
+	{ Fingerprint: "smtp", Trigger: "smtp", Module: "smtp" },
+	{ Fingerprint: "imap", Trigger: "imap", Module: "imap" },
+	{ Fingerprint: "pop3", Trigger: "pop3", Module: "pop3" },
+	{ Fingerprint: "telnet", Trigger: "telnet", Module: "telnet" },
+	{ Fingerprint: "smb", Trigger: "smb", Module: "smb" },
+	{ Fingerprint: "mysql", Trigger: "mysql", Module: "mysql" },
+	{ Fingerprint: "postgres", Trigger: "postgres", Module: "postgres" },
+	{ Fingerprint: "mssql", Trigger: "mssql", Module: "mssql" },
+	{ Fingerprint: "oracle", Trigger: "oracle", Module: "oracle" },
+	{ Fingerprint: "mongodb", Trigger: "mongodb", Module: "mongodb" },
+	{ Fingerprint: "redis", Trigger: "redis", Module: "redis" },
+	{ Fingerprint: "memcached_ascii", Trigger: "memcached", Module: "memcached" },
+	{ Fingerprint: "memcached_binary", Trigger: "memcached", Module: "memcached" },
+	{ Fingerprint: "amqp", Trigger: "amqp091", Module: "amqp091" },
+	{ Fingerprint: "mqtt", Trigger: "mqtt", Module: "mqtt" },
+	{ Fingerprint: "pptp", Trigger: "pptp", Module: "pptp" },
+	{ Fingerprint: "modbus", Trigger: "modbus", Module: "modbus" },
+	{ Fingerprint: "dnp3", Trigger: "dnp3", Module: "dnp3" },
+	{ Fingerprint: "fox", Trigger: "fox", Module: "fox" },
+	{ Fingerprint: "siemens", Trigger: "siemens", Module: "siemens" },
+	// S7-1200/1500 still answer S7comm on the same TSAP setup
+	{ Fingerprint: "s7commplus", Trigger: "siemens", Module: "siemens" },
+	// zgrab2's bacnet module only speaks BACnet/IP over UDP
+	{ Fingerprint: "bacnet", Trigger: "bacnet", Module: "bacnet",
+		Match: func( r *result_record ) bool { return r.Transport == TRANSPORT_UDP } },
+	{ Fingerprint: "socks5", Trigger: "socks5", Module: "socks5" },
+}
+
+func zgrab2ModuleFor( r *result_record ) ( *zgrab2_module, bool ) {
+
+	fingerprint := r.Fingerprint
+	for {
+		if m, ok := zgrab2ModuleByFingerprint( r, fingerprint ); ok {
+			return m, true
+		}
+		i := strings.LastIndex( fingerprint, "/" )
+		if i < 0 {
+			return nil, false
+		}
+		fingerprint = fingerprint[:i]
+	}
+}
+
+func zgrab2ModuleByFingerprint( r *result_record, fingerprint string ) ( *zgrab2_module, bool ) {
+
+	for _, m := range zgrab2Modules {
+		if m.Fingerprint != fingerprint {
+			continue
+		}
+		if m.Match == nil || m.Match( r ) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// WriteZGrab2Ini writes the zgrab2 multiple-module config matching the
+// triggers LZR emits. ports come from the input lines rather than the ini.
+func WriteZGrab2Ini( fname string ) error {
+
+	f, err := os.Create( fname )
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter( f )
+	fmt.Fprintln( w, "[Application Options]" )
+	seen := make( map[string]bool )
+	for _, m := range zgrab2Modules {
+		if seen[ m.Trigger ] {
+			continue
+		}
+		seen[ m.Trigger ] = true
+		fmt.Fprintf( w, "\n[%s]\nname=%q\ntrigger=%q\n", m.Module, m.Trigger, m.Trigger )
+		for _, flag := range m.Flags {
+			fmt.Fprintf( w, "%s=%s\n", flag[0], flag[1] )
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+/* zgrab2_sink writes one line of zgrab2 csv input (ip, domain, tag, port)
+ * per fingerprinted target, to stdout or a named pipe
+ */
+type zgrab2_sink struct {
+	file		*os.File
+	w			*bufio.Writer
+}
+
+func newZGrab2Sink( path string ) ( *zgrab2_sink, error ) {
+
+	if path == "-" {
+		return &zgrab2_sink{ file: os.Stdout, w: bufio.NewWriter( os.Stdout ) }, nil
+	}
+	if _, err := os.Stat( path ); os.IsNotExist( err ) {
+		if err := syscall.Mkfifo( path, 0644 ); err != nil {
+			return nil, err
+		}
+	}
+	// blocks until zgrab2 opens the other end of the pipe
+	fmt.Fprintln( os.Stderr, "++Waiting for zgrab2 to read from:", path )
+	file, err := os.OpenFile( path, os.O_WRONLY|os.O_APPEND, 0644 )
+	if err != nil {
+		return nil, err
+	}
+	return &zgrab2_sink{ file: file, w: bufio.NewWriter( file ) }, nil
+}
+
+func ( s *zgrab2_sink ) Write( record *result_record ) error {
+
+	m, ok := zgrab2ModuleFor( record )
+	if !ok {
+		return nil
+	}
+	_, err := s.w.WriteString( record.Saddr + ",," + m.Trigger + "," + strconv.Itoa( record.Sport ) + "\n" )
+	if err != nil {
+		return err
+	}
+	// hand targets over as soon as they are known
+	return s.w.Flush()
+}
+
+func ( s *zgrab2_sink ) Flush() error {
+	return s.w.Flush()
+}
+
+func ( s *zgrab2_sink ) Close() error {
+
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.file == os.Stdout {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2020 The Board of Trustees of The Leland Stanford Junior University
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lzr
+
+import (
+	"testing"
+)
+
+func TestZGrab2ModuleFor( t *testing.T ) {
+
+	for _, c := range []struct{
+		fingerprint		string
+		transport		string
+		data			string
+		trigger			string
+	}{
+		//raw TLS that happens to contain "HTTP" is still only tls
+		{ "tls", TRANSPORT_TCP, "\x16\x03\x03\x00\x40HTTP/1.1", "tls" },
+		{ "tls/http", TRANSPORT_TCP, "", "https" },
+		{ "tls/imap", TRANSPORT_TCP, "", "imaps" },
+		{ "tls/mqtt", TRANSPORT_TCP, "", "tls" },
+		{ "tls/unknown", TRANSPORT_TCP, "", "tls" },
+		{ "http/jenkins", TRANSPORT_TCP, "", "http" },
+		{ "tls/http/grafana", TRANSPORT_TCP, "", "https" },
+		{ "winrm", TRANSPORT_TCP, "", "winrm" },
+		{ "etcd", TRANSPORT_TCP, "", "etcd" },
+		{ "http_proxy", TRANSPORT_TCP, "", "http" },
+		{ "s7commplus", TRANSPORT_TCP, "", "siemens" },
+		{ "bacnet", TRANSPORT_UDP, "", "bacnet" },
+		{ "bacnet", TRANSPORT_TCP, "", "" },
+		{ "kafka", TRANSPORT_TCP, "", "" },
+	} {
+		r := &result_record{ Fingerprint: c.fingerprint, Transport: c.transport, Data: c.data }
+		m, ok := zgrab2ModuleFor( r )
+		switch {
+		case c.trigger == "" && ok:
+			t.Errorf( "%s over %s: triggered %s", c.fingerprint, c.transport, m.Trigger )
+		case c.trigger != "" && ( !ok || m.Trigger != c.trigger ):
+			t.Errorf( "%s over %s: got %+v, want %s", c.fingerprint, c.transport, m, c.trigger )
+		}
+	}
+}